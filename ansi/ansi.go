@@ -3,6 +3,7 @@ package ansi
 import (
 	"bytes"
 	"fmt"
+	"strconv"
 
 	"github.com/bloeys/gglm/gglm"
 )
@@ -52,6 +53,73 @@ const (
 
 	// Device Status Report. Reports the cursor position (CPR) by transmitting ESC[n;mR, where n is the row and m is the column
 	CSIType_DSR
+
+	// DEC Private Mode Set (DECSET). Enables the private modes listed in the params (e.g. ESC[?1049h)
+	CSIType_DECSET
+
+	// DEC Private Mode Reset (DECRST). Disables the private modes listed in the params (e.g. ESC[?1049l)
+	CSIType_DECRST
+
+	// Set Cursor Style (DECSCUSR). Sets the cursor shape and whether it blinks (e.g. ESC[5 q). Note the space before the 'q'.
+	// If n is 0 or 1 (or missing), blinking block. If n is 2, steady block.
+	// If n is 3, blinking underline. If n is 4, steady underline.
+	// If n is 5, blinking bar. If n is 6, steady bar.
+	CSIType_DECSCUSR
+
+	// Primary Device Attributes (DA1). Asks for the terminal's conformance level and features (ESC[c or ESC[0c).
+	// The response is DA1Response
+	CSIType_DA1
+
+	// Secondary Device Attributes (DA2). Asks for the terminal's type and version (ESC[>c or ESC[>0c).
+	// The response is DA2Response
+	CSIType_DA2
+
+	// Report Terminal Name and Version (XTVERSION). Asks for the terminal's name (ESC[>q or ESC[>0q).
+	// The response is XTVersionResponse
+	CSIType_XTVERSION
+
+	// Insert Character (ICH). Inserts n (default 1) blank cells at the cursor, shifting the rest of the row right
+	CSIType_ICH
+
+	// Delete Character (DCH). Deletes n (default 1) cells at the cursor, shifting the rest of the row left
+	CSIType_DCH
+
+	// Insert Line (IL). Inserts n (default 1) blank lines at the cursor row, shifting the following rows down
+	CSIType_IL
+
+	// Delete Line (DL). Deletes n (default 1) lines starting at the cursor row, shifting the following rows up
+	CSIType_DL
+
+	// Repeat (REP). Writes the last written char n (default 1) more times, which programs use for long rules and bars
+	CSIType_REP
+
+	// Hyperlink (OSC 8). Following text links to AnsiCodeInfo.URI until a hyperlink code with an empty URI.
+	// Unlike the other types this is an OSC code, which is ESC]8;params;URI followed by BEL or ESC\
+	CSIType_Hyperlink
+)
+
+// Responses to device attribute queries, which programs (e.g. vim and tmux) use to decide which features they can use.
+// We report being a VT100 with advanced video (which has SGR attributes) and identify as nterm.
+// See: https://invisible-island.net/xterm/ctlseqs/ctlseqs.html#h3-Device-Control-functions
+const (
+	DA1Response       = "\x1b[?1;2c"
+	DA2Response       = "\x1b[>0;0;0c"
+	XTVersionResponse = "\x1bP>|nterm\x1b\\"
+)
+
+// DEC private modes that can be set/reset with DECSET/DECRST (e.g. ESC[?1049h).
+// See: https://invisible-island.net/xterm/ctlseqs/ctlseqs.html#h2-Functions-using-CSI-_-ordered-by-the-final-character_s_
+const (
+	DecPrivateMode_AutoWrap       = 7    // Auto-wrap mode (DECAWM). When reset, writing past the last column overwrites it instead of wrapping
+	DecPrivateMode_CursorVisible  = 25   // Text cursor enable mode (DECTCEM). When reset, the cursor is hidden
+	DecPrivateMode_AltScreenBuf   = 1049 // Save cursor and switch to the alternate screen buffer, clearing it first
+	DecPrivateMode_BracketedPaste = 2004 // Pasted text is sent between BracketedPasteStart and BracketedPasteEnd
+)
+
+// Markers written around pasted text while bracketed paste mode is set, so programs can tell a paste from typing
+const (
+	BracketedPasteStart = "\x1b[200~"
+	BracketedPasteEnd   = "\x1b[201~"
 )
 
 // https://en.wikipedia.org/wiki/ANSI_escape_code#CSI_(Control_Sequence_Introducer)_sequences
@@ -112,8 +180,83 @@ var (
 	AnsiCSIBytesLen = len(AnsiCSIBytes)
 	// AnsiCSIStringBytes    = []byte{'\\', 'x', '1', 'b', '['} // represents the string: \x1b[
 	// AnsiCSIStringBytesLen = len(AnsiCSIStringBytes)
+
+	// AnsiOSCBytes start an Operating System Command (e.g. ESC]8;;https://example.com BEL), which ends with BEL or ST (ESC\)
+	AnsiOSCBytes    = []byte{'\x1b', ']'}
+	AnsiOSCBytesLen = len(AnsiOSCBytes)
+
+	// AnsiSCSG0Bytes start a sequence selecting the G0 charset (e.g. ESC(0)
+	AnsiSCSG0Bytes    = []byte{'\x1b', '('}
+	AnsiSCSG0BytesLen = len(AnsiSCSG0Bytes)
+)
+
+// Charset is a character set selected with an SCS (Select Character Set) sequence, which is ESC followed by '(' and
+// the final byte of the charset (e.g. ESC(0). Only the G0 set (selected with '(') is supported
+type Charset byte
+
+const (
+	Charset_ASCII              Charset = 'B'
+	Charset_DecSpecialGraphics Charset = '0' // DEC line drawing characters, used by programs like tree and ncurses apps
 )
 
+// decSpecialGraphics are the runes 0x60-0x7E map to in the DEC special graphics charset
+var decSpecialGraphics = [...]rune{
+	'\u25C6', // ` diamond
+	'\u2592', // a checkerboard
+	'\u2409', // b HT
+	'\u240C', // c FF
+	'\u240D', // d CR
+	'\u240A', // e LF
+	'\u00B0', // f degree
+	'\u00B1', // g plus/minus
+	'\u2424', // h NL
+	'\u240B', // i VT
+	'\u2518', // j bottom right corner
+	'\u2510', // k top right corner
+	'\u250C', // l top left corner
+	'\u2514', // m bottom left corner
+	'\u253C', // n crossing lines
+	'\u23BA', // o scan line 1
+	'\u23BB', // p scan line 3
+	'\u2500', // q horizontal line
+	'\u23BC', // r scan line 7
+	'\u23BD', // s scan line 9
+	'\u251C', // t left tee
+	'\u2524', // u right tee
+	'\u2534', // v bottom tee
+	'\u252C', // w top tee
+	'\u2502', // x vertical line
+	'\u2264', // y less than or equal
+	'\u2265', // z greater than or equal
+	'\u03C0', // { pi
+	'\u2260', // | not equal
+	'\u00A3', // } pound
+	'\u00B7', // ~ centered dot
+}
+
+// DEC_SpecialGraphics returns the rune r is shown as when the DEC special graphics charset is active (e.g. 'q' is '\u2500').
+// Runes outside 0x60-0x7E are unchanged
+func DEC_SpecialGraphics(r rune) rune {
+
+	if r < 0x60 || r > 0x7E {
+		return r
+	}
+
+	return decSpecialGraphics[r-0x60]
+}
+
+// NextSCSCode returns the index of the first SCS sequence selecting the G0 charset (e.g. ESC(0) in arr and the selected charset.
+// SCS sequences are always three bytes long. index is -1 if there is no such sequence
+func NextSCSCode(arr []byte) (index int, charset Charset) {
+
+	index = bytes.Index(arr, AnsiSCSG0Bytes)
+	if index == -1 || index+AnsiSCSG0BytesLen >= len(arr) {
+		return -1, 0
+	}
+
+	return index, Charset(arr[index+AnsiSCSG0BytesLen])
+}
+
 type AnsiCodePayloadType int32
 
 const (
@@ -127,6 +270,27 @@ const (
 	AnsiCodePayloadType_LineOffset
 	AnsiCodePayloadType_LineAbs
 	AnsiCodePayloadType_ScrollOffset
+
+	// AnsiCodePayloadType_DecPrivateMode has the mode number (e.g. 1049) in Info.X()
+	AnsiCodePayloadType_DecPrivateMode
+
+	// AnsiCodePayloadType_CursorStyle has the DECSCUSR param (e.g. 5 for a blinking bar) in Info.X()
+	AnsiCodePayloadType_CursorStyle
+
+	// AnsiCodePayloadType_Blink has the SGR param in Info.X(), which is 5 for slow blink, 6 for rapid blink or 25 to stop blinking
+	AnsiCodePayloadType_Blink
+
+	// AnsiCodePayloadType_ReverseVideo has the SGR param in Info.X(), which is 7 to swap the fg and bg colors or 27 to stop swapping
+	AnsiCodePayloadType_ReverseVideo
+
+	// AnsiCodePayloadType_Bold has the SGR param in Info.X(), which is 1 for bold or 22 for normal intensity
+	AnsiCodePayloadType_Bold
+
+	// AnsiCodePayloadType_Italic has the SGR param in Info.X(), which is 3 for italic or 23 to stop italics
+	AnsiCodePayloadType_Italic
+
+	// AnsiCodePayloadType_Count has the number of cells or lines affected by an editing code (e.g. ICH) in Info.X()
+	AnsiCodePayloadType_Count
 )
 
 func (a AnsiCodePayloadType) HasOption(opt AnsiCodePayloadType) bool {
@@ -136,11 +300,23 @@ func (a AnsiCodePayloadType) HasOption(opt AnsiCodePayloadType) bool {
 type AnsiCodeInfoPayload struct {
 	Info gglm.Vec4
 	Type AnsiCodePayloadType
+
+	// SgrCode is the SGR param the payload was parsed from (e.g. 31 for a red fg), and is only set for colors.
+	// It lets users replace the default colors of base 16 codes (see Color16IndexFromSgrCode)
+	SgrCode int
+
+	// UsesPalette is set for base 16 and 256 color codes (e.g. ESC[38;5;208m), where PaletteIndex is the index of the
+	// color in a 256 color palette and Info is its default color. RGB colors don't use the palette
+	UsesPalette  bool
+	PaletteIndex uint8
 }
 
 type AnsiCodeInfo struct {
 	Type    CSIType
 	Payload []AnsiCodeInfoPayload
+
+	// URI is the link of CSIType_Hyperlink codes, and is empty for the code ending a link
+	URI string
 }
 
 func NextAnsiCode(arr []byte) (index int, code []byte) {
@@ -150,6 +326,8 @@ func NextAnsiCode(arr []byte) (index int, code []byte) {
 	// Zero or more "parameter bytes" in the range 0x30–0x3F.
 	// Zero or more "intermediate bytes" in the range 0x20–0x2F.
 	// One "final byte" in the range 0x40–0x7E.
+	//
+	// OSC codes (see AnsiOSCBytes) are also returned
 
 	const paramBytesRegion = 0
 	const intermBytesRegion = 1
@@ -157,11 +335,26 @@ func NextAnsiCode(arr []byte) (index int, code []byte) {
 	startOffset := 0
 	for startOffset < len(arr)-1 {
 
-		ansiEscIndex := bytes.Index(arr[startOffset:], AnsiCSIBytes)
-		if ansiEscIndex == -1 {
+		ansiEscIndex := bytes.IndexByte(arr[startOffset:], AnsiEscByte)
+		if ansiEscIndex == -1 || startOffset+ansiEscIndex+1 >= len(arr) {
 			return -1, nil
 		}
 		ansiEscIndex += startOffset
+		startOffset = ansiEscIndex + 1
+
+		if arr[ansiEscIndex+1] == AnsiOSCBytes[1] {
+
+			oscLen := oscCodeLen(arr[ansiEscIndex:])
+			if oscLen == -1 {
+				continue
+			}
+
+			return ansiEscIndex, arr[ansiEscIndex : ansiEscIndex+oscLen]
+		}
+
+		if arr[ansiEscIndex+1] != AnsiCSIBytes[1] {
+			continue
+		}
 		startOffset = ansiEscIndex + AnsiCSIBytesLen
 
 		// Now that we have found an ESC[, to parse the sequence we expect bytes in a specific order
@@ -218,6 +411,50 @@ func NextAnsiCode(arr []byte) (index int, code []byte) {
 	return -1, nil
 }
 
+// oscCodeLen returns the length of the OSC code at the start of arr including its terminator (BEL or ST),
+// or -1 if the code isn't terminated. Like other terminals, an ESC that doesn't start an ST cancels the code
+func oscCodeLen(arr []byte) int {
+
+	for i := AnsiOSCBytesLen; i < len(arr); i++ {
+
+		switch arr[i] {
+		case '\a':
+			return i + 1
+		case AnsiEscByte:
+			if i+1 < len(arr) && arr[i+1] == '\\' {
+				return i + 2
+			}
+			return -1
+		}
+	}
+
+	return -1
+}
+
+// StripAnsi appends src to dst without any ansi codes and returns the result. If dst is nil a new slice is allocated.
+// Incomplete codes are not removed
+func StripAnsi(src []byte, dst []byte) []byte {
+
+	if dst == nil {
+		dst = make([]byte, 0, len(src))
+	}
+
+	for {
+
+		index, code := NextAnsiCode(src)
+		if index == -1 {
+			return append(dst, src...)
+		}
+
+		dst = append(dst, src[:index]...)
+		src = src[index+len(code):]
+	}
+}
+
+func StripAnsiString(s string) string {
+	return string(StripAnsi([]byte(s), nil))
+}
+
 func InfoFromAnsiCode(code []byte) (info AnsiCodeInfo) {
 
 	codeLen := len(code)
@@ -225,6 +462,10 @@ func InfoFromAnsiCode(code []byte) (info AnsiCodeInfo) {
 		return info
 	}
 
+	if code[1] == AnsiOSCBytes[1] {
+		return infoFromOscCode(code)
+	}
+
 	finalByte := code[codeLen-1]
 	args := code[AnsiCSIBytesLen : codeLen-1]
 
@@ -261,16 +502,104 @@ func InfoFromAnsiCode(code []byte) (info AnsiCodeInfo) {
 	case 'f':
 		info.Type = CSIType_HVP
 
-		// case 'n':
-		// 	if code[codeLen-2] == '6' {
-		// 		info.Type = CSIType_DSR
-		// 		args = code[AnsiCSIBytesLen : codeLen-2]
-		// 	}
+	case '@':
+		info.Type = CSIType_ICH
+		info.Payload = parseCountArg(args)
+	case 'P':
+		info.Type = CSIType_DCH
+		info.Payload = parseCountArg(args)
+	case 'L':
+		info.Type = CSIType_IL
+		info.Payload = parseCountArg(args)
+	case 'M':
+		info.Type = CSIType_DL
+		info.Payload = parseCountArg(args)
+	case 'b':
+		info.Type = CSIType_REP
+		info.Payload = parseCountArg(args)
+
+	case 'h':
+		if len(args) > 0 && args[0] == '?' {
+			info.Type = CSIType_DECSET
+			info.Payload = parseDecPrivateModeArgs(args[1:])
+		}
+	case 'l':
+		if len(args) > 0 && args[0] == '?' {
+			info.Type = CSIType_DECRST
+			info.Payload = parseDecPrivateModeArgs(args[1:])
+		}
+
+	case 'q':
+		if len(args) > 0 && args[len(args)-1] == ' ' {
+			info.Type = CSIType_DECSCUSR
+			info.Payload = []AnsiCodeInfoPayload{{
+				Info: gglm.Vec4{Data: [4]float32{float32(getSgrIntCodeFromBytes(args[:len(args)-1]))}},
+				Type: AnsiCodePayloadType_CursorStyle,
+			}}
+		} else if len(args) > 0 && args[0] == '>' && isZeroOrEmptyArg(args[1:]) {
+			info.Type = CSIType_XTVERSION
+		}
+
+	case 'c':
+		if isZeroOrEmptyArg(args) {
+			info.Type = CSIType_DA1
+		} else if args[0] == '>' && isZeroOrEmptyArg(args[1:]) {
+			info.Type = CSIType_DA2
+		}
+
+	case 'n':
+		// Only cursor position reports (ESC[6n) are supported
+		if len(args) == 1 && args[0] == '6' {
+			info.Type = CSIType_DSR
+		}
+	}
+
+	return info
+}
+
+// infoFromOscCode parses a terminated OSC code. Only hyperlinks (OSC 8) are supported
+func infoFromOscCode(code []byte) (info AnsiCodeInfo) {
+
+	body := bytes.TrimSuffix(bytes.TrimSuffix(code[AnsiOSCBytesLen:], []byte{'\a'}), []byte("\x1b\\"))
+
+	// Hyperlinks are '8;params;URI', where params are optional key=value pairs (e.g. id=x) that we ignore
+	if !bytes.HasPrefix(body, []byte("8;")) {
+		return info
+	}
+
+	paramsEnd := bytes.IndexByte(body[2:], ';')
+	if paramsEnd == -1 {
+		return info
 	}
 
+	info.Type = CSIType_Hyperlink
+	info.URI = string(body[2+paramsEnd+1:])
 	return info
 }
 
+// parseCountArg returns a count payload for editing codes (e.g. ICH), where a missing or zero count is 1
+func parseCountArg(args []byte) (payload []AnsiCodeInfoPayload) {
+
+	count := 1
+	if len(args) > 0 {
+		count = getSgrIntCodeFromBytes(args)
+	}
+
+	if count < 1 {
+		count = 1
+	}
+
+	return []AnsiCodeInfoPayload{{
+		Info: gglm.Vec4{Data: [4]float32{float32(count)}},
+		Type: AnsiCodePayloadType_Count,
+	}}
+}
+
+// isZeroOrEmptyArg returns true if args is empty or a single 0, which is what queries (e.g. DA1) take
+func isZeroOrEmptyArg(args []byte) bool {
+	return len(args) == 0 || len(args) == 1 && args[0] == '0'
+}
+
 func ParseSGRArgs(args []byte) (payload []AnsiCodeInfoPayload) {
 
 	// @PERF: Too many allocations here, once per code :/
@@ -278,9 +607,12 @@ func ParseSGRArgs(args []byte) (payload []AnsiCodeInfoPayload) {
 
 	// @TODO should we trim spaces?
 	splitArgs := bytes.Split(args, []byte{';'})
-	for _, a := range splitArgs {
+	for i := 0; i < len(splitArgs); i++ {
 
-		if len(a) == 0 || a[0] == byte('0') {
+		// Params can have leading zeros, so '01' (as used by ls) is bold and not a reset
+		a := splitArgs[i]
+		intCode := getSgrIntCodeFromBytes(a)
+		if intCode == 0 {
 			payload = append(payload, AnsiCodeInfoPayload{
 				Type: AnsiCodePayloadType_Reset,
 			})
@@ -289,31 +621,137 @@ func ParseSGRArgs(args []byte) (payload []AnsiCodeInfoPayload) {
 
 		// @TODO We can't use this setup of one info field because one ansi code can have many settings.
 		// For example, it can set Fg+Bg at once. So we need info per option.
-		intCode := getSgrIntCodeFromBytes(a)
 		if intCode >= 30 && intCode <= 37 || intCode >= 90 && intCode <= 97 {
+			index, _ := Color16IndexFromSgrCode(intCode)
 			payload = append(payload, AnsiCodeInfoPayload{
-				Info: ColorFromSgrCode(intCode),
-				Type: AnsiCodePayloadType_ColorFg,
+				Info:         ColorFromSgrCode(intCode),
+				Type:         AnsiCodePayloadType_ColorFg,
+				SgrCode:      intCode,
+				UsesPalette:  true,
+				PaletteIndex: uint8(index),
 			})
 			continue
 		}
 
 		if intCode >= 40 && intCode <= 47 || intCode >= 100 && intCode <= 107 {
+			index, _ := Color16IndexFromSgrCode(intCode)
+			payload = append(payload, AnsiCodeInfoPayload{
+				Info:         ColorFromSgrCode(intCode),
+				Type:         AnsiCodePayloadType_ColorBg,
+				SgrCode:      intCode,
+				UsesPalette:  true,
+				PaletteIndex: uint8(index),
+			})
+			continue
+		}
+
+		if intCode == 5 || intCode == 6 || intCode == 25 {
 			payload = append(payload, AnsiCodeInfoPayload{
-				Info: ColorFromSgrCode(intCode),
-				Type: AnsiCodePayloadType_ColorBg,
+				Info: gglm.Vec4{Data: [4]float32{float32(intCode)}},
+				Type: AnsiCodePayloadType_Blink,
 			})
 			continue
 		}
 
-		// @TODO Support bold/underline etc
-		// @TODO Support 256 and RGB colors
+		if intCode == 7 || intCode == 27 {
+			payload = append(payload, AnsiCodeInfoPayload{
+				Info: gglm.Vec4{Data: [4]float32{float32(intCode)}},
+				Type: AnsiCodePayloadType_ReverseVideo,
+			})
+			continue
+		}
+
+		if intCode == 1 || intCode == 22 {
+			payload = append(payload, AnsiCodeInfoPayload{
+				Info: gglm.Vec4{Data: [4]float32{float32(intCode)}},
+				Type: AnsiCodePayloadType_Bold,
+			})
+			continue
+		}
+
+		if intCode == 3 || intCode == 23 {
+			payload = append(payload, AnsiCodeInfoPayload{
+				Info: gglm.Vec4{Data: [4]float32{float32(intCode)}},
+				Type: AnsiCodePayloadType_Italic,
+			})
+			continue
+		}
+
+		// RGB colors are ESC[38;2;r;g;bm for fg and ESC[48;2;r;g;bm for bg
+		if (intCode == 38 || intCode == 48) && i+4 < len(splitArgs) && getSgrIntCodeFromBytes(splitArgs[i+1]) == 2 {
+
+			payloadType := AnsiCodePayloadType_ColorFg
+			if intCode == 48 {
+				payloadType = AnsiCodePayloadType_ColorBg
+			}
+
+			payload = append(payload, AnsiCodeInfoPayload{
+				Info: gglm.Vec4{Data: [4]float32{
+					float32(getSgrIntCodeFromBytes(splitArgs[i+2])) / 255,
+					float32(getSgrIntCodeFromBytes(splitArgs[i+3])) / 255,
+					float32(getSgrIntCodeFromBytes(splitArgs[i+4])) / 255,
+					1,
+				}},
+				Type:    payloadType,
+				SgrCode: intCode,
+			})
+
+			i += 4
+			continue
+		}
+
+		// 256 colors are ESC[38;5;nm for fg and ESC[48;5;nm for bg
+		if (intCode == 38 || intCode == 48) && i+2 < len(splitArgs) && getSgrIntCodeFromBytes(splitArgs[i+1]) == 5 {
+
+			payloadType := AnsiCodePayloadType_ColorFg
+			if intCode == 48 {
+				payloadType = AnsiCodePayloadType_ColorBg
+			}
+
+			index := getSgrIntCodeFromBytes(splitArgs[i+2])
+			if index > 255 {
+				index = 255
+			}
+
+			payload = append(payload, AnsiCodeInfoPayload{
+				Info:         xtermPalette[index],
+				Type:         payloadType,
+				SgrCode:      intCode,
+				UsesPalette:  true,
+				PaletteIndex: uint8(index),
+			})
+
+			i += 2
+			continue
+		}
+
+		// @TODO Support underline etc
 		println("Code not supported yet: " + fmt.Sprint(intCode))
 	}
 
 	return payload
 }
 
+func parseDecPrivateModeArgs(args []byte) (payload []AnsiCodeInfoPayload) {
+
+	// Multiple modes can be set/reset at once, e.g. ESC[?1049;25h
+	splitArgs := bytes.Split(args, []byte{';'})
+	payload = make([]AnsiCodeInfoPayload, 0, len(splitArgs))
+	for _, a := range splitArgs {
+
+		if len(a) == 0 {
+			continue
+		}
+
+		payload = append(payload, AnsiCodeInfoPayload{
+			Info: gglm.Vec4{Data: [4]float32{float32(getSgrIntCodeFromBytes(a))}},
+			Type: AnsiCodePayloadType_DecPrivateMode,
+		})
+	}
+
+	return payload
+}
+
 func getSgrIntCodeFromBytes(bs []byte) (code int) {
 
 	mul := 1
@@ -351,6 +789,62 @@ func getSgrIntCodeFromBytes(bs []byte) (code int) {
 	return code
 }
 
+// Color16IndexFromSgrCode returns the index (0-15) of a base 16 color code in the standard order, which is
+// black, red, green, yellow, blue, magenta, cyan and white followed by their bright versions.
+// Fg and bg codes of the same color have the same index. ok is false for other codes
+func Color16IndexFromSgrCode(code int) (index int, ok bool) {
+
+	switch {
+	case code >= Ansi_Fg_Black && code <= Ansi_Fg_White:
+		return code - Ansi_Fg_Black, true
+	case code >= Ansi_Fg_Gray && code <= Ansi_Fg_Bright_White:
+		return code - Ansi_Fg_Gray + 8, true
+	case code >= Ansi_Bg_Black && code <= Ansi_Bg_White:
+		return code - Ansi_Bg_Black, true
+	case code >= Ansi_Bg_Gray && code <= Ansi_Bg_Bright_White:
+		return code - Ansi_Bg_Gray + 8, true
+	}
+
+	return 0, false
+}
+
+// xtermPalette is the default palette of xterm, and is used for the default colors of 256 color codes
+var xtermPalette = newXtermPalette()
+
+// XtermPalette returns the default 256 color palette of xterm, which is the base 16 colors, then a 6x6x6 color cube,
+// then 24 shades of gray
+func XtermPalette() [256]gglm.Vec4 {
+	return xtermPalette
+}
+
+func newXtermPalette() (palette [256]gglm.Vec4) {
+
+	base16 := [16]uint32{
+		0x000000, 0xcd0000, 0x00cd00, 0xcdcd00, 0x0000ee, 0xcd00cd, 0x00cdcd, 0xe5e5e5,
+		0x7f7f7f, 0xff0000, 0x00ff00, 0xffff00, 0x5c5cff, 0xff00ff, 0x00ffff, 0xffffff,
+	}
+
+	rgb := func(r, g, b uint32) gglm.Vec4 {
+		return gglm.Vec4{Data: [4]float32{float32(r) / 255, float32(g) / 255, float32(b) / 255, 1}}
+	}
+
+	for i, c := range base16 {
+		palette[i] = rgb(c>>16&0xff, c>>8&0xff, c&0xff)
+	}
+
+	cubeLevels := [6]uint32{0, 0x5f, 0x87, 0xaf, 0xd7, 0xff}
+	for i := 0; i < 216; i++ {
+		palette[16+i] = rgb(cubeLevels[i/36], cubeLevels[i/6%6], cubeLevels[i%6])
+	}
+
+	for i := uint32(0); i < 24; i++ {
+		gray := 8 + i*10
+		palette[232+i] = rgb(gray, gray, gray)
+	}
+
+	return palette
+}
+
 func ColorFromSgrCode(code int) gglm.Vec4 {
 
 	switch code {
@@ -441,3 +935,90 @@ func ColorFromSgrCode(code int) gglm.Vec4 {
 
 	panic("Invalid ansi code: " + fmt.Sprint(code))
 }
+
+// Encoder builds a stream of ANSI codes, and is the inverse of InfoFromAnsiCode.
+// Text can be mixed in by writing to the buffer between calls, e.g. with WriteString
+type Encoder struct {
+	buf bytes.Buffer
+}
+
+// SetFgColor writes an RGB foreground color code (ESC[38;2;r;g;bm). Alpha is ignored
+func (e *Encoder) SetFgColor(c gglm.Vec4) {
+	e.writeSgrColor(38, &c)
+}
+
+// SetBgColor writes an RGB background color code (ESC[48;2;r;g;bm). Alpha is ignored
+func (e *Encoder) SetBgColor(c gglm.Vec4) {
+	e.writeSgrColor(48, &c)
+}
+
+func (e *Encoder) writeSgrColor(code int, c *gglm.Vec4) {
+
+	e.buf.Write(AnsiCSIBytes)
+	e.buf.WriteString(strconv.Itoa(code))
+	e.buf.WriteString(";2")
+	for i := 0; i < 3; i++ {
+		e.buf.WriteByte(';')
+		e.buf.WriteString(strconv.Itoa(int(colorComponentToByte(c.Data[i]))))
+	}
+	e.buf.WriteByte('m')
+}
+
+func colorComponentToByte(f float32) uint8 {
+
+	if f <= 0 {
+		return 0
+	}
+
+	if f >= 1 {
+		return 255
+	}
+
+	return uint8(f*255 + 0.5)
+}
+
+// Reset writes ESC[0m, which resets all SGR attributes including colors
+func (e *Encoder) Reset() {
+	e.buf.Write(AnsiCSIBytes)
+	e.buf.WriteString("0m")
+}
+
+// MoveCursor writes a CUP code moving the cursor to row and col. Like GlyphGrid, row and col are 0-based
+// and are converted to the 1-based values CUP uses
+func (e *Encoder) MoveCursor(row, col int) {
+	e.buf.Write(AnsiCSIBytes)
+	e.buf.WriteString(strconv.Itoa(row + 1))
+	e.buf.WriteByte(';')
+	e.buf.WriteString(strconv.Itoa(col + 1))
+	e.buf.WriteByte('H')
+}
+
+// ClearScreen writes ESC[2J, which clears the whole screen without moving the cursor
+func (e *Encoder) ClearScreen() {
+	e.buf.Write(AnsiCSIBytes)
+	e.buf.WriteString("2J")
+}
+
+// SetTitle writes an OSC 0 code (ESC]0;title BEL) setting the window title
+func (e *Encoder) SetTitle(title string) {
+	e.buf.WriteString("\x1b]0;")
+	e.buf.WriteString(title)
+	e.buf.WriteByte('\a')
+}
+
+// SetHyperlink writes an OSC 8 code (ESC]8;;uri ESC\) making the following text link to uri, where an empty uri ends the link
+func (e *Encoder) SetHyperlink(uri string) {
+	e.buf.WriteString("\x1b]8;;")
+	e.buf.WriteString(uri)
+	e.buf.WriteString("\x1b\\")
+}
+
+// WriteString writes s as-is, so text can be placed between codes
+func (e *Encoder) WriteString(s string) {
+	e.buf.WriteString(s)
+}
+
+// Bytes returns everything written so far. The slice is only valid until the next write
+func (e *Encoder) Bytes() []byte {
+	return e.buf.Bytes()
+}
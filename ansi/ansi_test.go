@@ -0,0 +1,80 @@
+package ansi_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/bloeys/nterm/ansi"
+)
+
+// denseAnsiText is ~100KB of text with one color code every 20 bytes, similar to the output of 'ls --color' or a compiler
+var denseAnsiText = bytes.Repeat([]byte("\x1b[31mHello, friend!\n"), 100*1024/20)
+
+var plainText = bytes.Repeat([]byte("Hello there, friend!\n"), 100*1024/21)
+
+func BenchmarkNextAnsiCode_DenseOutput(b *testing.B) {
+	benchmarkAllAnsiCodes(b, denseAnsiText)
+}
+
+func BenchmarkNextAnsiCode_NoAnsi(b *testing.B) {
+	benchmarkAllAnsiCodes(b, plainText)
+}
+
+// benchmarkAllAnsiCodes finds all the codes in text, like DrawTextAnsiCodesOnGrid does
+func benchmarkAllAnsiCodes(b *testing.B, text []byte) {
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(text)))
+	for i := 0; i < b.N; i++ {
+
+		bs := text
+		for {
+
+			index, code := ansi.NextAnsiCode(bs)
+			if index == -1 {
+				break
+			}
+
+			bs = bs[index+len(code):]
+		}
+	}
+}
+
+func TestREP(t *testing.T) {
+
+	info := ansi.InfoFromAnsiCode([]byte("\x1b[12b"))
+	if info.Type != ansi.CSIType_REP || len(info.Payload) != 1 || info.Payload[0].Type != ansi.AnsiCodePayloadType_Count {
+		t.Fatalf("Expected a REP code with a count payload but got %+v\n", info)
+	}
+
+	for code, expectedCount := range map[string]float32{"\x1b[12b": 12, "\x1b[b": 1, "\x1b[0b": 1} {
+		if count := ansi.InfoFromAnsiCode([]byte(code)).Payload[0].Info.X(); count != expectedCount {
+			t.Fatalf("Expected %q to have a count of %v but got %v\n", code, expectedCount, count)
+		}
+	}
+
+	// REP codes are found and stripped like other CSI codes
+	if stripped := ansi.StripAnsiString("-\x1b[79b\n"); stripped != "-\n" {
+		t.Fatalf("Expected REP to be stripped but got %q\n", stripped)
+	}
+}
+
+func BenchmarkParseSGRArgs_SimpleColor(b *testing.B) {
+
+	args := []byte("0;31")
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ansi.ParseSGRArgs(args)
+	}
+}
+
+func BenchmarkParseSGRArgs_RGB(b *testing.B) {
+
+	args := []byte("38;2;255;128;0;48;2;0;64;128")
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ansi.ParseSGRArgs(args)
+	}
+}
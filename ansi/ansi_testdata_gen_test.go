@@ -0,0 +1,91 @@
+package ansi_test
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/bloeys/nterm/ansi"
+)
+
+// GenerateAnsiOutput returns n random chunks of terminal output, which are valid SGR codes, other valid CSI codes,
+// malformed escape sequences, ascii text and multi-byte utf-8 text. The output only depends on the state of rng
+func GenerateAnsiOutput(n int, rng *rand.Rand) []byte {
+
+	// SGR codes that the parser supports, so the output isn't full of 'not supported' messages
+	sgrCodes := []string{"0", "", "31", "42", "97", "107", "5", "6", "25", "7", "27", "1", "22", "3", "23", "01;34", "0;31;44", "38;5;208"}
+	csiFinalBytes := []byte{'A', 'B', 'C', 'D', 'H', 'J', 'K', '@', 'P', 'L', 'M', 'n', 'c'}
+	malformed := []string{"\x1b", "\x1b[", "\x1b[31", "\x1b[;;;", "\x1b[38;2;", "\x1b[38;5", "\x1b[?", "\x1b[?1049", "\x1b(", "\x1b]0;title", "\x1b[\x1b[m", "[31m"}
+	text := []string{"hello", " ", "\n", "\t", "ls -la", "日本語", "héllo", "🙂", "‍", "\xff\xfe", "\xe6\x97"}
+
+	buf := &bytes.Buffer{}
+	for i := 0; i < n; i++ {
+
+		switch rng.Intn(6) {
+		case 0:
+			fmt.Fprintf(buf, "\x1b[%sm", sgrCodes[rng.Intn(len(sgrCodes))])
+		case 1:
+			fmt.Fprintf(buf, "\x1b[38;2;%d;%d;%dm", rng.Intn(256), rng.Intn(256), rng.Intn(256))
+		case 2:
+			fmt.Fprintf(buf, "\x1b[%d;%d%c", rng.Intn(100), rng.Intn(100), csiFinalBytes[rng.Intn(len(csiFinalBytes))])
+		case 3:
+			buf.WriteString(malformed[rng.Intn(len(malformed))])
+		default:
+			buf.WriteString(text[rng.Intn(len(text))])
+		}
+	}
+
+	return buf.Bytes()
+}
+
+func FuzzNextAnsiCode(f *testing.F) {
+
+	for seed := int64(0); seed < 16; seed++ {
+		f.Add(GenerateAnsiOutput(64, rand.New(rand.NewSource(seed))))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+
+		bs := data
+		for len(bs) > 0 {
+
+			index, code := ansi.NextAnsiCode(bs)
+			if index == -1 {
+				break
+			}
+
+			if index < 0 || index+len(code) > len(bs) || len(code) == 0 {
+				t.Fatalf("NextAnsiCode returned index=%d and a code of len %d for an input of len %d", index, len(code), len(bs))
+			}
+
+			if !bytes.Equal(code, bs[index:index+len(code)]) {
+				t.Fatalf("code %q isn't at index %d of the input", code, index)
+			}
+
+			bs = bs[index+len(code):]
+		}
+	})
+}
+
+func FuzzInfoFromAnsiCode(f *testing.F) {
+
+	for seed := int64(0); seed < 16; seed++ {
+
+		bs := GenerateAnsiOutput(64, rand.New(rand.NewSource(seed)))
+		for {
+
+			index, code := ansi.NextAnsiCode(bs)
+			if index == -1 {
+				break
+			}
+
+			f.Add(code)
+			bs = bs[index+len(code):]
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, code []byte) {
+		ansi.InfoFromAnsiCode(code)
+	})
+}
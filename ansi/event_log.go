@@ -0,0 +1,128 @@
+package ansi
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bloeys/nterm/ring"
+)
+
+// AnsiEvent is an ansi code received at Timestamp
+type AnsiEvent struct {
+	Timestamp time.Time
+	Code      []byte
+	Info      AnsiCodeInfo
+}
+
+// AnsiEventLog keeps the most recent ansi codes, which helps with finding out why a program isn't drawn correctly
+type AnsiEventLog struct {
+	Events *ring.Buffer[AnsiEvent]
+}
+
+func NewAnsiEventLog(maxEvents uint64) *AnsiEventLog {
+	return &AnsiEventLog{
+		Events: ring.NewBuffer[AnsiEvent](maxEvents),
+	}
+}
+
+// AddCodes logs all ansi codes found in text. Codes are copied so text can be reused after this call
+func (l *AnsiEventLog) AddCodes(text []byte) {
+
+	now := time.Now()
+	for {
+
+		index, code := NextAnsiCode(text)
+		if index == -1 {
+			return
+		}
+		text = text[index+len(code):]
+
+		l.Events.Write(AnsiEvent{
+			Timestamp: now,
+			Code:      append([]byte{}, code...),
+			Info:      InfoFromAnsiCode(code),
+		})
+	}
+}
+
+// WriteToFile writes all logged events to the file (oldest first), with one event per line
+func (l *AnsiEventLog) WriteToFile(file string) error {
+
+	sb := strings.Builder{}
+	it := l.Events.Iterator()
+	for e, done := it.NextPtr(); !done; e, done = it.NextPtr() {
+		sb.WriteString(FormatAnsiEvent(*e))
+		sb.WriteByte('\n')
+	}
+
+	return os.WriteFile(file, []byte(sb.String()), 0644)
+}
+
+// FormatAnsiEvent returns a human readable version of the event, for example:
+//
+//	15:04:05.000 "\x1b[?1049h" type=DECSET(16) payload=[...]
+func FormatAnsiEvent(e AnsiEvent) string {
+	return fmt.Sprintf("%s %q type=%s(%d) payload=%+v", e.Timestamp.Format("15:04:05.000"), e.Code, csiTypeName(e.Info.Type), e.Info.Type, e.Info.Payload)
+}
+
+func csiTypeName(t CSIType) string {
+
+	switch t {
+	case CSIType_CUU:
+		return "CUU"
+	case CSIType_CUD:
+		return "CUD"
+	case CSIType_CUF:
+		return "CUF"
+	case CSIType_CUB:
+		return "CUB"
+	case CSIType_CNL:
+		return "CNL"
+	case CSIType_CPL:
+		return "CPL"
+	case CSIType_CHA:
+		return "CHA"
+	case CSIType_CUP:
+		return "CUP"
+	case CSIType_ED:
+		return "ED"
+	case CSIType_EL:
+		return "EL"
+	case CSIType_SU:
+		return "SU"
+	case CSIType_SD:
+		return "SD"
+	case CSIType_HVP:
+		return "HVP"
+	case CSIType_SGR:
+		return "SGR"
+	case CSIType_DSR:
+		return "DSR"
+	case CSIType_DECSET:
+		return "DECSET"
+	case CSIType_DECRST:
+		return "DECRST"
+	case CSIType_DECSCUSR:
+		return "DECSCUSR"
+	case CSIType_DA1:
+		return "DA1"
+	case CSIType_DA2:
+		return "DA2"
+	case CSIType_XTVERSION:
+		return "XTVERSION"
+	case CSIType_ICH:
+		return "ICH"
+	case CSIType_DCH:
+		return "DCH"
+	case CSIType_IL:
+		return "IL"
+	case CSIType_DL:
+		return "DL"
+	case CSIType_REP:
+		return "REP"
+	default:
+		return "Unknown"
+	}
+}
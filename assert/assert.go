@@ -1,15 +1,28 @@
 package assert
 
 import (
+	"errors"
 	"fmt"
-
-	"github.com/bloeys/nterm/consts"
 )
 
-func T(check bool, msg string, args ...any) {
-	if consts.Mode_Debug && !check {
-		// Sprintf is done inside the assert because putting it as the argument to 'msg' blocks
-		// the function from getting fully optimized out on a release build (and slower in general)
-		panic("Assert failed: " + fmt.Sprintf(msg, args...))
+// PanicOnFail makes Check panic instead of returning an error, which is useful to stop at the
+// first failure while debugging
+var PanicOnFail = false
+
+// Check returns an error if check is false, and nil otherwise. Unlike T it works in release builds,
+// which lets callers recover from failures
+func Check(check bool, msg string, args ...any) error {
+
+	if check {
+		return nil
 	}
+
+	// Sprintf is done inside the assert because putting it as the argument to 'msg' blocks
+	// the function from getting fully optimized out on a release build (and slower in general)
+	err := errors.New("Assert failed: " + fmt.Sprintf(msg, args...))
+	if PanicOnFail {
+		panic(err.Error())
+	}
+
+	return err
 }
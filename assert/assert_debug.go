@@ -0,0 +1,12 @@
+//go:build !release
+
+package assert
+
+// T panics if check is false. Release builds (built with '-tags release') use an empty T instead
+func T(check bool, msg string, args ...any) {
+
+	err := Check(check, msg, args...)
+	if err != nil {
+		panic(err.Error())
+	}
+}
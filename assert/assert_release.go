@@ -0,0 +1,6 @@
+//go:build release
+
+package assert
+
+// T does nothing in release builds, and is always inlined so asserts cost nothing
+func T(check bool, msg string, args ...any) {}
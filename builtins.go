@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bloeys/nterm/shell"
+)
+
+// initBuiltins registers the commands nterm runs itself instead of starting a process, either because they must change
+// nterm's own state (e.g. cd) or because they are shell builtins that might not exist as programs (e.g. echo on Windows).
+// It also sets currentDir
+func (nt *nterm) initBuiltins() {
+
+	nt.builtins = map[string]func(args []string) error{
+		"cd":     nt.cdBuiltin,
+		"pwd":    nt.pwdBuiltin,
+		"export": nt.exportBuiltin,
+		"echo":   nt.echoBuiltin,
+		"exit":   nt.exitBuiltin,
+	}
+
+	var err error
+	nt.currentDir, err = os.Getwd()
+	if err != nil {
+		fmt.Println("Failed to get working directory. Err: " + err.Error())
+	}
+}
+
+// runBuiltin runs cmdStr if its first word is a builtin, and returns false if it isn't one.
+// Errors are written to textBuf
+func (nt *nterm) runBuiltin(cmdStr string) (isBuiltin bool) {
+
+	words := shell.SplitWords(cmdStr)
+	if len(words) == 0 {
+		return false
+	}
+
+	name := words[0].Text
+	builtin, ok := nt.builtins[name]
+	if !ok {
+		return false
+	}
+
+	args, err := shell.ExpandWordGlobsInDir(nt.currentDir, words[1:])
+	if err != nil && nt.Settings.GlobNoMatchError {
+		nt.WriteToTextBuf([]byte(fmt.Sprintf("Expanding globs failed. Error: %s\n", err.Error())))
+		return true
+	}
+
+	err = builtin(args)
+	if err != nil {
+		nt.WriteToTextBuf([]byte(fmt.Sprintf("%s: %s\n", name, err.Error())))
+	}
+
+	return true
+}
+
+// cdBuiltin changes currentDir (where the cmds of this pane run) to the only arg, or to the home directory if there are no args.
+// The working directory of the process isn't changed, because it is shared by all panes
+func (nt *nterm) cdBuiltin(args []string) error {
+
+	if len(args) > 1 {
+		return errors.New("too many arguments")
+	}
+
+	dir := ""
+	if len(args) == 1 {
+		dir = args[0]
+	} else {
+
+		var err error
+		dir, err = os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+	}
+
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(nt.currentDir, dir)
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return fmt.Errorf("'%s' is not a directory", dir)
+	}
+
+	nt.currentDir = filepath.Clean(dir)
+	nt.WriteToTextBuf([]byte(nt.currentDir + "\n"))
+	return nil
+}
+
+func (nt *nterm) pwdBuiltin(args []string) error {
+	nt.WriteToTextBuf([]byte(nt.currentDir + "\n"))
+	return nil
+}
+
+// exportBuiltin sets env vars given as VAR=value, which are then inherited by cmds. Without args, all env vars are printed
+func (nt *nterm) exportBuiltin(args []string) error {
+
+	if len(args) == 0 {
+
+		env := os.Environ()
+		sort.Strings(env)
+		nt.WriteToTextBuf([]byte(strings.Join(env, "\n") + "\n"))
+		return nil
+	}
+
+	for _, arg := range args {
+
+		name, value, found := strings.Cut(arg, "=")
+		if !found || name == "" {
+			return fmt.Errorf("'%s' is not in the form VAR=value", arg)
+		}
+
+		err := os.Setenv(name, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (nt *nterm) echoBuiltin(args []string) error {
+	nt.WriteToTextBuf([]byte(strings.Join(args, " ") + "\n"))
+	return nil
+}
+
+// exitBuiltin closes the pane, which quits nterm if it is the only one
+func (nt *nterm) exitBuiltin(args []string) error {
+	nt.ClosePane()
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+// cmdBufState is a copy of cmdBuf and the cursor, which is what undo/redo restore
+type cmdBufState struct {
+	buf       []rune
+	bufLen    int64
+	cursorPos int64
+}
+
+// pushCmdBufHistory saves the current cmdBuf state so the next edit can be undone. Redo history is
+// lost because it doesn't follow from the new edit. Must be called before cmdBuf is modified
+func (nt *nterm) pushCmdBufHistory() {
+
+	limit := nt.Settings.CmdBufUndoLimit
+	if limit <= 0 {
+		return
+	}
+
+	// The oldest states are dropped when over the limit
+	if len(nt.cmdBufHistory) >= limit {
+		copy(nt.cmdBufHistory, nt.cmdBufHistory[len(nt.cmdBufHistory)-limit+1:])
+		nt.cmdBufHistory = nt.cmdBufHistory[:limit-1]
+	}
+
+	nt.cmdBufHistory = append(nt.cmdBufHistory, nt.currCmdBufState())
+	nt.cmdBufRedoHistory = nt.cmdBufRedoHistory[:0]
+}
+
+// UndoCmdBuf reverts the last edit to cmdBuf, and does nothing if there is nothing to undo
+func (nt *nterm) UndoCmdBuf() {
+
+	if len(nt.cmdBufHistory) == 0 {
+		return
+	}
+
+	nt.cmdBufRedoHistory = append(nt.cmdBufRedoHistory, nt.currCmdBufState())
+
+	lastIndex := len(nt.cmdBufHistory) - 1
+	nt.setCmdBufState(&nt.cmdBufHistory[lastIndex])
+	nt.cmdBufHistory = nt.cmdBufHistory[:lastIndex]
+}
+
+// RedoCmdBuf re-applies the last edit reverted by UndoCmdBuf
+func (nt *nterm) RedoCmdBuf() {
+
+	if len(nt.cmdBufRedoHistory) == 0 {
+		return
+	}
+
+	nt.cmdBufHistory = append(nt.cmdBufHistory, nt.currCmdBufState())
+
+	lastIndex := len(nt.cmdBufRedoHistory) - 1
+	nt.setCmdBufState(&nt.cmdBufRedoHistory[lastIndex])
+	nt.cmdBufRedoHistory = nt.cmdBufRedoHistory[:lastIndex]
+}
+
+// ClearCmdBufHistory removes all undo and redo states, which is done when a command is submitted
+func (nt *nterm) ClearCmdBufHistory() {
+	nt.cmdBufHistory = nt.cmdBufHistory[:0]
+	nt.cmdBufRedoHistory = nt.cmdBufRedoHistory[:0]
+}
+
+func (nt *nterm) currCmdBufState() cmdBufState {
+
+	buf := make([]rune, nt.cmdBufLen)
+	copy(buf, nt.cmdBuf[:nt.cmdBufLen])
+
+	return cmdBufState{
+		buf:       buf,
+		bufLen:    nt.cmdBufLen,
+		cursorPos: nt.cursorCharIndex,
+	}
+}
+
+func (nt *nterm) setCmdBufState(s *cmdBufState) {
+	copy(nt.cmdBuf, s.buf)
+	nt.cmdBufLen = s.bufLen
+	nt.cursorCharIndex = s.cursorPos
+}
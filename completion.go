@@ -0,0 +1,264 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bloeys/nterm/shell"
+)
+
+// CompleteAtCursor completes the word before the cursor. The first word of a command is completed from the
+// executables in $PATH and the builtins, while other words (and words that look like paths) are completed from files.
+//
+// A unique match is completed fully. With many matches their common prefix is completed and the candidates are
+// shown above the command line, and pressing Tab again cycles through them
+func (nt *nterm) CompleteAtCursor() {
+
+	// Cycle if nothing changed since the last completion
+	if nt.hasTabCandidates() {
+
+		nt.tabIndex = (nt.tabIndex + 1) % len(nt.tabCandidates)
+		nt.replaceTabWord(nt.tabCandidates[nt.tabIndex])
+		return
+	}
+
+	wordStart, isCmdName := completionWordStart(nt.cmdBuf[:nt.cursorCharIndex])
+	word := string(nt.cmdBuf[wordStart:nt.cursorCharIndex])
+
+	var candidates []string
+	if isCmdName && !looksLikePath(word) {
+		candidates = commandCandidates(word, nt.builtins)
+	} else {
+		candidates = pathCandidates(word, nt.currentDir)
+	}
+
+	nt.tabCandidates = nil
+	nt.tabIndex = -1
+	nt.tabWordStart = wordStart
+	nt.tabWord = word
+
+	switch len(candidates) {
+	case 0:
+		return
+	case 1:
+		// Dirs end with a separator so the user can continue completing inside them
+		completion := candidates[0]
+		if !strings.HasSuffix(completion, "/") {
+			completion += " "
+		}
+
+		nt.replaceTabWord(completion)
+	default:
+		nt.replaceTabWord(commonPrefix(candidates))
+		nt.tabCandidates = candidates
+	}
+}
+
+// hasTabCandidates returns true if the last completion had many candidates and the cmdBuf wasn't changed since
+func (nt *nterm) hasTabCandidates() bool {
+
+	if len(nt.tabCandidates) == 0 {
+		return false
+	}
+
+	wordEnd := nt.tabWordStart + int64(len([]rune(nt.tabWord)))
+	return nt.cursorCharIndex == wordEnd && wordEnd <= nt.cmdBufLen && string(nt.cmdBuf[nt.tabWordStart:wordEnd]) == nt.tabWord
+}
+
+// replaceTabWord replaces the word being completed with word, and moves the cursor to its end
+func (nt *nterm) replaceTabWord(word string) {
+
+	if word == nt.tabWord {
+		return
+	}
+
+	newWord := []rune(word)
+	oldWordEnd := nt.tabWordStart + int64(len([]rune(nt.tabWord)))
+	newWordEnd := nt.tabWordStart + int64(len(newWord))
+	newLen := nt.cmdBufLen - oldWordEnd + newWordEnd
+	if newLen > int64(len(nt.cmdBuf)) {
+		return
+	}
+
+	nt.pushCmdBufHistory()
+	copy(nt.cmdBuf[newWordEnd:], nt.cmdBuf[oldWordEnd:nt.cmdBufLen])
+	copy(nt.cmdBuf[nt.tabWordStart:], newWord)
+
+	nt.cmdBufLen = newLen
+	nt.cursorCharIndex = newWordEnd
+	nt.tabWord = word
+}
+
+// DrawTabCandidates writes the completion candidates on a row of grid, with the selected one highlighted.
+// Candidates that don't fit in the row are replaced with '...'
+func (nt *nterm) DrawTabCandidates(grid *GlyphGrid) {
+
+	if !nt.hasTabCandidates() {
+		return
+	}
+
+	if grid.CursorX != grid.LeftMargin {
+		grid.WriteString("\n", &nt.Settings.DefaultFgColor, &nt.Settings.DefaultBgColor)
+	}
+
+	const ellipsis = "..."
+	freeWidth := int(grid.SizeX-grid.LeftMargin) - 1 // The last column is kept for the new line
+	for i, c := range nt.tabCandidates {
+
+		// Paths are shown without their directory, like other shells do
+		name := filepath.Base(c)
+		if strings.HasSuffix(c, "/") {
+			name += "/"
+		}
+
+		nameWidth := len([]rune(name)) + 2
+		if nameWidth+len(ellipsis) > freeWidth && i < len(nt.tabCandidates)-1 || nameWidth > freeWidth {
+			grid.WriteString(ellipsis, &nt.Settings.DefaultFgColor, &nt.Settings.DefaultBgColor)
+			break
+		}
+		freeWidth -= nameWidth
+
+		bgColor := &nt.Settings.DefaultBgColor
+		if i == nt.tabIndex {
+			bgColor = &nt.Settings.SelectionBgColor
+		}
+
+		grid.WriteString(name, &nt.Settings.DefaultFgColor, bgColor)
+		grid.WriteString("  ", &nt.Settings.DefaultFgColor, &nt.Settings.DefaultBgColor)
+	}
+
+	grid.WriteString("\n", &nt.Settings.DefaultFgColor, &nt.Settings.DefaultBgColor)
+}
+
+// completionWordStart returns the index where the last word of text starts, and whether that word is in the
+// position of a command name (the first word of a pipeline stage)
+func completionWordStart(text []rune) (wordStart int64, isCmdName bool) {
+
+	wordStart = int64(len(text))
+	for wordStart > 0 && !isCompletionWordSep(text[wordStart-1]) {
+		wordStart--
+	}
+
+	before := strings.TrimSpace(string(text[:wordStart]))
+	return wordStart, before == "" || strings.HasSuffix(before, "|")
+}
+
+func isCompletionWordSep(r rune) bool {
+	return r == ' ' || r == '\t' || r == '|'
+}
+
+func looksLikePath(word string) bool {
+	return strings.ContainsRune(word, '/') || strings.ContainsRune(word, filepath.Separator)
+}
+
+// pathCandidates returns the sorted files and dirs that start with prefix, where dirs end with '/'.
+// Relative prefixes are completed from dir
+func pathCandidates(prefix, dir string) []string {
+
+	matches, err := shell.GlobInDir(dir, prefix+"*")
+	if err != nil {
+		return nil
+	}
+
+	for i := 0; i < len(matches); i++ {
+
+		// Glob drops the './' prefix, but we must keep the word as the user typed it
+		if strings.HasPrefix(prefix, "./") && !strings.HasPrefix(matches[i], "./") {
+			matches[i] = "./" + matches[i]
+		}
+
+		statPath := matches[i]
+		if dir != "" && !filepath.IsAbs(statPath) {
+			statPath = filepath.Join(dir, statPath)
+		}
+
+		info, err := os.Stat(statPath)
+		if err == nil && info.IsDir() {
+			matches[i] += "/"
+		}
+	}
+
+	return matches
+}
+
+// commandCandidates returns the sorted names of the builtins and the executables in $PATH that start with prefix.
+// An empty prefix has no candidates, because listing every command isn't useful
+func commandCandidates(prefix string, builtins map[string]func(args []string) error) []string {
+
+	if prefix == "" {
+		return nil
+	}
+
+	found := map[string]struct{}{}
+	for name := range builtins {
+		if strings.HasPrefix(name, prefix) {
+			found[name] = struct{}{}
+		}
+	}
+
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+
+		for _, e := range entries {
+
+			if !strings.HasPrefix(e.Name(), prefix) {
+				continue
+			}
+
+			// Stat follows symlinks, which is how many executables are installed
+			info, err := os.Stat(filepath.Join(dir, e.Name()))
+			if err != nil || info.IsDir() || !isExecutable(info) {
+				continue
+			}
+
+			found[e.Name()] = struct{}{}
+		}
+	}
+
+	candidates := make([]string, 0, len(found))
+	for name := range found {
+		candidates = append(candidates, name)
+	}
+
+	sort.Strings(candidates)
+	return candidates
+}
+
+// isExecutable returns true if any of the execute permission bits are set. Windows has no such bits so all files are executable
+func isExecutable(info os.FileInfo) bool {
+	return runtime.GOOS == "windows" || info.Mode()&0111 != 0
+}
+
+// commonPrefix returns the longest prefix shared by all strs
+func commonPrefix(strs []string) string {
+
+	if len(strs) == 0 {
+		return ""
+	}
+
+	prefix := strs[0]
+	for _, s := range strs[1:] {
+
+		i := 0
+		for i < len(prefix) && i < len(s) && prefix[i] == s[i] {
+			i++
+		}
+
+		prefix = prefix[:i]
+	}
+
+	// Don't split a multi-byte rune
+	for !utf8.ValidString(prefix) {
+		prefix = prefix[:len(prefix)-1]
+	}
+
+	return prefix
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"io"
+	"os/exec"
+
+	"github.com/bloeys/gglm/gglm"
+	"github.com/bloeys/nterm/ansi"
+	"github.com/bloeys/nterm/glyphs"
+	"github.com/bloeys/nterm/ring"
+)
+
+// Exports for tests in package main_test
+var (
+	BytesToRunes        = bytesToRunes
+	ReleaseRunes        = releaseRunes
+	WriteToActiveScreen = (*nterm).writeToActiveScreen
+	SplitPipeline       = splitPipeline
+	ExpandAliases       = expandAliases
+	ParseHexColor       = parseHexColor
+	FormatHexColor      = formatHexColor
+	FormatStatusLine    = formatStatusLine
+	IsBlinkOn           = isBlinkOn
+	TerminateCmds       = terminateCmds
+	ReverseVideoColors  = reverseVideoColors
+	ReplaySgrCodes      = (*nterm).replaySgrCodes
+	PaneBounds          = paneBounds
+	NewExecCmd          = newExecCmd
+	CheckLinkScheme     = checkLinkScheme
+	StringLiteralEnd    = stringLiteralEnd
+)
+
+// NewTextOnlyNterm returns an nterm without a window or renderer, which is enough for writing and parsing text
+// and editing cmdBuf
+func NewTextOnlyNterm() *nterm {
+
+	nt := &nterm{
+		Lines:   ring.NewBuffer[Line](minLineBufSize),
+		textBuf: ring.NewBuffer[byte](minTextBufSize),
+		cmdBuf:  make([]rune, defaultCmdBufSize),
+		Settings: &Settings{
+			MaxScrollbackBytes: defaultTextBufSize,
+			MaxScrollbackLines: defaultLineBufSize,
+			CmdBufUndoLimit:    defaultUndoLimit,
+			ColorPalette:       ansi.XtermPalette(),
+		},
+	}
+
+	nt.initBuiltins()
+	return nt
+}
+
+// NewTestColors returns the fg and bg colors tests write with, which are opaque white and transparent black like the default theme
+func NewTestColors() (fg, bg *gglm.Vec4) {
+	return gglm.NewVec4(1, 1, 1, 1), gglm.NewVec4(0, 0, 0, 0)
+}
+
+// NewTestGrid returns a text-only nterm and an empty grid of the given size for writing ansi text, along with the
+// colors of NewTestColors
+func NewTestGrid(width, height uint) (nt *nterm, grid *GlyphGrid, fg, bg *gglm.Vec4) {
+	fg, bg = NewTestColors()
+	return NewTextOnlyNterm(), NewGlyphGrid(width, height), fg, bg
+}
+
+// SetScreenSize gives nt a renderer without a window that has the given screen size and cell size, which is enough
+// for laying out panes and grids
+func (nt *nterm) SetScreenSize(width, height int32, cellWidth, cellHeight float32) {
+	nt.GlyphRend = &glyphs.GlyphRend{
+		Atlas:        &glyphs.FontAtlas{SpaceAdvance: cellWidth, LineHeight: cellHeight},
+		ScreenWidth:  width,
+		ScreenHeight: height,
+	}
+	nt.LayoutPanes()
+}
+
+// SetGlyphRend gives nt the renderer gr (e.g. one without a window), and lays out the panes for the screen size of gr
+func (nt *nterm) SetGlyphRend(gr *glyphs.GlyphRend) {
+	nt.GlyphRend = gr
+	nt.lastCmdCharPos = gglm.NewVec3(0, gr.Atlas.LineHeight, 0)
+	nt.LayoutPanes()
+}
+
+// PaneBoundsAndFocus returns the left edge and width of nt, and whether it has focus
+func (nt *nterm) PaneBoundsAndFocus() (left, width float32, focused bool) {
+	return nt.paneLeft, nt.PaneWidth(), !nt.unfocused
+}
+
+// GridSizes returns the sizes of the normal and alt glyph grids
+func (nt *nterm) GridSizes() (w, h, altW, altH uint) {
+	return nt.glyphGrid.SizeX, nt.glyphGrid.SizeY, nt.altGlyphGrid.SizeX, nt.altGlyphGrid.SizeY
+}
+
+// TextBufText returns everything in textBuf
+func (nt *nterm) TextBufText() string {
+	v1, v2 := nt.textBuf.Views()
+	return string(v1) + string(v2)
+}
+
+// CurrentDir returns the working directory as set by the cd builtin
+func (nt *nterm) CurrentDir() string {
+	return nt.currentDir
+}
+
+// CmdBufText returns the command being typed and the cursor position within it
+func (nt *nterm) CmdBufText() (text string, cursorPos int64) {
+	return string(nt.cmdBuf[:nt.cmdBufLen]), nt.cursorCharIndex
+}
+
+// TabCandidates returns the candidates of the last completion and the index of the one in cmdBuf
+func (nt *nterm) TabCandidates() (candidates []string, index int) {
+	return nt.tabCandidates, nt.tabIndex
+}
+
+// SetCmdBufCursor moves the cursor to pos within cmdBuf
+func (nt *nterm) SetCmdBufCursor(pos int64) {
+	nt.cursorCharIndex = pos
+}
+
+// ActiveSettingsEditor returns the open settings editor, or nil if it's closed
+func (nt *nterm) ActiveSettingsEditor() *SettingsEditor {
+	return nt.settingsEditor
+}
+
+// SetActiveCmd makes the started cmd c the active cmd, as if it was run by HandleReturn. stdin can be nil if nothing is written to the cmd
+func (nt *nterm) SetActiveCmd(c *exec.Cmd, stdin io.WriteCloser) {
+	nt.activeCmd = &Cmd{C: c, Stages: []*exec.Cmd{c}, Stdin: stdin}
+}
+
+// HasActiveCmd returns true if there is an active cmd
+func (nt *nterm) HasActiveCmd() bool {
+	return nt.activeCmd != nil
+}
+
+// IsAltScreen returns true if output goes to the alt grid
+func (nt *nterm) IsAltScreen() bool {
+	return nt.useAltScreen
+}
+
+// AltGrid returns the alt screen grid
+func (nt *nterm) AltGrid() *GlyphGrid {
+	return nt.altGlyphGrid
+}
+
+// SearchMatch returns the indices of the search matches and the index of the current one
+func (nt *nterm) SearchMatch() (matches []int64, index int) {
+	return nt.searchMatches, nt.searchMatchIndex
+}
+
+// ScrollPos returns the index (relative to textBuf.Start()) of the first char drawn
+func (nt *nterm) ScrollPos() int64 {
+	return nt.scrollPosRel
+}
@@ -2,60 +2,749 @@ package main
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
 	"unicode/utf8"
 
 	"github.com/bloeys/gglm/gglm"
+	"github.com/bloeys/nterm/ansi"
+	"github.com/bloeys/nterm/glyphs"
 )
 
+// WideGlyphTail is the glyph of the right tile of a wide rune (e.g. CJK ideographs), which takes two tiles.
+// It is never a valid rune, and tiles holding it aren't drawn
+const WideGlyphTail rune = -1
+
 type GridTile struct {
-	Glyph   rune
+	Glyph rune
+
+	// Mark is a combining mark (e.g. an accent) drawn over Glyph, or zero if there is none
+	Mark    rune
 	FgColor gglm.Vec4
 	BgColor gglm.Vec4
+
+	// Bold (SGR 1) and Italic (SGR 3) tiles are drawn with the matching font, or a synthetic one if it isn't loaded
+	Bold   bool
+	Italic bool
+
+	// Blink tiles (SGR 5 and 6) alternate between showing the glyph and only the background.
+	// RapidBlink tiles use the rapid blink period instead of the slow one
+	Blink      bool
+	RapidBlink bool
+
+	// ReverseVideo tiles (SGR 7) are drawn with FgColor and BgColor swapped
+	ReverseVideo bool
+
+	// URL is the link of tiles written within an OSC 8 hyperlink, which is opened by clicking the tile
+	URL string
 }
 
+// WrapMode is how the cursor moved from one row to the next
+type WrapMode uint8
+
+const (
+	// WrapMode_Hard is an explicit new line (or the row didn't wrap at all)
+	WrapMode_Hard WrapMode = iota
+	// WrapMode_Soft is an automatic wrap because the row was full, so the next row continues the same logical line
+	WrapMode_Soft
+	// WrapMode_Word is like WrapMode_Soft, but the row wrapped early so a word isn't split between two rows
+	WrapMode_Word
+)
+
 type GlyphGrid struct {
 	CursorX uint
 	CursorY uint
 	SizeX   uint
 	SizeY   uint
 	Tiles   [][]GridTile
+
+	// Dirty mirrors Tiles and is true for tiles that changed since the last ClearDirty call
+	Dirty [][]bool
+
+	// RowWrapKind[y] is how row y ended, which lets us treat soft wrapped rows as one logical line
+	RowWrapKind []WrapMode
+
+	// AutoWrap (DECAWM) moves the cursor to the next row when writing past the last column.
+	// If false the cursor stays at the last column and further writes overwrite it
+	AutoWrap bool
+
+	// WordWrap makes AutoWrap move a word that doesn't fit in the rest of the row to the next row instead of splitting it.
+	// Words longer than a row are still split
+	WordWrap bool
+
+	// charsetMode is the charset selected with SCS sequences (e.g. ESC(0), and runes are translated from it as they are written.
+	// The zero value is the same as ansi.Charset_ASCII
+	charsetMode ansi.Charset
+
+	// blink and rapidBlink are set on written tiles (see SetBlink)
+	blink      bool
+	rapidBlink bool
+
+	// reverseVideo is set on written tiles (see SetReverseVideo)
+	reverseVideo bool
+
+	// bold and italic are set on written tiles (see SetBold and SetItalic)
+	bold   bool
+	italic bool
+
+	// url is set on written tiles (see SetHyperlink)
+	url string
+
+	// LeftMargin is how many columns at the start of each row are skipped when the cursor moves to a new row,
+	// which keeps them free for things like line numbers
+	LeftMargin uint
+
+	// ScrollX scrolls the grid horizontally by skipping the first ScrollX columns of each line. While it isn't zero
+	// lines don't wrap, and the parts that don't fit in the row are dropped
+	ScrollX uint
+
+	// LongestLineLen is the most columns taken by a line written since the last ClearAll, including wrapped and
+	// skipped columns. lineCol is the column of the cursor within its line
+	LongestLineLen uint
+	lineCol        uint
+
+	// Position of the last written rune, which is where combining marks go
+	lastRuneX   uint
+	lastRuneY   uint
+	hasLastRune bool
+
+	// repRune is the last written rune that isn't a new line or zero width (before charset translation), and
+	// repFgColor and repBgColor are its colors. They are used by RepeatLastRune, and hasRepRune is false until one is written
+	repRune    rune
+	repFgColor gglm.Vec4
+	repBgColor gglm.Vec4
+	hasRepRune bool
 }
 
 func (gg *GlyphGrid) Write(rs []rune, fgColor *gglm.Vec4, bgColor *gglm.Vec4) {
 
 	for i := 0; i < len(rs); i++ {
 
-		r := rs[i]
-		gg.Tiles[gg.CursorY][gg.CursorX] = GridTile{
-			Glyph:   r,
-			FgColor: *fgColor,
-			BgColor: *bgColor,
+		if gg.WordWrap && gg.isWordStart(rs[i]) && !gg.wrapForWord(wordWidth(rs[i:]), fgColor, bgColor) {
+			break
+		}
+
+		if !gg.writeRune(rs[i], fgColor, bgColor) {
+			break
+		}
+	}
+}
+
+// WriteBytes is like Write but decodes the utf-8 text directly, which avoids allocating a rune slice.
+// Like bytesToRunes, writing stops at the first invalid utf-8 sequence
+func (gg *GlyphGrid) WriteBytes(bs []byte, fgColor *gglm.Vec4, bgColor *gglm.Vec4) {
+
+	for len(bs) > 0 {
+
+		r, size := utf8.DecodeRune(bs)
+		if r == utf8.RuneError {
+			break
+		}
+
+		if gg.WordWrap && gg.isWordStart(r) && !gg.wrapForWord(wordWidthBytes(bs), fgColor, bgColor) {
+			break
+		}
+		bs = bs[size:]
+
+		if !gg.writeRune(r, fgColor, bgColor) {
+			break
+		}
+	}
+}
+
+// WriteString is like WriteBytes but for strings, and also avoids allocating a rune slice
+func (gg *GlyphGrid) WriteString(str string, fgColor *gglm.Vec4, bgColor *gglm.Vec4) {
+
+	for len(str) > 0 {
+
+		r, size := utf8.DecodeRuneInString(str)
+		if r == utf8.RuneError {
+			break
+		}
+
+		if gg.WordWrap && gg.isWordStart(r) && !gg.wrapForWord(wordWidthString(str), fgColor, bgColor) {
+			break
 		}
+		str = str[size:]
 
-		if !gg.TickCursor(r == '\n') {
+		if !gg.writeRune(r, fgColor, bgColor) {
 			break
 		}
 	}
 }
 
+// WriteTiles is like Write but uses the colors of each tile
+func (gg *GlyphGrid) WriteTiles(tiles []GridTile) {
+
+	for i := 0; i < len(tiles); i++ {
+
+		t := &tiles[i]
+		if gg.WordWrap && gg.isWordStart(t.Glyph) && !gg.wrapForWord(wordWidthTiles(tiles[i:]), &t.FgColor, &t.BgColor) {
+			break
+		}
+
+		if !gg.writeRune(t.Glyph, &t.FgColor, &t.BgColor) {
+			break
+		}
+	}
+}
+
+// isWordStart returns true if writing r at the cursor starts a new word, which is when r isn't a space
+// and is either the first rune of the row or comes after a space
+func (gg *GlyphGrid) isWordStart(r rune) bool {
+
+	if r == ' ' || r == '\n' || glyphs.RuneWidth(r) == 0 {
+		return false
+	}
+
+	return !gg.hasLastRune || gg.Tiles[gg.lastRuneY][gg.lastRuneX].Glyph == ' '
+}
+
+// wrapForWord moves the cursor to the start of the next row if a word that takes wordWidth tiles doesn't fit
+// in the rest of the current row but fits in an empty one. The rest of the row is filled with spaces.
+// Returns false if the word needs to wrap but the cursor is already on the last row
+func (gg *GlyphGrid) wrapForWord(wordWidth uint, fgColor *gglm.Vec4, bgColor *gglm.Vec4) (success bool) {
+
+	if !gg.AutoWrap || gg.CursorX == gg.LeftMargin || gg.CursorX+wordWidth <= gg.SizeX || wordWidth > gg.SizeX-gg.LeftMargin {
+		return true
+	}
+
+	if gg.CursorY == gg.SizeY-1 {
+		return false
+	}
+
+	for x := gg.CursorX; x < gg.SizeX; x++ {
+		gg.setTile(x, gg.CursorY, GridTile{Glyph: ' ', FgColor: *fgColor, BgColor: *bgColor})
+	}
+
+	gg.RowWrapKind[gg.CursorY] = WrapMode_Word
+	gg.CursorX = gg.LeftMargin
+	gg.CursorY++
+	gg.hasLastRune = false
+	return true
+}
+
+// wordWidth returns how many tiles the word at the start of rs takes, where a word ends at a space or new line
+func wordWidth(rs []rune) (width uint) {
+
+	for i := 0; i < len(rs) && rs[i] != ' ' && rs[i] != '\n'; i++ {
+		width += uint(glyphs.RuneWidth(rs[i]))
+	}
+
+	return width
+}
+
+// wordWidthBytes is like wordWidth but for utf-8 text
+func wordWidthBytes(bs []byte) (width uint) {
+
+	for len(bs) > 0 {
+
+		r, size := utf8.DecodeRune(bs)
+		if r == ' ' || r == '\n' || r == utf8.RuneError {
+			break
+		}
+
+		width += uint(glyphs.RuneWidth(r))
+		bs = bs[size:]
+	}
+
+	return width
+}
+
+// wordWidthString is like wordWidthBytes but for strings
+func wordWidthString(str string) (width uint) {
+
+	for _, r := range str {
+
+		if r == ' ' || r == '\n' || r == utf8.RuneError {
+			break
+		}
+
+		width += uint(glyphs.RuneWidth(r))
+	}
+
+	return width
+}
+
+// wordWidthTiles is like wordWidth but uses the glyphs of tiles
+func wordWidthTiles(tiles []GridTile) (width uint) {
+
+	for i := 0; i < len(tiles) && tiles[i].Glyph != ' ' && tiles[i].Glyph != '\n'; i++ {
+		width += uint(glyphs.RuneWidth(tiles[i].Glyph))
+	}
+
+	return width
+}
+
+// writeRune writes r at the cursor and advances it, and returns false if the cursor can't advance.
+// Wide runes take two tiles, where the right one holds WideGlyphTail, and combining marks don't take a tile
+// but are put on the tile of the last written rune
+func (gg *GlyphGrid) writeRune(r rune, fgColor *gglm.Vec4, bgColor *gglm.Vec4) (success bool) {
+
+	untranslatedRune := r
+	if gg.charsetMode == ansi.Charset_DecSpecialGraphics {
+		r = ansi.DEC_SpecialGraphics(r)
+	}
+
+	if glyphs.RuneWidth(r) == 0 {
+
+		// Other zero width runes (e.g. BOM) are dropped. Only one mark per tile is supported
+		if gg.hasLastRune && glyphs.IsCombiningMark(r) {
+
+			t := gg.Tiles[gg.lastRuneY][gg.lastRuneX]
+			if t.Mark == 0 {
+				t.Mark = r
+				gg.setTile(gg.lastRuneX, gg.lastRuneY, t)
+			}
+		}
+
+		return true
+	}
+
+	if r != '\n' {
+		gg.repRune = untranslatedRune
+		gg.repFgColor = *fgColor
+		gg.repBgColor = *bgColor
+		gg.hasRepRune = true
+	}
+
+	isWide := gg.SizeX > 1 && glyphs.EastAsianWidth(r) == 2
+	if !gg.trackLineCol(r, isWide) {
+
+		// Marks of skipped runes are skipped too
+		gg.hasLastRune = false
+		return true
+	}
+
+	if isWide && gg.CursorX == gg.SizeX-1 {
+
+		if gg.AutoWrap {
+
+			// Wide runes can't be split between rows, so the last column is left empty and the rune goes on the next row
+			gg.setTile(gg.CursorX, gg.CursorY, GridTile{Glyph: ' ', FgColor: *fgColor, BgColor: *bgColor})
+			if !gg.TickCursor(false) {
+				return false
+			}
+
+		} else {
+			// There is no room for the right half
+			isWide = false
+		}
+	}
+
+	gg.setTile(gg.CursorX, gg.CursorY, GridTile{
+		Glyph:        r,
+		FgColor:      *fgColor,
+		BgColor:      *bgColor,
+		Blink:        gg.blink,
+		RapidBlink:   gg.rapidBlink,
+		ReverseVideo: gg.reverseVideo,
+		Bold:         gg.bold,
+		Italic:       gg.italic,
+		URL:          gg.url,
+	})
+
+	gg.lastRuneX = gg.CursorX
+	gg.lastRuneY = gg.CursorY
+	gg.hasLastRune = r != '\n'
+
+	if isWide {
+
+		if !gg.TickCursor(false) {
+			return false
+		}
+
+		gg.setTile(gg.CursorX, gg.CursorY, GridTile{
+			Glyph:        WideGlyphTail,
+			FgColor:      *fgColor,
+			BgColor:      *bgColor,
+			Blink:        gg.blink,
+			RapidBlink:   gg.rapidBlink,
+			ReverseVideo: gg.reverseVideo,
+			Bold:         gg.bold,
+			Italic:       gg.italic,
+			URL:          gg.url,
+		})
+	}
+
+	return gg.TickCursor(r == '\n')
+}
+
+// RepeatLastRune writes the last written rune count more times with the colors it was written with, which is what REP does.
+// Nothing is written if no rune was written since the last ClearAll. Writes past the grid area would only scroll, so count
+// is clamped to it
+func (gg *GlyphGrid) RepeatLastRune(count int) {
+
+	if !gg.hasRepRune {
+		return
+	}
+
+	count = clamp(count, 0, int(gg.SizeX*gg.SizeY))
+	fgColor, bgColor := gg.repFgColor, gg.repBgColor
+	for i := 0; i < count; i++ {
+		if !gg.writeRune(gg.repRune, &fgColor, &bgColor) {
+			break
+		}
+	}
+}
+
+// trackLineCol moves lineCol past r, and returns false if r should be skipped because it's scrolled out of view.
+// The last column of the row is kept for new lines, so lines stop before it instead of wrapping
+func (gg *GlyphGrid) trackLineCol(r rune, isWide bool) (isVisible bool) {
+
+	if r == '\n' {
+		gg.lineCol = 0
+		return true
+	}
+
+	width := uint(1)
+	if isWide {
+		width = 2
+	}
+
+	col := gg.lineCol
+	gg.lineCol += width
+	if gg.lineCol > gg.LongestLineLen {
+		gg.LongestLineLen = gg.lineCol
+	}
+
+	return gg.ScrollX == 0 || col >= gg.ScrollX && gg.CursorX+width < gg.SizeX
+}
+
 func (gg *GlyphGrid) ClearRow(rowIndex uint) {
 
 	if rowIndex >= gg.SizeY {
 		panic(fmt.Sprintf("passed row index of %d is larger or equal than grid Y size of %d\n", rowIndex, gg.SizeY))
 	}
 
+	gg.clearRow(rowIndex)
+}
+
+func (gg *GlyphGrid) ClearAll() {
+
+	for y := uint(0); y < gg.SizeY; y++ {
+		gg.clearRow(y)
+	}
+
+	gg.hasLastRune = false
+	gg.hasRepRune = false
+	gg.charsetMode = ansi.Charset_ASCII
+	gg.blink = false
+	gg.rapidBlink = false
+	gg.reverseVideo = false
+	gg.bold = false
+	gg.italic = false
+	gg.url = ""
+	gg.lineCol = 0
+	gg.LongestLineLen = 0
+}
+
+// SetCharset makes the following writes use charset (e.g. DEC line drawing characters). Unsupported charsets are treated as ASCII
+func (gg *GlyphGrid) SetCharset(charset ansi.Charset) {
+	gg.charsetMode = charset
+}
+
+// SetBlink makes the following writes blink (slowly unless rapid is true) until it is called with blink=false or the grid is cleared
+func (gg *GlyphGrid) SetBlink(blink, rapid bool) {
+	gg.blink = blink
+	gg.rapidBlink = blink && rapid
+}
+
+// SetReverseVideo makes the following writes have swapped fg and bg colors until it is called with false or the grid is cleared
+func (gg *GlyphGrid) SetReverseVideo(reverse bool) {
+	gg.reverseVideo = reverse
+}
+
+// SetBold makes the following writes bold until it is called with false or the grid is cleared
+func (gg *GlyphGrid) SetBold(bold bool) {
+	gg.bold = bold
+}
+
+// SetItalic makes the following writes italic until it is called with false or the grid is cleared
+func (gg *GlyphGrid) SetItalic(italic bool) {
+	gg.italic = italic
+}
+
+// SetHyperlink makes the following writes link to url until it is called with an empty url or the grid is cleared
+func (gg *GlyphGrid) SetHyperlink(url string) {
+	gg.url = url
+}
+
+func (gg *GlyphGrid) clearRow(rowIndex uint) {
+
+	gg.RowWrapKind[rowIndex] = WrapMode_Hard
+
 	row := gg.Tiles[rowIndex]
+	dirtyRow := gg.Dirty[rowIndex]
 	for x := 0; x < len(row); x++ {
+
+		if row[x].Glyph == utf8.RuneError {
+			continue
+		}
+
 		row[x].Glyph = utf8.RuneError
+		row[x].Mark = 0
+		dirtyRow[x] = true
 	}
 }
 
-func (gg *GlyphGrid) ClearAll() {
+// CopyRegion copies the width*height tiles starting at (srcX, srcY) to (dstX, dstY). The regions can overlap,
+// which allows shifting rows within a scroll region. Row wrap kinds are copied too when whole rows are copied
+func (gg *GlyphGrid) CopyRegion(srcY, dstY, height, srcX, dstX, width int) {
 
-	for y := 0; y < len(gg.Tiles); y++ {
-		row := gg.Tiles[y]
+	gg.checkRegion(srcY, srcX, height, width)
+	gg.checkRegion(dstY, dstX, height, width)
+
+	copyFullRows := srcX == 0 && dstX == 0 && width == int(gg.SizeX)
+
+	copyRow := func(i int) {
+
+		srcRow := gg.Tiles[srcY+i][srcX : srcX+width]
+		dstRow := gg.Tiles[dstY+i][dstX : dstX+width]
+		copy(dstRow, srcRow)
+
+		dirtyRow := gg.Dirty[dstY+i][dstX : dstX+width]
+		for x := 0; x < len(dirtyRow); x++ {
+			dirtyRow[x] = true
+		}
+
+		if copyFullRows {
+			gg.RowWrapKind[dstY+i] = gg.RowWrapKind[srcY+i]
+		}
+	}
+
+	// When moving down we go from the bottom so we don't overwrite rows before copying them
+	if dstY > srcY {
+		for i := height - 1; i >= 0; i-- {
+			copyRow(i)
+		}
+	} else {
+		for i := 0; i < height; i++ {
+			copyRow(i)
+		}
+	}
+}
+
+// Resized returns a grid of the new size with the tiles, cursor and write state (e.g. charset) of gg. Columns that don't fit
+// are dropped, and if there are too few rows then rows above the cursor are dropped first (as if they were scrolled away)
+func (gg *GlyphGrid) Resized(width, height uint) *GlyphGrid {
+
+	newGrid := NewGlyphGrid(width, height)
+	tiles, dirty, rowWrapKind := newGrid.Tiles, newGrid.Dirty, newGrid.RowWrapKind
+
+	*newGrid = *gg
+	newGrid.SizeX = width
+	newGrid.SizeY = height
+	newGrid.Tiles = tiles
+	newGrid.Dirty = dirty
+	newGrid.RowWrapKind = rowWrapKind
+
+	droppedRows := uint(0)
+	if gg.CursorY >= height {
+		droppedRows = gg.CursorY - height + 1
+	}
+
+	for y := uint(0); y < height && y+droppedRows < gg.SizeY; y++ {
+
+		srcRow := gg.Tiles[y+droppedRows]
+		copy(tiles[y], srcRow)
+		rowWrapKind[y] = gg.RowWrapKind[y+droppedRows]
+
+		// A wide rune that lost its tail can't be drawn
+		if width < gg.SizeX && srcRow[width].Glyph == WideGlyphTail {
+			tiles[y][width-1].Glyph = utf8.RuneError
+		}
+	}
+
+	newGrid.CursorX = clamp(gg.CursorX, 0, width-1)
+	newGrid.CursorY = clamp(gg.CursorY-droppedRows, 0, height-1)
+	newGrid.LeftMargin = clamp(gg.LeftMargin, 0, width-1)
+	newGrid.hasLastRune = false
+
+	return newGrid
+}
+
+// FillRegion sets the width*height tiles starting at (x, y) to tile, which is usually used to clear
+// rows left empty after CopyRegion
+func (gg *GlyphGrid) FillRegion(y, x, height, width int, tile GridTile) {
+
+	gg.checkRegion(y, x, height, width)
+
+	for row := y; row < y+height; row++ {
+		for col := x; col < x+width; col++ {
+			gg.setTile(uint(col), uint(row), tile)
+		}
+	}
+}
+
+// InsertCells shifts the tiles of row y starting at column x right by count, and sets the count tiles at x to fill.
+// Tiles shifted past the end of the row are lost
+func (gg *GlyphGrid) InsertCells(y, x, count int, fill GridTile) {
+
+	gg.checkRegion(y, x, 1, 0)
+
+	count = clamp(count, 0, int(gg.SizeX)-x)
+	gg.CopyRegion(y, y, 1, x, x+count, int(gg.SizeX)-x-count)
+	gg.FillRegion(y, x, 1, count, fill)
+}
+
+// DeleteCells removes count tiles of row y starting at column x, shifting the rest of the row left,
+// and sets the count tiles left at the end of the row to fill
+func (gg *GlyphGrid) DeleteCells(y, x, count int, fill GridTile) {
+
+	gg.checkRegion(y, x, 1, 0)
+
+	count = clamp(count, 0, int(gg.SizeX)-x)
+	gg.CopyRegion(y, y, 1, x+count, x, int(gg.SizeX)-x-count)
+	gg.FillRegion(y, int(gg.SizeX)-count, 1, count, fill)
+}
+
+// InsertLines shifts rows starting at y down by count, and sets the tiles of the count rows at y to fill.
+// Rows shifted past the bottom of the grid are lost
+func (gg *GlyphGrid) InsertLines(y, count int, fill GridTile) {
+
+	gg.checkRegion(y, 0, 0, 0)
+
+	count = clamp(count, 0, int(gg.SizeY)-y)
+	gg.CopyRegion(y, y+count, int(gg.SizeY)-y-count, 0, 0, int(gg.SizeX))
+	gg.FillRegion(y, 0, count, int(gg.SizeX), fill)
+	gg.setRowWrapKinds(y, count, WrapMode_Hard)
+}
+
+// DeleteLines removes count rows starting at y, shifting the following rows up,
+// and sets the tiles of the count rows left at the bottom of the grid to fill
+func (gg *GlyphGrid) DeleteLines(y, count int, fill GridTile) {
+
+	gg.checkRegion(y, 0, 0, 0)
+
+	count = clamp(count, 0, int(gg.SizeY)-y)
+	gg.CopyRegion(y+count, y, int(gg.SizeY)-y-count, 0, 0, int(gg.SizeX))
+	gg.FillRegion(int(gg.SizeY)-count, 0, count, int(gg.SizeX), fill)
+	gg.setRowWrapKinds(int(gg.SizeY)-count, count, WrapMode_Hard)
+}
+
+func (gg *GlyphGrid) setRowWrapKinds(y, count int, wrapMode WrapMode) {
+	for i := y; i < y+count; i++ {
+		gg.RowWrapKind[i] = wrapMode
+	}
+}
+
+func (gg *GlyphGrid) checkRegion(y, x, height, width int) {
+
+	if x < 0 || y < 0 || width < 0 || height < 0 || x+width > int(gg.SizeX) || y+height > int(gg.SizeY) {
+		panic(fmt.Sprintf("region with x=%d, y=%d, width=%d, height=%d is outside grid of size %dx%d\n", x, y, width, height, gg.SizeX, gg.SizeY))
+	}
+}
+
+// WordAt returns the first and last columns of the word (consecutive non-space glyphs) that has the tile at (x, y).
+// A wide glyph's tail tile is part of its word. ok is false if the tile is a space or empty.
+// Words are only searched for within row y, even if the row is soft wrapped
+func (gg *GlyphGrid) WordAt(x, y uint) (startX, endX uint, ok bool) {
+
+	row := gg.Tiles[y]
+	if !isWordGlyph(row[x].Glyph) {
+		return 0, 0, false
+	}
+
+	startX = x
+	for startX > 0 && isWordGlyph(row[startX-1].Glyph) {
+		startX--
+	}
+
+	endX = x
+	for endX+1 < gg.SizeX && isWordGlyph(row[endX+1].Glyph) {
+		endX++
+	}
+
+	return startX, endX, true
+}
+
+func isWordGlyph(r rune) bool {
+	return r == WideGlyphTail || r != 0 && r != utf8.RuneError && !unicode.IsSpace(r)
+}
+
+// LogicalLineAt returns the first and last rows of the logical line that has row y, which is y plus
+// all the rows soft wrapped into it or out of it
+func (gg *GlyphGrid) LogicalLineAt(y uint) (startY, endY uint) {
+
+	startY = y
+	for startY > 0 && gg.RowWrapKind[startY-1] != WrapMode_Hard {
+		startY--
+	}
+
+	endY = y
+	for endY+1 < gg.SizeY && gg.RowWrapKind[endY] != WrapMode_Hard {
+		endY++
+	}
+
+	return startY, endY
+}
+
+// TileAt returns the grid position and tile at a screen position relative to the top left corner of the grid, where each
+// tile is cellWidth by cellHeight pixels. found is false if the position is outside the grid
+func (gg *GlyphGrid) TileAt(screenX, screenY, cellWidth, cellHeight float32) (gridX, gridY int, t *GridTile, found bool) {
+
+	if screenX < 0 || screenY < 0 {
+		return 0, 0, nil, false
+	}
+
+	gridX = int(screenX / cellWidth)
+	gridY = int(screenY / cellHeight)
+	if gridX >= int(gg.SizeX) || gridY >= int(gg.SizeY) {
+		return 0, 0, nil, false
+	}
+
+	return gridX, gridY, &gg.Tiles[gridY][gridX], true
+}
+
+// setTile only updates the tile (and marks it dirty) if the new tile is different from the current one
+func (gg *GlyphGrid) setTile(x, y uint, t GridTile) {
+
+	if gg.Tiles[y][x] == t {
+		return
+	}
+
+	gg.Tiles[y][x] = t
+	gg.Dirty[y][x] = true
+}
+
+// HasDirty returns true if any tile changed since the last ClearDirty call
+func (gg *GlyphGrid) HasDirty() bool {
+
+	for y := 0; y < len(gg.Dirty); y++ {
+
+		row := gg.Dirty[y]
 		for x := 0; x < len(row); x++ {
-			row[x].Glyph = utf8.RuneError
+			if row[x] {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (gg *GlyphGrid) ClearDirty() {
+
+	for y := 0; y < len(gg.Dirty); y++ {
+
+		row := gg.Dirty[y]
+		for x := 0; x < len(row); x++ {
+			row[x] = false
+		}
+	}
+}
+
+// MarkAllDirty forces all tiles to be redrawn, which is needed when something that isn't part of
+// the tiles changes how they are drawn (e.g. selection)
+func (gg *GlyphGrid) MarkAllDirty() {
+
+	for y := 0; y < len(gg.Dirty); y++ {
+
+		row := gg.Dirty[y]
+		for x := 0; x < len(row); x++ {
+			row[x] = true
 		}
 	}
 }
@@ -66,12 +755,19 @@ func (gg *GlyphGrid) SetCursor(x, y uint) {
 		panic("cursor position can not be larger than grid size")
 	}
 
+	// The cursor isn't drawn as part of the grid, so moving it doesn't dirty any tiles
+
 	gg.CursorX = x
 	gg.CursorY = y
+	gg.hasLastRune = false
 }
 
 func (gg *GlyphGrid) TickCursor(forceDown bool) (success bool) {
 
+	if !forceDown && !gg.AutoWrap && gg.CursorX == gg.SizeX-1 {
+		return true
+	}
+
 	if gg.CursorX == gg.SizeX-1 && gg.CursorY == gg.SizeY-1 {
 		// fmt.Println("trying to advance cursor beyond grid which is not allowed. Keeping cursor at position")
 		return false
@@ -84,14 +780,16 @@ func (gg *GlyphGrid) TickCursor(forceDown bool) (success bool) {
 			return false
 		}
 
-		gg.CursorX = 0
+		gg.RowWrapKind[gg.CursorY] = WrapMode_Hard
+		gg.CursorX = gg.LeftMargin
 		gg.CursorY++
 		return true
 	}
 
 	gg.CursorX++
 	if gg.CursorX >= gg.SizeX {
-		gg.CursorX = 0
+		gg.RowWrapKind[gg.CursorY] = WrapMode_Soft
+		gg.CursorX = gg.LeftMargin
 		gg.CursorY++
 	}
 
@@ -109,7 +807,14 @@ func (gg *GlyphGrid) Print() {
 			if row[x].Glyph == utf8.RuneError {
 				break
 			}
+
+			if row[x].Glyph == WideGlyphTail {
+				continue
+			}
 			fmt.Print(string(row[x].Glyph))
+			if row[x].Mark != 0 {
+				fmt.Print(string(row[x].Mark))
+			}
 		}
 
 		fmt.Print("\n")
@@ -117,6 +822,136 @@ func (gg *GlyphGrid) Print() {
 	fmt.Println("---")
 }
 
+// MarshalText serializes the glyphs and colors of the tiles, which is useful for comparing grids in tests.
+// Each row is a line of tab separated tiles, and each tile is 'glyph|fgR,fgG,fgB,fgA|bgR,bgG,bgB,bgA' where
+// the glyph is a quoted rune (e.g. 'a') or -1 for WideGlyphTail. Other tile fields are not serialized
+func (gg *GlyphGrid) MarshalText() ([]byte, error) {
+
+	sb := strings.Builder{}
+	for y := 0; y < len(gg.Tiles); y++ {
+
+		for x := 0; x < len(gg.Tiles[y]); x++ {
+
+			if x > 0 {
+				sb.WriteByte('\t')
+			}
+
+			t := &gg.Tiles[y][x]
+			if t.Glyph == WideGlyphTail {
+				sb.WriteString("-1")
+			} else {
+				sb.WriteString(strconv.QuoteRune(t.Glyph))
+			}
+
+			sb.WriteByte('|')
+			writeTextColor(&sb, &t.FgColor)
+			sb.WriteByte('|')
+			writeTextColor(&sb, &t.BgColor)
+		}
+
+		sb.WriteByte('\n')
+	}
+
+	return []byte(sb.String()), nil
+}
+
+func writeTextColor(sb *strings.Builder, c *gglm.Vec4) {
+
+	for i := 0; i < len(c.Data); i++ {
+
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+
+		sb.WriteString(strconv.FormatFloat(float64(c.Data[i]), 'g', -1, 32))
+	}
+}
+
+// UnmarshalGlyphGrid is the inverse of GlyphGrid.MarshalText, and returns a grid sized to fit the rows of data,
+// which must all have the same number of tiles
+func UnmarshalGlyphGrid(data []byte) (*GlyphGrid, error) {
+
+	rows := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(rows) == 0 || rows[0] == "" {
+		return nil, fmt.Errorf("glyph grid data has no tiles")
+	}
+
+	width := len(strings.Split(rows[0], "\t"))
+	gg := NewGlyphGrid(uint(width), uint(len(rows)))
+	for y, row := range rows {
+
+		tiles := strings.Split(row, "\t")
+		if len(tiles) != width {
+			return nil, fmt.Errorf("row %d of glyph grid data has %d tiles but row 0 has %d", y, len(tiles), width)
+		}
+
+		for x, tileText := range tiles {
+
+			err := parseTextTile(&gg.Tiles[y][x], tileText)
+			if err != nil {
+				return nil, fmt.Errorf("tile %d of row %d of glyph grid data is invalid. Err: %w", x, y, err)
+			}
+		}
+	}
+
+	return gg, nil
+}
+
+// parseTextTile parses a tile written by GlyphGrid.MarshalText. The colors are split from the end because the glyph might be a '|'
+func parseTextTile(t *GridTile, s string) error {
+
+	bgStart := strings.LastIndexByte(s, '|')
+	if bgStart == -1 {
+		return fmt.Errorf("'%s' is not in the form glyph|fg|bg", s)
+	}
+
+	fgStart := strings.LastIndexByte(s[:bgStart], '|')
+	if fgStart == -1 {
+		return fmt.Errorf("'%s' is not in the form glyph|fg|bg", s)
+	}
+
+	glyph := s[:fgStart]
+	if glyph == "-1" {
+		t.Glyph = WideGlyphTail
+	} else {
+
+		unquoted, err := strconv.Unquote(glyph)
+		r, size := utf8.DecodeRuneInString(unquoted)
+		if err != nil || size != len(unquoted) || size == 0 {
+			return fmt.Errorf("glyph %s is not a quoted rune", glyph)
+		}
+
+		t.Glyph = r
+	}
+
+	err := parseTextColor(&t.FgColor, s[fgStart+1:bgStart])
+	if err != nil {
+		return err
+	}
+
+	return parseTextColor(&t.BgColor, s[bgStart+1:])
+}
+
+func parseTextColor(c *gglm.Vec4, s string) error {
+
+	components := strings.Split(s, ",")
+	if len(components) != len(c.Data) {
+		return fmt.Errorf("color '%s' is not in the form r,g,b,a", s)
+	}
+
+	for i := 0; i < len(components); i++ {
+
+		f, err := strconv.ParseFloat(components[i], 32)
+		if err != nil {
+			return fmt.Errorf("color '%s' is not in the form r,g,b,a", s)
+		}
+
+		c.Data[i] = float32(f)
+	}
+
+	return nil
+}
+
 func NewGlyphGrid(width, height uint) *GlyphGrid {
 
 	if width == 0 || height == 0 {
@@ -124,8 +959,15 @@ func NewGlyphGrid(width, height uint) *GlyphGrid {
 	}
 
 	tiles := make([][]GridTile, height)
+	dirty := make([][]bool, height)
 	for i := 0; i < len(tiles); i++ {
+
 		tiles[i] = make([]GridTile, width)
+
+		dirty[i] = make([]bool, width)
+		for j := 0; j < len(dirty[i]); j++ {
+			dirty[i][j] = true
+		}
 	}
 
 	return &GlyphGrid{
@@ -134,5 +976,9 @@ func NewGlyphGrid(width, height uint) *GlyphGrid {
 		SizeX:   width,
 		SizeY:   height,
 		Tiles:   tiles,
+		Dirty:   dirty,
+
+		RowWrapKind: make([]WrapMode, height),
+		AutoWrap:    true,
 	}
 }
@@ -1,12 +1,16 @@
 package glyphs
 
 import (
+	"crypto/sha256"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"image"
 	"image/color"
 	"image/draw"
 	"image/png"
 	"os"
+	"path/filepath"
 	"unicode"
 
 	"github.com/bloeys/nterm/assert"
@@ -26,8 +30,33 @@ type FontAtlas struct {
 	SpaceAdvance float32
 	//LineHeight is the height of metrics.Height
 	LineHeight float32
+
+	// GlyphCount is the number of glyphs on the atlas
+	GlyphCount int
+	// AtlasSize is the size of Img in pixels
+	AtlasSize image.Point
+	// PackingEfficiency is the fraction of atlas pixels inside glyph bounds, where 1 means no space is wasted
+	PackingEfficiency float32
+	// AverageGlyphDensity is the average fraction of non-black pixels inside the bounds of a glyph
+	AverageGlyphDensity float32
+}
+
+// atlasStatsJson is the file written by FontAtlas.SaveStats
+type atlasStatsJson struct {
+	GlyphCount          int
+	AtlasSizeX          int
+	AtlasSizeY          int
+	PackingEfficiency   float32
+	AverageGlyphDensity float32
 }
 
+// AtlasCacheDir is where atlases created by NewFontAtlasFromFile/NewFontAtlasFromBytes are cached so they don't have to be
+// rebuilt on every startup. Caching is disabled if this is empty
+var AtlasCacheDir = defaultAtlasCacheDir()
+
+// atlasCacheVersion must be changed whenever the way atlases are built or saved changes so old caches are ignored
+const atlasCacheVersion = 1
+
 type FontAtlasGlyph struct {
 	Rune  rune
 	U     float32
@@ -54,13 +83,214 @@ func NewFontAtlasFromFile(fontFile string, fontOptions *truetype.Options) (*Font
 		return nil, err
 	}
 
+	return NewFontAtlasFromBytes(fBytes, fontOptions)
+}
+
+// NewFontAtlasFromBytes is like NewFontAtlasFromFile but takes the contents of a TTF or TTC file,
+// which is useful when the font is embedded
+func NewFontAtlasFromBytes(fBytes []byte, fontOptions *truetype.Options) (*FontAtlas, error) {
+
 	f, err := truetype.Parse(fBytes)
 	if err != nil {
 		return nil, err
 	}
 
 	face := truetype.NewFace(f, fontOptions)
-	return NewFontAtlasFromFont(f, face, uint(fontOptions.Size))
+
+	cachePath := ""
+	if AtlasCacheDir != "" {
+
+		cachePath = filepath.Join(AtlasCacheDir, atlasCacheKey(fBytes, fontOptions))
+		atlas, err := LoadAtlas(cachePath)
+		if err == nil {
+			atlas.Font = f
+			atlas.Face = face
+			return atlas, nil
+		}
+	}
+
+	atlas, err := NewFontAtlasFromFont(f, face, uint(fontOptions.Size))
+	if err != nil {
+		return nil, err
+	}
+
+	// Failing to cache isn't fatal, it just means we will rebuild the atlas next time
+	if cachePath != "" {
+		err = SaveAtlas(cachePath, atlas)
+		if err != nil {
+			fmt.Printf("Failed to save font atlas to cache at '%s'. Err: %s\n", cachePath, err.Error())
+		}
+	}
+
+	return atlas, nil
+}
+
+// atlasCacheJson is the sidecar file saved with the atlas image. Font and Face aren't saved
+type atlasCacheJson struct {
+	Version      int
+	SpaceAdvance float32
+	LineHeight   float32
+	Glyphs       map[rune]FontAtlasGlyph
+}
+
+// SaveAtlas saves the atlas as two files, the image at 'path.png' and the glyph information at 'path.json'.
+// The font and face of the atlas are not saved
+func SaveAtlas(path string, atlas *FontAtlas) error {
+
+	err := os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	err = SaveImgToPNG(atlas.Img, path+".png")
+	if err != nil {
+		return err
+	}
+
+	jsonBytes, err := json.Marshal(&atlasCacheJson{
+		Version:      atlasCacheVersion,
+		SpaceAdvance: atlas.SpaceAdvance,
+		LineHeight:   atlas.LineHeight,
+		Glyphs:       atlas.Glyphs,
+	})
+	if err != nil {
+		return err
+	}
+
+	// The json is written last so that a failed save never produces a cache that looks valid
+	return os.WriteFile(path+".json", jsonBytes, 0644)
+}
+
+// LoadAtlas loads an atlas saved with SaveAtlas. The returned atlas has a nil Font and Face,
+// so the caller must set them if they are needed (e.g. to change the font size)
+func LoadAtlas(path string) (*FontAtlas, error) {
+
+	jsonBytes, err := os.ReadFile(path + ".json")
+	if err != nil {
+		return nil, err
+	}
+
+	cacheJson := &atlasCacheJson{}
+	err = json.Unmarshal(jsonBytes, cacheJson)
+	if err != nil {
+		return nil, err
+	}
+
+	if cacheJson.Version != atlasCacheVersion {
+		return nil, fmt.Errorf("atlas cache version is %d but expected %d", cacheJson.Version, atlasCacheVersion)
+	}
+
+	imgFile, err := os.Open(path + ".png")
+	if err != nil {
+		return nil, err
+	}
+	defer imgFile.Close()
+
+	img, err := png.Decode(imgFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// The decoder might not return RGBA (e.g. if the image was saved as grayscale)
+	rgbaImg, ok := img.(*image.RGBA)
+	if !ok {
+		rgbaImg = image.NewRGBA(img.Bounds())
+		draw.Draw(rgbaImg, rgbaImg.Bounds(), img, img.Bounds().Min, draw.Src)
+	}
+
+	atlas := &FontAtlas{
+		Img:          rgbaImg,
+		Glyphs:       cacheJson.Glyphs,
+		SpaceAdvance: cacheJson.SpaceAdvance,
+		LineHeight:   cacheJson.LineHeight,
+	}
+	atlas.calcStats()
+
+	return atlas, nil
+}
+
+// SaveStats writes GlyphCount, AtlasSize, PackingEfficiency and AverageGlyphDensity as json to path,
+// which lets CI track how font and size changes affect the atlas
+func (fa *FontAtlas) SaveStats(path string) error {
+
+	jsonBytes, err := json.MarshalIndent(&atlasStatsJson{
+		GlyphCount:          fa.GlyphCount,
+		AtlasSizeX:          fa.AtlasSize.X,
+		AtlasSizeY:          fa.AtlasSize.Y,
+		PackingEfficiency:   fa.PackingEfficiency,
+		AverageGlyphDensity: fa.AverageGlyphDensity,
+	}, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, jsonBytes, 0644)
+}
+
+// calcStats sets the stats fields (e.g. PackingEfficiency) from Img and Glyphs
+func (fa *FontAtlas) calcStats() {
+
+	fa.GlyphCount = len(fa.Glyphs)
+	fa.AtlasSize = fa.Img.Bounds().Size()
+	fa.PackingEfficiency = 0
+	fa.AverageGlyphDensity = 0
+
+	usedPixels := 0
+	densitySum := float32(0)
+	for r := range fa.Glyphs {
+
+		bounds := fa.GlyphBounds(r).Intersect(fa.Img.Bounds())
+		if bounds.Empty() {
+			continue
+		}
+
+		filledPixels := 0
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				c := fa.Img.RGBAAt(x, y)
+				if c.R > 0 || c.G > 0 || c.B > 0 {
+					filledPixels++
+				}
+			}
+		}
+
+		pixels := bounds.Dx() * bounds.Dy()
+		usedPixels += pixels
+		densitySum += float32(filledPixels) / float32(pixels)
+	}
+
+	if fa.AtlasSize.X > 0 && fa.AtlasSize.Y > 0 {
+		fa.PackingEfficiency = float32(usedPixels) / float32(fa.AtlasSize.X*fa.AtlasSize.Y)
+	}
+
+	if fa.GlyphCount > 0 {
+		fa.AverageGlyphDensity = densitySum / float32(fa.GlyphCount)
+	}
+}
+
+// atlasCacheKey returns a file name that changes if the font or any of the options affecting the atlas change
+func atlasCacheKey(fontBytes []byte, fontOptions *truetype.Options) string {
+	fontHash := sha256.Sum256(fontBytes)
+	return fmt.Sprintf(
+		"%x-v%d-size%.2f-dpi%.2f-h%d-spx%d-spy%d",
+		fontHash[:16],
+		atlasCacheVersion,
+		fontOptions.Size,
+		fontOptions.DPI,
+		fontOptions.Hinting,
+		fontOptions.SubPixelsX,
+		fontOptions.SubPixelsY,
+	)
+}
+
+func defaultAtlasCacheDir() string {
+
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(cacheDir, "nterm", "atlases")
 }
 
 func calcNeededAtlasSize(glyphs []rune, face font.Face, charPaddingXFixed, charPaddingYFixed fixed.Int26_6) (atlasSizeX, atlasSizeY int) {
@@ -274,9 +504,42 @@ func NewFontAtlasFromFont(f *truetype.Font, face font.Face, pointSize uint) (*Fo
 	// drawer.Dot.Y += lineHeightFixed + charPaddingYFixed
 	// drawer.DrawString(string(finalR))
 
+	atlas.calcStats()
 	return atlas, nil
 }
 
+// GlyphBounds returns the pixel bounds of r on the atlas image, or an empty rectangle if r isn't in the atlas.
+// U/V are from the bottom left (as in opengl) while image coordinates are from the top left
+func (fa *FontAtlas) GlyphBounds(r rune) image.Rectangle {
+
+	g, ok := fa.Glyphs[r]
+	if !ok {
+		return image.Rectangle{}
+	}
+
+	atlasSizeY := fa.Img.Bounds().Dy()
+	return image.Rect(
+		int(g.U),
+		atlasSizeY-int(g.V+g.SizeV),
+		int(g.U+g.SizeU),
+		atlasSizeY-int(g.V),
+	)
+}
+
+// GlyphAt returns the rune whose bounds (see GlyphBounds) contain the atlas pixel at atlasX and atlasY.
+// found is false if the pixel is padding between glyphs or outside the atlas
+func (fa *FontAtlas) GlyphAt(atlasX, atlasY int) (r rune, found bool) {
+
+	p := image.Pt(atlasX, atlasY)
+	for r := range fa.Glyphs {
+		if p.In(fa.GlyphBounds(r)) {
+			return r, true
+		}
+	}
+
+	return 0, false
+}
+
 func drawRectOutline(img *image.RGBA, rect image.Rectangle, color color.NRGBA) {
 
 	rowPixCount := img.Stride / 4
@@ -2,8 +2,13 @@ package glyphs
 
 import (
 	"fmt"
+	"image"
+	"image/draw"
 	"math"
+	"os"
+	"sort"
 	"unicode"
+	"unicode/utf8"
 
 	"github.com/bloeys/gglm/gglm"
 	"github.com/bloeys/nmage/assets"
@@ -18,16 +23,38 @@ import (
 )
 
 const (
-	DefaultGlyphsPerBatch = 4 * 1024
+	// MaxGlyphsPerBatch is how many glyphs fit in the instance buffers. Drawing more in one frame takes multiple draw calls
+	MaxGlyphsPerBatch      = 4 * 1024
+	DefaultTabStopInterval = 8
 
 	floatsPerGlyph = 13
 	invalidRune    = unicode.ReplacementChar
+
+	// bgRunMergeEpsilon is how far apart in pixels two bg quads can be and still be merged by writeBgQuad, because
+	// positions are sums of float advances
+	bgRunMergeEpsilon = 0.01
 )
 
 var (
 	RuneInfos map[rune]RuneInfo
+
+	// RuneInfoSource is used instead of RuneInfos when it isn't nil, which allows loading rune infos
+	// as they are needed (see LazyRuneInfos)
+	RuneInfoSource RuneInfoProvider
 )
 
+// runeInfo returns the info of r from RuneInfoSource or RuneInfos. Runes without info get
+// an empty RuneInfo, which is the only case where ScriptTable is nil
+func runeInfo(r rune) RuneInfo {
+
+	if RuneInfoSource != nil {
+		ri, _ := RuneInfoSource.Get(r)
+		return ri
+	}
+
+	return RuneInfos[r]
+}
+
 type GlyphRendOpt uint64
 
 const (
@@ -39,18 +66,47 @@ const (
 
 type GlyphRendOptValues struct {
 	BgColor *gglm.Vec4
+
+	// FgColor is used by draw calls that pass a nil color
+	FgColor *gglm.Vec4
+}
+
+// GlyphRendOpts are the options applied by GlyphRend.SetOptions. Nil fields are left unchanged
+type GlyphRendOpts struct {
+	BgColor *gglm.Vec4
+	FgColor *gglm.Vec4
 }
 
 type GlyphRend struct {
 	Atlas    *FontAtlas
 	AtlasTex *assets.Texture
 
+	// BoldAtlas, ItalicAtlas and BoldItalicAtlas are optional style variants of Atlas used when DrawBold/DrawItalic are set.
+	// A missing bold variant is replaced by synthetic bold, and a missing italic variant by the upright font
+	BoldAtlas       *FontAtlas
+	ItalicAtlas     *FontAtlas
+	BoldItalicAtlas *FontAtlas
+
+	// FallbackFonts are searched in order for glyphs missing from Atlas.
+	//
+	// Fallback glyphs are always drawn using the line height of Atlas so they stay aligned with the rest of the text
+	FallbackFonts []*FontAtlas
+
+	// All atlases are packed into one texture, and atlasVOffsets has the V offset of each atlas other than Atlas within it
+	atlasVOffsets map[*FontAtlas]float32
+
 	GlyphMesh           *meshes.Mesh
 	GlyphFgInstancedBuf buffers.Buffer
 	GlyphBgInstancedBuf buffers.Buffer
 	GlyphMat            *materials.Material
 	TextRunsBuf         []TextRun
 
+	// runeBuf is reused by DrawBytesOpenGLAbs to decode utf-8 text without allocating every call
+	runeBuf []rune
+
+	// singleRuneBuf holds the rune drawn by DrawRune so it can be put in a TextRun without allocating
+	singleRuneBuf [1]rune
+
 	//Luckily slices still work with go-opengl, so for now we will use our slice as an array (no appending)
 	GlyphFgCount uint32
 	GlyphFgVBO   []float32
@@ -61,12 +117,40 @@ type GlyphRend struct {
 	ScreenWidth  int32
 	ScreenHeight int32
 
-	SpacesPerTab uint
+	// TabStops are the sorted columns tabs move to. Columns after the last tab stop use a tab stop
+	// every TabStopInterval columns. See NextTabStop
+	TabStops        []int
+	TabStopInterval int
+
+	// TabOriginX is the screen x position of column zero when finding tab stops, which is where the text starts
+	// (e.g. after the pane offset, the padding and the line number gutter)
+	TabOriginX float32
+
+	// DrawBold and DrawItalic select the style variant used for drawn glyphs (see AtlasForStyle).
+	// Synthetic bold draws each glyph twice, with the second copy moved right by BoldOffsetX
+	DrawBold    bool
+	DrawItalic  bool
+	BoldOffsetX float32
 
 	Opts      GlyphRendOpt
 	OptValues GlyphRendOptValues
+
+	Stats GlyphRendStats
 }
 
+// GlyphRendStats are counted over all Draw calls since the last ResetStats call
+type GlyphRendStats struct {
+	DrawCalls uint32
+	FgGlyphs  uint32
+	BgGlyphs  uint32
+}
+
+func (gr *GlyphRend) ResetStats() {
+	gr.Stats = GlyphRendStats{}
+}
+
+// Deprecated: Use SetOptions, which sets option values together with their opts so
+// they are never out of sync
 func (gr *GlyphRend) SetOpts(opts ...GlyphRendOpt) {
 
 	for _, v := range opts {
@@ -82,6 +166,27 @@ func (gr *GlyphRend) SetOpts(opts ...GlyphRendOpt) {
 	gl.ProgramUniform1ui(gr.GlyphMat.ShaderProg.ID, gr.GlyphMat.GetUnifLoc("opts1"), uint32(gr.Opts))
 }
 
+// SetOptions copies the non-nil values of opts into OptValues and enables their matching opts in one call.
+// The values are copied, so changing them after the call has no effect
+func (gr *GlyphRend) SetOptions(opts GlyphRendOpts) {
+
+	newOpts := gr.Opts
+	if opts.BgColor != nil {
+		gr.OptValues.BgColor.Data = opts.BgColor.Data
+		newOpts |= GlyphRendOpt_BgColor
+	}
+
+	if opts.FgColor != nil {
+		gr.OptValues.FgColor.Data = opts.FgColor.Data
+	}
+
+	// This is called per drawn tile, so we only update the uniform when opts change
+	if newOpts != gr.Opts {
+		gr.Opts = newOpts
+		gl.ProgramUniform1ui(gr.GlyphMat.ShaderProg.ID, gr.GlyphMat.GetUnifLoc("opts1"), uint32(gr.Opts))
+	}
+}
+
 func (gr *GlyphRend) HasOpt(opt GlyphRendOpt) bool {
 	return gr.Opts&opt != 0
 }
@@ -175,6 +280,43 @@ func (gr *GlyphRend) DrawTextOpenGLAbs(text []rune, startPos *gglm.Vec3, color *
 	return *drawPos
 }
 
+// DrawBytesOpenGLAbs is like DrawTextOpenGLAbs but takes utf-8 text, which is decoded into a buffer
+// owned by the GlyphRend so no allocations are needed once the buffer is big enough.
+// Like bytesToRunes in package main, decoding stops at the first invalid utf-8 sequence
+func (gr *GlyphRend) DrawBytesOpenGLAbs(text []byte, startPos *gglm.Vec3, color *gglm.Vec4) gglm.Vec3 {
+
+	gr.runeBuf = gr.runeBuf[:0]
+	for len(text) > 0 {
+
+		r, size := utf8.DecodeRune(text)
+		if r == utf8.RuneError {
+			break
+		}
+
+		gr.runeBuf = append(gr.runeBuf, r)
+		text = text[size:]
+	}
+
+	return gr.DrawTextOpenGLAbs(gr.runeBuf, startPos, color)
+}
+
+// DrawRune prepares a single rune that will be drawn on the next GlyphRend.Draw call, and returns the position after it.
+// Unlike the DrawText functions it doesn't allocate, but it also doesn't move to a new line on '\n' or wrap at the screen edge,
+// so callers drawing many runes must position them (e.g. DrawGlyphGrid, which draws one tile at a time).
+// pos is in the range ([0,ScreenWidth],[0,ScreenHeight]) where (0,0) is bottom left.
+// Color is RGBA in the range [0,1].
+func (gr *GlyphRend) DrawRune(r rune, pos *gglm.Vec3, color *gglm.Vec4) gglm.Vec3 {
+
+	gr.singleRuneBuf[0] = r
+	run := TextRun{Runes: gr.singleRuneBuf[:], IsLtr: true}
+
+	drawPos := *pos
+	fgBufIndex, bgBufIndex := gr.getFgAndBgBufIndices()
+	gr.drawRune(&run, 0, invalidRune, &drawPos, color, float32(gr.Atlas.LineHeight), &fgBufIndex, &bgBufIndex)
+
+	return drawPos
+}
+
 func (gr *GlyphRend) DrawTextOpenGLAbsRect(text []rune, rectTopLeft *gglm.Vec3, rectBotRight *gglm.Vec2, color *gglm.Vec4) gglm.Vec3 {
 
 	runs := gr.TextRunsBuf[:]
@@ -312,6 +454,35 @@ func (gr *GlyphRend) getFgAndBgBufIndices() (fgBufIndex, bgBufIndex uint32) {
 // @Debug
 var PrintPositions bool
 
+// NextTabStop returns the column of the first tab stop after currentCol
+func (gr *GlyphRend) NextTabStop(currentCol int) int {
+
+	for _, tabStop := range gr.TabStops {
+		if tabStop > currentCol {
+			return tabStop
+		}
+	}
+
+	if gr.TabStopInterval <= 0 {
+		return currentCol + 1
+	}
+
+	return (currentCol/gr.TabStopInterval + 1) * gr.TabStopInterval
+}
+
+// SetTabStops replaces the current tab stops with the passed columns. Columns after the last
+// passed tab stop still use a tab stop every TabStopInterval columns
+func (gr *GlyphRend) SetTabStops(positions ...int) {
+	gr.TabStops = append(gr.TabStops[:0], positions...)
+	sort.Ints(gr.TabStops)
+}
+
+// ResetTabStops removes all set tab stops and uses a tab stop every 'interval' columns
+func (gr *GlyphRend) ResetTabStops(interval int) {
+	gr.TabStops = gr.TabStops[:0]
+	gr.TabStopInterval = interval
+}
+
 func (gr *GlyphRend) GridSize() (w, h int64) {
 	w = int64(gr.ScreenWidth) / int64(gr.Atlas.SpaceAdvance)
 	h = int64(gr.ScreenHeight) / int64(gr.Atlas.LineHeight)
@@ -328,26 +499,36 @@ func (gr *GlyphRend) drawRune(run *TextRun, i int, prevRune rune, pos *gglm.Vec3
 
 	r := run.Runes[i]
 	if r == '\t' {
-		pos.AddX(gr.Atlas.SpaceAdvance * float32(gr.SpacesPerTab))
+		currCol := int(floorF32((pos.X() - gr.TabOriginX) / gr.Atlas.SpaceAdvance))
+		pos.AddX(gr.Atlas.SpaceAdvance * float32(gr.NextTabStop(currCol)-currCol))
 		return
 	}
 
+	if IsZeroWidthFormat(r) {
+		return
+	}
+
+	// Combining marks are drawn over the previous char, so they don't get a background or move the position
+	isCombiningMark := IsCombiningMark(r)
+
+	atlas, syntheticBold := gr.AtlasForStyle(gr.DrawBold, gr.DrawItalic)
+
 	var g FontAtlasGlyph
 	if run.IsLtr {
 		if i < len(run.Runes)-1 {
 			//start or middle of sentence
-			g = GlyphFromRunes(gr.Atlas.Glyphs, r, prevRune, run.Runes[i+1])
+			g = gr.glyphFromRunes(atlas, r, prevRune, run.Runes[i+1])
 		} else {
 			//Last character
-			g = GlyphFromRunes(gr.Atlas.Glyphs, r, prevRune, invalidRune)
+			g = gr.glyphFromRunes(atlas, r, prevRune, invalidRune)
 		}
 	} else {
 		if i > 0 {
 			//start or middle of sentence
-			g = GlyphFromRunes(gr.Atlas.Glyphs, r, run.Runes[i-1], prevRune)
+			g = gr.glyphFromRunes(atlas, r, run.Runes[i-1], prevRune)
 		} else {
 			//Last character
-			g = GlyphFromRunes(gr.Atlas.Glyphs, r, invalidRune, prevRune)
+			g = gr.glyphFromRunes(atlas, r, invalidRune, prevRune)
 		}
 	}
 
@@ -365,42 +546,96 @@ func (gr *GlyphRend) drawRune(run *TextRun, i int, prevRune rune, pos *gglm.Vec3
 	}
 
 	//Add the glyph information to the vbo
-	if gr.HasOpt(GlyphRendOpt_BgColor) {
-		// UV
-		gr.GlyphBgVBO[*glyphBgBufIndex+0] = -1
-		gr.GlyphBgVBO[*glyphBgBufIndex+1] = -1
-		*glyphBgBufIndex += 2
-
-		//UVSize
-		gr.GlyphBgVBO[*glyphBgBufIndex+0] = 0
-		gr.GlyphBgVBO[*glyphBgBufIndex+1] = 0
-		*glyphBgBufIndex += 2
-
-		//Color
-		gr.GlyphBgVBO[*glyphBgBufIndex+0] = gr.OptValues.BgColor.R()
-		gr.GlyphBgVBO[*glyphBgBufIndex+1] = gr.OptValues.BgColor.G()
-		gr.GlyphBgVBO[*glyphBgBufIndex+2] = gr.OptValues.BgColor.B()
-		gr.GlyphBgVBO[*glyphBgBufIndex+3] = gr.OptValues.BgColor.A()
-		*glyphBgBufIndex += 4
-
-		//Model Pos
-		gr.GlyphBgVBO[*glyphBgBufIndex+0] = pos.X()
-		gr.GlyphBgVBO[*glyphBgBufIndex+1] = pos.Y()
-		gr.GlyphBgVBO[*glyphBgBufIndex+2] = pos.Z()
-		*glyphBgBufIndex += 3
-
-		//Model Scale
-		gr.GlyphBgVBO[*glyphBgBufIndex+0] = gr.Atlas.SpaceAdvance
-		gr.GlyphBgVBO[*glyphBgBufIndex+1] = lineHeightF32
-		*glyphBgBufIndex += 2
-
-		gr.GlyphBgCount++
-		if gr.GlyphBgCount == DefaultGlyphsPerBatch {
-			gr.Draw()
-			*glyphBgBufIndex = 0
+	if gr.HasOpt(GlyphRendOpt_BgColor) && !isCombiningMark {
+		gr.writeBgQuad(pos, lineHeightF32, glyphBgBufIndex)
+	}
+
+	gr.writeFgGlyph(g, &drawPos, color, glyphFgBufIndex)
+	if syntheticBold {
+		drawPos.AddX(gr.BoldOffsetX)
+		gr.writeFgGlyph(g, &drawPos, color, glyphFgBufIndex)
+	}
+
+	if !isCombiningMark {
+		pos.AddX(g.Advance)
+	}
+}
+
+// writeBgQuad adds a background quad of one cell at pos, and issues a draw call if the buffer is full.
+//
+// Rows often have long runs of cells with the same bg color, so if the last bg quad has the same color and height and ends
+// where this one starts then it is stretched over this cell instead, and the whole run takes a single instance
+func (gr *GlyphRend) writeBgQuad(pos *gglm.Vec3, lineHeightF32 float32, glyphBgBufIndex *uint32) {
+
+	if gr.GlyphBgCount > 0 && *glyphBgBufIndex >= floatsPerGlyph {
+
+		// Color starts at 4, model pos at 8 and model scale at 11
+		last := gr.GlyphBgVBO[*glyphBgBufIndex-floatsPerGlyph : *glyphBgBufIndex]
+		bgColor := gr.OptValues.BgColor
+		if last[4] == bgColor.R() && last[5] == bgColor.G() && last[6] == bgColor.B() && last[7] == bgColor.A() &&
+			last[9] == pos.Y() && last[10] == pos.Z() && last[12] == lineHeightF32 &&
+			absF32(last[8]+last[11]-pos.X()) < bgRunMergeEpsilon {
+
+			last[11] = pos.X() + gr.Atlas.SpaceAdvance - last[8]
+			return
 		}
 	}
 
+	// UV
+	gr.GlyphBgVBO[*glyphBgBufIndex+0] = -1
+	gr.GlyphBgVBO[*glyphBgBufIndex+1] = -1
+	*glyphBgBufIndex += 2
+
+	//UVSize
+	gr.GlyphBgVBO[*glyphBgBufIndex+0] = 0
+	gr.GlyphBgVBO[*glyphBgBufIndex+1] = 0
+	*glyphBgBufIndex += 2
+
+	//Color
+	gr.GlyphBgVBO[*glyphBgBufIndex+0] = gr.OptValues.BgColor.R()
+	gr.GlyphBgVBO[*glyphBgBufIndex+1] = gr.OptValues.BgColor.G()
+	gr.GlyphBgVBO[*glyphBgBufIndex+2] = gr.OptValues.BgColor.B()
+	gr.GlyphBgVBO[*glyphBgBufIndex+3] = gr.OptValues.BgColor.A()
+	*glyphBgBufIndex += 4
+
+	//Model Pos
+	gr.GlyphBgVBO[*glyphBgBufIndex+0] = pos.X()
+	gr.GlyphBgVBO[*glyphBgBufIndex+1] = pos.Y()
+	gr.GlyphBgVBO[*glyphBgBufIndex+2] = pos.Z()
+	*glyphBgBufIndex += 3
+
+	//Model Scale
+	gr.GlyphBgVBO[*glyphBgBufIndex+0] = gr.Atlas.SpaceAdvance
+	gr.GlyphBgVBO[*glyphBgBufIndex+1] = lineHeightF32
+	*glyphBgBufIndex += 2
+
+	gr.GlyphBgCount++
+	if gr.GlyphBgCount == MaxGlyphsPerBatch {
+		gr.Draw()
+		*glyphBgBufIndex = 0
+	}
+}
+
+// DrawBoldGlyph prepares a synthetic bold glyph that will be drawn on the next GlyphRend.Draw call.
+// The glyph is drawn twice, once at pos and once moved right by BoldOffsetX.
+//
+// pos is the bottom left of the glyph quad, so bearing and descent adjustments must already be applied
+func (gr *GlyphRend) DrawBoldGlyph(g FontAtlasGlyph, pos gglm.Vec3, color gglm.Vec4) {
+
+	fgBufIndex, _ := gr.getFgAndBgBufIndices()
+	gr.writeFgGlyph(g, &pos, &color, &fgBufIndex)
+
+	pos.AddX(gr.BoldOffsetX)
+	gr.writeFgGlyph(g, &pos, &color, &fgBufIndex)
+}
+
+// writeFgGlyph adds one glyph instance to the foreground vbo, and issues a draw call if the buffer is full
+func (gr *GlyphRend) writeFgGlyph(g FontAtlasGlyph, drawPos *gglm.Vec3, color *gglm.Vec4, glyphFgBufIndex *uint32) {
+
+	if color == nil {
+		color = gr.OptValues.FgColor
+	}
+
 	//UV
 	gr.GlyphFgVBO[*glyphFgBufIndex+0] = g.U
 	gr.GlyphFgVBO[*glyphFgBufIndex+1] = g.V
@@ -429,16 +664,22 @@ func (gr *GlyphRend) drawRune(run *TextRun, i int, prevRune rune, pos *gglm.Vec3
 	gr.GlyphFgVBO[*glyphFgBufIndex+1] = g.SizeV
 	*glyphFgBufIndex += 2
 
-	pos.AddX(g.Advance)
-
 	//If we fill the buffer we issue a draw call
 	gr.GlyphFgCount++
-	if gr.GlyphFgCount == DefaultGlyphsPerBatch {
+	if gr.GlyphFgCount == MaxGlyphsPerBatch {
 		gr.Draw()
 		*glyphFgBufIndex = 0
 	}
 }
 
+func absF32(x float32) float32 {
+	if x < 0 {
+		return -x
+	}
+
+	return x
+}
+
 // func roundF32(x float32) float32 {
 // 	return float32(math.Round(float64(x)))
 // }
@@ -463,7 +704,7 @@ func (gr *GlyphRend) GetTextRuns(rs []rune, textRunsBuf *[]TextRun) {
 	}
 
 	runs := textRunsBuf
-	currRunScript := RuneInfos[rs[0]].ScriptTable
+	currRunScript := runeInfo(rs[0]).ScriptTable
 
 	//TODO: We need to detect neutral characters through BiDi category, not being in common
 	//TODO: Diacritics go into things like 'Category_Mn' and don't necessairly follow the parent script (e.g. Arabic diacritics are NOT in unicode.Arabic).
@@ -472,7 +713,7 @@ func (gr *GlyphRend) GetTextRuns(rs []rune, textRunsBuf *[]TextRun) {
 	for i := 1; i < len(rs); i++ {
 
 		r := rs[i]
-		ri := RuneInfos[r]
+		ri := runeInfo(r)
 		//A run is a set of characters using the same script (and other metrics) minus leading/trailing neutral characters
 		if ri.ScriptTable == currRunScript || ri.ScriptTable == unicode.Common {
 			continue
@@ -511,7 +752,7 @@ func (gr *GlyphRend) GetTextRuns(rs []rune, textRunsBuf *[]TextRun) {
 		bidiCat := BidiCategory_L
 		for _, r := range run.Runes {
 			if !unicode.Is(unicode.Common, r) {
-				bidiCat = RuneInfos[r].BidiCat
+				bidiCat = runeInfo(r).BidiCat
 				break
 			}
 		}
@@ -519,6 +760,70 @@ func (gr *GlyphRend) GetTextRuns(rs []rune, textRunsBuf *[]TextRun) {
 	}
 }
 
+// glyphFromRunes is like GlyphFromRunes but searches the fallback fonts if the glyph is not in the main atlas
+func (gr *GlyphRend) glyphFromRunes(atlas *FontAtlas, curr, prev, next rune) FontAtlasGlyph {
+
+	// Missing glyphs are zero valued. We don't check for a zero size because some glyphs (e.g. space) are empty
+	g := GlyphFromRunes(atlas.Glyphs, curr, prev, next)
+	if g.Rune != 0 || curr == 0 {
+		g.V += gr.atlasVOffsets[atlas]
+		return g
+	}
+
+	// Style variants might have fewer glyphs than the main font
+	if atlas != gr.Atlas {
+
+		g = GlyphFromRunes(gr.Atlas.Glyphs, curr, prev, next)
+		if g.Rune != 0 {
+			return g
+		}
+	}
+
+	for i := 0; i < len(gr.FallbackFonts); i++ {
+
+		fallbackG := GlyphFromRunes(gr.FallbackFonts[i].Glyphs, curr, prev, next)
+		if fallbackG.Rune == 0 {
+			continue
+		}
+
+		fallbackG.V += gr.atlasVOffsets[gr.FallbackFonts[i]]
+		return fallbackG
+	}
+
+	return g
+}
+
+// AtlasForStyle returns the atlas used to draw glyphs of the passed style, and whether
+// bold must be synthesized because there is no atlas with a bold variant
+func (gr *GlyphRend) AtlasForStyle(bold, italic bool) (atlas *FontAtlas, syntheticBold bool) {
+
+	if bold && italic {
+
+		if gr.BoldItalicAtlas != nil {
+			return gr.BoldItalicAtlas, false
+		}
+
+		if gr.ItalicAtlas != nil {
+			return gr.ItalicAtlas, true
+		}
+	}
+
+	if bold {
+
+		if gr.BoldAtlas != nil {
+			return gr.BoldAtlas, false
+		}
+
+		return gr.Atlas, true
+	}
+
+	if italic && gr.ItalicAtlas != nil {
+		return gr.ItalicAtlas, false
+	}
+
+	return gr.Atlas, false
+}
+
 // GlyphFromRunes does shaping where it selects the proper rune based (e.g. end Alef) on the surrounding runes
 func GlyphFromRunes(glyphTable map[rune]FontAtlasGlyph, curr, prev, next rune) FontAtlasGlyph {
 
@@ -540,17 +845,17 @@ func GlyphFromRunes(glyphTable map[rune]FontAtlasGlyph, curr, prev, next rune) F
 		return glyphTable[curr]
 	}
 
-	ri := RuneInfos[curr]
+	ri := runeInfo(curr)
 	if ri.JoinType == JoiningType_None || ri.JoinType == JoiningType_Transparent {
 		return glyphTable[curr]
 	}
 
-	prevJoinType := RuneInfos[prev].JoinType
+	prevJoinType := runeInfo(prev).JoinType
 	joinWithRight := prevIsValid &&
 		(prevJoinType == JoiningType_Dual || prevJoinType == JoiningType_Left || prevJoinType == JoiningType_Causing) &&
 		(ri.JoinType == JoiningType_Dual || ri.JoinType == JoiningType_Right)
 
-	nextJoinType := RuneInfos[next].JoinType
+	nextJoinType := runeInfo(next).JoinType
 	joinWithLeft := nextIsValid &&
 		(nextJoinType == JoiningType_Dual || nextJoinType == JoiningType_Right || nextJoinType == JoiningType_Causing) &&
 		(ri.JoinType == JoiningType_Dual || ri.JoinType == JoiningType_Left)
@@ -573,7 +878,7 @@ func GlyphFromRunes(glyphTable map[rune]FontAtlasGlyph, curr, prev, next rune) F
 		for i := 0; i < len(ri.EquivalentRunes); i++ {
 
 			otherRune := ri.EquivalentRunes[i]
-			otherDecompTag := RuneInfos[otherRune].DecompTag
+			otherDecompTag := runeInfo(otherRune).DecompTag
 			if otherDecompTag == DecompTag_initial {
 				curr = otherRune
 				break
@@ -585,7 +890,7 @@ func GlyphFromRunes(glyphTable map[rune]FontAtlasGlyph, curr, prev, next rune) F
 		for i := 0; i < len(ri.EquivalentRunes); i++ {
 
 			otherRune := ri.EquivalentRunes[i]
-			otherDecompTag := RuneInfos[otherRune].DecompTag
+			otherDecompTag := runeInfo(otherRune).DecompTag
 			if otherDecompTag == DecompTag_medial {
 				curr = otherRune
 				break
@@ -597,7 +902,7 @@ func GlyphFromRunes(glyphTable map[rune]FontAtlasGlyph, curr, prev, next rune) F
 		for i := 0; i < len(ri.EquivalentRunes); i++ {
 
 			otherRune := ri.EquivalentRunes[i]
-			otherDecompTag := RuneInfos[otherRune].DecompTag
+			otherDecompTag := runeInfo(otherRune).DecompTag
 			if otherDecompTag == DecompTag_final {
 				curr = otherRune
 				break
@@ -628,6 +933,8 @@ func (gr *GlyphRend) Draw() {
 		gl.BufferSubData(gl.ARRAY_BUFFER, 0, int(gr.GlyphBgCount*floatsPerGlyph)*4, gl.Ptr(&gr.GlyphBgVBO[:gr.GlyphBgCount*floatsPerGlyph][0]))
 
 		gl.DrawElementsInstanced(gl.TRIANGLES, gr.GlyphBgInstancedBuf.IndexBufCount, gl.UNSIGNED_INT, gl.PtrOffset(0), int32(gr.GlyphBgCount))
+		gr.Stats.DrawCalls++
+		gr.Stats.BgGlyphs += gr.GlyphBgCount
 		gr.GlyphBgCount = 0
 	}
 
@@ -637,6 +944,8 @@ func (gr *GlyphRend) Draw() {
 		gl.BufferSubData(gl.ARRAY_BUFFER, 0, int(gr.GlyphFgCount*floatsPerGlyph)*4, gl.Ptr(&gr.GlyphFgVBO[:gr.GlyphFgCount*floatsPerGlyph][0]))
 
 		gl.DrawElementsInstanced(gl.TRIANGLES, gr.GlyphFgInstancedBuf.IndexBufCount, gl.UNSIGNED_INT, gl.PtrOffset(0), int32(gr.GlyphFgCount))
+		gr.Stats.DrawCalls++
+		gr.Stats.FgGlyphs += gr.GlyphFgCount
 		gr.GlyphFgCount = 0
 	}
 
@@ -653,11 +962,52 @@ func (gr *GlyphRend) SetFace(fontOptions *truetype.Options) error {
 		return err
 	}
 
+	newFallbacks := make([]*FontAtlas, len(gr.FallbackFonts))
+	for i, fallback := range gr.FallbackFonts {
+
+		newFallbacks[i], err = atlasWithNewFace(fallback, fontOptions)
+		if err != nil {
+			return err
+		}
+	}
+
+	newBold, err := atlasWithNewFace(gr.BoldAtlas, fontOptions)
+	if err != nil {
+		return err
+	}
+
+	newItalic, err := atlasWithNewFace(gr.ItalicAtlas, fontOptions)
+	if err != nil {
+		return err
+	}
+
+	newBoldItalic, err := atlasWithNewFace(gr.BoldItalicAtlas, fontOptions)
+	if err != nil {
+		return err
+	}
+
 	gr.Atlas = newAtlas
+	gr.FallbackFonts = newFallbacks
+	gr.BoldAtlas = newBold
+	gr.ItalicAtlas = newItalic
+	gr.BoldItalicAtlas = newBoldItalic
+	gr.BoldOffsetX = DefaultBoldOffsetX(gr.Atlas)
 	gr.updateFontAtlasTexture()
 	return nil
 }
 
+// atlasWithNewFace creates a new atlas using the font of the passed atlas. Returns nil if the passed atlas is nil
+func atlasWithNewFace(atlas *FontAtlas, fontOptions *truetype.Options) (*FontAtlas, error) {
+
+	if atlas == nil {
+		return nil, nil
+	}
+
+	face := truetype.NewFace(atlas.Font, fontOptions)
+	return NewFontAtlasFromFont(atlas.Font, face, uint(fontOptions.Size))
+}
+
+// SetFontFromFile replaces the main font of the glyph renderer. Fallback fonts are kept as is
 func (gr *GlyphRend) SetFontFromFile(fontFile string, fontOptions *truetype.Options) error {
 
 	atlas, err := NewFontAtlasFromFile(fontFile, fontOptions)
@@ -666,10 +1016,85 @@ func (gr *GlyphRend) SetFontFromFile(fontFile string, fontOptions *truetype.Opti
 	}
 
 	gr.Atlas = atlas
+	gr.BoldOffsetX = DefaultBoldOffsetX(gr.Atlas)
 	gr.updateFontAtlasTexture()
 	return nil
 }
 
+// SetFallbackFontsFromFiles creates atlases for the passed fonts and uses them (in order) to draw glyphs
+// that are missing from the main font. Any existing fallback fonts are replaced
+func (gr *GlyphRend) SetFallbackFontsFromFiles(fontOptions *truetype.Options, fontFiles ...string) error {
+
+	fallbacks := make([]*FontAtlas, len(fontFiles))
+	for i := 0; i < len(fontFiles); i++ {
+
+		atlas, err := NewFontAtlasFromFile(fontFiles[i], fontOptions)
+		if err != nil {
+			return err
+		}
+
+		fallbacks[i] = atlas
+	}
+
+	gr.FallbackFonts = fallbacks
+	return gr.updateFontAtlasTexture()
+}
+
+// extraAtlases returns all atlases other than the main one (i.e. style variants and fallbacks)
+func (gr *GlyphRend) extraAtlases() []*FontAtlas {
+
+	atlases := make([]*FontAtlas, 0, 3+len(gr.FallbackFonts))
+	for _, atlas := range []*FontAtlas{gr.BoldAtlas, gr.ItalicAtlas, gr.BoldItalicAtlas} {
+		if atlas != nil {
+			atlases = append(atlases, atlas)
+		}
+	}
+
+	return append(atlases, gr.FallbackFonts...)
+}
+
+// atlasTextureImg returns the image of the main atlas if there are no other atlases, otherwise it returns
+// a new image with all atlases stacked vertically, with the main atlas at the bottom so its V values stay the same.
+//
+// The V offset of each extra atlas within the returned image is stored in gr.atlasVOffsets
+func (gr *GlyphRend) atlasTextureImg() *image.RGBA {
+
+	gr.atlasVOffsets = map[*FontAtlas]float32{}
+	extraAtlases := gr.extraAtlases()
+	if len(extraAtlases) == 0 {
+		return gr.Atlas.Img
+	}
+
+	width := gr.Atlas.Img.Rect.Dx()
+	height := gr.Atlas.Img.Rect.Dy()
+	for _, extra := range extraAtlases {
+
+		if extra.Img.Rect.Dx() > width {
+			width = extra.Img.Rect.Dx()
+		}
+
+		height += extra.Img.Rect.Dy()
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.Black, image.Point{}, draw.Src)
+
+	// V is measured from the bottom of the image, so an atlas drawn at imgY (measured from the top) gets a V offset
+	// equal to the number of pixels under it
+	imgY := 0
+	for _, extra := range extraAtlases {
+
+		extraHeight := extra.Img.Rect.Dy()
+		draw.Draw(img, image.Rect(0, imgY, extra.Img.Rect.Dx(), imgY+extraHeight), extra.Img, image.Point{}, draw.Src)
+
+		gr.atlasVOffsets[extra] = float32(height - imgY - extraHeight)
+		imgY += extraHeight
+	}
+
+	draw.Draw(img, image.Rect(0, imgY, gr.Atlas.Img.Rect.Dx(), height), gr.Atlas.Img, image.Point{}, draw.Src)
+	return img
+}
+
 // updateFontAtlasTexture uploads the texture representing the font atlas to the GPU
 // and updates the GlyphRend.AtlasTex field.
 //
@@ -682,7 +1107,7 @@ func (gr *GlyphRend) updateFontAtlasTexture() error {
 		gr.AtlasTex = nil
 	}
 
-	atlasTex, err := assets.LoadTextureInMemPngImg(gr.Atlas.Img, nil)
+	atlasTex, err := assets.LoadTextureInMemPngImg(gr.atlasTextureImg(), nil)
 	if err != nil {
 		return err
 	}
@@ -701,6 +1126,14 @@ func (gr *GlyphRend) updateFontAtlasTexture() error {
 	return nil
 }
 
+// DefaultBoldOffsetX returns a bold offset that scales with the font size. A small fraction of the advance only
+// thickens the stems, while larger offsets (e.g. half the advance) draw a visible second copy that bleeds into the
+// next cell. Positions are floored to whole pixels when drawing, so the offset is never less than one pixel
+// otherwise bold would have no effect on small fonts
+func DefaultBoldOffsetX(atlas *FontAtlas) float32 {
+	return float32(math.Max(1, float64(atlas.SpaceAdvance)/12))
+}
+
 func (gr *GlyphRend) SetScreenSize(screenWidth, screenHeight int32) {
 
 	gr.ScreenWidth = screenWidth
@@ -713,28 +1146,137 @@ func (gr *GlyphRend) SetScreenSize(screenWidth, screenHeight int32) {
 	gr.GlyphMat.SetUnifMat4("projViewMat", projViewMtx)
 }
 
-func NewGlyphRend(fontFile string, fontOptions *truetype.Options, screenWidth, screenHeight int32) (*GlyphRend, error) {
+// newGlyphRendConfig holds the optional settings of the NewGlyphRend functions, and is filled by NewGlyphRendOpt functions
+type newGlyphRendConfig struct {
+	FallbackFontFiles  []string
+	BoldFontFile       string
+	ItalicFontFile     string
+	BoldItalicFontFile string
+}
 
-	var err error
-	if RuneInfos == nil {
-		RuneInfos, err = ParseUnicodeData("./unicode-data-13.txt", "./arabic-shaping-13.txt")
-		if err != nil {
-			return nil, err
-		}
+type NewGlyphRendOpt func(cfg *newGlyphRendConfig)
+
+// WithFallbackFonts searches the passed fonts in order for glyphs missing from the main font
+func WithFallbackFonts(fontFiles ...string) NewGlyphRendOpt {
+	return func(cfg *newGlyphRendConfig) {
+		cfg.FallbackFontFiles = append(cfg.FallbackFontFiles, fontFiles...)
+	}
+}
+
+// WithBoldFont uses the passed font for bold text instead of synthetic bold
+func WithBoldFont(fontFile string) NewGlyphRendOpt {
+	return func(cfg *newGlyphRendConfig) {
+		cfg.BoldFontFile = fontFile
 	}
+}
+
+func WithItalicFont(fontFile string) NewGlyphRendOpt {
+	return func(cfg *newGlyphRendConfig) {
+		cfg.ItalicFontFile = fontFile
+	}
+}
 
+func WithBoldItalicFont(fontFile string) NewGlyphRendOpt {
+	return func(cfg *newGlyphRendConfig) {
+		cfg.BoldItalicFontFile = fontFile
+	}
+}
+
+// NewGlyphRend creates a glyph renderer that uses fontFile as its main font. Style variants and fallback fonts
+// can be added using the With* options (e.g. WithBoldFont)
+func NewGlyphRend(fontFile string, fontOptions *truetype.Options, screenWidth, screenHeight int32, opts ...NewGlyphRendOpt) (*GlyphRend, error) {
+
+	err := loadDefaultRuneInfos()
+	if err != nil {
+		return nil, err
+	}
+
+	fontBytes, err := os.ReadFile(fontFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return newGlyphRend(fontBytes, fontOptions, screenWidth, screenHeight, opts)
+}
+
+// NewGlyphRendFromBytes is like NewGlyphRend but takes the contents of the font file,
+// which is useful when the font is embedded
+func NewGlyphRendFromBytes(fontBytes []byte, fontOptions *truetype.Options, screenWidth, screenHeight int32, opts ...NewGlyphRendOpt) (*GlyphRend, error) {
+
+	err := loadDefaultRuneInfos()
+	if err != nil {
+		return nil, err
+	}
+
+	return newGlyphRend(fontBytes, fontOptions, screenWidth, screenHeight, opts)
+}
+
+// NewGlyphRendWithUnicodeData is like NewGlyphRendFromBytes but also takes the contents of the unicode data
+// and arabic shaping files instead of loading them from the working directory. RuneInfos is replaced by the passed data
+func NewGlyphRendWithUnicodeData(fontBytes, unicodeBytes, arabicBytes []byte, fontOptions *truetype.Options, screenWidth, screenHeight int32, opts ...NewGlyphRendOpt) (*GlyphRend, error) {
+
+	runeInfos, err := ParseUnicodeDataFromBytes(unicodeBytes, arabicBytes)
+	if err != nil {
+		return nil, err
+	}
+	RuneInfos = runeInfos
+	RuneInfoSource = nil
+
+	return newGlyphRend(fontBytes, fontOptions, screenWidth, screenHeight, opts)
+}
+
+// optionalFontAtlasFromFile returns nil if fontFile is empty, otherwise it is the same as NewFontAtlasFromFile
+func optionalFontAtlasFromFile(fontFile string, fontOptions *truetype.Options) (*FontAtlas, error) {
+
+	if fontFile == "" {
+		return nil, nil
+	}
+
+	return NewFontAtlasFromFile(fontFile, fontOptions)
+}
+
+// loadDefaultRuneInfos sets RuneInfoSource to lazily load the unicode data files in the working directory,
+// unless rune infos are loaded already
+func loadDefaultRuneInfos() error {
+
+	if RuneInfos != nil || RuneInfoSource != nil {
+		return nil
+	}
+
+	lazyRuneInfos, err := LazyRuneInfos("./unicode-data-13.txt", "./arabic-shaping-13.txt")
+	if err != nil {
+		return err
+	}
+
+	// Most text is Latin, which is mixed with Common runes like spaces and punctuation
+	lazyRuneInfos.PreloadScript(unicode.Latin)
+	lazyRuneInfos.PreloadScript(unicode.Common)
+
+	RuneInfoSource = lazyRuneInfos
+	return nil
+}
+
+func newGlyphRend(fontBytes []byte, fontOptions *truetype.Options, screenWidth, screenHeight int32, opts []NewGlyphRendOpt) (*GlyphRend, error) {
+
+	cfg := &newGlyphRendConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	var err error
 	gr := &GlyphRend{
 		GlyphFgCount: 0,
-		GlyphFgVBO:   make([]float32, floatsPerGlyph*DefaultGlyphsPerBatch),
+		GlyphFgVBO:   make([]float32, floatsPerGlyph*MaxGlyphsPerBatch),
 
-		GlyphBgCount: 0,
-		GlyphBgVBO:   make([]float32, floatsPerGlyph*DefaultGlyphsPerBatch),
-		TextRunsBuf:  make([]TextRun, 0, 20),
-		SpacesPerTab: 4,
+		GlyphBgCount:    0,
+		GlyphBgVBO:      make([]float32, floatsPerGlyph*MaxGlyphsPerBatch),
+		TextRunsBuf:     make([]TextRun, 0, 20),
+		TabStopInterval: DefaultTabStopInterval,
 
 		Opts: GlyphRendOpt_None,
 		OptValues: GlyphRendOptValues{
 			BgColor: gglm.NewVec4(0, 0, 0, 0),
+			FgColor: gglm.NewVec4(1, 1, 1, 1),
 		},
 	}
 
@@ -765,7 +1307,32 @@ func NewGlyphRend(fontFile string, fontOptions *truetype.Options, screenWidth, s
 	gr.GlyphMat = materials.NewMaterial("glyphMat", "./res/shaders/glyph.glsl")
 
 	//With the material ready we can generate the atlas
-	gr.Atlas, err = NewFontAtlasFromFile(fontFile, fontOptions)
+	gr.Atlas, err = NewFontAtlasFromBytes(fontBytes, fontOptions)
+	if err != nil {
+		return nil, err
+	}
+	gr.BoldOffsetX = DefaultBoldOffsetX(gr.Atlas)
+
+	gr.FallbackFonts = make([]*FontAtlas, len(cfg.FallbackFontFiles))
+	for i := 0; i < len(cfg.FallbackFontFiles); i++ {
+
+		gr.FallbackFonts[i], err = NewFontAtlasFromFile(cfg.FallbackFontFiles[i], fontOptions)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	gr.BoldAtlas, err = optionalFontAtlasFromFile(cfg.BoldFontFile, fontOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	gr.ItalicAtlas, err = optionalFontAtlasFromFile(cfg.ItalicFontFile, fontOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	gr.BoldItalicAtlas, err = optionalFontAtlasFromFile(cfg.BoldItalicFontFile, fontOptions)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,118 @@
+package glyphs
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// RuneInfoProvider gives the RuneInfo of runes. ok is false for runes with no info
+type RuneInfoProvider interface {
+	Get(r rune) (ri RuneInfo, ok bool)
+}
+
+var _ RuneInfoProvider = &LazyRuneInfoProvider{}
+
+// LazyRuneInfoProvider only parses the unicode data of a script the first time a rune of that script is requested,
+// which is much faster than parsing the whole file when only a few scripts (e.g. Latin) are used.
+//
+// EquivalentRunes of an info only has runes from loaded scripts, which is enough for things like Arabic shaping
+// where the equivalent runes are in the same script. It is safe to use from multiple goroutines
+type LazyRuneInfoProvider struct {
+	lines  []string
+	asInfo map[rune]ArabicShapingInfo
+
+	mutex         sync.RWMutex
+	ris           map[rune]RuneInfo
+	loadedScripts map[*unicode.RangeTable]struct{}
+
+	// missingRunes are runes without info in a loaded script (e.g. CJK ideographs, which are listed as ranges),
+	// and are remembered so we don't look up their script every time
+	missingRunes map[rune]struct{}
+}
+
+// LazyRuneInfos reads the unicode data files but doesn't parse rune infos until they are requested.
+// See ParseUnicodeData for the file formats
+func LazyRuneInfos(unicodeDataFile, arabicShapingFile string) (*LazyRuneInfoProvider, error) {
+
+	unicodeDataBytes, err := os.ReadFile(unicodeDataFile)
+	if err != nil {
+		return nil, err
+	}
+
+	arabicShapingBytes, err := os.ReadFile(arabicShapingFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return LazyRuneInfosFromBytes(unicodeDataBytes, arabicShapingBytes)
+}
+
+// LazyRuneInfosFromBytes is like LazyRuneInfos but takes the contents of the files instead of their paths
+func LazyRuneInfosFromBytes(unicodeData, arabicShaping []byte) (*LazyRuneInfoProvider, error) {
+
+	// The arabic shaping file is small so we parse it right away
+	asInfo, err := ParseArabicShapingFromBytes(arabicShaping)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LazyRuneInfoProvider{
+		lines:         strings.Split(string(unicodeData), "\n"),
+		asInfo:        asInfo,
+		ris:           map[rune]RuneInfo{},
+		loadedScripts: map[*unicode.RangeTable]struct{}{},
+		missingRunes:  map[rune]struct{}{},
+	}, nil
+}
+
+func (p *LazyRuneInfoProvider) Get(r rune) (ri RuneInfo, ok bool) {
+
+	p.mutex.RLock()
+	ri, ok = p.ris[r]
+	_, isMissing := p.missingRunes[r]
+	p.mutex.RUnlock()
+
+	// Loading a script can add the equivalent runes of runes in other scripts, which creates infos
+	// that only have EquivalentRunes set, so we still have to load the script of those
+	if ok && ri.ScriptTable != nil || isMissing {
+		return ri, ok
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	// Runes not in any script never have info (which is also the case with ParseUnicodeData)
+	script := ScriptTableFromRune(r)
+	if script != nil {
+		p.loadScript(script)
+	}
+
+	ri, ok = p.ris[r]
+	if !ok || ri.ScriptTable == nil {
+		p.missingRunes[r] = struct{}{}
+	}
+
+	return ri, ok
+}
+
+// PreloadScript parses the infos of all runes in script (e.g. unicode.Latin) now
+// instead of when the first rune of script is requested
+func (p *LazyRuneInfoProvider) PreloadScript(script *unicode.RangeTable) {
+
+	p.mutex.Lock()
+	p.loadScript(script)
+	p.mutex.Unlock()
+}
+
+// loadScript must be called with the write lock held
+func (p *LazyRuneInfoProvider) loadScript(script *unicode.RangeTable) {
+
+	if _, ok := p.loadedScripts[script]; ok {
+		return
+	}
+
+	parseUnicodeDataLines(p.ris, p.lines, p.asInfo, []*unicode.RangeTable{script})
+	p.loadedScripts[script] = struct{}{}
+}
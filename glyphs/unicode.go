@@ -184,6 +184,37 @@ type RuneInfo struct {
 //The latest file can be found at https://www.unicode.org/Public/UCD/latest/ucd/UnicodeData.txt
 func ParseUnicodeData(unicodeDataFile, arabicShapingFile string, rangesToLoad ...*unicode.RangeTable) (map[rune]RuneInfo, error) {
 
+	unicodeDataBytes, err := os.ReadFile(unicodeDataFile)
+	if err != nil {
+		return nil, err
+	}
+
+	arabicShapingBytes, err := os.ReadFile(arabicShapingFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseUnicodeDataFromBytes(unicodeDataBytes, arabicShapingBytes, rangesToLoad...)
+}
+
+// ParseUnicodeDataFromBytes is like ParseUnicodeData but takes the contents of the files instead of their paths,
+// which is useful when the files are embedded
+func ParseUnicodeDataFromBytes(unicodeData, arabicShaping []byte, rangesToLoad ...*unicode.RangeTable) (map[rune]RuneInfo, error) {
+
+	asInfo, err := ParseArabicShapingFromBytes(arabicShaping)
+	if err != nil {
+		return nil, err
+	}
+
+	ris := make(map[rune]RuneInfo)
+	parseUnicodeDataLines(ris, strings.Split(string(unicodeData), "\n"), asInfo, rangesToLoad)
+	return ris, nil
+}
+
+// parseUnicodeDataLines adds the infos of runes within rangesToLoad (or all runes if rangesToLoad is nil) to ris,
+// where lines are the lines of a 'UnicodeData' file
+func parseUnicodeDataLines(ris map[rune]RuneInfo, lines []string, asInfo map[rune]ArabicShapingInfo, rangesToLoad []*unicode.RangeTable) {
+
 	type field uint8
 	const (
 		field_codeValue         field = 0
@@ -203,41 +234,36 @@ func ParseUnicodeData(unicodeDataFile, arabicShapingFile string, rangesToLoad ..
 		field_titleCaseMap      field = 14
 	)
 
-	asInfo, err := ParseArabicShaping(arabicShapingFile)
-	if err != nil {
-		return nil, err
-	}
-
-	fBytes, err := os.ReadFile(unicodeDataFile)
-	if err != nil {
-		return nil, err
-	}
-
-	ris := make(map[rune]RuneInfo)
-	lines := strings.Split(string(fBytes), "\n")
 	for _, l := range lines {
 
-		fields := strings.SplitN(l, ";", 15)
-		r := runeFromHexCodeString(fields[field_codeValue])
+		if len(l) == 0 {
+			continue
+		}
+
+		// The code value is checked before splitting the line so skipped runes are cheap
+		r := runeFromHexCodeString(l[:strings.IndexByte(l, ';')])
 		if rangesToLoad != nil && !unicode.In(r, rangesToLoad...) {
 			continue
 		}
 
+		fields := strings.SplitN(l, ";", 15)
+
 		scriptTable := ScriptTableFromRune(r)
 		if scriptTable == nil {
 			continue
 		}
 
-		ri := ris[r]
-		ri = RuneInfo{
+		// Equivalent runes might already be added by previous runes, so we keep them
+		ri := RuneInfo{
 			Name:      fields[field_charName],
 			Cat:       categoryStringToCategory(fields[field_generalCategory]),
 			BidiCat:   bidiCategoryStringToBidiCategory(fields[field_bidiCategory]),
 			DecompTag: DecompTag_NONE,
 
 			//NOTE: This is not perfect (NamesList.txt notes some additional ligatures), but good enough :)
-			IsLigature:  strings.Contains(fields[field_charName], "LIGATURE"),
-			ScriptTable: scriptTable,
+			IsLigature:      strings.Contains(fields[field_charName], "LIGATURE"),
+			ScriptTable:     scriptTable,
+			EquivalentRunes: ris[r].EquivalentRunes,
 		}
 
 		//Handle join type
@@ -291,8 +317,6 @@ func ParseUnicodeData(unicodeDataFile, arabicShapingFile string, rangesToLoad ..
 
 		ris[r] = ri
 	}
-
-	return ris, nil
 }
 
 func runeFromHexCodeString(c string) rune {
@@ -876,6 +900,16 @@ type ArabicShapingInfo struct {
 
 func ParseArabicShaping(arabicShapingFile string) (map[rune]ArabicShapingInfo, error) {
 
+	fBytes, err := os.ReadFile(arabicShapingFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseArabicShapingFromBytes(fBytes)
+}
+
+func ParseArabicShapingFromBytes(arabicShaping []byte) (map[rune]ArabicShapingInfo, error) {
+
 	type field int
 	const (
 		field_codeValue    field = 0
@@ -884,13 +918,8 @@ func ParseArabicShaping(arabicShapingFile string) (map[rune]ArabicShapingInfo, e
 		field_joiningGroup field = 3
 	)
 
-	fBytes, err := os.ReadFile(arabicShapingFile)
-	if err != nil {
-		return nil, err
-	}
-
 	asInfo := map[rune]ArabicShapingInfo{}
-	lines := strings.Split(string(fBytes), "\n")
+	lines := strings.Split(string(arabicShaping), "\n")
 	for _, l := range lines {
 
 		if len(l) == 0 || l[0] == '#' {
@@ -925,3 +954,45 @@ func joiningTypeFromString(c string) JoiningType {
 		panic("unknown joining type string: " + c)
 	}
 }
+
+// RuneWidth returns how many terminal columns r takes. Combining marks (e.g. accents) and zero width chars (e.g. BOM) are zero
+// because they are drawn over the previous char, East Asian wide runes are two, and everything else is one
+func RuneWidth(r rune) int {
+
+	if IsZeroWidthFormat(r) || IsCombiningMark(r) {
+		return 0
+	}
+
+	return EastAsianWidth(r)
+}
+
+// IsCombiningMark returns true for non-spacing and enclosing marks (categories Mn and Me)
+func IsCombiningMark(r rune) bool {
+
+	// Marks only start after the latin ranges
+	if r < 0x0300 {
+		return false
+	}
+
+	if ri := runeInfo(r); ri.ScriptTable != nil {
+		return ri.Cat == Category_Mn || ri.Cat == Category_Me
+	}
+
+	// Rune infos might not be loaded or might not have this rune
+	return unicode.In(r, unicode.Mn, unicode.Me)
+}
+
+// IsZeroWidthFormat returns true for invisible format chars that take no space, like the zero width space and BOM
+func IsZeroWidthFormat(r rune) bool {
+
+	switch r {
+	case 0x200B, // Zero width space
+		0x200C, // Zero width non-joiner
+		0x200D, // Zero width joiner
+		0x2060, // Word joiner
+		0xFEFF: // Zero width no-break space (BOM)
+		return true
+	default:
+		return false
+	}
+}
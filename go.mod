@@ -7,12 +7,10 @@ require (
 	github.com/bloeys/nmage v0.16.3
 	github.com/go-gl/gl v0.0.0-20211210172815-726fda9656d6
 	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0
+	github.com/inkyblackness/imgui-go/v4 v4.6.0
 	github.com/veandco/go-sdl2 v0.4.25
 	golang.org/x/exp v0.0.0-20220706164943-b4a6d9510983
 	golang.org/x/image v0.0.0-20220617043117-41969df76e82
 )
 
-require (
-	github.com/bloeys/assimp-go v0.4.4 // indirect
-	github.com/inkyblackness/imgui-go/v4 v4.6.0 // indirect
-)
+require github.com/bloeys/assimp-go v0.4.4 // indirect
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"unicode"
+
+	"github.com/bloeys/gglm/gglm"
+)
+
+// Highlighter colors a single logical line of output that has no ansi codes
+type Highlighter interface {
+	// Highlight returns one tile per rune of line. The returned slice is only valid until the next call
+	Highlight(line []rune, defaultFg, defaultBg *gglm.Vec4) []GridTile
+}
+
+var (
+	_ Highlighter = &DefaultHighlighter{}
+	_ Highlighter = &GoHighlighter{}
+)
+
+// DefaultHighlighter colors string literals, numbers, and comments starting with '//' or '#'
+type DefaultHighlighter struct {
+	Settings *Settings
+	tiles    []GridTile
+}
+
+func (h *DefaultHighlighter) Highlight(line []rune, defaultFg, defaultBg *gglm.Vec4) []GridTile {
+	h.tiles = highlightLine(h.tiles, line, h.Settings, defaultFg, defaultBg, defaultCommentPrefixes, nil)
+	return h.tiles
+}
+
+// GoHighlighter is an example language specific highlighter. It is like DefaultHighlighter
+// but also colors Go keywords, and only treats '//' as a comment
+type GoHighlighter struct {
+	Settings *Settings
+	tiles    []GridTile
+}
+
+func (h *GoHighlighter) Highlight(line []rune, defaultFg, defaultBg *gglm.Vec4) []GridTile {
+	h.tiles = highlightLine(h.tiles, line, h.Settings, defaultFg, defaultBg, goCommentPrefixes, goKeywords)
+	return h.tiles
+}
+
+var (
+	defaultCommentPrefixes = [][]rune{[]rune("//"), []rune("#")}
+	goCommentPrefixes      = [][]rune{[]rune("//")}
+
+	goKeywords = map[string]struct{}{
+		"break": {}, "case": {}, "chan": {}, "const": {}, "continue": {}, "default": {}, "defer": {}, "else": {}, "fallthrough": {},
+		"for": {}, "func": {}, "go": {}, "goto": {}, "if": {}, "import": {}, "interface": {}, "map": {}, "package": {},
+		"range": {}, "return": {}, "select": {}, "struct": {}, "switch": {}, "type": {}, "var": {},
+	}
+)
+
+// highlightLine is shared by the highlighters and appends the tiles of line to tiles[:0]. Comments must start at the beginning
+// of the line or after whitespace so things like urls aren't treated as comments. Keywords are only checked if keywords isn't nil
+func highlightLine(tiles []GridTile, line []rune, s *Settings, defaultFg, defaultBg *gglm.Vec4, commentPrefixes [][]rune, keywords map[string]struct{}) []GridTile {
+
+	tiles = tiles[:0]
+	for i := 0; i < len(line); i++ {
+		tiles = append(tiles, GridTile{
+			Glyph:   line[i],
+			FgColor: *defaultFg,
+			BgColor: *defaultBg,
+		})
+	}
+
+	for i := 0; i < len(line); {
+
+		r := line[i]
+		afterSpace := i == 0 || unicode.IsSpace(line[i-1])
+		afterIdent := i > 0 && isIdentRune(line[i-1])
+
+		if afterSpace && hasAnyPrefix(line[i:], commentPrefixes) {
+			setTilesFgColor(tiles[i:], &s.CommentColor)
+			break
+		}
+
+		// Apostrophes within words (e.g. don't) don't start strings
+		if r == '"' || (r == '\'' && !afterIdent) {
+			end := stringLiteralEnd(line, i)
+			setTilesFgColor(tiles[i:end], &s.StringColor)
+			i = end
+			continue
+		}
+
+		if !isIdentRune(r) {
+			i++
+			continue
+		}
+
+		end := i + 1
+		for end < len(line) && (isIdentRune(line[end]) || unicode.IsDigit(r) && line[end] == '.') {
+			end++
+		}
+
+		if unicode.IsDigit(r) && !afterIdent {
+			setTilesFgColor(tiles[i:end], &s.NumberColor)
+		} else if keywords != nil {
+			if _, ok := keywords[string(line[i:end])]; ok {
+				setTilesFgColor(tiles[i:end], &s.KeywordColor)
+			}
+		}
+
+		i = end
+	}
+
+	return tiles
+}
+
+// stringLiteralEnd returns the index after the quote that closes the string starting at line[start],
+// or len(line) if the string isn't closed. Quotes escaped with a backslash don't close the string
+func stringLiteralEnd(line []rune, start int) int {
+
+	quote := line[start]
+	for i := start + 1; i < len(line); i++ {
+
+		if line[i] == '\\' {
+			i++
+			continue
+		}
+
+		if line[i] == quote {
+			return i + 1
+		}
+	}
+
+	return len(line)
+}
+
+func hasAnyPrefix(rs []rune, prefixes [][]rune) bool {
+
+	for _, prefix := range prefixes {
+
+		if len(prefix) > len(rs) {
+			continue
+		}
+
+		matched := true
+		for i := 0; i < len(prefix); i++ {
+			if rs[i] != prefix[i] {
+				matched = false
+				break
+			}
+		}
+
+		if matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isIdentRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func setTilesFgColor(tiles []GridTile, color *gglm.Vec4) {
+	for i := 0; i < len(tiles); i++ {
+		tiles[i].FgColor = *color
+	}
+}
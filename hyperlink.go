@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os/exec"
+	"runtime"
+
+	"github.com/bloeys/gglm/gglm"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// HyperlinkAt returns the URL of the tile at grid position pos, or an empty string if it isn't part of a hyperlink
+func (nt *nterm) HyperlinkAt(pos gglm.Vec2) string {
+
+	grid := nt.ActiveGlyphGrid()
+	if grid == nil {
+		return ""
+	}
+
+	x, y := uint(pos.X()), uint(pos.Y())
+	if x >= grid.SizeX || y >= grid.SizeY {
+		return ""
+	}
+
+	return grid.Tiles[y][x].URL
+}
+
+// SetHandCursor shows the hand mouse cursor (used when hovering links) if hand is true, and the arrow cursor otherwise
+func (nt *nterm) SetHandCursor(hand bool) {
+
+	if hand == nt.isHandCursor {
+		return
+	}
+
+	// System cursors are created on first use and kept
+	if nt.handCursor == nil {
+		nt.handCursor = sdl.CreateSystemCursor(sdl.SYSTEM_CURSOR_HAND)
+		nt.arrowCursor = sdl.CreateSystemCursor(sdl.SYSTEM_CURSOR_ARROW)
+	}
+
+	nt.isHandCursor = hand
+	if hand {
+		sdl.SetCursor(nt.handCursor)
+	} else {
+		sdl.SetCursor(nt.arrowCursor)
+	}
+}
+
+// checkLinkScheme returns an error if rawURL can't be parsed or doesn't use one of the schemes that are safe to open.
+// Links come from the output of cmds, so 'file' links aren't allowed because the default program of a file might run it
+func checkLinkScheme(rawURL string) error {
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+
+	switch u.Scheme {
+	case "http", "https", "ftp", "mailto":
+		return nil
+	default:
+		return fmt.Errorf("links with the scheme '%s' aren't opened", u.Scheme)
+	}
+}
+
+// openURL opens rawURL with the default program of the platform (e.g. a browser for https links) if it passes checkLinkScheme
+func openURL(rawURL string) error {
+
+	err := checkLinkScheme(rawURL)
+	if err != nil {
+		return err
+	}
+
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", rawURL)
+	case "darwin":
+		cmd = exec.Command("open", rawURL)
+	default:
+		cmd = exec.Command("xdg-open", rawURL)
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	// The opener usually exits right away, and waiting on it lets it be cleaned up
+	go cmd.Wait()
+	return nil
+}
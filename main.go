@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"math"
@@ -9,9 +10,9 @@ import (
 	"os/exec"
 	"runtime"
 	"runtime/pprof"
+	"strconv"
 	"strings"
 	"sync"
-	"syscall"
 	"time"
 	"unicode/utf8"
 
@@ -29,23 +30,20 @@ import (
 	"github.com/bloeys/nterm/consts"
 	"github.com/bloeys/nterm/glyphs"
 	"github.com/bloeys/nterm/ring"
+	"github.com/bloeys/nterm/shell"
+	"github.com/bloeys/nterm/theme"
 	"github.com/golang/freetype/truetype"
+	"github.com/inkyblackness/imgui-go/v4"
 	"github.com/veandco/go-sdl2/sdl"
 	"golang.org/x/exp/constraints"
 	"golang.org/x/image/font"
 )
 
-type Settings struct {
-	DefaultFgColor gglm.Vec4
-	DefaultBgColor gglm.Vec4
-	StringColor    gglm.Vec4
-
-	MaxFps   int
-	LimitFps bool
-}
-
 type Cmd struct {
+	// C is the first cmd of Stages, which gets the input typed by the user.
+	// Stages has more than one cmd when cmds are piped (e.g. 'ls | grep go')
 	C      *exec.Cmd
+	Stages []*exec.Cmd
 	Stdout io.ReadCloser
 	Stdin  io.WriteCloser
 	Stderr io.ReadCloser
@@ -63,6 +61,45 @@ func (l *Line) Len() uint64 {
 	return size
 }
 
+// gridDrawInfo is what's needed to know if the instances created by the last DrawGlyphGrid call can be reused
+type gridDrawInfo struct {
+	IsValid bool
+
+	Grid           *GlyphGrid
+	ScreenWidth    int32
+	ScreenHeight   int32
+	PaneLeft       float32
+	FgCount        uint32
+	BgCount        uint32
+	LastCmdCharPos gglm.Vec3
+	ScrollOffsetY  float32
+
+	// The settings used while drawing, which can change without changing the grid (e.g. from the settings editor)
+	PaddingLeft    float32
+	PaddingTop     float32
+	PaddingRight   float32
+	DefaultFgColor gglm.Vec4
+	DefaultBgColor gglm.Vec4
+
+	HasSelection  bool
+	SelStartIndex uint
+	SelEndIndex   uint
+
+	// HasBlink is true if any drawn tile blinks, in which case the draw can only be reused while the blink states are the same
+	HasBlink     bool
+	SlowBlinkOn  bool
+	RapidBlinkOn bool
+
+	Unfocused bool
+}
+
+// frameStats are shown in the debug stats overlay. They are collected at the end of a frame,
+// so the overlay always shows the stats of the previous frame
+type frameStats struct {
+	FrameTime time.Duration
+	GlyphRend glyphs.GlyphRendStats
+}
+
 var _ engine.Game = &nterm{}
 
 type nterm struct {
@@ -83,21 +120,172 @@ type nterm struct {
 	textBuf      *ring.Buffer[byte]
 	textBufMutex sync.Mutex
 
+	// sgrReplayBuf holds the text searched by replaySgrCodes, and is reused between frames
+	sgrReplayBuf []byte
+
+	// visibleTextBuf is a copy of the part of textBuf on screen, which lets us parse it without holding textBufMutex.
+	// It is reused between frames
+	visibleTextBuf []byte
+
 	cmdBuf    []rune
 	cmdBufLen int64
 
+	// cmdBufHistory has the cmdBuf states before each edit, newest last, which are restored by Ctrl+Z.
+	// Undone states are moved to cmdBufRedoHistory, which are restored by Ctrl+Y
+	cmdBufHistory     []cmdBufState
+	cmdBufRedoHistory []cmdBufState
+
 	cursorCharIndex int64
+
+	// tabCandidates are the completions shown when Tab matches many words, and tabIndex is the one in cmdBuf (or -1).
+	// tabWord is the text at tabWordStart that is being completed, which is replaced by each completion
+	tabCandidates []string
+	tabIndex      int
+	tabWordStart  int64
+	tabWord       string
+
 	// lastCmdCharPos is the screen pos of the last cmdBuf char drawn this frame
 	lastCmdCharPos *gglm.Vec3
 	scrollPosRel   int64
 	scrollSpd      int64
 
+	// subLineScrollOffset is how far we scrolled past the line at scrollPosRel, and is always in [0, 1).
+	// wheelDeltaY is the mouse wheel movement since the last ReadInputs call, which can be fractional on touchpads
+	subLineScrollOffset float32
+	wheelDeltaY         float32
+
+	// horizontalScrollOffset is how many columns lines are scrolled to the right (see GlyphGrid.ScrollX), and
+	// wheelDeltaX is the horizontal mouse wheel movement not yet applied to it
+	horizontalScrollOffset int64
+	wheelDeltaX            float32
+
+	// pendingFontSize is the font size requested by zooming, and is zero if there is no pending change.
+	// pendingFontSizeTime is the time of the last zoom request
+	pendingFontSize     uint32
+	pendingFontSizeTime time.Time
+
+	// cursorBlinkTimer is when the cursor blink state last flipped
+	cursorBlinkTimer time.Time
+	cursorBlinkOn    bool
+
+	// startupTime is used for blinking text, so all blinking tiles are in sync
+	startupTime time.Time
+
+	// CursorVisible is set by programs with DECTCEM (ESC[?25h/ESC[?25l), which full-screen programs
+	// use to hide the cursor while they redraw. The cursor isn't drawn at all while it's false.
+	// It is reset to true when activeCmd is cleared
+	CursorVisible bool
+
+	// cursorStyleOverride and cursorBlinkOverride are set by programs with DECSCUSR (e.g. ESC[5 q), and are used instead of
+	// Settings.CursorStyle and Settings.CursorBlink while hasCursorStyleOverride is true. This leaves the settings (which are shared
+	// by all panes) as they are. They are reset when activeCmd is cleared
+	hasCursorStyleOverride bool
+	cursorStyleOverride    CursorStyle
+	cursorBlinkOverride    bool
+
+	// bracketedPasteMode is set by programs with DECSET 2004 (ESC[?2004h), and makes Paste wrap pasted text in
+	// ansi.BracketedPasteStart and ansi.BracketedPasteEnd. It is reset when activeCmd is cleared
+	bracketedPasteMode bool
+
+	// autoWrapDisabled is set by programs with DECRST 7 (ESC[?7l), and makes writing past the last column overwrite it instead of wrapping.
+	// It is set as output comes in rather than while drawing, because the normal grid is redrawn from textBuf every frame and
+	// would apply old codes again. It is reset when activeCmd is cleared
+	autoWrapDisabled bool
+
 	glyphGrid *GlyphGrid
 
+	// cursorReportGrid is where textBuf is laid out to answer cursor position requests, because glyphGrid is only drawn once per frame.
+	// It is only used under textBufMutex
+	cursorReportGrid *GlyphGrid
+
+	// lineNumberGutterWidth is how many columns on the left of glyphGrid are used for line numbers when enabled.
+	// It is enough for the largest line index plus a separating space
+	lineNumberGutterWidth int
+
+	// altGlyphGrid is the alternate screen used by full-screen programs (e.g. vim, less).
+	// Unlike glyphGrid it has no scrollback and is written to directly as output comes in
+	altGlyphGrid     *GlyphGrid
+	useAltScreen     bool
+	altScreenFgColor gglm.Vec4
+	altScreenBgColor gglm.Vec4
+
+	// statusLineGrid is the single row status line drawn below the active grid when Settings.ShowStatusLine is true
+	statusLineGrid *GlyphGrid
+
+	// selectionStart and selectionEnd are grid positions of the first and last selected tiles (e.g. the tiles touched by a mouse drag).
+	// They might not be in order (e.g. when dragging upwards), and are only used if hasSelection is true
+	selectionStart gglm.Vec2
+	selectionEnd   gglm.Vec2
+	hasSelection   bool
+	isSelecting    bool
+
+	// clickCount is 2 for a double click and 3 for a triple click, which is when the left button was pressed on the
+	// same tile as the last press (lastClickPos) within Settings.DoubleClickIntervalMs
+	clickCount    int
+	lastClickTime time.Time
+	lastClickPos  gglm.Vec2
+
+	// isHandCursor is true while the mouse is over a hyperlink, which shows handCursor instead of arrowCursor (see SetHandCursor)
+	isHandCursor bool
+	handCursor   *sdl.Cursor
+	arrowCursor  *sdl.Cursor
+
+	lastGridDraw gridDrawInfo
+
+	// searchMode is true while the search bar is open. searchMatches are the textBuf indices (relative to textBuf.Start())
+	// of all matches of searchBuf, and searchMatchIndex is the index of the match we last jumped to or -1
+	searchMode       bool
+	searchBuf        []rune
+	searchMatches    []int64
+	searchMatchIndex int
+
+	// settingsEditor is non-nil while the settings editor (opened with Ctrl+,) is shown
+	settingsEditor *SettingsEditor
+
 	activeCmd *Cmd
 	Settings  *Settings
 
+	// panes are the split panes of the window from left to right (see SplitVertical), and are only set on the root nterm.
+	// panes[0] is the root, and focusedPane is the index of the pane that gets input. Other panes have root set, and
+	// share the window, renderer and settings of the root but have their own buffers, grids and cmd
+	root        *nterm
+	panes       []*nterm
+	focusedPane int
+
+	// paneLeft and paneWidth are the part of the window a pane is drawn in, where a zero paneWidth is the whole window.
+	// unfocused is true for panes that don't have focus, which are drawn with dimmed colors
+	paneLeft  float32
+	paneWidth float32
+	unfocused bool
+
+	// rawInputMode sends typed text and keys straight to the stdin of activeCmd instead of cmdBuf, for cmds that do
+	// their own line editing and echo (e.g. an interactive shell). It is toggled with Ctrl+Shift+R
+	rawInputMode bool
+
+	// builtins are cmds run by nterm itself (see initBuiltins), and currentDir is the working directory as set by cd
+	builtins   map[string]func(args []string) error
+	currentDir string
+
+	// Highlighter colors output lines without ansi codes, and is nil when highlighting is off.
+	// It is one of highlighters, which are cycled through with Ctrl+Shift+H
+	Highlighter      Highlighter
+	highlighters     []Highlighter
+	highlighterIndex int
+
+	// Theme is one of themes, which are cycled through with Ctrl+T. SetTheme puts its colors in the settings
+	Theme      *theme.Theme
+	themes     []theme.Theme
+	themeIndex int
+
 	frameStartTime time.Time
+	frameStats     frameStats
+
+	// ansiEventLog has the last received ansi codes, and is only used in debug mode
+	ansiEventLog *ansi.AnsiEventLog
+
+	// editedMaxScrollbackBytes and editedMaxScrollbackLines hold the values in the debug settings panel until they are applied
+	editedMaxScrollbackBytes int32
+	editedMaxScrollbackLines int32
 
 	SepLinePos gglm.Vec3
 
@@ -110,18 +298,45 @@ const (
 	hinting   = font.HintingNone
 
 	defaultCmdBufSize  = 4 * 1024
-	defaultLineBufSize = 10 * 1024 // Max number of lines
+	defaultUndoLimit   = 50
+	defaultLineBufSize = 10 * 1024 // Default max number of lines
 	defaultTextBufSize = 8 * 1024 * 1024
 
+	// textBuf and Lines start at these sizes and grow as needed up to the max scrollback in settings.
+	// Compacting never shrinks them below these
+	minLineBufSize = 256
+	minTextBufSize = 64 * 1024
+
+	// How many ansi codes are kept in the ansi event log, and where F5 writes it in debug mode
+	ansiEventLogSize = 1000
+	ansiEventLogFile = "./ansi-log.txt"
+
 	// How many lines to move per scroll
 	defaultScrollSpd = 1
 
+	// How long to wait after the last zoom request before changing the font size
+	fontSizeChangeDelay = 150 * time.Millisecond
+
+	// How far back from the first visible char we look for the SGR codes that set its colors (see replaySgrCodes)
+	maxSgrReplayLen = 64 * 1024
+
+	// How many columns one step of the horizontal wheel or Shift+Left/Right scrolls
+	horizontalScrollSpd = 4
+
+	// How long cmds terminated with Ctrl+T have to exit before they are killed
+	cmdTerminateGracePeriod = 3 * time.Second
+
+	// The largest padding in pixels allowed on each side of the window (see Settings.PaddingLeft)
+	maxPadding = 32
+
 	unscaledWindowWidth  = 1280
 	unscaledWindowHeight = 720
 )
 
 var (
 	drawGrid      bool
+	drawStats     bool
+	drawSettings  bool
 	drawManyLines = false
 
 	textToShow = ""
@@ -160,9 +375,9 @@ func main() {
 		imguiInfo: nmageimgui.NewImGUI(),
 		FontSize:  24,
 
-		Lines: ring.NewBuffer[Line](defaultLineBufSize),
+		Lines: ring.NewBuffer[Line](minLineBufSize),
 
-		textBuf: ring.NewBuffer[byte](defaultTextBufSize),
+		textBuf: ring.NewBuffer[byte](minTextBufSize),
 
 		cursorCharIndex: 0,
 		lastCmdCharPos:  gglm.NewVec3(0, 0, 0),
@@ -171,17 +386,104 @@ func main() {
 
 		scrollSpd: defaultScrollSpd,
 
+		startupTime: time.Now(),
+
 		Settings: &Settings{
 			DefaultFgColor: *gglm.NewVec4(1, 1, 1, 1),
 			DefaultBgColor: *gglm.NewVec4(0, 0, 0, 0),
+			CursorColor:    *gglm.NewVec4(1, 1, 1, 1),
 			StringColor:    *gglm.NewVec4(242/255.0, 244/255.0, 10/255.0, 1),
-			MaxFps:         120,
-			LimitFps:       true,
+			NumberColor:    *gglm.NewVec4(0.7, 0.55, 0.95, 1),
+			CommentColor:   *gglm.NewVec4(0.45, 0.6, 0.45, 1),
+			KeywordColor:   *gglm.NewVec4(0.35, 0.6, 0.95, 1),
+
+			SelectionBgColor: *gglm.NewVec4(0.25, 0.4, 0.65, 1),
+			HyperlinkColor:   *gglm.NewVec4(0.4, 0.65, 1, 1),
+			LineNumberColor:  *gglm.NewVec4(0.6, 0.6, 0.6, 1),
+			AliasColor:       *gglm.NewVec4(0.55, 0.55, 0.55, 1),
+
+			ColorPalette: ansi.XtermPalette(),
+
+			FontFile: "./res/fonts/CascadiaMono-Regular.ttf",
+
+			SearchMatchBgColor: *gglm.NewVec4(0.7, 0.5, 0.1, 1),
+			SearchBarBgColor:   *gglm.NewVec4(0.2, 0.2, 0.2, 1),
+
+			MinFontSize: 8,
+			MaxFontSize: 96,
+
+			MaxScrollbackBytes: defaultTextBufSize,
+			MaxScrollbackLines: defaultLineBufSize,
+
+			CursorStyle:           CursorStyle_Bar,
+			CursorBlink:           true,
+			CursorBlinkIntervalMs: 500,
+
+			SlowBlinkPeriodMs:  530,
+			RapidBlinkPeriodMs: 100,
+
+			DoubleClickIntervalMs: 400,
+
+			CmdBufUndoLimit: defaultUndoLimit,
+
+			MaxFps:   120,
+			LimitFps: true,
 		},
 
+		cursorBlinkOn: true,
+		CursorVisible: true,
+
 		firstValidLine: &Line{},
 	}
 
+	err = LoadSettings(settingsFile, p.Settings)
+	if err != nil {
+		fmt.Printf("Failed to load settings from '%s', using defaults. Err: %s\n", settingsFile, err.Error())
+	}
+
+	// Buffers start at their min size, so the max can't be smaller
+	p.Settings.MaxScrollbackBytes = clamp(p.Settings.MaxScrollbackBytes, minTextBufSize, math.MaxInt32)
+	p.Settings.MaxScrollbackLines = clamp(p.Settings.MaxScrollbackLines, minLineBufSize, math.MaxInt32)
+
+	p.Settings.PaddingLeft = clamp(p.Settings.PaddingLeft, 0, maxPadding)
+	p.Settings.PaddingTop = clamp(p.Settings.PaddingTop, 0, maxPadding)
+	p.Settings.PaddingRight = clamp(p.Settings.PaddingRight, 0, maxPadding)
+	p.Settings.PaddingBottom = clamp(p.Settings.PaddingBottom, 0, maxPadding)
+
+	if consts.Mode_Debug {
+		p.ansiEventLog = ansi.NewAnsiEventLog(ansiEventLogSize)
+	}
+
+	p.initBuiltins()
+
+	p.highlighters = []Highlighter{&DefaultHighlighter{Settings: p.Settings}, &GoHighlighter{Settings: p.Settings}, nil}
+	p.Highlighter = p.highlighters[0]
+
+	// Without a theme file the colors from the settings file are kept, and the theme is only used once cycled to
+	p.themes = []theme.Theme{theme.ThemeDark, theme.ThemeLight, theme.ThemeSolarizedDark, theme.ThemeSolarizedLight}
+	p.Theme = &p.themes[0]
+	if p.Settings.ThemeFile != "" {
+
+		th, err := theme.LoadThemeFromFile(p.Settings.ThemeFile)
+		if err != nil {
+			fmt.Printf("Failed to load theme from '%s', using the default theme. Err: %s\n", p.Settings.ThemeFile, err.Error())
+		} else {
+			p.themes = append([]theme.Theme{th}, p.themes...)
+			p.SetTheme(&p.themes[0])
+		}
+	}
+
+	// The palette file is loaded after the theme so all of its colors are kept
+	if p.Settings.PaletteFile != "" {
+
+		palette, err := LoadPaletteFromFile(p.Settings.PaletteFile)
+		if err != nil {
+			fmt.Printf("Failed to load palette from '%s', using the default palette. Err: %s\n", p.Settings.PaletteFile, err.Error())
+		} else {
+			p.Settings.ColorPalette = palette
+		}
+	}
+
 	p.win.EventCallbacks = append(p.win.EventCallbacks, p.handleSDLEvent)
 
 	//Don't flash white
@@ -240,14 +542,231 @@ func getDpiScaling(unscaledWindowWidth, unscaledWindowHeight int32) float32 {
 
 func (nt *nterm) handleSDLEvent(e sdl.Event) {
 
+	// Window events are handled by the root, which lays out the panes, and other events go to the focused pane
+	if fp := nt.FocusedPane(); fp != nt {
+		if _, isWindowEvent := e.(*sdl.WindowEvent); !isWindowEvent {
+			fp.handleSDLEvent(e)
+			return
+		}
+	}
+
 	switch e := e.(type) {
 
 	case *sdl.TextInputEvent:
-		nt.WriteToCmdBuf([]rune(e.GetText()))
+		if nt.settingsEditor != nil {
+			nt.settingsEditor.WriteToEditBuf([]rune(e.GetText()))
+		} else if nt.searchMode {
+			nt.WriteToSearchBuf([]rune(e.GetText()))
+		} else if nt.IsRawInputMode() {
+			nt.WriteToActiveCmd([]byte(e.GetText()))
+		} else {
+			nt.WriteToCmdBuf([]rune(e.GetText()))
+		}
 	case *sdl.WindowEvent:
 		if e.Event == sdl.WINDOWEVENT_SIZE_CHANGED {
 			nt.HandleWindowResize()
 		}
+
+	case *sdl.MouseButtonEvent:
+
+		if e.Button != sdl.BUTTON_LEFT {
+			break
+		}
+
+		if e.Type == sdl.MOUSEBUTTONDOWN {
+
+			pos := nt.MousePosToGridPos(e.X, e.Y)
+			now := time.Now()
+			if nt.clickCount > 0 && nt.clickCount < 3 && pos.Eq(&nt.lastClickPos) &&
+				now.Sub(nt.lastClickTime) <= time.Duration(nt.Settings.DoubleClickIntervalMs)*time.Millisecond {
+				nt.clickCount++
+			} else {
+				nt.clickCount = 1
+			}
+			nt.lastClickTime = now
+			nt.lastClickPos = pos
+
+			switch nt.clickCount {
+			case 2:
+				nt.isSelecting = false
+				nt.SelectWordAt(pos)
+				nt.copySelectionToClipboard()
+			case 3:
+				nt.isSelecting = false
+				nt.SelectLogicalLineAt(pos)
+				nt.copySelectionToClipboard()
+			default:
+				nt.isSelecting = true
+				nt.hasSelection = false
+				nt.selectionStart = pos
+				nt.selectionEnd = pos
+			}
+
+			break
+		}
+
+		if !nt.isSelecting {
+			break
+		}
+
+		nt.isSelecting = false
+		nt.selectionEnd = nt.MousePosToGridPos(e.X, e.Y)
+		nt.hasSelection = !nt.selectionStart.Eq(&nt.selectionEnd)
+		nt.copySelectionToClipboard()
+
+		// A single Ctrl+click that didn't select anything opens the link under it. Plain clicks don't, so that
+		// clicking (e.g. the first click of a double click) never opens a link by accident
+		isCtrlDown := input.KeyDown(sdl.K_LCTRL) || input.KeyDown(sdl.K_RCTRL)
+		if url := nt.HyperlinkAt(nt.selectionEnd); isCtrlDown && !nt.hasSelection && nt.clickCount == 1 && url != "" {
+
+			err := openURL(url)
+			if err != nil {
+				nt.WriteToTextBuf([]byte(fmt.Sprintf("Opening '%s' failed. Error: %s\n", url, err.Error())))
+			}
+		}
+
+	case *sdl.MouseMotionEvent:
+		if nt.isSelecting {
+			nt.selectionEnd = nt.MousePosToGridPos(e.X, e.Y)
+			nt.hasSelection = !nt.selectionStart.Eq(&nt.selectionEnd)
+		}
+
+		tile, found := nt.TileAtMousePos(e.X, e.Y)
+		nt.SetHandCursor(found && tile.URL != "")
+
+	case *sdl.MouseWheelEvent:
+
+		// PreciseY is zero on SDL versions older than 2.0.18
+		delta := e.PreciseY
+		if delta == 0 {
+			delta = float32(e.Y)
+		}
+
+		deltaX := e.PreciseX
+		if deltaX == 0 {
+			deltaX = float32(e.X)
+		}
+
+		if e.Direction == sdl.MOUSEWHEEL_FLIPPED {
+			delta = -delta
+			deltaX = -deltaX
+		}
+
+		nt.wheelDeltaY += delta
+		nt.wheelDeltaX += deltaX
+	}
+}
+
+// MousePosToGridPos takes a mouse position in window coordinates (origin at top left) and returns
+// the grid position of the tile under it, clamped to the grid bounds
+func (nt *nterm) MousePosToGridPos(x, y int32) gglm.Vec2 {
+
+	// Rows are moved up by the scroll offset when drawing
+	pos := gglm.NewVec3(float32(x), float32(y)+nt.ActiveSubLineScrollOffset()*nt.GlyphRend.Atlas.LineHeight, 0)
+	nt.ScreenPosToGridPos(pos)
+
+	grid := nt.ActiveGlyphGrid()
+	return gglm.Vec2{Data: [2]float32{
+		clamp(pos.X(), 0, float32(grid.SizeX-1)),
+		clamp(pos.Y(), 0, float32(grid.SizeY-1)),
+	}}
+}
+
+// TileAtMousePos returns the tile of the active grid under a mouse position in window coordinates (origin at top left).
+// Unlike MousePosToGridPos the position isn't clamped, so found is false if the mouse isn't over the grid
+func (nt *nterm) TileAtMousePos(x, y int32) (tile *GridTile, found bool) {
+
+	grid := nt.ActiveGlyphGrid()
+	if grid == nil {
+		return nil, false
+	}
+
+	// Rows are moved up by the scroll offset when drawing
+	lineHeight := nt.GlyphRend.Atlas.LineHeight
+	screenX := float32(x) - nt.paneLeft - nt.Settings.PaddingLeft
+	screenY := float32(y) + nt.ActiveSubLineScrollOffset()*lineHeight - nt.Settings.PaddingTop
+
+	_, _, tile, found = grid.TileAt(screenX, screenY, nt.GlyphRend.Atlas.SpaceAdvance, lineHeight)
+	return tile, found
+}
+
+// selectionTileIndices returns the indices of the first and last selected tiles, where a tile's index
+// is y*grid.SizeX+x. hasSelection is false if nothing is selected
+func (nt *nterm) selectionTileIndices() (startIndex, endIndex uint, hasSelection bool) {
+
+	if !nt.hasSelection {
+		return 0, 0, false
+	}
+
+	grid := nt.ActiveGlyphGrid()
+	startIndex = uint(nt.selectionStart.Y())*grid.SizeX + uint(nt.selectionStart.X())
+	endIndex = uint(nt.selectionEnd.Y())*grid.SizeX + uint(nt.selectionEnd.X())
+	if startIndex > endIndex {
+		startIndex, endIndex = endIndex, startIndex
+	}
+
+	return startIndex, endIndex, true
+}
+
+// SelectedText returns the glyphs of the selected tiles (empty tiles are skipped)
+func (nt *nterm) SelectedText() string {
+
+	startIndex, endIndex, hasSelection := nt.selectionTileIndices()
+	if !hasSelection {
+		return ""
+	}
+
+	grid := nt.ActiveGlyphGrid()
+	sb := strings.Builder{}
+	for i := startIndex; i <= endIndex; i++ {
+
+		t := &grid.Tiles[i/grid.SizeX][i%grid.SizeX]
+		if t.Glyph == utf8.RuneError || t.Glyph == WideGlyphTail {
+			continue
+		}
+
+		sb.WriteRune(t.Glyph)
+		if t.Mark != 0 {
+			sb.WriteRune(t.Mark)
+		}
+	}
+
+	return sb.String()
+}
+
+// SelectWordAt selects the word that has the tile at grid position pos. Nothing is selected if the tile isn't part of a word
+func (nt *nterm) SelectWordAt(pos gglm.Vec2) {
+
+	startX, endX, ok := nt.ActiveGlyphGrid().WordAt(uint(pos.X()), uint(pos.Y()))
+	nt.hasSelection = ok
+	if !ok {
+		return
+	}
+
+	nt.selectionStart = gglm.Vec2{Data: [2]float32{float32(startX), pos.Y()}}
+	nt.selectionEnd = gglm.Vec2{Data: [2]float32{float32(endX), pos.Y()}}
+}
+
+// SelectLogicalLineAt selects all rows of the logical line (i.e. including soft wrapped rows) that has the tile at grid position pos
+func (nt *nterm) SelectLogicalLineAt(pos gglm.Vec2) {
+
+	grid := nt.ActiveGlyphGrid()
+	startY, endY := grid.LogicalLineAt(uint(pos.Y()))
+
+	nt.hasSelection = true
+	nt.selectionStart = gglm.Vec2{Data: [2]float32{0, float32(startY)}}
+	nt.selectionEnd = gglm.Vec2{Data: [2]float32{float32(grid.SizeX - 1), float32(endY)}}
+}
+
+func (nt *nterm) copySelectionToClipboard() {
+
+	if !nt.hasSelection {
+		return
+	}
+
+	err := sdl.SetClipboardText(nt.SelectedText())
+	if err != nil {
+		fmt.Println("Failed to copy selection to clipboard. Err: " + err.Error())
 	}
 }
 
@@ -262,13 +781,29 @@ func (nt *nterm) Init() {
 	w, h := nt.win.SDLWin.GetSize()
 	// p.GlyphRend, err = glyphs.NewGlyphRend("./res/fonts/tajawal-regular-var.ttf", &truetype.Options{Size: float64(p.FontSize), DPI: p.Dpi, SubPixelsX: subPixelX, SubPixelsY: subPixelY, Hinting: hinting}, w, h)
 	// nt.GlyphRend, err = glyphs.NewGlyphRend("./res/fonts/alm-fixed.ttf", &truetype.Options{Size: float64(nt.FontSize), DPI: nt.Dpi, SubPixelsX: subPixelX, SubPixelsY: subPixelY, Hinting: hinting}, w, h)
-	nt.GlyphRend, err = glyphs.NewGlyphRend("./res/fonts/CascadiaMono-Regular.ttf", &truetype.Options{Size: float64(nt.FontSize), DPI: nt.Dpi, SubPixelsX: subPixelX, SubPixelsY: subPixelY, Hinting: hinting}, w, h)
+	nt.GlyphRend, err = glyphs.NewGlyphRend(
+		nt.Settings.FontFile,
+		&truetype.Options{Size: float64(nt.FontSize), DPI: nt.Dpi, SubPixelsX: subPixelX, SubPixelsY: subPixelY, Hinting: hinting},
+		w, h,
+		glyphs.WithBoldFont(nt.Settings.BoldFontFile),
+		glyphs.WithItalicFont(nt.Settings.ItalicFontFile),
+		glyphs.WithBoldItalicFont(nt.Settings.BoldItalicFontFile),
+	)
 	if err != nil {
 		panic("Failed to create atlas from font file. Err: " + err.Error())
 	}
 
-	nt.GlyphRend.OptValues.BgColor = &nt.Settings.DefaultBgColor
-	nt.GlyphRend.SetOpts(glyphs.GlyphRendOpt_BgColor)
+	// Printed outside debug mode too, so users can see what a font size costs in atlas size
+	atlas := nt.GlyphRend.Atlas
+	fmt.Printf(
+		"Atlas glyphs: %d, atlas size: %dx%d, packing efficiency: %0.2f, average glyph density: %0.2f\n",
+		atlas.GlyphCount, atlas.AtlasSize.X, atlas.AtlasSize.Y, atlas.PackingEfficiency, atlas.AverageGlyphDensity,
+	)
+
+	nt.GlyphRend.SetOptions(glyphs.GlyphRendOpts{
+		BgColor: &nt.Settings.DefaultBgColor,
+		FgColor: &nt.Settings.DefaultFgColor,
+	})
 
 	// if consts.Mode_Debug {
 	// glyphs.SaveImgToPNG(p.GlyphRend.Atlas.Img, "./debug-atlas.png")
@@ -281,21 +816,22 @@ func (nt *nterm) Init() {
 	}
 
 	nt.gridMat = materials.NewMaterial("grid", "./res/shaders/grid.glsl")
+
+	// This also creates the glyph grids
 	nt.HandleWindowResize()
 
 	// Set initial cursor pos
 	nt.lastCmdCharPos.SetY(nt.GlyphRend.Atlas.LineHeight)
-
-	// Init glyph grid
-	gridWidth, gridHeight := nt.GridSize()
-	nt.glyphGrid = NewGlyphGrid(uint(gridWidth), uint(gridHeight))
 }
 
 func (nt *nterm) Update() {
 
 	nt.frameStartTime = time.Now()
 
-	if input.IsQuitClicked() || input.KeyClicked(sdl.K_ESCAPE) {
+	// Escape closes the search bar or settings editor instead of quitting while they are open, and is sent to the
+	// active cmd in raw input mode
+	fp := nt.FocusedPane()
+	if input.IsQuitClicked() || (input.KeyClicked(sdl.K_ESCAPE) && !fp.searchMode && fp.settingsEditor == nil && !fp.IsRawInputMode()) {
 		engine.Quit()
 	}
 
@@ -304,58 +840,120 @@ func (nt *nterm) Update() {
 	}
 
 	//Font sizing
-	oldFontSize := nt.FontSize
-	fontSizeChanged := false
 	if input.KeyClicked(sdl.K_KP_PLUS) {
-		nt.FontSize += 2
-		fontSizeChanged = true
+		nt.SetFontSize(nt.FontSize + 2)
 	} else if input.KeyClicked(sdl.K_KP_MINUS) {
-		nt.FontSize -= 2
-		fontSizeChanged = true
+		nt.SetFontSize(nt.FontSize - 2)
 	}
 
-	if fontSizeChanged {
+	if nt.pendingFontSize != 0 && time.Since(nt.pendingFontSizeTime) >= fontSizeChangeDelay {
+		nt.SetFontSize(nt.pendingFontSize)
+		nt.pendingFontSize = 0
+	}
+
+	// Ctrl+Shift+D splits the focused pane, and Ctrl+Tab (or Ctrl+Shift+Tab) moves focus to the next (or previous) pane
+	isCtrlDown := input.KeyDown(sdl.K_LCTRL) || input.KeyDown(sdl.K_RCTRL)
+	isShiftDown := input.KeyDown(sdl.K_LSHIFT) || input.KeyDown(sdl.K_RSHIFT)
+	if isCtrlDown && isShiftDown && input.KeyClicked(sdl.K_d) {
 
-		err := nt.GlyphRend.SetFace(&truetype.Options{Size: float64(nt.FontSize), DPI: nt.Dpi, SubPixelsX: subPixelX, SubPixelsY: subPixelY, Hinting: hinting})
+		_, err := fp.SplitVertical()
 		if err != nil {
-			nt.FontSize = oldFontSize
-			fmt.Println("Failed to update font face. Err: " + err.Error())
-		} else {
-			glyphs.SaveImgToPNG(nt.GlyphRend.Atlas.Img, "./debug-atlas.png")
-			gridWidth, gridHeight := nt.GridSize()
-			nt.glyphGrid = NewGlyphGrid(uint(gridWidth), uint(gridHeight))
-			fmt.Println("New font size:", nt.FontSize, "; New texture size:", nt.GlyphRend.Atlas.Img.Rect.Max.X)
+			fp.WriteToTextBuf([]byte(fmt.Sprintf("Splitting pane failed. Error: %s\n", err.Error())))
 		}
+	} else if isCtrlDown && isShiftDown && input.KeyClicked(sdl.K_TAB) {
+		nt.FocusPrev()
+	} else if isCtrlDown && input.KeyClicked(sdl.K_TAB) {
+		nt.FocusNext()
+	}
+
+	// Only the focused pane reads input (see MainUpdate)
+	for _, p := range nt.Panes() {
+		p.UpdateCursorBlink()
+		p.MainUpdate()
+	}
+}
+
+// SetFontSize rebuilds the font atlas and glyph grids using the new font size, which is clamped
+// to the min/max font size in settings. The font size is unchanged if there is an error
+func (nt *nterm) SetFontSize(fontSize uint32) {
+
+	fontSize = clamp(fontSize, nt.Settings.MinFontSize, nt.Settings.MaxFontSize)
+	if fontSize == nt.FontSize {
+		return
+	}
+
+	err := nt.GlyphRend.SetFace(&truetype.Options{Size: float64(fontSize), DPI: nt.Dpi, SubPixelsX: subPixelX, SubPixelsY: subPixelY, Hinting: hinting})
+	if err != nil {
+		fmt.Println("Failed to update font face. Err: " + err.Error())
+		return
+	}
+
+	if consts.Mode_Debug {
+		glyphs.SaveImgToPNG(nt.GlyphRend.Atlas.Img, "./debug-atlas.png")
+	}
+
+	// The atlas is shared by all panes. The root isn't one of them if its pane was closed
+	nt.FontSize = fontSize
+	for _, p := range nt.Panes() {
+		p.FontSize = fontSize
+		p.rebuildGrids()
+	}
+
+	fmt.Println("New font size:", nt.FontSize, "; New texture size:", nt.GlyphRend.Atlas.Img.Rect.Max.X)
+}
+
+// RequestFontSizeChange changes the font size by delta after fontSizeChangeDelay passes without further requests.
+// This is used for zooming with the mouse wheel so we don't rebuild the atlas on every wheel tick
+func (nt *nterm) RequestFontSizeChange(delta int64) {
+
+	// Pending changes are applied by the root
+	nt = nt.Root()
+	fontSize := int64(nt.FontSize)
+	if nt.pendingFontSize != 0 {
+		fontSize = int64(nt.pendingFontSize)
 	}
 
-	nt.MainUpdate()
+	fontSize = clamp(fontSize+delta, int64(nt.Settings.MinFontSize), int64(nt.Settings.MaxFontSize))
+	nt.pendingFontSize = uint32(fontSize)
+	nt.pendingFontSizeTime = time.Now()
 }
 
 func (nt *nterm) MainUpdate() {
 
+	// Running cmds write to textBuf and Lines from other goroutines, so reading them must happen under the mutex
+	// otherwise our iterators and views might go stale midway
+	nt.textBufMutex.Lock()
+
+	if isRingBufSparse(nt.textBuf, minTextBufSize) || isRingBufSparse(nt.Lines, minLineBufSize) {
+		nt.compactBuffers()
+	}
+
 	// Keep a reference to the first valid line
 	if !IsLineValid(nt.textBuf, nt.firstValidLine) || nt.firstValidLine.Len() == 0 {
 
-		lineIt := nt.Lines.Iterator()
-		for p, done := lineIt.NextPtr(); !done; p, done = lineIt.NextPtr() {
+		// Lines whose text was overwritten never become valid again, so we drop them instead of skipping them every time
+		invalidLineCount := int64(0)
+		for invalidLineCount < nt.Lines.Len() && getLineStatus(nt.textBuf, nt.Lines.GetPtr(uint64(invalidLineCount))) == LineStatus_Invalid {
+			invalidLineCount++
+		}
+		nt.Lines.Rotate(invalidLineCount)
 
-			lineStatus := getLineStatus(nt.textBuf, p)
-			if lineStatus == LineStatus_Invalid {
-				continue
-			}
+		if p, ok := nt.Lines.FirstPtr(); ok {
 
 			// If start index is invalid but end index is still valid then we push the start into a valid position
-			if lineStatus == LineStatus_PartiallyInvalid {
-				diff := nt.textBuf.WrittenElements - nt.firstValidLine.StartIndex_WriteCount
-				deltaToValid := diff - uint64(nt.textBuf.Cap) + 1 // How much we need to move startIndex to be barely valid
+			if getLineStatus(nt.textBuf, p) == LineStatus_PartiallyInvalid {
+				diff := nt.textBuf.Written() - nt.firstValidLine.StartIndex_WriteCount
+				deltaToValid := diff - uint64(nt.textBuf.Cap()) + 1 // How much we need to move startIndex to be barely valid
 				nt.firstValidLine.StartIndex_WriteCount = clamp(nt.firstValidLine.StartIndex_WriteCount+deltaToValid, 0, nt.firstValidLine.EndIndex_WriteCount-1)
 			}
 
 			nt.firstValidLine = p
-			break
 		}
 	}
 
+	// The largest line index is Lines.Len(), which is the line currently being parsed
+	nt.lineNumberGutterWidth = digitCount(nt.Lines.Len()) + 1
+
 	// Since we have more chars than lines the first line might not start
 	// at the first char but midway in the buffer, so we ensure that scrollPosRel
 	// starts at the first line
@@ -364,23 +962,81 @@ func (nt *nterm) MainUpdate() {
 		nt.scrollPosRel = firstValidLineStartIndexRel
 	}
 
-	nt.ReadInputs()
+	if nt.Settings.ShowStatusLine {
+		nt.UpdateStatusLine()
+	}
+
+	nt.textBufMutex.Unlock()
+
+	if !nt.unfocused {
+		nt.ReadInputs()
+	}
 
 	// Line separator
 	nt.SepLinePos.SetY(2 * nt.GlyphRend.Atlas.LineHeight)
 
+	// The editor draws over everything using its own grid, so the other grids are left as they are
+	if nt.settingsEditor != nil {
+		nt.DrawSettingsEditor()
+		nt.DrawGlyphGrid()
+		return
+	}
+
+	// The alt grid is updated as output comes in, so unlike the normal grid it isn't rebuilt from textBuf every frame
+	if nt.useAltScreen {
+		nt.textBufMutex.Lock()
+		nt.DrawGlyphGrid()
+		nt.textBufMutex.Unlock()
+
+		if nt.Settings.ShowStatusLine {
+			nt.DrawStatusLine()
+		}
+		return
+	}
+
 	// Draw textBuf
-	nt.glyphGrid.ClearAll()
-	nt.glyphGrid.SetCursor(0, 0)
+	// The longest line is from the last frame, which is fine because lines only change when scrolling or getting output
+	nt.ScrollHorizontal(0)
+
+	nt.resetTextBufGrid(nt.glyphGrid)
 
 	gw, gh := nt.GridSize()
+	nt.textBufMutex.Lock()
 	v1, v2 := nt.textBuf.ViewsFromToRelIndex(uint64(nt.scrollPosRel), uint64(nt.scrollPosRel)+uint64(gw*gh))
 
-	nt.DrawTextAnsiCodesOnGlyphGrid(v1)
-	nt.DrawTextAnsiCodesOnGlyphGrid(v2)
-	nt.glyphGrid.Write(nt.cmdBuf[:nt.cmdBufLen], &nt.Settings.DefaultFgColor, &nt.Settings.DefaultBgColor)
+	// Colors continue from the codes before the first visible char, and from v1 to v2
+	currFgColor := nt.Settings.DefaultFgColor
+	currBgColor := nt.Settings.DefaultBgColor
+	firstValidLineStartIndexRel = int64(nt.textBuf.RelIndexFromWriteCount(nt.firstValidLine.StartIndex_WriteCount))
+	nt.replaySgrCodes(nt.glyphGrid, firstValidLineStartIndexRel, nt.scrollPosRel, &currFgColor, &currBgColor)
+
+	nt.visibleTextBuf = append(append(nt.visibleTextBuf[:0], v1...), v2...)
+	firstLineIndex, firstRowIsLineStart := nt.LineIndexFromTextBufIndex(nt.scrollPosRel)
+	nt.textBufMutex.Unlock()
+
+	// Parsing is done on the copy so cmds writing output aren't blocked while we draw
+	nt.DrawTextAnsiCodesOnGlyphGrid(nt.visibleTextBuf, &currFgColor, &currBgColor)
+
+	// The command being typed is never scrolled horizontally. In raw input mode the active cmd echoes input itself
+	nt.glyphGrid.ScrollX = 0
+	if !nt.IsRawInputMode() {
+		nt.DrawTabCandidates(nt.glyphGrid)
+		nt.glyphGrid.Write(nt.cmdBuf[:nt.cmdBufLen], &nt.Settings.DefaultFgColor, &nt.Settings.DefaultBgColor)
+	}
+
+	if nt.Settings.ShowLineNumbers {
+		nt.DrawLineNumbers(nt.glyphGrid, firstLineIndex, firstRowIsLineStart)
+	}
+
+	if nt.searchMode {
+		nt.HighlightSearchMatches(nt.glyphGrid)
+		nt.DrawSearchBar(nt.glyphGrid)
+	}
 
 	nt.DrawGlyphGrid()
+	if nt.Settings.ShowStatusLine {
+		nt.DrawStatusLine()
+	}
 
 	if input.KeyClicked(sdl.K_F4) {
 		nt.glyphGrid.Print()
@@ -388,75 +1044,386 @@ func (nt *nterm) MainUpdate() {
 	}
 }
 
-func (nt *nterm) DrawGlyphGrid() {
-
-	top := float32(nt.GlyphRend.ScreenHeight) - nt.GlyphRend.Atlas.LineHeight
-	nt.lastCmdCharPos.Data = gglm.NewVec3(0, top, 0).Data
-
-	for y := 0; y < len(nt.glyphGrid.Tiles); y++ {
-
-		row := nt.glyphGrid.Tiles[y]
-
-		for x := 0; x < len(row); x++ {
-
-			g := &row[x]
-			if g.Glyph == utf8.RuneError {
-				continue
-			}
+// resetTextBufGrid clears grid and sets it up for writing textBuf from scrollPosRel
+func (nt *nterm) resetTextBufGrid(grid *GlyphGrid) {
 
-			nt.GlyphRend.OptValues.BgColor.Data = g.BgColor.Data
-			nt.lastCmdCharPos.Data = nt.GlyphRend.DrawTextOpenGLAbsRectWithStartPos([]rune{g.Glyph}, nt.lastCmdCharPos, gglm.NewVec3(0, top, 0), gglm.NewVec2(float32(nt.GlyphRend.ScreenWidth), nt.GlyphRend.Atlas.LineHeight), &g.FgColor).Data
-		}
+	grid.ClearAll()
+	grid.ScrollX = uint(nt.horizontalScrollOffset)
+	grid.WordWrap = nt.IsWordWrapped()
+	grid.AutoWrap = !nt.autoWrapDisabled
+	grid.LeftMargin = 0
+	if nt.Settings.ShowLineNumbers {
+		grid.LeftMargin = clamp(uint(nt.lineNumberGutterWidth), 0, grid.SizeX-1)
 	}
+	grid.SetCursor(grid.LeftMargin, 0)
 }
 
-func (nt *nterm) ReadInputs() {
-
-	if input.KeyClicked(sdl.K_RETURN) || input.KeyClicked(sdl.K_KP_ENTER) {
-
-		if nt.cmdBufLen > 0 {
-			nt.cursorCharIndex = nt.cmdBufLen // This is so \n is written to the end of the cmdBuf
-			nt.WriteToCmdBuf([]rune{'\n'})
-			nt.HandleReturn()
-		} else {
-			nt.WriteToTextBuf([]byte{'\n'})
-		}
-	}
+// ActiveGlyphGrid returns the settings editor grid if the editor is open, the alt grid if a program switched to
+// the alternate screen, and otherwise the normal grid
+func (nt *nterm) ActiveGlyphGrid() *GlyphGrid {
 
-	// Cursor movement and scroll
-	if input.KeyClicked(sdl.K_LEFT) {
-		nt.cursorCharIndex = clamp(nt.cursorCharIndex-1, 0, nt.cmdBufLen)
-	} else if input.KeyClicked(sdl.K_RIGHT) {
-		nt.cursorCharIndex = clamp(nt.cursorCharIndex+1, 0, nt.cmdBufLen)
+	// The editor grid is created on the first frame after opening
+	if nt.settingsEditor != nil && nt.settingsEditor.grid != nil {
+		return nt.settingsEditor.grid
 	}
 
-	if input.KeyClicked(sdl.K_HOME) {
-		nt.cursorCharIndex = 0
-	} else if input.KeyClicked(sdl.K_END) {
-		nt.cursorCharIndex = nt.cmdBufLen
+	if nt.useAltScreen {
+		return nt.altGlyphGrid
 	}
 
-	if input.KeyDown(sdl.K_LCTRL) && input.KeyClicked(sdl.K_END) {
+	return nt.glyphGrid
+}
 
-		charsPerLine, _ := nt.GridSize()
-		nt.scrollPosRel = FindNLinesIndexIterator(nt.textBuf.Iterator(), nt.Lines.Iterator(), nt.textBuf.Len-1, -nt.scrollSpd, charsPerLine-1)
-		nt.scrollPosRel = clamp(nt.scrollPosRel, int64(nt.textBuf.RelIndexFromWriteCount(nt.firstValidLine.StartIndex_WriteCount)), nt.textBuf.Len-1)
+// DrawLineNumbers fills the left margin of each grid row with the right aligned index of the line starting on that row.
+// Rows that continue a soft wrapped line get an empty gutter
+func (nt *nterm) DrawLineNumbers(grid *GlyphGrid, firstLineIndex int64, firstRowIsLineStart bool) {
 
-	} else if input.KeyDown(sdl.K_LCTRL) && input.KeyClicked(sdl.K_HOME) {
-		nt.scrollPosRel = 0
+	if grid.LeftMargin == 0 {
+		return
 	}
 
-	if mouseWheelYNorm := -int64(input.GetMouseWheelYNorm()); mouseWheelYNorm != 0 {
+	var labelBuf [20]byte
+	maxLabelLen := int(grid.LeftMargin) - 1 // The last gutter column separates the numbers from the text
 
-		charsPerLine, _ := nt.GridSize()
-		if mouseWheelYNorm < 0 {
-			nt.scrollPosRel = FindNLinesIndexIterator(nt.textBuf.Iterator(), nt.Lines.Iterator(), nt.scrollPosRel, -nt.scrollSpd, charsPerLine-1)
-		} else {
-			nt.scrollPosRel = FindNLinesIndexIterator(nt.textBuf.Iterator(), nt.Lines.Iterator(), nt.scrollPosRel, nt.scrollSpd, charsPerLine-1)
+	lineIndex := firstLineIndex
+	isLineStart := firstRowIsLineStart
+	for y := uint(0); y < grid.SizeY; y++ {
+
+		if y > 0 {
+			isLineStart = grid.RowWrapKind[y-1] == WrapMode_Hard
+			if isLineStart {
+				lineIndex++
+			}
 		}
 
-		nt.scrollPosRel = clamp(nt.scrollPosRel, int64(nt.textBuf.RelIndexFromWriteCount(nt.firstValidLine.StartIndex_WriteCount)), nt.textBuf.Len-1)
-	}
+		// Nothing is written past this row
+		if grid.Tiles[y][grid.LeftMargin].Glyph == utf8.RuneError {
+			break
+		}
+
+		label := labelBuf[:0]
+		if isLineStart {
+			label = strconv.AppendInt(label, lineIndex, 10)
+			if len(label) > maxLabelLen {
+				label = label[len(label)-maxLabelLen:]
+			}
+		}
+
+		labelStart := maxLabelLen - len(label)
+		for x := 0; x < int(grid.LeftMargin); x++ {
+
+			r := ' '
+			if x >= labelStart && x < maxLabelLen {
+				r = rune(label[x-labelStart])
+			}
+
+			grid.setTile(uint(x), y, GridTile{
+				Glyph:   r,
+				FgColor: nt.Settings.LineNumberColor,
+				BgColor: nt.Settings.DefaultBgColor,
+			})
+		}
+	}
+}
+
+func (nt *nterm) DrawGlyphGrid() {
+
+	grid := nt.ActiveGlyphGrid()
+	selStartIndex, selEndIndex, hasSelection := nt.selectionTileIndices()
+
+	// GlyphRend doesn't keep instances between frames so we can't only draw the tiles that changed.
+	// However, instance data of the last draw is still in the VBOs, so if nothing changed and the grid was the first thing
+	// drawn in both frames we can skip all tiles and just reuse the old instances
+	scrollOffsetY := nt.ActiveSubLineScrollOffset() * nt.GlyphRend.Atlas.LineHeight
+
+	sinceStartupMs := time.Since(nt.startupTime).Milliseconds()
+	slowBlinkOn := isBlinkOn(sinceStartupMs, nt.Settings.SlowBlinkPeriodMs)
+	rapidBlinkOn := isBlinkOn(sinceStartupMs, nt.Settings.RapidBlinkPeriodMs)
+
+	ld := &nt.lastGridDraw
+	canReuseLastDraw := ld.IsValid &&
+		!grid.HasDirty() &&
+		ld.Grid == grid &&
+		ld.ScreenWidth == nt.GlyphRend.ScreenWidth && ld.ScreenHeight == nt.GlyphRend.ScreenHeight &&
+		ld.PaneLeft == nt.paneLeft &&
+		ld.ScrollOffsetY == scrollOffsetY &&
+		ld.PaddingLeft == nt.Settings.PaddingLeft && ld.PaddingTop == nt.Settings.PaddingTop && ld.PaddingRight == nt.Settings.PaddingRight &&
+		ld.DefaultFgColor == nt.Settings.DefaultFgColor && ld.DefaultBgColor == nt.Settings.DefaultBgColor &&
+		ld.HasSelection == hasSelection && ld.SelStartIndex == selStartIndex && ld.SelEndIndex == selEndIndex &&
+		(!ld.HasBlink || ld.SlowBlinkOn == slowBlinkOn && ld.RapidBlinkOn == rapidBlinkOn) &&
+		ld.Unfocused == nt.unfocused &&
+		nt.GlyphRend.GlyphFgCount == 0 && nt.GlyphRend.GlyphBgCount == 0
+
+	if canReuseLastDraw {
+		nt.GlyphRend.GlyphFgCount = ld.FgCount
+		nt.GlyphRend.GlyphBgCount = ld.BgCount
+		nt.lastCmdCharPos.Data = ld.LastCmdCharPos.Data
+		return
+	}
+
+	// If something was drawn before the grid then grid instances won't start at zero
+	startedEmpty := nt.GlyphRend.GlyphFgCount == 0 && nt.GlyphRend.GlyphBgCount == 0
+
+	// When partially scrolled to the next line everything moves up and the first row is partially hidden
+	top := float32(nt.GlyphRend.ScreenHeight) - nt.Settings.PaddingTop - nt.GlyphRend.Atlas.LineHeight + scrollOffsetY
+	left := nt.paneLeft + nt.Settings.PaddingLeft
+	right := nt.paneLeft + nt.PaneWidth() - nt.Settings.PaddingRight
+	nt.lastCmdCharPos.Data = gglm.NewVec3(left, top, 0).Data
+	nt.GlyphRend.TabOriginX = left + float32(grid.LeftMargin)*nt.GlyphRend.Atlas.SpaceAdvance
+
+	hasBlink := false
+	drawnFgInstances := uint32(0)
+	for y := 0; y < len(grid.Tiles); y++ {
+
+		row := grid.Tiles[y]
+
+		for x := 0; x < len(row); x++ {
+
+			g := &row[x]
+			if g.Glyph == utf8.RuneError || g.Glyph == WideGlyphTail {
+				continue
+			}
+
+			fgColor, bgColor := &g.FgColor, &g.BgColor
+			if g.URL != "" {
+				fgColor = &nt.Settings.HyperlinkColor
+			}
+
+			if g.ReverseVideo {
+				reversedFg, reversedBg := reverseVideoColors(*fgColor, g.BgColor)
+				fgColor, bgColor = &reversedFg, &reversedBg
+			}
+
+			tileIndex := uint(y)*grid.SizeX + uint(x)
+			if hasSelection && tileIndex >= selStartIndex && tileIndex <= selEndIndex {
+				bgColor = &nt.Settings.SelectionBgColor
+			}
+
+			if nt.unfocused {
+				dimmedFg := dimColor(*fgColor)
+				fgColor = &dimmedFg
+			}
+			nt.GlyphRend.SetOptions(glyphs.GlyphRendOpts{BgColor: bgColor})
+
+			nt.GlyphRend.DrawBold = g.Bold
+			nt.GlyphRend.DrawItalic = g.Italic
+
+			// Hidden blinking tiles are drawn as a space so only their background shows, which is the fg color with reverse video
+			glyph, mark := g.Glyph, g.Mark
+			if g.Blink {
+
+				hasBlink = true
+				if g.RapidBlink && !rapidBlinkOn || !g.RapidBlink && !slowBlinkOn {
+					glyph, mark = ' ', 0
+				}
+			}
+
+			// Runes are drawn one at a time, so we do the new lines and wrapping that the DrawText functions would do
+			if glyph == '\n' {
+				nt.lastCmdCharPos.SetXYZ(left, nt.lastCmdCharPos.Y()-nt.GlyphRend.Atlas.LineHeight, 0)
+			}
+
+			glyphStartPos := *nt.lastCmdCharPos
+			nt.lastCmdCharPos.Data = nt.GlyphRend.DrawRune(glyph, nt.lastCmdCharPos, fgColor).Data
+			drawnRunes := uint32(1)
+
+			// Combining marks don't advance, so drawing one after its glyph puts it over the glyph
+			if mark != 0 {
+				nt.lastCmdCharPos.Data = nt.GlyphRend.DrawRune(mark, nt.lastCmdCharPos, fgColor).Data
+				drawnRunes++
+			}
+			drawnFgInstances += drawnRunes
+
+			// Wide glyphs take exactly two columns regardless of their advance, so the following columns stay aligned
+			isWide := x+1 < len(row) && row[x+1].Glyph == WideGlyphTail
+			if isWide {
+				nt.lastCmdCharPos.SetX(glyphStartPos.X() + 2*nt.GlyphRend.Atlas.SpaceAdvance)
+			}
+
+			if nt.lastCmdCharPos.X()+nt.GlyphRend.Atlas.SpaceAdvance >= right {
+				nt.lastCmdCharPos.SetXYZ(left, nt.lastCmdCharPos.Y()-nt.GlyphRend.Atlas.LineHeight, 0)
+			}
+
+			// Synthetic bold glyphs are drawn twice so they take two instances
+			if _, syntheticBold := nt.GlyphRend.AtlasForStyle(g.Bold, g.Italic); syntheticBold {
+				drawnFgInstances += drawnRunes
+			}
+		}
+	}
+	nt.GlyphRend.DrawBold = false
+	nt.GlyphRend.DrawItalic = false
+	nt.GlyphRend.TabOriginX = 0
+
+	grid.ClearDirty()
+
+	// If the batch got full during drawing then some of the grid instances were already drawn and overwritten
+	*ld = gridDrawInfo{
+		IsValid:        startedEmpty && nt.GlyphRend.GlyphFgCount == drawnFgInstances,
+		Grid:           grid,
+		ScreenWidth:    nt.GlyphRend.ScreenWidth,
+		ScreenHeight:   nt.GlyphRend.ScreenHeight,
+		PaneLeft:       nt.paneLeft,
+		ScrollOffsetY:  scrollOffsetY,
+		PaddingLeft:    nt.Settings.PaddingLeft,
+		PaddingTop:     nt.Settings.PaddingTop,
+		PaddingRight:   nt.Settings.PaddingRight,
+		DefaultFgColor: nt.Settings.DefaultFgColor,
+		DefaultBgColor: nt.Settings.DefaultBgColor,
+		FgCount:        nt.GlyphRend.GlyphFgCount,
+		BgCount:        nt.GlyphRend.GlyphBgCount,
+		LastCmdCharPos: *nt.lastCmdCharPos,
+		HasSelection:   hasSelection,
+		SelStartIndex:  selStartIndex,
+		SelEndIndex:    selEndIndex,
+		HasBlink:       hasBlink,
+		SlowBlinkOn:    slowBlinkOn,
+		RapidBlinkOn:   rapidBlinkOn,
+		Unfocused:      nt.unfocused,
+	}
+}
+
+// reverseVideoColors swaps fg and bg for reverse video tiles. The default bg is often fully transparent, so
+// it is made opaque when used as the fg to keep the text visible
+func reverseVideoColors(fg, bg gglm.Vec4) (newFg, newBg gglm.Vec4) {
+
+	newFg, newBg = bg, fg
+	if newFg.A() == 0 {
+		newFg.SetA(1)
+	}
+
+	return newFg, newBg
+}
+
+// isBlinkOn returns true if blinking text should be visible after elapsedMs, which is during the first half of each period.
+// Blinking text is always visible if periodMs isn't positive
+func isBlinkOn(elapsedMs, periodMs int64) bool {
+	return periodMs <= 0 || elapsedMs%periodMs < periodMs/2
+}
+
+func (nt *nterm) ReadInputs() {
+
+	wheelDeltaY := nt.wheelDeltaY
+	nt.wheelDeltaY = 0
+
+	if nt.settingsEditor != nil {
+		nt.ReadSettingsEditorInputs()
+		return
+	}
+
+	if nt.searchMode {
+		nt.ReadSearchInputs()
+		return
+	}
+
+	if input.KeyDown(sdl.K_LCTRL) && input.KeyClicked(sdl.K_COMMA) {
+		nt.OpenSettingsEditor()
+		return
+	}
+
+	if input.KeyDown(sdl.K_LCTRL) && input.KeyClicked(sdl.K_f) {
+		nt.OpenSearch()
+		return
+	}
+
+	if input.KeyDown(sdl.K_LCTRL) && input.KeyDown(sdl.K_LSHIFT) && input.KeyClicked(sdl.K_k) {
+		nt.Compact()
+	}
+
+	if input.KeyDown(sdl.K_LCTRL) && input.KeyDown(sdl.K_LSHIFT) && input.KeyClicked(sdl.K_h) {
+		nt.highlighterIndex = (nt.highlighterIndex + 1) % len(nt.highlighters)
+		nt.Highlighter = nt.highlighters[nt.highlighterIndex]
+	}
+
+	// Ctrl+T terminates the running cmd, and cycles themes when nothing is running
+	if input.KeyDown(sdl.K_LCTRL) && input.KeyClicked(sdl.K_t) {
+
+		if activeCmd := nt.activeCmd; activeCmd != nil {
+			nt.WriteToTextBuf([]byte(fmt.Sprintf("Terminating '%s'\n", activeCmd.C.Path)))
+			terminateCmds(activeCmd.Stages, cmdTerminateGracePeriod)
+		} else {
+			nt.themeIndex = (nt.themeIndex + 1) % len(nt.themes)
+			nt.SetTheme(&nt.themes[nt.themeIndex])
+		}
+	}
+
+	if input.KeyDown(sdl.K_LCTRL) && input.KeyDown(sdl.K_LSHIFT) && input.KeyClicked(sdl.K_r) {
+		nt.rawInputMode = !nt.rawInputMode
+	}
+
+	if input.KeyDown(sdl.K_LCTRL) && input.KeyDown(sdl.K_LSHIFT) && input.KeyClicked(sdl.K_v) {
+		nt.PasteFromClipboard()
+	}
+
+	if nt.IsRawInputMode() {
+		nt.ReadRawInputs(wheelDeltaY)
+		return
+	}
+
+	// Tab completes while typing cmds, but text written to a running cmd is left as-is
+	if input.KeyClicked(sdl.K_TAB) && !input.KeyDown(sdl.K_LCTRL) && !input.KeyDown(sdl.K_RCTRL) && nt.activeCmd == nil {
+		nt.CompleteAtCursor()
+	}
+
+	if input.KeyDown(sdl.K_LCTRL) && input.KeyClicked(sdl.K_z) {
+		nt.UndoCmdBuf()
+	} else if input.KeyDown(sdl.K_LCTRL) && input.KeyClicked(sdl.K_y) {
+		nt.RedoCmdBuf()
+	}
+
+	if input.KeyClicked(sdl.K_RETURN) || input.KeyClicked(sdl.K_KP_ENTER) {
+
+		if nt.cmdBufLen > 0 {
+			nt.cursorCharIndex = nt.cmdBufLen // This is so \n is written to the end of the cmdBuf
+			nt.WriteToCmdBuf([]rune{'\n'})
+			nt.HandleReturn()
+		} else {
+			nt.WriteToTextBuf([]byte{'\n'})
+		}
+	}
+
+	// Horizontal scroll, where the wheel moves a few columns at a time and touchpad movements below a column are kept for later
+	wheelColumns := int64(nt.wheelDeltaX * horizontalScrollSpd)
+	nt.wheelDeltaX -= float32(wheelColumns) / horizontalScrollSpd
+	if wheelColumns != 0 {
+		nt.ScrollHorizontal(wheelColumns)
+	}
+
+	isShiftDown := input.KeyDown(sdl.K_LSHIFT) || input.KeyDown(sdl.K_RSHIFT)
+	if isShiftDown && input.KeyClicked(sdl.K_LEFT) {
+		nt.ScrollHorizontal(-horizontalScrollSpd)
+	} else if isShiftDown && input.KeyClicked(sdl.K_RIGHT) {
+		nt.ScrollHorizontal(horizontalScrollSpd)
+	}
+
+	// Cursor movement and scroll
+	if !isShiftDown && input.KeyClicked(sdl.K_LEFT) {
+		nt.cursorCharIndex = clamp(nt.cursorCharIndex-1, 0, nt.cmdBufLen)
+	} else if !isShiftDown && input.KeyClicked(sdl.K_RIGHT) {
+		nt.cursorCharIndex = clamp(nt.cursorCharIndex+1, 0, nt.cmdBufLen)
+	}
+
+	if input.KeyClicked(sdl.K_HOME) {
+		nt.cursorCharIndex = 0
+	} else if input.KeyClicked(sdl.K_END) {
+		nt.cursorCharIndex = nt.cmdBufLen
+	}
+
+	if input.KeyDown(sdl.K_LCTRL) && input.KeyClicked(sdl.K_END) {
+		nt.JumpToBottom()
+	} else if input.KeyDown(sdl.K_LCTRL) && input.KeyClicked(sdl.K_HOME) {
+		nt.JumpToTop()
+	}
+
+	mouseWheelYNorm := -int64(input.GetMouseWheelYNorm())
+	if mouseWheelYNorm != 0 && (input.KeyDown(sdl.K_LCTRL) || input.KeyDown(sdl.K_RCTRL)) {
+
+		// Ctrl+scroll zooms, where scrolling up makes text bigger
+		nt.RequestFontSizeChange(-2 * mouseWheelYNorm)
+
+	} else if wheelDeltaY != 0 {
+		// Scrolling the wheel up (positive delta) moves towards older text
+		nt.ScrollSmooth(-wheelDeltaY * float32(nt.scrollSpd))
+	}
 
 	// Delete inputs
 	// @TODO: Implement hold to delete
@@ -469,128 +1436,305 @@ func (nt *nterm) ReadInputs() {
 	}
 }
 
-func (nt *nterm) DrawTextAnsiCodesOnGlyphGrid(bs []byte) {
+func (nt *nterm) DrawTextAnsiCodesOnGlyphGrid(bs []byte, currFgColor, currBgColor *gglm.Vec4) {
 
-	// @TODO: We should remember color state even if the ansi codes are out of view
-	currFgColor := nt.Settings.DefaultFgColor
-	currBgColor := nt.Settings.DefaultBgColor
+	if nt.Highlighter == nil {
+		nt.DrawTextAnsiCodesOnGrid(nt.glyphGrid, bs, currFgColor, currBgColor)
+		return
+	}
 
-	draw := func(rs []rune) {
-		nt.glyphGrid.Write(rs, &currFgColor, &currBgColor)
+	// Lines with ansi codes (or that are colored by codes on previous lines) keep their colors, and only the rest are highlighted
+	for len(bs) > 0 {
+
+		lineEnd := bytes.IndexByte(bs, '\n') + 1
+		if lineEnd == 0 {
+			lineEnd = len(bs)
+		}
+
+		line := bs[:lineEnd]
+		bs = bs[lineEnd:]
+
+		usesDefaultColors := *currFgColor == nt.Settings.DefaultFgColor && *currBgColor == nt.Settings.DefaultBgColor
+		if !usesDefaultColors || bytes.IndexByte(line, ansi.AnsiEscByte) != -1 {
+			nt.DrawTextAnsiCodesOnGrid(nt.glyphGrid, line, currFgColor, currBgColor)
+			continue
+		}
+
+		rs := bytesToRunes(line)
+		nt.HighlightAndWriteToGrid(rs, currFgColor, currBgColor)
+		releaseRunes(rs)
+	}
+}
+
+// HighlightAndWriteToGrid colors text (which must have no ansi codes) with the active highlighter and writes the tiles to the
+// glyph grid, so highlighted text is selectable and drawn like any other output. fg and bg are the colors of uncolored text
+func (nt *nterm) HighlightAndWriteToGrid(text []rune, fg, bg *gglm.Vec4) {
+
+	if nt.Highlighter == nil {
+		nt.glyphGrid.Write(text, fg, bg)
+		return
 	}
 
+	nt.glyphGrid.WriteTiles(nt.Highlighter.Highlight(text, fg, bg))
+}
+
+// DrawTextAnsiCodesOnGrid writes the text in bs to the grid while applying the ansi codes within it.
+// currFgColor and currBgColor are the colors to start with, and are updated to the colors active at the end of bs
+func (nt *nterm) DrawTextAnsiCodesOnGrid(grid *GlyphGrid, bs []byte, currFgColor, currBgColor *gglm.Vec4) {
+
 	for {
 
 		index, code := ansi.NextAnsiCode(bs)
 		if index == -1 {
-			draw(bytesToRunes(bs))
+			writeBytesWithCharsets(grid, bs, currFgColor, currBgColor)
 			break
 		}
 
 		// Draw text before the code
-		before := bytesToRunes(bs[:index])
-		draw(before)
+		writeBytesWithCharsets(grid, bs[:index], currFgColor, currBgColor)
 
-		//Apply codes
-		ansiCodeInfo := ansi.InfoFromAnsiCode(code)
-		// fmt.Printf("Info: %+v\n", ansiCodeInfo)
-		for i := 0; i < len(ansiCodeInfo.Payload); i++ {
+		nt.applyAnsiCode(grid, code, currFgColor, currBgColor)
 
-			payload := &ansiCodeInfo.Payload[i]
+		// Advance beyond the code chars
+		bs = bs[index+len(code):]
+	}
+}
 
-			if payload.Type.HasOption(ansi.AnsiCodePayloadType_Reset) {
-				currFgColor = nt.Settings.DefaultFgColor
-				currBgColor = nt.Settings.DefaultBgColor
-				break
-			}
+// replaySgrCodes applies the SGR codes (colors and styles) and hyperlinks in textBuf between the relative indices from and to
+// onto grid and the colors, without writing any text. This lets text at index 'to' be drawn with the colors it was
+// written with even when the codes that set them are out of view.
+// Only the last maxSgrReplayLen bytes are searched for codes. Must be called with textBufMutex held
+func (nt *nterm) replaySgrCodes(grid *GlyphGrid, from, to int64, currFgColor, currBgColor *gglm.Vec4) {
 
-			if payload.Type.HasOption(ansi.AnsiCodePayloadType_ColorFg) {
-				currFgColor = payload.Info
-			} else if payload.Type.HasOption(ansi.AnsiCodePayloadType_ColorBg) {
-				currBgColor = payload.Info
-			}
+	from = clamp(from, to-maxSgrReplayLen, to)
+	if from < 0 || from >= to {
+		return
+	}
+
+	if int64(cap(nt.sgrReplayBuf)) < to-from {
+		nt.sgrReplayBuf = make([]byte, to-from)
+	}
+	bs := nt.sgrReplayBuf[:to-from]
+	bs = bs[:nt.textBuf.PeekInto(bs, uint64(from))]
+
+	for {
+
+		index, code := ansi.NextAnsiCode(bs)
+		if index == -1 {
+			break
+		}
+
+		if code[len(code)-1] == 'm' || bytes.HasPrefix(code, ansi.AnsiOSCBytes) {
+			nt.applyAnsiCode(grid, code, currFgColor, currBgColor)
 		}
 
-		// Advance beyond the code chars
 		bs = bs[index+len(code):]
 	}
 }
 
-// @TODO: Rewrite to draw on glyph grid
-func (nt *nterm) SyntaxHighlightAndDraw(text []rune, pos gglm.Vec3) gglm.Vec3 {
+// applyAnsiCode changes the colors and grid state as requested by code
+func (nt *nterm) applyAnsiCode(grid *GlyphGrid, code []byte, currFgColor, currBgColor *gglm.Vec4) {
 
-	startIndex := 0
-	startPos := pos.Clone()
-	currColor := &nt.Settings.DefaultFgColor
+	ansiCodeInfo := ansi.InfoFromAnsiCode(code)
+	// fmt.Printf("Info: %+v\n", ansiCodeInfo)
+	if ansiCodeInfo.Type == ansi.CSIType_Hyperlink {
+		grid.SetHyperlink(ansiCodeInfo.URI)
+		return
+	}
 
-	inSingleString := false
-	inDoubleString := false
-	for i := 0; i < len(text); i++ {
+	if ansiCodeInfo.Type == ansi.CSIType_REP {
+		grid.RepeatLastRune(int(ansiCodeInfo.Payload[0].Info.X()))
+		return
+	}
+	for i := 0; i < len(ansiCodeInfo.Payload); i++ {
+
+		payload := &ansiCodeInfo.Payload[i]
 
-		r := text[i]
-		switch r {
+		if payload.Type.HasOption(ansi.AnsiCodePayloadType_Reset) {
+			*currFgColor = nt.Settings.DefaultFgColor
+			*currBgColor = nt.Settings.DefaultBgColor
+			grid.SetBlink(false, false)
+			grid.SetReverseVideo(false)
+			grid.SetBold(false)
+			grid.SetItalic(false)
 
-		// Text might be drawn in multiple calls, once per color for example. If the first half
-		// of the text gets drawn and the second half has a newline, the renderer will reset the X pos
-		// to the middle of the text not the start as it uses the start X position of the second half.
-		// So to get correct new line handling we handle newlines here
-		case '\n':
-			pos.Data = nt.GlyphRend.DrawTextOpenGLAbs(text[startIndex:i], &pos, currColor).Data
-			pos.SetX(startPos.X())
-			pos.AddY(-nt.GlyphRend.Atlas.LineHeight)
-			startIndex = i + 1
+			// Codes like ESC[0;1m reset and then set new styles
 			continue
+		}
 
-		case '"':
+		if payload.Type.HasOption(ansi.AnsiCodePayloadType_ColorFg) {
+			*currFgColor = nt.colorFromPayload(payload)
+		} else if payload.Type.HasOption(ansi.AnsiCodePayloadType_ColorBg) {
+			*currBgColor = nt.colorFromPayload(payload)
+		} else if payload.Type.HasOption(ansi.AnsiCodePayloadType_Blink) {
+			sgrParam := int(payload.Info.X())
+			grid.SetBlink(sgrParam != 25, sgrParam == 6)
+		} else if payload.Type.HasOption(ansi.AnsiCodePayloadType_ReverseVideo) {
+			grid.SetReverseVideo(int(payload.Info.X()) == 7)
+		} else if payload.Type.HasOption(ansi.AnsiCodePayloadType_Bold) {
+			grid.SetBold(int(payload.Info.X()) == 1)
+		} else if payload.Type.HasOption(ansi.AnsiCodePayloadType_Italic) {
+			grid.SetItalic(int(payload.Info.X()) == 3)
+		} else if payload.Type.HasOption(ansi.AnsiCodePayloadType_Count) {
+			editGrid(grid, ansiCodeInfo.Type, int(payload.Info.X()), currFgColor, currBgColor)
+		}
+	}
+}
 
-			if inSingleString {
-				continue
-			}
+// editGrid applies the insert/delete codes (ICH, DCH, IL and DL) at the grid cursor.
+// Empty tiles aren't drawn and so don't take space, which means inserted cells and lines must be blanks to keep the
+// following tiles in place. Deleted cells at the end of a row are left empty, because a row usually ends in a new line
+func editGrid(grid *GlyphGrid, codeType ansi.CSIType, count int, fgColor, bgColor *gglm.Vec4) {
 
-			if !inDoubleString {
-				pos.Data = nt.GlyphRend.DrawTextOpenGLAbs(text[startIndex:i], &pos, currColor).Data
+	blank := GridTile{Glyph: ' ', FgColor: *fgColor, BgColor: *bgColor}
+	cursorX, cursorY := int(grid.CursorX), int(grid.CursorY)
 
-				startIndex = i
-				inDoubleString = true
-				currColor = &nt.Settings.StringColor
-				continue
-			}
+	// The cursor can be one past the last column or row after writing, where there is nothing to edit
+	if cursorX >= int(grid.SizeX) || cursorY >= int(grid.SizeY) {
+		return
+	}
 
-			pos.Data = nt.GlyphRend.DrawTextOpenGLAbs(text[startIndex:i+1], &pos, currColor).Data
-			startIndex = i + 1
-			inDoubleString = false
-			currColor = &nt.Settings.DefaultFgColor
+	switch codeType {
+	case ansi.CSIType_ICH:
+		grid.InsertCells(cursorY, cursorX, count, blank)
+	case ansi.CSIType_DCH:
+		grid.DeleteCells(cursorY, cursorX, count, GridTile{Glyph: utf8.RuneError})
 
-		case '\'':
-			if inDoubleString {
-				continue
-			}
+	// Like other terminals, inserting and deleting lines moves the cursor to the start of the row
+	case ansi.CSIType_IL:
+		grid.InsertLines(cursorY, count, blank)
+		grid.SetCursor(grid.LeftMargin, grid.CursorY)
+	case ansi.CSIType_DL:
+		grid.DeleteLines(cursorY, count, blank)
+		grid.SetCursor(grid.LeftMargin, grid.CursorY)
+	}
+}
 
-			if !inSingleString {
-				pos.Data = nt.GlyphRend.DrawTextOpenGLAbs(text[startIndex:i], &pos, currColor).Data
+// colorFromPayload returns the color of a color payload, where base 16 and 256 colors come from Settings.ColorPalette
+func (nt *nterm) colorFromPayload(payload *ansi.AnsiCodeInfoPayload) gglm.Vec4 {
 
-				startIndex = i
-				inSingleString = true
-				currColor = &nt.Settings.StringColor
-				continue
-			}
+	if !payload.UsesPalette {
+		return payload.Info
+	}
+
+	return nt.Settings.ColorPalette[payload.PaletteIndex]
+}
+
+// writeBytesWithCharsets writes bs to the grid while applying the SCS sequences within it (e.g. ESC(0 which
+// switches to DEC line drawing characters). bs must not have other ansi codes
+func writeBytesWithCharsets(grid *GlyphGrid, bs []byte, fgColor, bgColor *gglm.Vec4) {
 
-			pos.Data = nt.GlyphRend.DrawTextOpenGLAbs(text[startIndex:i+1], &pos, &nt.Settings.StringColor).Data
-			startIndex = i + 1
-			inSingleString = false
-			currColor = &nt.Settings.DefaultFgColor
+	for {
+
+		index, charset := ansi.NextSCSCode(bs)
+		if index == -1 {
+			grid.WriteBytes(bs, fgColor, bgColor)
+			return
 		}
+
+		grid.WriteBytes(bs[:index], fgColor, bgColor)
+		grid.SetCharset(charset)
+
+		bs = bs[index+ansi.AnsiSCSG0BytesLen+1:]
 	}
+}
 
-	if startIndex < len(text) {
-		if inDoubleString || inSingleString {
-			pos.Data = nt.GlyphRend.DrawTextOpenGLAbs(text[startIndex:], &pos, &nt.Settings.StringColor).Data
-		} else {
-			pos.Data = nt.GlyphRend.DrawTextOpenGLAbs(text[startIndex:], &pos, &nt.Settings.DefaultFgColor).Data
+// JumpToTop scrolls to the oldest output we still have
+func (nt *nterm) JumpToTop() {
+
+	nt.textBufMutex.Lock()
+	nt.scrollPosRel = clamp(int64(nt.textBuf.RelIndexFromWriteCount(nt.firstValidLine.StartIndex_WriteCount)), 0, nt.textBuf.Len()-1)
+	nt.subLineScrollOffset = 0
+	nt.textBufMutex.Unlock()
+}
+
+// IsWordWrapped returns true if output is drawn with word wrap, which is when it's enabled and there is no horizontal scrolling
+func (nt *nterm) IsWordWrapped() bool {
+	return nt.Settings.WordWrap && nt.horizontalScrollOffset == 0
+}
+
+// JumpToBottom scrolls so the last screen of output is visible, with the last line on the row above the cmd line
+func (nt *nterm) JumpToBottom() {
+
+	charsPerLine, rows := nt.GridSize()
+	wordWrap := nt.IsWordWrapped()
+
+	nt.textBufMutex.Lock()
+	defer nt.textBufMutex.Unlock()
+
+	// Word wrapped rows are counted up from the row of the cursor after the last char, which is the cmd line
+	startIndex := nt.textBuf.Len() - 1
+	if wordWrap {
+		startIndex = nt.textBuf.Len()
+	}
+
+	nt.scrollPosRel = FindNLinesIndexIterator(nt.textBuf.Iterator(), nt.Lines.Iterator(), startIndex, -(rows - 1), charsPerLine-1, wordWrap)
+	nt.scrollPosRel = clamp(nt.scrollPosRel, int64(nt.textBuf.RelIndexFromWriteCount(nt.firstValidLine.StartIndex_WriteCount)), nt.textBuf.Len()-1)
+	nt.subLineScrollOffset = 0
+}
+
+// ScrollSmooth scrolls by a possibly fractional number of lines, where positive values scroll down.
+// Whole lines move scrollPosRel, and the remaining fraction is kept in subLineScrollOffset and applied when drawing
+func (nt *nterm) ScrollSmooth(lines float32) {
+
+	charsPerLine, _ := nt.GridSize()
+	wordWrap := nt.IsWordWrapped()
+
+	nt.textBufMutex.Lock()
+	defer nt.textBufMutex.Unlock()
+
+	minScrollPos := int64(nt.textBuf.RelIndexFromWriteCount(nt.firstValidLine.StartIndex_WriteCount))
+	nextLineIndex := func(dir int64) int64 {
+		newPos := FindNLinesIndexIterator(nt.textBuf.Iterator(), nt.Lines.Iterator(), nt.scrollPosRel, dir, charsPerLine-1, wordWrap)
+		return clamp(newPos, minScrollPos, nt.textBuf.Len()-1)
+	}
+
+	nt.subLineScrollOffset += lines
+	for nt.subLineScrollOffset >= 1 || nt.subLineScrollOffset < 0 {
+
+		dir := int64(1)
+		if nt.subLineScrollOffset < 0 {
+			dir = -1
+		}
+
+		newPos := nextLineIndex(dir)
+		if newPos == nt.scrollPosRel {
+			// Reached the top or bottom
+			nt.subLineScrollOffset = 0
+			return
 		}
+
+		nt.scrollPosRel = newPos
+		nt.subLineScrollOffset -= float32(dir)
+	}
+
+	// We can't be partially scrolled past the last line
+	if nt.subLineScrollOffset > 0 && nextLineIndex(1) == nt.scrollPosRel {
+		nt.subLineScrollOffset = 0
+	}
+}
+
+// ScrollHorizontal scrolls the lines of the normal screen by delta columns, where positive values show text further right.
+// The offset is kept between zero and how far the longest line on screen goes past the right edge
+func (nt *nterm) ScrollHorizontal(delta int64) {
+
+	grid := nt.glyphGrid
+	maxOffset := int64(grid.LongestLineLen) - int64(grid.SizeX-grid.LeftMargin) + 1 // The last column is kept for new lines
+	if maxOffset < 0 {
+		maxOffset = 0
 	}
 
-	return pos
+	nt.horizontalScrollOffset = clamp(nt.horizontalScrollOffset+delta, 0, maxOffset)
+}
+
+// ActiveSubLineScrollOffset returns subLineScrollOffset, or zero on the alt screen because it can't be scrolled
+func (nt *nterm) ActiveSubLineScrollOffset() float32 {
+
+	if nt.useAltScreen {
+		return 0
+	}
+
+	return nt.subLineScrollOffset
 }
 
 func (nt *nterm) DeletePrevChar() {
@@ -599,6 +1743,7 @@ func (nt *nterm) DeletePrevChar() {
 		return
 	}
 
+	nt.pushCmdBufHistory()
 	copy(nt.cmdBuf[nt.cursorCharIndex-1:], nt.cmdBuf[nt.cursorCharIndex:])
 
 	nt.cmdBufLen--
@@ -611,6 +1756,7 @@ func (nt *nterm) DeleteNextChar() {
 		return
 	}
 
+	nt.pushCmdBufHistory()
 	copy(nt.cmdBuf[nt.cursorCharIndex:], nt.cmdBuf[nt.cursorCharIndex+1:])
 
 	nt.cmdBufLen--
@@ -621,6 +1767,8 @@ func (nt *nterm) HandleReturn() {
 	cmdRunes := nt.cmdBuf[:nt.cmdBufLen]
 	nt.cmdBufLen = 0
 	nt.cursorCharIndex = 0
+	nt.ClearCmdBufHistory()
+	nt.tabCandidates = nil
 
 	cmdStr := string(cmdRunes)
 	cmdBytes := []byte(cmdStr)
@@ -628,62 +1776,141 @@ func (nt *nterm) HandleReturn() {
 
 	if nt.activeCmd != nil {
 
-		// println("Wrote:", string(cmdBytes))
-		_, err := nt.activeCmd.Stdin.Write(cmdBytes)
-		if err != nil {
-			nt.WriteToTextBuf([]byte(fmt.Sprintf("Writing to stdin pipe of '%s' failed. Error: %s\n", nt.activeCmd.C.Path, err.Error())))
-			nt.ClearActiveCmd()
-			return
-		}
+		nt.WriteToActiveCmd(cmdBytes)
+		return
+	}
 
+	cmdStr, expanded, err := expandAliases(strings.TrimSpace(cmdStr), nt.Settings.Aliases)
+	if err != nil {
+		nt.WriteToTextBuf([]byte(fmt.Sprintf("Expanding aliases failed. Error: %s\n", err.Error())))
 		return
 	}
 
-	cmdSplit := strings.Split(strings.TrimSpace(cmdStr), " ")
-	cmdName := cmdSplit[0]
-	var args []string
-	if len(cmdSplit) >= 2 {
-		args = cmdSplit[1:]
+	if expanded {
+		e := ansi.Encoder{}
+		e.SetFgColor(nt.Settings.AliasColor)
+		e.WriteString(cmdStr)
+		e.Reset()
+		e.WriteString("\n")
+		nt.WriteToTextBuf(e.Bytes())
 	}
 
-	cmd := exec.Command(cmdName, args...)
-	if runtime.GOOS == "windows" {
-		cmd.SysProcAttr = &syscall.SysProcAttr{
-			CmdLine: strings.TrimSpace(cmdStr),
+	// Commands can be chained with pipes, where the output of each command is the input of the next one
+	stageStrs := splitPipeline(cmdStr)
+
+	// Builtins can't be part of a pipeline because they aren't processes
+	if len(stageStrs) == 1 && nt.runBuiltin(shell.ExpandEnvVars(stageStrs[0])) {
+		return
+	}
+	stages := make([]*exec.Cmd, len(stageStrs))
+	for i, stageStr := range stageStrs {
+
+		if stageStr == "" {
+			nt.WriteToTextBuf([]byte(fmt.Sprintf("Pipeline stage %d is empty\n", i+1)))
+			return
+		}
+
+		var err error
+		stages[i], err = newExecCmd(shell.ExpandEnvVars(stageStr), nt.currentDir)
+		if err != nil && nt.Settings.GlobNoMatchError {
+			nt.WriteToTextBuf([]byte(fmt.Sprintf("Expanding globs failed. Error: %s\n", err.Error())))
+			return
 		}
 	}
 
-	outPipe, err := cmd.StdoutPipe()
+	cmdName := stages[0].Path
+	lastStage := stages[len(stages)-1]
+
+	inPipe, err := stages[0].StdinPipe()
 	if err != nil {
-		nt.WriteToTextBuf([]byte(fmt.Sprintf("Creating stdout pipe of '%s' failed. Error: %s\n", cmdName, err.Error())))
+		nt.WriteToTextBuf([]byte(fmt.Sprintf("Creating stdin pipe of '%s' failed. Error: %s\n", cmdName, err.Error())))
 		return
 	}
 
-	inPipe, err := cmd.StdinPipe()
+	for i := 0; i < len(stages)-1; i++ {
+
+		stageOut, err := stages[i].StdoutPipe()
+		if err != nil {
+			nt.WriteToTextBuf([]byte(fmt.Sprintf("Creating stdout pipe of pipeline stage %d ('%s') failed. Error: %s\n", i+1, stageStrs[i], err.Error())))
+			return
+		}
+
+		stages[i+1].Stdin = stageOut
+	}
+
+	outPipe, err := lastStage.StdoutPipe()
 	if err != nil {
-		nt.WriteToTextBuf([]byte(fmt.Sprintf("Creating stdin pipe of '%s' failed. Error: %s\n", cmdName, err.Error())))
+		nt.WriteToTextBuf([]byte(fmt.Sprintf("Creating stdout pipe of '%s' failed. Error: %s\n", lastStage.Path, err.Error())))
 		return
 	}
 
-	errPipe, err := cmd.StderrPipe()
+	// All stages write errors to the same pipe
+	errPipe, errPipeWriter, err := os.Pipe()
 	if err != nil {
 		nt.WriteToTextBuf([]byte(fmt.Sprintf("Creating stderr pipe of '%s' failed. Error: %s\n", cmdName, err.Error())))
 		return
 	}
 
+	for _, stage := range stages {
+		stage.Stderr = errPipeWriter
+	}
+
 	startTime := time.Now()
-	err = cmd.Start()
-	if err != nil {
-		nt.WriteToTextBuf([]byte(fmt.Sprintf("Running '%s' failed. Error: %s\n", cmdName, err.Error())))
+	for i, stage := range stages {
+
+		err = stage.Start()
+		if err == nil {
+			continue
+		}
+
+		killCmds(stages[:i])
+		errPipe.Close()
+		errPipeWriter.Close()
+
+		if len(stages) == 1 {
+			nt.WriteToTextBuf([]byte(fmt.Sprintf("Running '%s' failed. Error: %s\n", cmdName, err.Error())))
+		} else {
+			nt.WriteToTextBuf([]byte(fmt.Sprintf("Running pipeline stage %d ('%s') failed. Error: %s\n", i+1, stageStrs[i], err.Error())))
+		}
 		return
 	}
+
+	// The stages have their own copies of the pipes between them. Closing ours means a stage sees EOF (or SIGPIPE)
+	// when the stage on the other side exits, and the stderr pipe gets EOF once all stages exit
+	errPipeWriter.Close()
+	for i := 1; i < len(stages); i++ {
+		stages[i].Stdin.(io.Closer).Close()
+	}
+
 	nt.activeCmd = &Cmd{
-		C:      cmd,
+		C:      stages[0],
+		Stages: stages,
 		Stdout: outPipe,
 		Stdin:  inPipe,
 		Stderr: errPipe,
 	}
 
+	// When a stage fails the rest are killed, and only the first failure is reported
+	var reportFailureOnce sync.Once
+	onStageExit := func(stageIndex int, err error) {
+
+		if len(stages) == 1 || !isPipelineStageFailure(err) {
+			return
+		}
+
+		reportFailureOnce.Do(func() {
+			nt.WriteToTextBuf([]byte(fmt.Sprintf("Pipeline stage %d ('%s') failed. Error: %s\n", stageIndex+1, stageStrs[stageIndex], err.Error())))
+			killCmds(stages)
+		})
+	}
+
+	// The last stage is waited on after reading all its output, because waiting closes its stdout pipe
+	for i := 0; i < len(stages)-1; i++ {
+		go func(stageIndex int) {
+			onStageExit(stageIndex, stages[stageIndex].Wait())
+		}(i)
+	}
+
 	//Stdout
 	go func() {
 
@@ -692,6 +1919,29 @@ func (nt *nterm) HandleReturn() {
 		}()
 
 		defer nt.ClearActiveCmd()
+
+		// The timeout is cancelled after waiting, so it also covers cmds that closed stdout but are still running
+		if cmdTimeout := nt.Settings.CommandTimeout; cmdTimeout > 0 {
+
+			ctx, cancel := context.WithTimeout(context.Background(), cmdTimeout)
+			defer cancel()
+
+			go func() {
+
+				<-ctx.Done()
+				if ctx.Err() != context.DeadlineExceeded {
+					return
+				}
+
+				nt.WriteToTextBuf([]byte(fmt.Sprintf("'%s' timed out after %s and was killed\n", cmdName, cmdTimeout)))
+				killCmds(stages)
+			}()
+		}
+
+		defer func() {
+			onStageExit(len(stages)-1, lastStage.Wait())
+		}()
+
 		buf := make([]byte, 4*1024)
 		for nt.activeCmd != nil {
 
@@ -720,10 +1970,12 @@ func (nt *nterm) HandleReturn() {
 	//Stderr
 	go func() {
 
+		defer errPipe.Close()
+
 		buf := make([]byte, 1024)
 		for nt.activeCmd != nil {
 
-			readBytes, err := nt.activeCmd.Stderr.Read(buf)
+			readBytes, err := errPipe.Read(buf)
 			if err != nil {
 
 				if err == io.EOF {
@@ -743,10 +1995,15 @@ func (nt *nterm) HandleReturn() {
 	}()
 }
 
+// ParseLines finds the lines ending in bs, which is the text about to be written to textBuf.
+// LineBeingParsed.EndIndex_WriteCount is how far parsing got, so bytes of an unfinished line are only
+// scanned once even when the line arrives over many writes (e.g. a program printing a progress bar)
 func (nt *nterm) ParseLines(bs []byte) {
 
 	// @TODO We should virtually break lines when they are too long
-	checkedBytes := uint64(0)
+	parsedEnd := nt.LineBeingParsed.EndIndex_WriteCount
+	assert.T(parsedEnd == nt.textBuf.Written(), "Line parsing is at write count %d but textBuf has %d written elements\n", parsedEnd, nt.textBuf.Written())
+
 	for len(bs) > 0 {
 
 		// IndexByte is assembly optimized for different platforms and is much faster than checking one byte at a time
@@ -756,34 +2013,178 @@ func (nt *nterm) ParseLines(bs []byte) {
 		}
 		bs = bs[index+1:]
 
-		checkedBytes += uint64(index + 1)
-		nt.LineBeingParsed.EndIndex_WriteCount = nt.textBuf.WrittenElements + checkedBytes
-		nt.WriteLine(&nt.LineBeingParsed)
-		nt.LineBeingParsed.StartIndex_WriteCount = nt.textBuf.WrittenElements + checkedBytes
+		parsedEnd += uint64(index + 1)
+		nt.LineBeingParsed.EndIndex_WriteCount = parsedEnd
+		nt.WriteLine(&nt.LineBeingParsed)
+		nt.LineBeingParsed.StartIndex_WriteCount = parsedEnd
+	}
+
+	// Whatever is left belongs to the unfinished line
+	nt.LineBeingParsed.EndIndex_WriteCount = parsedEnd + uint64(len(bs))
+}
+
+func (nt *nterm) WriteLine(l *Line) {
+	assert.T(l.StartIndex_WriteCount <= l.EndIndex_WriteCount, "Invalid line: %+v\n", l)
+
+	if growRingBuf(nt.Lines, 1, int64(nt.Settings.MaxScrollbackLines)) {
+		nt.onLinesMoved()
+	}
+	nt.Lines.Write(*l)
+}
+
+// Compact shrinks textBuf and Lines to fit their contents (with some room to grow), which frees memory
+// after a lot of output. The buffers grow back as needed
+func (nt *nterm) Compact() {
+	nt.textBufMutex.Lock()
+	nt.compactBuffers()
+	nt.textBufMutex.Unlock()
+}
+
+// SetScrollbackLimits changes the max size of textBuf and Lines. If the buffers are larger than the new limits then the oldest
+// text and lines are dropped. The limits can't be smaller than the min buffer sizes
+func (nt *nterm) SetScrollbackLimits(maxBytes, maxLines int) {
+
+	nt.textBufMutex.Lock()
+	defer nt.textBufMutex.Unlock()
+
+	nt.Settings.MaxScrollbackBytes = clamp(maxBytes, minTextBufSize, math.MaxInt32)
+	nt.Settings.MaxScrollbackLines = clamp(maxLines, minLineBufSize, math.MaxInt32)
+
+	shrinkRingBuf(nt.textBuf, int64(nt.Settings.MaxScrollbackBytes))
+	if shrinkRingBuf(nt.Lines, int64(nt.Settings.MaxScrollbackLines)) {
+		nt.onLinesMoved()
+	}
+
+	// Dropped text might have been on screen
+	nt.scrollPosRel = clamp(nt.scrollPosRel, 0, nt.textBuf.Len()-1)
+	nt.subLineScrollOffset = 0
+}
+
+// compactBuffers is like Compact, but textBufMutex must be held by the caller
+func (nt *nterm) compactBuffers() {
+
+	compactRingBuf(nt.textBuf, minTextBufSize)
+	if compactRingBuf(nt.Lines, minLineBufSize) {
+		nt.onLinesMoved()
+	}
+}
+
+// onLinesMoved must be called when Lines.Data is reallocated, because firstValidLine points into it
+func (nt *nterm) onLinesMoved() {
+	firstValidLine := *nt.firstValidLine
+	nt.firstValidLine = &firstValidLine
+}
+
+// ClearActiveCmd detaches the active cmd and resets the modes it might have set, because a cmd that crashed, was killed
+// or simply forgot to reset them shouldn't leave nterm in a state meant for that cmd
+func (nt *nterm) ClearActiveCmd() {
+
+	if nt.activeCmd == nil {
+		return
+	}
+
+	nt.activeCmd = nil
+
+	// A cmd that set bracketed paste mode and exited without resetting it shouldn't change how pastes into cmdBuf work
+	nt.bracketedPasteMode = false
+	nt.hasCursorStyleOverride = false
+	nt.autoWrapDisabled = false
+	nt.CursorVisible = true
+
+	// Leaving the alt screen brings back the normal grid, which is rebuilt from textBuf every frame
+	nt.textBufMutex.Lock()
+	nt.SetAltScreen(false)
+	nt.textBufMutex.Unlock()
+}
+
+// SetTheme makes t the active theme, and replaces the default and cursor colors and the base 16 colors of the palette
+// in settings with the ones of t
+func (nt *nterm) SetTheme(t *theme.Theme) {
+
+	nt.Theme = t
+	nt.Settings.DefaultFgColor = t.DefaultFg
+	nt.Settings.DefaultBgColor = t.DefaultBg
+	nt.Settings.CursorColor = t.CursorColor
+	copy(nt.Settings.ColorPalette[:len(t.Colors)], t.Colors[:])
+
+	// The renderer is only created in Init
+	if nt.GlyphRend == nil {
+		return
+	}
+
+	nt.GlyphRend.SetOptions(glyphs.GlyphRendOpts{
+		BgColor: &nt.Settings.DefaultBgColor,
+		FgColor: &nt.Settings.DefaultFgColor,
+	})
+}
+
+// SetCursorStyleFromDecscusr overrides the cursor style and blinking of the settings using the param of a DECSCUSR code (e.g. ESC[5 q).
+// The override lasts until activeCmd is cleared
+func (nt *nterm) SetCursorStyleFromDecscusr(param int) {
+
+	switch param {
+	case 0, 1, 2:
+		nt.cursorStyleOverride = CursorStyle_Block
+	case 3, 4:
+		nt.cursorStyleOverride = CursorStyle_Underline
+	case 5, 6:
+		nt.cursorStyleOverride = CursorStyle_Bar
+	default:
+		return
+	}
+
+	// Odd params (and zero) blink while even ones are steady
+	nt.cursorBlinkOverride = param == 0 || param%2 == 1
+	nt.hasCursorStyleOverride = true
+}
+
+// CursorStyle returns the cursor style set by the active cmd with DECSCUSR, or Settings.CursorStyle if there is none
+func (nt *nterm) CursorStyle() CursorStyle {
+
+	if nt.hasCursorStyleOverride {
+		return nt.cursorStyleOverride
 	}
+
+	return nt.Settings.CursorStyle
 }
 
-func (nt *nterm) WriteLine(l *Line) {
-	assert.T(l.StartIndex_WriteCount <= l.EndIndex_WriteCount, "Invalid line: %+v\n", l)
-	nt.Lines.Write(*l)
+// CursorBlink is like CursorStyle but for Settings.CursorBlink
+func (nt *nterm) CursorBlink() bool {
+
+	if nt.hasCursorStyleOverride {
+		return nt.cursorBlinkOverride
+	}
+
+	return nt.Settings.CursorBlink
 }
 
-func (nt *nterm) ClearActiveCmd() {
+// UpdateCursorBlink flips cursor visibility every CursorBlinkIntervalMs if blinking is enabled
+func (nt *nterm) UpdateCursorBlink() {
 
-	if nt.activeCmd == nil {
+	if !nt.CursorBlink() || nt.Settings.CursorBlinkIntervalMs <= 0 {
+		nt.cursorBlinkOn = true
 		return
 	}
 
-	nt.activeCmd = nil
+	if time.Since(nt.cursorBlinkTimer) < time.Duration(nt.Settings.CursorBlinkIntervalMs)*time.Millisecond {
+		return
+	}
+
+	nt.cursorBlinkOn = !nt.cursorBlinkOn
+	nt.cursorBlinkTimer = time.Now()
 }
 
 func (nt *nterm) DrawCursor() {
 
+	if !nt.cursorBlinkOn {
+		return
+	}
+
 	//Position cursor by placing it at the end of the drawn characters then walking backwards
 	pos := nt.lastCmdCharPos.Clone()
 
-	pos.AddY(nt.GlyphRend.Atlas.LineHeight * 0.5)
-	for i := clamp(nt.cmdBufLen, 0, int64(len(nt.cmdBuf))); i > nt.cursorCharIndex; i-- {
+	// cmdBuf isn't drawn in raw input mode, so the cursor stays after the output of the cmd
+	for i := clamp(nt.cmdBufLen, 0, int64(len(nt.cmdBuf))); i > nt.cursorCharIndex && !nt.IsRawInputMode(); i-- {
 
 		if nt.cmdBuf[i] == '\n' {
 			pos.AddY(nt.GlyphRend.Atlas.LineHeight)
@@ -792,19 +2193,55 @@ func (nt *nterm) DrawCursor() {
 		pos.AddX(-nt.GlyphRend.Atlas.SpaceAdvance)
 	}
 
-	nt.rend.Draw(nt.gridMesh, gglm.NewTrMatId().Translate(pos).Scale(gglm.NewVec3(0.1*nt.GlyphRend.Atlas.SpaceAdvance, nt.GlyphRend.Atlas.LineHeight, 1)), nt.gridMat)
+	// The cursor mesh is a quad centered on its position, and pos is now the bottom left of the cursor cell
+	cellWidth := nt.GlyphRend.Atlas.SpaceAdvance
+	cellHeight := nt.GlyphRend.Atlas.LineHeight
+	scale := gglm.NewVec3(0, 0, 1)
+	switch nt.CursorStyle() {
+	case CursorStyle_Block:
+		pos.AddX(cellWidth * 0.5)
+		pos.AddY(cellHeight * 0.5)
+		scale.SetX(cellWidth)
+		scale.SetY(cellHeight)
+	case CursorStyle_Underline:
+		pos.AddX(cellWidth * 0.5)
+		pos.AddY(cellHeight * 0.05)
+		scale.SetX(cellWidth)
+		scale.SetY(cellHeight * 0.1)
+	default:
+		pos.AddY(cellHeight * 0.5)
+		scale.SetX(cellWidth * 0.1)
+		scale.SetY(cellHeight)
+	}
+
+	// The grid material is also used for other lines, which are white
+	nt.gridMat.SetUnifVec4("color", &nt.Settings.CursorColor)
+	nt.rend.Draw(nt.gridMesh, gglm.NewTrMatId().Translate(pos).Scale(scale), nt.gridMat)
+	nt.gridMat.SetUnifVec4("color", gglm.NewVec4(1, 1, 1, 1))
 }
 
-// GridSize returns how many cells horizontally (aka chars per line) and how many cells vertically (aka lines)
+// GridSize returns how many cells horizontally (aka chars per line) and how many cells vertically (aka lines) fit
+// in the screen without the padding. The status line isn't part of the grid, so when it's shown the grid has one less
+// row than fits on the screen
 func (nt *nterm) GridSize() (w, h int64) {
-	w = int64(nt.GlyphRend.ScreenWidth) / int64(nt.GlyphRend.Atlas.SpaceAdvance)
-	h = int64(nt.GlyphRend.ScreenHeight) / int64(nt.GlyphRend.Atlas.LineHeight)
+
+	contentWidth := clamp(nt.PaneWidth()-nt.Settings.PaddingLeft-nt.Settings.PaddingRight, 0, math.MaxFloat32)
+	contentHeight := clamp(float32(nt.GlyphRend.ScreenHeight)-nt.Settings.PaddingTop-nt.Settings.PaddingBottom, 0, math.MaxFloat32)
+
+	w = int64(contentWidth) / int64(nt.GlyphRend.Atlas.SpaceAdvance)
+	h = int64(contentHeight) / int64(nt.GlyphRend.Atlas.LineHeight)
+	if nt.Settings.ShowStatusLine && h > 1 {
+		h--
+	}
+
 	return w, h
 }
 
+// ScreenPosToGridPos converts a position in window coordinates (origin at top left) to a grid position,
+// where positions in the top and left padding are before the first cell
 func (nt *nterm) ScreenPosToGridPos(screenPos *gglm.Vec3) {
-	screenPos.SetX(FloorF32(screenPos.X() / nt.GlyphRend.Atlas.SpaceAdvance))
-	screenPos.SetY(FloorF32(screenPos.Y() / nt.GlyphRend.Atlas.LineHeight))
+	screenPos.SetX(FloorF32((screenPos.X() - nt.paneLeft - nt.Settings.PaddingLeft) / nt.GlyphRend.Atlas.SpaceAdvance))
+	screenPos.SetY(FloorF32((screenPos.Y() - nt.Settings.PaddingTop) / nt.GlyphRend.Atlas.LineHeight))
 }
 
 func (nt *nterm) DebugUpdate() {
@@ -827,6 +2264,30 @@ func (nt *nterm) DebugUpdate() {
 	if input.KeyDown(sdl.K_LCTRL) && input.KeyClicked(sdl.K_SPACE) {
 		drawGrid = !drawGrid
 	}
+
+	// F3 goes to the next match while searching
+	if input.KeyClicked(sdl.K_F3) && !nt.searchMode {
+		drawStats = !drawStats
+	}
+
+	if input.KeyClicked(sdl.K_F5) {
+
+		nt.textBufMutex.Lock()
+		err := nt.ansiEventLog.WriteToFile(ansiEventLogFile)
+		nt.textBufMutex.Unlock()
+
+		if err != nil {
+			fmt.Printf("Failed to write ansi event log to '%s'. Err: %s\n", ansiEventLogFile, err.Error())
+		} else {
+			fmt.Printf("Wrote ansi event log to '%s'\n", ansiEventLogFile)
+		}
+	}
+
+	if input.KeyClicked(sdl.K_F2) {
+		drawSettings = !drawSettings
+		nt.editedMaxScrollbackBytes = int32(nt.Settings.MaxScrollbackBytes)
+		nt.editedMaxScrollbackLines = int32(nt.Settings.MaxScrollbackLines)
+	}
 }
 
 func (nt *nterm) Render() {
@@ -840,7 +2301,9 @@ func (nt *nterm) Render() {
 		nt.rend.Draw(nt.gridMesh, gglm.NewTrMatId().Translate(gglm.NewVec3(sizeX/2, nt.SepLinePos.Y(), 0)).Scale(gglm.NewVec3(sizeX, 1, 1)), nt.gridMat)
 	}
 
-	nt.DrawCursor()
+	if fp := nt.FocusedPane(); fp.CursorVisible && fp.settingsEditor == nil {
+		fp.DrawCursor()
+	}
 }
 
 func (nt *nterm) DebugRender() {
@@ -849,6 +2312,14 @@ func (nt *nterm) DebugRender() {
 		nt.DrawGrid()
 	}
 
+	if drawStats {
+		nt.DrawStats()
+	}
+
+	if drawSettings {
+		nt.DrawSettingsPanel()
+	}
+
 	fps := int(timing.GetAvgFPS())
 	if len(textToShow) > 0 {
 		str := textToShow
@@ -858,17 +2329,63 @@ func (nt *nterm) DebugRender() {
 			for i := 0; i < charsPerFrame/charCount; i++ {
 				nt.GlyphRend.DrawTextOpenGLAbsString(str, gglm.NewVec3(xOff, float32(nt.GlyphRend.Atlas.LineHeight)*5+yOff, 0), &nt.Settings.DefaultFgColor)
 			}
-			nt.win.SDLWin.SetTitle(fmt.Sprint("FPS: ", fps, " Draws/f: ", math.Ceil(charsPerFrame/glyphs.DefaultGlyphsPerBatch), " chars/f: ", charsPerFrame, " chars/s: ", fps*charsPerFrame))
+			nt.win.SDLWin.SetTitle(fmt.Sprint("FPS: ", fps, " Draws/f: ", math.Ceil(charsPerFrame/glyphs.MaxGlyphsPerBatch), " chars/f: ", charsPerFrame, " chars/s: ", fps*charsPerFrame))
 		} else {
 			charsPerFrame := float64(charCount)
 			nt.GlyphRend.DrawTextOpenGLAbsString(str, gglm.NewVec3(xOff, float32(nt.GlyphRend.Atlas.LineHeight)*5+yOff, 0), &nt.Settings.DefaultFgColor)
-			nt.win.SDLWin.SetTitle(fmt.Sprint("FPS: ", fps, " Draws/f: ", math.Ceil(charsPerFrame/glyphs.DefaultGlyphsPerBatch), " chars/f: ", int(charsPerFrame), " chars/s: ", fps*int(charsPerFrame)))
+			nt.win.SDLWin.SetTitle(fmt.Sprint("FPS: ", fps, " Draws/f: ", math.Ceil(charsPerFrame/glyphs.MaxGlyphsPerBatch), " chars/f: ", int(charsPerFrame), " chars/s: ", fps*int(charsPerFrame)))
 		}
 	} else {
 		nt.win.SDLWin.SetTitle(fmt.Sprint("FPS: ", fps))
 	}
 }
 
+func (nt *nterm) DrawStats() {
+
+	imgui.SetNextWindowPos(imgui.Vec2{X: 10, Y: 10})
+	imgui.SetNextWindowBgAlpha(0.7)
+	flags := imgui.WindowFlagsNoDecoration | imgui.WindowFlagsAlwaysAutoResize | imgui.WindowFlagsNoSavedSettings | imgui.WindowFlagsNoFocusOnAppearing | imgui.WindowFlagsNoNav
+	if imgui.BeginV("Stats", nil, flags) {
+
+		stats := &nt.frameStats
+		imgui.Text(fmt.Sprintf("FPS: %d", int(timing.GetAvgFPS())))
+		imgui.Text(fmt.Sprintf("Frame time: %0.2fms", float64(stats.FrameTime.Microseconds())/1000))
+		imgui.Text(fmt.Sprintf("Glyph draw calls: %d", stats.GlyphRend.DrawCalls))
+		imgui.Text(fmt.Sprintf("Glyphs drawn (fg/bg): %d/%d", stats.GlyphRend.FgGlyphs, stats.GlyphRend.BgGlyphs))
+
+		nt.textBufMutex.Lock()
+		imgui.Text(fmt.Sprintf("textBuf: %0.2f%% (%d/%d)", float64(nt.textBuf.Len())/float64(nt.textBuf.Cap())*100, nt.textBuf.Len(), nt.textBuf.Cap()))
+		imgui.Text(fmt.Sprintf("Lines: %0.2f%% (%d/%d)", float64(nt.Lines.Len())/float64(nt.Lines.Cap())*100, nt.Lines.Len(), nt.Lines.Cap()))
+
+		validLines := nt.Lines.Count(func(l Line) bool { return IsLineValid(nt.textBuf, &l) })
+		imgui.Text(fmt.Sprintf("Valid lines: %d", validLines))
+		nt.textBufMutex.Unlock()
+
+		activeCmdName := "None"
+		if activeCmd := nt.activeCmd; activeCmd != nil {
+			activeCmdName = activeCmd.C.Path
+		}
+		imgui.Text("Active cmd: " + activeCmdName)
+	}
+	imgui.End()
+}
+
+// DrawSettingsPanel shows settings that can be changed at runtime. Values are only applied when 'Apply' is clicked
+// because changing buffer sizes reallocates them
+func (nt *nterm) DrawSettingsPanel() {
+
+	if imgui.BeginV("Settings", &drawSettings, imgui.WindowFlagsAlwaysAutoResize|imgui.WindowFlagsNoSavedSettings) {
+
+		imgui.DragIntV("Max scrollback bytes", &nt.editedMaxScrollbackBytes, 1024, minTextBufSize, math.MaxInt32, "%d", imgui.SliderFlagsAlwaysClamp)
+		imgui.DragIntV("Max scrollback lines", &nt.editedMaxScrollbackLines, 16, minLineBufSize, math.MaxInt32, "%d", imgui.SliderFlagsAlwaysClamp)
+
+		if imgui.Button("Apply") {
+			nt.SetScrollbackLimits(int(nt.editedMaxScrollbackBytes), int(nt.editedMaxScrollbackLines))
+		}
+	}
+	imgui.End()
+}
+
 func (nt *nterm) DrawGrid() {
 
 	sizeX := float32(nt.GlyphRend.ScreenWidth)
@@ -889,6 +2406,10 @@ func (nt *nterm) DrawGrid() {
 func (nt *nterm) FrameEnd() {
 	assert.T(nt.cursorCharIndex <= nt.cmdBufLen, "Cursor char index is larger than cmdBufLen! You probablly forgot to move/reset the cursor index along with the buffer length somewhere. Cursor=%d, cmdBufLen=%d\n", nt.cursorCharIndex, nt.cmdBufLen)
 
+	nt.frameStats.FrameTime = time.Since(nt.frameStartTime)
+	nt.frameStats.GlyphRend = nt.GlyphRend.Stats
+	nt.GlyphRend.ResetStats()
+
 	if nt.Settings.LimitFps {
 
 		elapsed := time.Since(nt.frameStartTime)
@@ -910,6 +2431,7 @@ func (nt *nterm) DeInit() {
 func (nt *nterm) HandleWindowResize() {
 	w, h := nt.win.SDLWin.GetSize()
 	nt.GlyphRend.SetScreenSize(w, h)
+	nt.LayoutPanes()
 
 	cam := camera.NewOrthographic(gglm.NewVec3(0, 0, 10), gglm.NewVec3(0, 0, -1), gglm.NewVec3(0, 1, 0), 0.1, 20, 0, float32(w), float32(h), 0)
 	projViewMtx := cam.ProjMat.Mul(&cam.ViewMat)
@@ -920,10 +2442,204 @@ func (nt *nterm) WriteToTextBuf(text []byte) {
 	// This is locked because running cmds are potentially writing to it same time we are
 	nt.textBufMutex.Lock()
 
+	if nt.ansiEventLog != nil {
+		nt.ansiEventLog.AddCodes(text)
+	}
+
+	// Output after a switch to the alternate screen doesn't go into textBuf, so we must
+	// find these switches and send each part of the text to the right place.
+	//
+	// Queries (DSR, DA1, DA2 and XTVERSION) are also answered here, because unlike other codes they must be handled exactly once.
+	// The same goes for DECSCUSR and DECAWM, which change state that isn't part of the text.
+	//
+	// @TODO: Handle ansi codes that are split between two writes
+	var responses []byte
+	searchStart := 0
+	for searchStart < len(text) {
+
+		index, code := ansi.NextAnsiCode(text[searchStart:])
+		if index == -1 {
+			break
+		}
+
+		index += searchStart
+		searchStart = index + len(code)
+
+		// Only parse DEC private mode and query codes so we don't do the work of parsing every code twice
+		finalByte := code[len(code)-1]
+		if finalByte == 'n' || finalByte == 'c' || finalByte == 'q' {
+
+			info := ansi.InfoFromAnsiCode(code)
+			if info.Type == ansi.CSIType_DECSCUSR {
+				nt.SetCursorStyleFromDecscusr(int(info.Payload[0].Info.X()))
+				continue
+			}
+
+			queryType := info.Type
+			if queryType != ansi.CSIType_DSR && queryType != ansi.CSIType_DA1 && queryType != ansi.CSIType_DA2 && queryType != ansi.CSIType_XTVERSION {
+				continue
+			}
+
+			// A reported position must include the text before the request, and the request itself isn't kept
+			nt.writeToActiveScreen(text[:index])
+			responses = append(responses, nt.queryResponse(queryType)...)
+
+			text = text[searchStart:]
+			searchStart = 0
+			continue
+		}
+
+		if finalByte != 'h' && finalByte != 'l' {
+			continue
+		}
+
+		info := ansi.InfoFromAnsiCode(code)
+		if info.Type != ansi.CSIType_DECSET && info.Type != ansi.CSIType_DECRST {
+			continue
+		}
+
+		// Switching screens and DECAWM change where and how the following text is written, so the text before the code
+		// is written first and the code itself isn't kept
+		if hasDecPrivateMode(&info, ansi.DecPrivateMode_AltScreenBuf) || hasDecPrivateMode(&info, ansi.DecPrivateMode_AutoWrap) {
+
+			nt.writeToActiveScreen(text[:index])
+
+			text = text[searchStart:]
+			searchStart = 0
+		}
+
+		isSet := info.Type == ansi.CSIType_DECSET
+		for i := 0; i < len(info.Payload); i++ {
+
+			switch int(info.Payload[i].Info.X()) {
+			case ansi.DecPrivateMode_CursorVisible:
+				nt.CursorVisible = isSet
+			case ansi.DecPrivateMode_BracketedPaste:
+				nt.bracketedPasteMode = isSet
+			case ansi.DecPrivateMode_AutoWrap:
+				nt.autoWrapDisabled = !isSet
+			case ansi.DecPrivateMode_AltScreenBuf:
+				nt.SetAltScreen(isSet)
+			}
+		}
+	}
+
+	nt.writeToActiveScreen(text)
+
+	nt.textBufMutex.Unlock()
+
+	// Writing to stdin blocks until the cmd reads it, so we don't hold the mutex while doing it
+	activeCmd := nt.activeCmd
+	if len(responses) > 0 && activeCmd != nil {
+
+		_, err := activeCmd.Stdin.Write(responses)
+		if err != nil {
+			fmt.Printf("Failed to write query response to stdin of '%s'. Err: %s\n", activeCmd.C.Path, err.Error())
+		}
+	}
+}
+
+// hasDecPrivateMode returns true if the DECSET or DECRST code of info has mode in its payload
+func hasDecPrivateMode(info *ansi.AnsiCodeInfo, mode int) bool {
+
+	for i := 0; i < len(info.Payload); i++ {
+		if int(info.Payload[i].Info.X()) == mode {
+			return true
+		}
+	}
+
+	return false
+}
+
+// queryResponse returns the response to a query code of type queryType (e.g. ansi.CSIType_DA1).
+//
+// textBufMutex must be held by the caller
+func (nt *nterm) queryResponse(queryType ansi.CSIType) string {
+
+	switch queryType {
+	case ansi.CSIType_DSR:
+		return nt.cursorPosReport()
+	case ansi.CSIType_DA1:
+		return ansi.DA1Response
+	case ansi.CSIType_DA2:
+		return ansi.DA2Response
+	case ansi.CSIType_XTVERSION:
+		return ansi.XTVersionResponse
+	default:
+		return ""
+	}
+}
+
+// cursorPosReport returns the response to a DSR code (ESC[6n), which is ESC[row;colR with a 1-based row and column.
+// Output on the normal screen isn't drawn until the next frame, so the text written so far is laid out the same way
+// the next frame will lay it out. The line number gutter isn't part of the reported column.
+//
+// textBufMutex must be held by the caller
+func (nt *nterm) cursorPosReport() string {
+
+	var x, y uint
+	if nt.useAltScreen {
+		x, y = nt.altGlyphGrid.CursorX, nt.altGlyphGrid.CursorY
+	} else if nt.glyphGrid != nil {
+
+		grid := nt.cursorReportGrid
+		if grid == nil || grid.SizeX != nt.glyphGrid.SizeX || grid.SizeY != nt.glyphGrid.SizeY {
+			grid = NewGlyphGrid(nt.glyphGrid.SizeX, nt.glyphGrid.SizeY)
+			nt.cursorReportGrid = grid
+		}
+		nt.resetTextBufGrid(grid)
+
+		// Colors don't change positions, so the codes before scrollPosRel aren't replayed
+		fgColor, bgColor := nt.Settings.DefaultFgColor, nt.Settings.DefaultBgColor
+		v1, v2 := nt.textBuf.ViewsFromToRelIndex(uint64(nt.scrollPosRel), uint64(nt.scrollPosRel)+uint64(grid.SizeX*grid.SizeY))
+		nt.DrawTextAnsiCodesOnGrid(grid, v1, &fgColor, &bgColor)
+		nt.DrawTextAnsiCodesOnGrid(grid, v2, &fgColor, &bgColor)
+
+		x, y = grid.CursorX-grid.LeftMargin, grid.CursorY
+	}
+
+	return fmt.Sprintf("\x1b[%d;%dR", y+1, x+1)
+}
+
+// writeToActiveScreen writes to textBuf normally, but when using the alternate screen
+// the text is written directly to the alt grid.
+//
+// textBufMutex must be held by the caller
+func (nt *nterm) writeToActiveScreen(text []byte) {
+
+	if len(text) == 0 {
+		return
+	}
+
+	if nt.useAltScreen {
+		nt.altGlyphGrid.AutoWrap = !nt.autoWrapDisabled
+		nt.DrawTextAnsiCodesOnGrid(nt.altGlyphGrid, text, &nt.altScreenFgColor, &nt.altScreenBgColor)
+		return
+	}
+
+	// Lines are valid as long as their text isn't overwritten, so we must grow before writing
+	growRingBuf(nt.textBuf, int64(len(text)), int64(nt.Settings.MaxScrollbackBytes))
+
 	nt.ParseLines(text)
 	nt.textBuf.Write(text...)
+}
 
-	nt.textBufMutex.Unlock()
+// SetAltScreen switches between the normal screen and the alternate screen used by full-screen programs.
+// The alt screen is cleared both when entering and leaving it, which matches DEC private mode 1049.
+//
+// textBufMutex must be held by the caller
+func (nt *nterm) SetAltScreen(enabled bool) {
+
+	if nt.useAltScreen == enabled {
+		return
+	}
+
+	nt.useAltScreen = enabled
+
+	nt.altGlyphGrid.ClearAll()
+	nt.altGlyphGrid.SetCursor(0, 0)
+	nt.altScreenFgColor = nt.Settings.DefaultFgColor
+	nt.altScreenBgColor = nt.Settings.DefaultBgColor
 }
 
 func (nt *nterm) WriteToCmdBuf(text []rune) {
@@ -932,6 +2648,7 @@ func (nt *nterm) WriteToCmdBuf(text []rune) {
 	newHeadPos := nt.cmdBufLen + delta
 	if newHeadPos <= defaultCmdBufSize {
 
+		nt.pushCmdBufHistory()
 		copy(nt.cmdBuf[nt.cursorCharIndex+delta:], nt.cmdBuf[nt.cursorCharIndex:])
 		copy(nt.cmdBuf[nt.cursorCharIndex:], text)
 
@@ -951,6 +2668,74 @@ func CeilF32(x float32) float32 {
 	return float32(math.Ceil(float64(x)))
 }
 
+// digitCount returns the number of decimal digits needed to print n
+func digitCount(n int64) int {
+
+	count := 1
+	for n >= 10 || n <= -10 {
+		n /= 10
+		count++
+	}
+
+	return count
+}
+
+// isRingBufSparse returns true if b uses less than a quarter of its capacity and can be compacted
+func isRingBufSparse[T any](b *ring.Buffer[T], minCap int64) bool {
+	return b.Cap() > minCap && b.Len() < b.Cap()/4
+}
+
+// compactRingBuf shrinks b to twice its length but not below minCap, and returns true if b was changed
+func compactRingBuf[T any](b *ring.Buffer[T], minCap int64) bool {
+
+	newCap := 2 * b.Len()
+	if newCap < minCap {
+		newCap = minCap
+	}
+
+	if newCap >= b.Cap() {
+		return false
+	}
+
+	err := b.Compact(newCap)
+	assert.T(err == nil, "Failed to compact ring buffer. Err: %v\n", err)
+	return true
+}
+
+// shrinkRingBuf reduces the capacity of b to maxCap if it is larger, dropping the oldest elements if needed,
+// and returns true if b was changed
+func shrinkRingBuf[T any](b *ring.Buffer[T], maxCap int64) bool {
+
+	if b.Cap() <= maxCap {
+		return false
+	}
+
+	// Oldest elements that don't fit are dropped
+	b.Rotate(b.Len() - maxCap)
+
+	err := b.Compact(maxCap)
+	assert.T(err == nil, "Failed to shrink ring buffer. Err: %v\n", err)
+	return true
+}
+
+// growRingBuf doubles the capacity of b (up to maxCap) until n more elements fit without overwriting
+// existing ones, and returns true if b was changed
+func growRingBuf[T any](b *ring.Buffer[T], n, maxCap int64) bool {
+
+	if b.Len()+n <= b.Cap() || b.Cap() >= maxCap {
+		return false
+	}
+
+	newCap := b.Cap()
+	for newCap < b.Len()+n && newCap < maxCap {
+		newCap *= 2
+	}
+
+	err := b.Grow(clamp(newCap, b.Cap(), maxCap))
+	assert.T(err == nil, "Failed to grow ring buffer. Err: %v\n", err)
+	return true
+}
+
 func clamp[T constraints.Ordered](x, min, max T) T {
 
 	if max < min {
@@ -968,6 +2753,19 @@ func clamp[T constraints.Ordered](x, min, max T) T {
 	return x
 }
 
+// maxPooledRuneBufCap is the biggest rune buffer we keep in runePool, so that one huge conversion
+// doesn't keep a lot of memory alive
+const maxPooledRuneBufCap = 1024 * 1024
+
+var runePool = &sync.Pool{
+	New: func() any {
+		buf := make([]rune, 0, 4096)
+		return &buf
+	},
+}
+
+// bytesToRunes decodes b into a rune slice taken from runePool, and stops at the first invalid utf-8 sequence.
+// The returned slice should be given back with releaseRunes once it is no longer used
 func bytesToRunes(b []byte) []rune {
 
 	runeCount := utf8.RuneCount(b)
@@ -975,8 +2773,7 @@ func bytesToRunes(b []byte) []rune {
 		return []rune{}
 	}
 
-	// @PERF We should use a pre-allocated buffer here
-	out := make([]rune, 0, runeCount)
+	out := (*runePool.Get().(*[]rune))[:0]
 	for {
 
 		r, size := utf8.DecodeRune(b)
@@ -991,11 +2788,29 @@ func bytesToRunes(b []byte) []rune {
 	return out
 }
 
+// releaseRunes puts a slice returned by bytesToRunes back into runePool
+func releaseRunes(rs []rune) {
+
+	if cap(rs) == 0 || cap(rs) > maxPooledRuneBufCap {
+		return
+	}
+
+	rs = rs[:0]
+	runePool.Put(&rs)
+}
+
 // FindNLinesIndexIterator starts at startIndex and moves n lines forward/backward, depending on whether 'n' is negative or positive,
 // then returns the starting index of the nth line.
 //
 // A line is counted when either a '\n' is seen or by seeing enough chars that a wrap is required.
-func FindNLinesIndexIterator(it ring.Iterator[byte], lineIt ring.Iterator[Line], startIndex, n, charsPerLine int64) (newIndex int64) {
+// If wordWrap is true rows also end early where GlyphGrid.WordWrap would wrap them (see findNRowsWordWrap).
+//
+// The buffers of the iterators must not be written to while this runs, otherwise the iterators go stale and the result is wrong.
+func FindNLinesIndexIterator(it ring.Iterator[byte], lineIt ring.Iterator[Line], startIndex, n, charsPerLine int64, wordWrap bool) (newIndex int64) {
+
+	if wordWrap {
+		return findNRowsWordWrap(it.Buf, startIndex, n, charsPerLine)
+	}
 
 	done := false
 	read := 0
@@ -1053,7 +2868,7 @@ func FindNLinesIndexIterator(it ring.Iterator[byte], lineIt ring.Iterator[Line],
 
 			if startMinusOneIndexByte == '\n' {
 
-				charsIntoLine := getCharGridPosX(it.Buf.Iterator(), lineIt, clamp(startIndex-2, 0, it.Buf.Len-1), charsPerLine)
+				charsIntoLine := getCharGridPosX(it.Buf.Iterator(), lineIt, clamp(startIndex-2, 0, it.Buf.Len()-1), charsPerLine)
 				if charsIntoLine > 0 {
 					charsSeenThisLine = charsPerLine - charsIntoLine
 				}
@@ -1100,13 +2915,154 @@ func FindNLinesIndexIterator(it ring.Iterator[byte], lineIt ring.Iterator[Line],
 	return newIndex
 }
 
+// maxLineLookBack is the most bytes of a line that are looked at to know where its rows wrap
+const maxLineLookBack = 8 * 1024
+
+// findNRowsWordWrap is FindNLinesIndexIterator for word wrapped text. Where a row wraps depends on the words since the start
+// of the row, so going back is done by laying out each line from its start until reaching the row we want.
+//
+// startIndex should be the start of a row, or textBuf.Len() to count from the row the cursor is on after writing all of textBuf
+func findNRowsWordWrap(buf *ring.Buffer[byte], startIndex, n, charsPerLine int64) (newIndex int64) {
+
+	if buf.Len() == 0 {
+		return 0
+	}
+
+	startIndex = clamp(startIndex, 0, buf.Len())
+	if n >= 0 {
+
+		newIndex = startIndex
+		for ; n > 0; n-- {
+
+			nextRowStart := nextRowStartWordWrap(buf, newIndex, charsPerLine)
+			if nextRowStart == newIndex {
+				break
+			}
+			newIndex = nextRowStart
+		}
+
+		return newIndex
+	}
+
+	// Lay out the line of pos from its start, then continue with the previous line until we moved up enough rows.
+	// Very long lines are only laid out from maxLineLookBack bytes before pos, which is off by a bit but never visible
+	// because the start of such a line can't be on the screen at the same time as pos
+	pos := startIndex
+	rowsUp := -n
+	rowStarts := make([]int64, 0, 8)
+	for {
+
+		lineStart := pos
+		for lineStart > 0 && pos-lineStart < maxLineLookBack && buf.Get(uint64(lineStart-1)) != '\n' {
+			lineStart--
+		}
+
+		rowStarts = append(rowStarts[:0], lineStart)
+		for {
+
+			nextRowStart := nextRowStartWordWrap(buf, rowStarts[len(rowStarts)-1], charsPerLine)
+			if nextRowStart == rowStarts[len(rowStarts)-1] || nextRowStart > pos {
+				break
+			}
+			rowStarts = append(rowStarts, nextRowStart)
+		}
+
+		posRow := int64(len(rowStarts) - 1)
+		if posRow >= rowsUp {
+			return rowStarts[posRow-rowsUp]
+		}
+
+		if lineStart == 0 {
+			return 0
+		}
+
+		// Going up from the first row of this line gives the row with the new line that ends the previous line
+		rowsUp -= posRow + 1
+		pos = lineStart - 1
+	}
+}
+
+// nextRowStartWordWrap returns the index of the first char of the row after the row starting at rowStart, or rowStart if
+// textBuf ends before the row does. Like GlyphGrid.WordWrap, a word that doesn't fit in the rest of the row goes on the
+// next row unless it's longer than a row. charsPerLine is one less than the number of columns in a row
+func nextRowStartWordWrap(buf *ring.Buffer[byte], rowStart, charsPerLine int64) int64 {
+
+	rowWidth := charsPerLine + 1
+	col := int64(0)
+	prevIsSpace := false
+	for i := rowStart; i < buf.Len(); {
+
+		r, size := runeAtRelIndex(buf, i)
+		if r == '\n' {
+			return i + int64(size)
+		}
+
+		width := int64(glyphs.RuneWidth(r))
+		isWordStart := r != ' ' && width > 0 && prevIsSpace
+		if isWordStart {
+
+			wordWidth := wordWidthAtRelIndex(buf, i, rowWidth+1)
+			if col+wordWidth > rowWidth && wordWidth <= rowWidth {
+				return i
+			}
+		}
+
+		// Wide runes that don't fit in the last column go on the next row
+		if col+width > rowWidth && col > 0 {
+			return i
+		}
+
+		col += width
+		i += int64(size)
+		if col >= rowWidth {
+			return i
+		}
+
+		if width > 0 {
+			prevIsSpace = r == ' '
+		}
+	}
+
+	return rowStart
+}
+
+// wordWidthAtRelIndex returns how many columns the word starting at the textBuf index relIndex takes, where a word ends at
+// a space or new line. Counting stops after maxWidth columns
+func wordWidthAtRelIndex(buf *ring.Buffer[byte], relIndex, maxWidth int64) (width int64) {
+
+	for i := relIndex; i < buf.Len() && width < maxWidth; {
+
+		r, size := runeAtRelIndex(buf, i)
+		if r == ' ' || r == '\n' {
+			break
+		}
+
+		width += int64(glyphs.RuneWidth(r))
+		i += int64(size)
+	}
+
+	return width
+}
+
+// runeAtRelIndex decodes the utf-8 rune starting at the textBuf index relIndex, which can wrap around the end of Data
+func runeAtRelIndex(buf *ring.Buffer[byte], relIndex int64) (r rune, size int) {
+
+	var runeBytes [utf8.UTFMax]byte
+	n := int(clamp(buf.Len()-relIndex, 0, utf8.UTFMax))
+	for i := 0; i < n; i++ {
+		runeBytes[i] = buf.Get(uint64(relIndex) + uint64(i))
+	}
+
+	return utf8.DecodeRune(runeBytes[:n])
+}
+
 // getCharGridPosX returns the dispaly grid's X position of the char at textBufStartIndexRel.
 // Wrapping is respected so if the char is at the end of a long line it's position will take that into consideration
 func getCharGridPosX(it ring.Iterator[byte], lineIt ring.Iterator[Line], textBufStartIndexRel, charsPerLine int64) int64 {
 
 	// Find line that contains the start index
-	line, _ := GetLineFromTextBufIndex(it, lineIt, uint64(textBufStartIndexRel))
-	if line == nil {
+	line, _, err := GetLineFromTextBufIndex(it, lineIt, uint64(textBufStartIndexRel))
+	if err != nil || line == nil {
 		return 0
 	}
 
@@ -1121,7 +3077,6 @@ func getCharGridPosX(it ring.Iterator[byte], lineIt ring.Iterator[Line], textBuf
 	lenV1 := int64(len(v1))
 	lenV2 := int64(len(v2))
 	lineLen := lenV1 + lenV2
-	const maxLineLookBack = 8 * 1024
 	if lineLen > maxLineLookBack {
 
 		extraLen := lineLen - maxLineLookBack
@@ -1149,51 +3104,74 @@ func PrintLine(textBuf *ring.Buffer[byte], p *Line) {
 	fmt.Println(string(v1) + string(v2))
 }
 
-func GetLineFromTextBufIndex(it ring.Iterator[byte], lineIt ring.Iterator[Line], textBufStartIndexRel uint64) (outLine *Line, pIndex uint64) {
+// LineIndexFromTextBufIndex returns the index (relative to Lines.Start()) of the line containing the textBuf char at textBufIndexRel,
+// and whether that char is the first one of the line. Chars after the last line belong to LineBeingParsed, which has index Lines.Len().
+//
+// textBufMutex must be held by the caller
+func (nt *nterm) LineIndexFromTextBufIndex(textBufIndexRel int64) (lineIndex int64, isLineStart bool) {
 
-	if lineIt.Buf.Len == 0 {
-		return
-	}
+	// Write count of the char, which lets us compare it with line start/end write counts
+	charWriteCount := nt.textBuf.Written() - uint64(nt.textBuf.Len()) + uint64(textBufIndexRel) + 1
 
-	// Find first valid line
-	lineIt.GotoStart()
-	for p, done := lineIt.NextPtr(); !done; p, done = lineIt.NextPtr() {
+	// Lines are ordered, so we find the first line that ends at or after the char
+	lineIndex, _ = ring.BinarySearchFunc(nt.Lines, func(l Line) int {
 
-		if !IsLineValid(it.Buf, p) {
-			continue
+		if l.EndIndex_WriteCount < charWriteCount {
+			return -1
 		}
 
-		lineIt.Prev()
-		break
+		return 0
+	})
+
+	line := &nt.LineBeingParsed
+	if lineIndex < nt.Lines.Len() {
+		line = nt.Lines.GetPtr(uint64(lineIndex))
 	}
 
-	// Binary search for the line
-	lowIndexRel := lineIt.CurrToRelIndex()
-	highIndexRel := uint64(lineIt.Buf.Len)
-	for lowIndexRel <= highIndexRel {
+	return lineIndex, charWriteCount == line.StartIndex_WriteCount+1
+}
 
-		medianIndexRel := (lowIndexRel + highIndexRel) / 2
-		p := lineIt.Buf.GetPtr(medianIndexRel)
+// GetLineFromTextBufIndex returns the line containing the char at textBufStartIndexRel and its index relative to Lines.Start().
+// An error is returned if no line has the char (e.g. it's after the last new line or past the end of textBuf),
+// and a nil line (with no error) is returned if there are no lines
+func GetLineFromTextBufIndex(it ring.Iterator[byte], lineIt ring.Iterator[Line], textBufStartIndexRel uint64) (outLine *Line, pIndex uint64, err error) {
 
-		startIndexRel := it.Buf.RelIndexFromWriteCount(p.StartIndex_WriteCount)
-		endIndexRel := it.Buf.RelIndexFromWriteCount(p.EndIndex_WriteCount)
+	lines := lineIt.Buf
+	if lines.Len() == 0 {
+		return nil, 0, nil
+	}
 
-		if textBufStartIndexRel < startIndexRel {
-			highIndexRel = medianIndexRel - 1
-		} else if textBufStartIndexRel > endIndexRel {
-			lowIndexRel = medianIndexRel + 1
-		} else {
-			outLine = p
-			pIndex = medianIndexRel
-			break
-		}
+	if textBufStartIndexRel >= uint64(it.Buf.Len()) {
+		return nil, 0, fmt.Errorf("text buffer relative index %d is out of bounds of text buffer with length %d", textBufStartIndexRel, it.Buf.Len())
 	}
 
-	if outLine == nil {
-		panic(fmt.Sprintf("Could not find line for text buffer relative index %d", textBufStartIndexRel))
+	// Write count of the char, which lets us compare it with line start/end write counts
+	charWriteCount := it.Buf.Written() - uint64(it.Buf.Len()) + textBufStartIndexRel + 1
+
+	// Lines are ordered and don't overlap, so we binary search for the line containing the char
+	lineIndex, found := ring.BinarySearchFunc(lines, func(l Line) int {
+
+		if l.EndIndex_WriteCount < charWriteCount {
+			return -1
+		}
+
+		if l.StartIndex_WriteCount >= charWriteCount {
+			return 1
+		}
+
+		return 0
+	})
+
+	// Lines with overwritten starts aren't returned because their start can't be used as a textBuf index
+	if found {
+
+		p := lines.GetPtr(uint64(lineIndex))
+		if IsLineValid(it.Buf, p) {
+			return p, uint64(lineIndex), nil
+		}
 	}
 
-	return outLine, pIndex
+	return nil, 0, assert.Check(false, "Could not find line for text buffer relative index %d", textBufStartIndexRel)
 }
 
 type LineStatus byte
@@ -1208,18 +3186,18 @@ const (
 
 // IsLineValid returns true only if the status is LineStatus_Valid
 func IsLineValid(textBuf *ring.Buffer[byte], p *Line) bool {
-	isValid := textBuf.WrittenElements-p.StartIndex_WriteCount < uint64(textBuf.Cap)
+	isValid := textBuf.Written()-p.StartIndex_WriteCount < uint64(textBuf.Cap())
 	return isValid
 }
 
 func getLineStatus(textBuf *ring.Buffer[byte], p *Line) LineStatus {
 
-	startValid := textBuf.WrittenElements-p.StartIndex_WriteCount < uint64(textBuf.Cap)
+	startValid := textBuf.Written()-p.StartIndex_WriteCount < uint64(textBuf.Cap())
 	if startValid {
 		return LineStatus_Valid
 	}
 
-	endValid := textBuf.WrittenElements-p.EndIndex_WriteCount < uint64(textBuf.Cap)
+	endValid := textBuf.Written()-p.EndIndex_WriteCount < uint64(textBuf.Cap())
 	if endValid {
 		return LineStatus_PartiallyInvalid
 	}
@@ -1,9 +1,29 @@
 package main_test
 
 import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/bloeys/gglm/gglm"
+	nterm "github.com/bloeys/nterm"
+	"github.com/bloeys/nterm/ansi"
 	"github.com/bloeys/nterm/glyphs"
+	"github.com/bloeys/nterm/ring"
+	"github.com/bloeys/nterm/theme"
+	"github.com/golang/freetype/truetype"
 	"golang.org/x/image/math/fixed"
 )
 
@@ -39,8 +59,2403 @@ func TestI26_6ToF32(t *testing.T) {
 	Check(t, ans, glyphs.I26_6ToF32(x))
 }
 
+func TestStripAnsi(t *testing.T) {
+
+	// Empty
+	Check(t, "", ansi.StripAnsiString(""))
+	Check(t, 0, len(ansi.StripAnsi(nil, nil)))
+
+	// No codes
+	Check(t, "hello", ansi.StripAnsiString("hello"))
+
+	// Single and back to back codes
+	Check(t, "hello", ansi.StripAnsiString("\x1b[31mhello\x1b[0m"))
+	Check(t, "a bold red b", ansi.StripAnsiString("a \x1b[1m\x1b[31mbold red\x1b[0m\x1b[0m b"))
+	Check(t, "", ansi.StripAnsiString("\x1b[?1049h\x1b[5 q\x1b[6n"))
+
+	// Incomplete codes are kept
+	Check(t, "text\x1b[31", ansi.StripAnsiString("\x1b[0mtext\x1b[31"))
+	Check(t, "text\x1b[", ansi.StripAnsiString("text\x1b["))
+
+	// Appends to dst
+	dst := []byte("start ")
+	Check(t, "start end", string(ansi.StripAnsi([]byte("\x1b[32mend"), dst)))
+}
+
+func TestDecPrivateModes(t *testing.T) {
+
+	info := ansi.InfoFromAnsiCode([]byte("\x1b[?25l"))
+	Check(t, ansi.CSIType_DECRST, info.Type)
+	Check(t, 1, len(info.Payload))
+	Check(t, ansi.DecPrivateMode_CursorVisible, int(info.Payload[0].Info.X()))
+
+	// Many modes at once
+	info = ansi.InfoFromAnsiCode([]byte("\x1b[?1049;25h"))
+	Check(t, ansi.CSIType_DECSET, info.Type)
+	Check(t, 2, len(info.Payload))
+	Check(t, ansi.DecPrivateMode_AltScreenBuf, int(info.Payload[0].Info.X()))
+	Check(t, ansi.DecPrivateMode_CursorVisible, int(info.Payload[1].Info.X()))
+}
+
+func TestDeviceAttributeQueries(t *testing.T) {
+
+	Check(t, ansi.CSIType_DA1, ansi.InfoFromAnsiCode([]byte("\x1b[c")).Type)
+	Check(t, ansi.CSIType_DA1, ansi.InfoFromAnsiCode([]byte("\x1b[0c")).Type)
+	Check(t, ansi.CSIType_DA2, ansi.InfoFromAnsiCode([]byte("\x1b[>c")).Type)
+	Check(t, ansi.CSIType_DA2, ansi.InfoFromAnsiCode([]byte("\x1b[>0c")).Type)
+	Check(t, ansi.CSIType_XTVERSION, ansi.InfoFromAnsiCode([]byte("\x1b[>q")).Type)
+	Check(t, ansi.CSIType_XTVERSION, ansi.InfoFromAnsiCode([]byte("\x1b[>0q")).Type)
+
+	// Other codes with the same final bytes aren't queries
+	Check(t, ansi.CSIType_Unknown, ansi.InfoFromAnsiCode([]byte("\x1b[1c")).Type)
+	Check(t, ansi.CSIType_Unknown, ansi.InfoFromAnsiCode([]byte("\x1b[>1c")).Type)
+	Check(t, ansi.CSIType_DECSCUSR, ansi.InfoFromAnsiCode([]byte("\x1b[2 q")).Type)
+
+	// Queries are answered instead of being kept in textBuf
+	nt := nterm.NewTextOnlyNterm()
+	nt.WriteToTextBuf([]byte("a\x1b[cb\x1b[>0qc\x1b[>cd\x1b[31me"))
+	Check(t, "abcd\x1b[31me", nt.TextBufText())
+}
+
+// bufWriteCloser keeps what is written to it, which lets tests read what nterm writes to the stdin of a cmd
+type bufWriteCloser struct {
+	strings.Builder
+}
+
+func (b *bufWriteCloser) Close() error {
+	return nil
+}
+
+func TestCursorPosReport(t *testing.T) {
+
+	nt := nterm.NewTextOnlyNterm()
+	nt.SetScreenSize(790, 400, 10, 20)
+	w, _, _, _ := nt.GridSizes()
+
+	stdin := &bufWriteCloser{}
+	nt.SetActiveCmd(exec.Command("vim"), stdin)
+
+	// Text before the request in the same write is part of the position, even though nothing was drawn yet
+	nt.WriteToTextBuf([]byte("ab\ncde\x1b[6n"))
+	Check(t, "\x1b[2;4R", stdin.String())
+	Check(t, "ab\ncde", nt.TextBufText())
+
+	stdin.Reset()
+	nt.WriteToTextBuf([]byte(strings.Repeat("x", int(w)) + "\x1b[6n"))
+	Check(t, "\x1b[3;4R", stdin.String())
+
+	// The line number gutter isn't part of the column
+	nt.Settings.ShowLineNumbers = true
+	stdin.Reset()
+	nt.WriteToTextBuf([]byte("\nf\x1b[6n"))
+	Check(t, "\x1b[4;2R", stdin.String())
+}
+
+func TestDecSpecialGraphics(t *testing.T) {
+
+	Check(t, '\u2500', ansi.DEC_SpecialGraphics('q'))
+	Check(t, '\u2502', ansi.DEC_SpecialGraphics('x'))
+	Check(t, '\u25C6', ansi.DEC_SpecialGraphics('`'))
+	Check(t, '\u00B7', ansi.DEC_SpecialGraphics('~'))
+	Check(t, 'A', ansi.DEC_SpecialGraphics('A'))
+	Check(t, '\u007F', ansi.DEC_SpecialGraphics('\u007F'))
+
+	index, charset := ansi.NextSCSCode([]byte("ab\x1b(0q"))
+	Check(t, 2, index)
+	Check(t, ansi.Charset_DecSpecialGraphics, charset)
+
+	index, _ = ansi.NextSCSCode([]byte("ab\x1b("))
+	Check(t, -1, index)
+
+	index, _ = ansi.NextSCSCode([]byte("\x1b[0m"))
+	Check(t, -1, index)
+
+	// Switching charsets while writing, including between other codes
+	nt, grid, fg, bg := nterm.NewTestGrid(8, 1)
+	nt.DrawTextAnsiCodesOnGrid(grid, []byte("q\x1b(0lq\x1b[31mk\x1b(Bq"), fg, bg)
+	Check(t, "q\u250C\u2500\u2510q", rowText(grid, 0))
+
+	// The charset is kept between writes until the grid is cleared
+	nt.DrawTextAnsiCodesOnGrid(grid, []byte("\x1b(0x"), fg, bg)
+	nt.DrawTextAnsiCodesOnGrid(grid, []byte("x"), fg, bg)
+	Check(t, "q\u250C\u2500\u2510q\u2502\u2502", rowText(grid, 0))
+
+	grid.ClearAll()
+	grid.SetCursor(0, 0)
+	grid.WriteString("x", fg, bg)
+	Check(t, "x", rowText(grid, 0))
+}
+
+func TestAnsiEncoder(t *testing.T) {
+
+	// Each code is parsed back into what was encoded
+	fgColor := gglm.NewVec4(1, 0, 51.0/255, 1)
+	bgColor := gglm.NewVec4(0, 128.0/255, 1, 1)
+
+	e := ansi.Encoder{}
+	e.SetFgColor(*fgColor)
+	e.SetBgColor(*bgColor)
+	e.WriteString("hi")
+	e.Reset()
+	e.MoveCursor(0, 4)
+	e.ClearScreen()
+	e.SetTitle("nterm")
+	Check(t, "\x1b[38;2;255;0;51m\x1b[48;2;0;128;255mhi\x1b[0m\x1b[1;5H\x1b[2J\x1b]0;nterm\a", string(e.Bytes()))
+
+	info := ansi.InfoFromAnsiCode([]byte("\x1b[38;2;255;0;51m"))
+	Check(t, ansi.CSIType_SGR, info.Type)
+	Check(t, 1, len(info.Payload))
+	Check(t, ansi.AnsiCodePayloadType_ColorFg, info.Payload[0].Type)
+	Check(t, *fgColor, info.Payload[0].Info)
+
+	payload := ansi.ParseSGRArgs([]byte("48;2;0;128;255"))
+	Check(t, 1, len(payload))
+	Check(t, ansi.AnsiCodePayloadType_ColorBg, payload[0].Type)
+	Check(t, *bgColor, payload[0].Info)
+
+	payload = ansi.ParseSGRArgs([]byte("0"))
+	Check(t, 1, len(payload))
+	Check(t, ansi.AnsiCodePayloadType_Reset, payload[0].Type)
+
+	// Codes after an RGB color are still parsed, and alpha isn't encoded
+	e = ansi.Encoder{}
+	e.SetFgColor(*gglm.NewVec4(0, 0, 0, 0.5))
+	payload = ansi.ParseSGRArgs(append(e.Bytes()[2:len(e.Bytes())-1], ";41"...))
+	Check(t, 2, len(payload))
+	Check(t, *gglm.NewVec4(0, 0, 0, 1), payload[0].Info)
+	Check(t, ansi.AnsiCodePayloadType_ColorBg, payload[1].Type)
+	Check(t, ansi.ColorFromSgrCode(ansi.Ansi_Bg_Red), payload[1].Info)
+
+	info = ansi.InfoFromAnsiCode([]byte("\x1b[1;5H"))
+	Check(t, ansi.CSIType_CUP, info.Type)
+	info = ansi.InfoFromAnsiCode([]byte("\x1b[2J"))
+	Check(t, ansi.CSIType_ED, info.Type)
+}
+
+func TestThemeColors(t *testing.T) {
+
+	index, ok := ansi.Color16IndexFromSgrCode(ansi.Ansi_Fg_Red)
+	Check(t, true, ok)
+	Check(t, theme.Color_Red, index)
+	index, ok = ansi.Color16IndexFromSgrCode(ansi.Ansi_Bg_Bright_White)
+	Check(t, true, ok)
+	Check(t, theme.Color_BrightWhite, index)
+	_, ok = ansi.Color16IndexFromSgrCode(38)
+	Check(t, false, ok)
+
+	// Without a theme the xterm palette is used
+	nt, grid, fg, bg := nterm.NewTestGrid(8, 1)
+	nt.DrawTextAnsiCodesOnGrid(grid, []byte("\x1b[31ma"), fg, bg)
+	Check(t, ansi.XtermPalette()[theme.Color_Red], grid.Tiles[0][0].FgColor)
+
+	// Base 16 colors come from the theme while RGB colors are unchanged
+	th := theme.ThemeSolarizedLight
+	nt.SetTheme(&th)
+	Check(t, th.DefaultFg, nt.Settings.DefaultFgColor)
+	Check(t, th.DefaultBg, nt.Settings.DefaultBgColor)
+	Check(t, th.CursorColor, nt.Settings.CursorColor)
+	Check(t, th.Colors[theme.Color_BrightWhite], nt.Settings.ColorPalette[theme.Color_BrightWhite])
+	Check(t, ansi.XtermPalette()[16], nt.Settings.ColorPalette[16])
+
+	grid = nterm.NewGlyphGrid(8, 1)
+	nt.DrawTextAnsiCodesOnGrid(grid, []byte("\x1b[31;102ma\x1b[38;2;0;0;255mb\x1b[0mc"), fg, bg)
+	Check(t, th.Colors[theme.Color_Red], grid.Tiles[0][0].FgColor)
+	Check(t, th.Colors[theme.Color_BrightGreen], grid.Tiles[0][0].BgColor)
+	Check(t, *gglm.NewVec4(0, 0, 1, 1), grid.Tiles[0][1].FgColor)
+	Check(t, th.DefaultFg, grid.Tiles[0][2].FgColor)
+	Check(t, th.DefaultBg, grid.Tiles[0][2].BgColor)
+}
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata with the current output")
+
+func TestGlyphGridGolden(t *testing.T) {
+
+	tests := []struct {
+		name          string
+		width, height uint
+		text          string
+	}{
+		{name: "plain", width: 8, height: 3, text: "hello\nworld, wrapped\n"},
+		{name: "colored", width: 8, height: 2, text: "\x1b[31mred\x1b[0m \x1b[42;97mgreen\x1b[38;2;0;128;255mrgb\x1b[0m!"},
+		// Only new lines, wrapping and the editing codes move the cursor when writing to the grid
+		{name: "cursor_movement", width: 8, height: 4, text: "abcdefghij\nxy\x1b[2@z\nlast\x1b[1L\x1b[34minserted"},
+	}
+
+	for _, test := range tests {
+
+		nt := nterm.NewTextOnlyNterm()
+		nt.Settings.DefaultFgColor = *gglm.NewVec4(1, 1, 1, 1)
+		fg := nt.Settings.DefaultFgColor
+		bg := nt.Settings.DefaultBgColor
+		grid := nterm.NewGlyphGrid(test.width, test.height)
+		nt.DrawTextAnsiCodesOnGrid(grid, []byte(test.text), &fg, &bg)
+
+		got, err := grid.MarshalText()
+		Check(t, true, err == nil)
+
+		path := filepath.Join("testdata", "grid_"+test.name+".golden")
+		if *updateGolden {
+			err = os.WriteFile(path, got, 0644)
+			Check(t, true, err == nil)
+		}
+
+		expected, err := os.ReadFile(path)
+		Check(t, true, err == nil)
+		Check(t, string(expected), string(got))
+
+		// Unmarshaling gives the same grid
+		unmarshaled, err := nterm.UnmarshalGlyphGrid(expected)
+		Check(t, true, err == nil)
+		Check(t, test.width, unmarshaled.SizeX)
+		Check(t, test.height, unmarshaled.SizeY)
+
+		remarshaled, _ := unmarshaled.MarshalText()
+		Check(t, string(expected), string(remarshaled))
+	}
+}
+
+func TestGlyphGridMarshalText(t *testing.T) {
+
+	// Glyphs that clash with the separators, wide runes and empty tiles survive a round trip
+	grid := nterm.NewGlyphGrid(6, 1)
+	grid.WriteString("|\t世", gglm.NewVec4(0.1, 0.2, 0.3, 1), gglm.NewVec4(0, 0, 0, 0.5))
+	Check(t, nterm.WideGlyphTail, grid.Tiles[0][3].Glyph)
+
+	data, err := grid.MarshalText()
+	Check(t, true, err == nil)
+	Check(t, true, strings.HasPrefix(string(data), "'|'|0.1,0.2,0.3,1|0,0,0,0.5\t'\\t'|"))
+
+	unmarshaled, err := nterm.UnmarshalGlyphGrid(data)
+	Check(t, true, err == nil)
+	for x := 0; x < 6; x++ {
+		Check(t, grid.Tiles[0][x].Glyph, unmarshaled.Tiles[0][x].Glyph)
+		Check(t, grid.Tiles[0][x].FgColor, unmarshaled.Tiles[0][x].FgColor)
+		Check(t, grid.Tiles[0][x].BgColor, unmarshaled.Tiles[0][x].BgColor)
+	}
+
+	// Errors
+	_, err = nterm.UnmarshalGlyphGrid(nil)
+	Check(t, true, err != nil)
+
+	_, err = nterm.UnmarshalGlyphGrid([]byte("'a'|1,1,1,1|0,0,0,0\t'b'|1,1,1,1|0,0,0,0\n'c'|1,1,1,1|0,0,0,0\n"))
+	Check(t, true, err != nil && strings.Contains(err.Error(), "row 1"))
+
+	_, err = nterm.UnmarshalGlyphGrid([]byte("'ab'|1,1,1,1|0,0,0,0"))
+	Check(t, true, err != nil)
+
+	_, err = nterm.UnmarshalGlyphGrid([]byte("'a'|1,1,1|0,0,0,0"))
+	Check(t, true, err != nil)
+
+	_, err = nterm.UnmarshalGlyphGrid([]byte("'a'|1,1,1,1"))
+	Check(t, true, err != nil)
+}
+
+func TestColorPalette(t *testing.T) {
+
+	palette := ansi.XtermPalette()
+	Check(t, *gglm.NewVec4(205/255.0, 0, 0, 1), palette[theme.Color_Red])
+	Check(t, *gglm.NewVec4(1, 135/255.0, 0, 1), palette[208])
+	Check(t, *gglm.NewVec4(8/255.0, 8/255.0, 8/255.0, 1), palette[232])
+	Check(t, *gglm.NewVec4(238/255.0, 238/255.0, 238/255.0, 1), palette[255])
+
+	// 256 colors use the palette, and codes after them are still parsed
+	payload := ansi.ParseSGRArgs([]byte("38;5;208;48;5;16;41"))
+	Check(t, 3, len(payload))
+	Check(t, ansi.AnsiCodePayloadType_ColorFg, payload[0].Type)
+	Check(t, true, payload[0].UsesPalette)
+	Check(t, uint8(208), payload[0].PaletteIndex)
+	Check(t, palette[208], payload[0].Info)
+	Check(t, ansi.AnsiCodePayloadType_ColorBg, payload[1].Type)
+	Check(t, uint8(16), payload[1].PaletteIndex)
+	Check(t, true, payload[2].UsesPalette)
+	Check(t, uint8(theme.Color_Red), payload[2].PaletteIndex)
+
+	payload = ansi.ParseSGRArgs([]byte("38;2;0;0;255"))
+	Check(t, false, payload[0].UsesPalette)
+
+	// Colors come from the settings palette
+	nt := nterm.NewTextOnlyNterm()
+	nt.Settings.ColorPalette[theme.Color_Red] = *gglm.NewVec4(0.5, 0.5, 0.5, 1)
+	nt.Settings.ColorPalette[208] = *gglm.NewVec4(0.25, 0.25, 0.25, 1)
+	fg, bg := nterm.NewTestColors()
+	grid := nterm.NewGlyphGrid(8, 1)
+	nt.DrawTextAnsiCodesOnGrid(grid, []byte("\x1b[31ma\x1b[38;5;208;41mb"), fg, bg)
+	Check(t, *gglm.NewVec4(0.5, 0.5, 0.5, 1), grid.Tiles[0][0].FgColor)
+	Check(t, *gglm.NewVec4(0.25, 0.25, 0.25, 1), grid.Tiles[0][1].FgColor)
+	Check(t, *gglm.NewVec4(0.5, 0.5, 0.5, 1), grid.Tiles[0][1].BgColor)
+
+	// Loading from a file
+	dir := t.TempDir()
+	writePalette := func(name string, colors []string) string {
+
+		path := filepath.Join(dir, name)
+		err := os.WriteFile(path, []byte(strings.Join(colors, "\n")), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return path
+	}
+
+	colors := make([]string, 256)
+	for i := 0; i < len(colors); i++ {
+		colors[i] = nterm.FormatHexColor(&palette[i])
+	}
+	colors[1] = "#ff8000"
+	colors[255] = "#00000080"
+
+	loaded, err := nterm.LoadPaletteFromFile(writePalette("ok.palette", append(colors, "", "")))
+	Check(t, true, err == nil)
+	Check(t, *gglm.NewVec4(1, 128/255.0, 0, 1), loaded[1])
+	Check(t, *gglm.NewVec4(0, 0, 0, 128/255.0), loaded[255])
+	Check(t, palette[208], loaded[208])
+
+	_, err = nterm.LoadPaletteFromFile(filepath.Join(dir, "missing.palette"))
+	Check(t, true, os.IsNotExist(err))
+
+	_, err = nterm.LoadPaletteFromFile(writePalette("short.palette", colors[:255]))
+	Check(t, true, err != nil && strings.Contains(err.Error(), "255 colors"))
+
+	_, err = nterm.LoadPaletteFromFile(writePalette("long.palette", append(colors, "#ffffff")))
+	Check(t, true, err != nil && strings.Contains(err.Error(), "more than 256"))
+
+	colors[9] = "red"
+	_, err = nterm.LoadPaletteFromFile(writePalette("bad.palette", colors))
+	Check(t, true, err != nil && strings.Contains(err.Error(), "line 10"))
+}
+
+func TestBlink(t *testing.T) {
+
+	info := ansi.InfoFromAnsiCode([]byte("\x1b[5;31;6;25m"))
+	Check(t, 4, len(info.Payload))
+	Check(t, ansi.AnsiCodePayloadType_Blink, info.Payload[0].Type)
+	Check(t, float32(5), info.Payload[0].Info.X())
+	Check(t, float32(6), info.Payload[2].Info.X())
+	Check(t, float32(25), info.Payload[3].Info.X())
+
+	// Blinking lasts until SGR 25 or a reset
+	nt, grid, fg, bg := nterm.NewTestGrid(8, 1)
+	nt.DrawTextAnsiCodesOnGrid(grid, []byte("a\x1b[5mb\x1b[6mc\x1b[25md\x1b[5me\x1b[0mf"), fg, bg)
+	Check(t, "abcdef", rowText(grid, 0))
+
+	expected := []struct{ blink, rapid bool }{{false, false}, {true, false}, {true, true}, {false, false}, {true, false}, {false, false}}
+	for x, e := range expected {
+		Check(t, e.blink, grid.Tiles[0][x].Blink)
+		Check(t, e.rapid, grid.Tiles[0][x].RapidBlink)
+	}
+
+	// Clearing stops blinking
+	nt.DrawTextAnsiCodesOnGrid(grid, []byte("\x1b[6m"), fg, bg)
+	grid.ClearAll()
+	grid.SetCursor(0, 0)
+	grid.WriteString("x", fg, bg)
+	Check(t, false, grid.Tiles[0][0].Blink)
+
+	// Visible for the first half of each period
+	Check(t, true, nterm.IsBlinkOn(0, 100))
+	Check(t, true, nterm.IsBlinkOn(49, 100))
+	Check(t, false, nterm.IsBlinkOn(50, 100))
+	Check(t, false, nterm.IsBlinkOn(99, 100))
+	Check(t, true, nterm.IsBlinkOn(1030, 100))
+	Check(t, true, nterm.IsBlinkOn(75, 0))
+}
+
+func TestReverseVideo(t *testing.T) {
+
+	info := ansi.InfoFromAnsiCode([]byte("\x1b[7;5;27m"))
+	Check(t, 3, len(info.Payload))
+	Check(t, ansi.AnsiCodePayloadType_ReverseVideo, info.Payload[0].Type)
+	Check(t, float32(7), info.Payload[0].Info.X())
+	Check(t, ansi.AnsiCodePayloadType_Blink, info.Payload[1].Type)
+	Check(t, float32(27), info.Payload[2].Info.X())
+
+	// Reverse video lasts until SGR 27 or a reset, and composes with blinking
+	nt, grid, fg, bg := nterm.NewTestGrid(8, 1)
+	nt.DrawTextAnsiCodesOnGrid(grid, []byte("a\x1b[7mb\x1b[5mc\x1b[27md\x1b[7me\x1b[0mf"), fg, bg)
+	Check(t, "abcdef", rowText(grid, 0))
+
+	expected := []struct{ reverse, blink bool }{{false, false}, {true, false}, {true, true}, {false, true}, {true, true}, {false, false}}
+	for x, e := range expected {
+		Check(t, e.reverse, grid.Tiles[0][x].ReverseVideo)
+		Check(t, e.blink, grid.Tiles[0][x].Blink)
+	}
+
+	// Clearing stops reverse video
+	nt.DrawTextAnsiCodesOnGrid(grid, []byte("\x1b[7m"), fg, bg)
+	grid.ClearAll()
+	grid.SetCursor(0, 0)
+	grid.WriteString("x", fg, bg)
+	Check(t, false, grid.Tiles[0][0].ReverseVideo)
+
+	// Colors are swapped, but a transparent bg becomes an opaque fg
+	newFg, newBg := nterm.ReverseVideoColors(*gglm.NewVec4(1, 0.5, 0, 1), *gglm.NewVec4(0, 0, 0.5, 0.5))
+	Check(t, *gglm.NewVec4(0, 0, 0.5, 0.5), newFg)
+	Check(t, *gglm.NewVec4(1, 0.5, 0, 1), newBg)
+
+	newFg, newBg = nterm.ReverseVideoColors(*fg, *bg)
+	Check(t, *gglm.NewVec4(0, 0, 0, 1), newFg)
+	Check(t, *fg, newBg)
+
+	// Tiles keep their colors and are only drawn swapped. Instances are 13 floats, where the color starts at 4
+	gr := newBgRunsGlyphRend(bg)
+	gr.ScreenWidth, gr.ScreenHeight = 800, 100
+	nt.SetGlyphRend(gr)
+	grid = nt.ActiveGlyphGrid()
+	nt.DrawTextAnsiCodesOnGrid(grid, []byte("a\x1b[7ma"), fg, bg)
+	Check(t, *fg, grid.Tiles[0][1].FgColor)
+	Check(t, *bg, grid.Tiles[0][1].BgColor)
+
+	instanceColor := func(vbo []float32, i int) gglm.Vec4 {
+		c := vbo[i*13+4:]
+		return *gglm.NewVec4(c[0], c[1], c[2], c[3])
+	}
+
+	nt.DrawGlyphGrid()
+	Check(t, uint32(2), gr.GlyphFgCount)
+	Check(t, uint32(2), gr.GlyphBgCount)
+	Check(t, *fg, instanceColor(gr.GlyphFgVBO, 0))
+	Check(t, *bg, instanceColor(gr.GlyphBgVBO, 0))
+	Check(t, *gglm.NewVec4(0, 0, 0, 1), instanceColor(gr.GlyphFgVBO, 1))
+	Check(t, *fg, instanceColor(gr.GlyphBgVBO, 1))
+}
+
+func TestBoldItalic(t *testing.T) {
+
+	// Leading zeros aren't resets, so codes like 01;34 (used by ls) are bold
+	info := ansi.InfoFromAnsiCode([]byte("\x1b[01;34;22;3;23m"))
+	Check(t, 5, len(info.Payload))
+	Check(t, ansi.AnsiCodePayloadType_Bold, info.Payload[0].Type)
+	Check(t, float32(1), info.Payload[0].Info.X())
+	Check(t, ansi.AnsiCodePayloadType_ColorFg, info.Payload[1].Type)
+	Check(t, float32(22), info.Payload[2].Info.X())
+	Check(t, ansi.AnsiCodePayloadType_Italic, info.Payload[3].Type)
+	Check(t, float32(23), info.Payload[4].Info.X())
+
+	// Tiles with 'B' should be bold, tiles with 'I' italic and tiles with 'X' both
+	nt, grid, fg, bg := nterm.NewTestGrid(8, 1)
+	nt.DrawTextAnsiCodesOnGrid(grid, []byte("a\x1b[1mB\x1b[3mX\x1b[22mI\x1b[23ma\x1b[0;1mB\x1b[0;31ma"), fg, bg)
+	Check(t, "aBXIaBa", rowText(grid, 0))
+
+	for x, r := range rowText(grid, 0) {
+		Check(t, r == 'B' || r == 'X', grid.Tiles[0][x].Bold)
+		Check(t, r == 'I' || r == 'X', grid.Tiles[0][x].Italic)
+	}
+
+	// Styles after a reset in the same code still apply
+	Check(t, nt.Settings.ColorPalette[1], grid.Tiles[0][6].FgColor)
+
+	// Styles set before the visible text are replayed
+	nt.WriteToTextBuf([]byte("\x1b[1;3ma\nb"))
+	grid = nterm.NewGlyphGrid(8, 1)
+	nterm.ReplaySgrCodes(nt, grid, 0, int64(len(nt.TextBufText())-1), fg, bg)
+	grid.WriteString("x", fg, bg)
+	Check(t, true, grid.Tiles[0][0].Bold)
+	Check(t, true, grid.Tiles[0][0].Italic)
+}
+
+func TestHyperlinks(t *testing.T) {
+
+	// Both BEL and ST end OSC codes, and params are ignored
+	index, code := ansi.NextAnsiCode([]byte("ab\x1b]8;id=1;https://example.com\x1b\\link"))
+	Check(t, 2, index)
+	Check(t, "\x1b]8;id=1;https://example.com\x1b\\", string(code))
+
+	info := ansi.InfoFromAnsiCode(code)
+	Check(t, ansi.CSIType_Hyperlink, info.Type)
+	Check(t, "https://example.com", info.URI)
+
+	info = ansi.InfoFromAnsiCode([]byte("\x1b]8;;\a"))
+	Check(t, ansi.CSIType_Hyperlink, info.Type)
+	Check(t, "", info.URI)
+
+	// Other OSC codes are stripped but not supported, and unterminated ones are kept as text
+	Check(t, ansi.CSIType_Unknown, ansi.InfoFromAnsiCode([]byte("\x1b]0;title\a")).Type)
+	Check(t, "ab", ansi.StripAnsiString("a\x1b]0;title\ab"))
+	Check(t, "a\x1b]8;;x", ansi.StripAnsiString("a\x1b]8;;x"))
+	Check(t, "a\x1b]0;tb", ansi.StripAnsiString("a\x1b]0;t\x1b[31mb"))
+
+	// Tiles between the start and end of a link have its URL
+	e := ansi.Encoder{}
+	e.WriteString("a")
+	e.SetHyperlink("https://example.com")
+	e.WriteString("bc")
+	e.SetHyperlink("")
+	e.WriteString("d")
+
+	nt, grid, fg, bg := nterm.NewTestGrid(8, 1)
+	nt.DrawTextAnsiCodesOnGrid(grid, e.Bytes(), fg, bg)
+	Check(t, "abcd", rowText(grid, 0))
+	Check(t, "", grid.Tiles[0][0].URL)
+	Check(t, "https://example.com", grid.Tiles[0][1].URL)
+	Check(t, "https://example.com", grid.Tiles[0][2].URL)
+	Check(t, "", grid.Tiles[0][3].URL)
+
+	// SGR resets don't end links, but clearing the grid does
+	nt.DrawTextAnsiCodesOnGrid(grid, []byte("\x1b]8;;https://example.com\a\x1b[0m"), fg, bg)
+	grid.WriteString("e", fg, bg)
+	Check(t, "https://example.com", grid.Tiles[0][4].URL)
+
+	grid.ClearAll()
+	grid.SetCursor(0, 0)
+	grid.WriteString("x", fg, bg)
+	Check(t, "", grid.Tiles[0][0].URL)
+
+	// Links started before the visible text are replayed
+	nt.WriteToTextBuf([]byte("\x1b]8;;https://example.com\aa\nb"))
+	grid = nterm.NewGlyphGrid(8, 1)
+	nterm.ReplaySgrCodes(nt, grid, 0, int64(len(nt.TextBufText())-1), fg, bg)
+	grid.WriteString("x", fg, bg)
+	Check(t, "https://example.com", grid.Tiles[0][0].URL)
+}
+
+func TestCheckLinkScheme(t *testing.T) {
+
+	Check(t, true, nterm.CheckLinkScheme("https://example.com") == nil)
+	Check(t, true, nterm.CheckLinkScheme("http://example.com/a?b=c") == nil)
+	Check(t, true, nterm.CheckLinkScheme("ftp://example.com/file.txt") == nil)
+	Check(t, true, nterm.CheckLinkScheme("mailto:someone@example.com") == nil)
+
+	// Files might be run by their default program, and unknown or missing schemes aren't trusted
+	Check(t, false, nterm.CheckLinkScheme("file:///C:/Windows/System32/calc.exe") == nil)
+	Check(t, false, nterm.CheckLinkScheme("javascript:alert(1)") == nil)
+	Check(t, false, nterm.CheckLinkScheme("ms-settings:") == nil)
+	Check(t, false, nterm.CheckLinkScheme("example.com") == nil)
+	Check(t, false, nterm.CheckLinkScheme("http://[::1") == nil)
+}
+
+func TestReplaySgrCodes(t *testing.T) {
+
+	nt := nterm.NewTextOnlyNterm()
+	text := "\x1b[31mred\n\x1b[5;7mmore\nplain\x1b[42m\x1b[0mend"
+	nt.WriteToTextBuf([]byte(text))
+
+	// Replaying applies the codes but writes nothing
+	replay := func(from, to int) (fg, bg gglm.Vec4, grid *nterm.GlyphGrid) {
+
+		fg = nt.Settings.DefaultFgColor
+		bg = nt.Settings.DefaultBgColor
+		grid = nterm.NewGlyphGrid(8, 1)
+		nterm.ReplaySgrCodes(nt, grid, int64(from), int64(to), &fg, &bg)
+		Check(t, "", rowText(grid, 0))
+
+		grid.WriteString("x", &fg, &bg)
+		return fg, bg, grid
+	}
+
+	fg, bg, grid := replay(0, strings.Index(text, "plain"))
+	Check(t, nt.Settings.ColorPalette[theme.Color_Red], fg)
+	Check(t, nt.Settings.DefaultBgColor, bg)
+	Check(t, true, grid.Tiles[0][0].Blink)
+	Check(t, true, grid.Tiles[0][0].ReverseVideo)
+
+	// Resets are replayed too
+	fg, bg, grid = replay(0, strings.Index(text, "end"))
+	Check(t, nt.Settings.DefaultFgColor, fg)
+	Check(t, nt.Settings.DefaultBgColor, bg)
+	Check(t, false, grid.Tiles[0][0].Blink)
+
+	// Only codes in the range are used
+	fg, _, grid = replay(strings.Index(text, "red"), strings.Index(text, "plain"))
+	Check(t, nt.Settings.DefaultFgColor, fg)
+	Check(t, true, grid.Tiles[0][0].Blink)
+
+	fg, _, _ = replay(0, strings.Index(text, "red"))
+	Check(t, nt.Settings.ColorPalette[theme.Color_Red], fg)
+
+	fg, _, _ = replay(5, 5)
+	Check(t, nt.Settings.DefaultFgColor, fg)
+}
+
+func TestHighlighters(t *testing.T) {
+
+	s := &nterm.Settings{
+		StringColor:  *gglm.NewVec4(1, 0, 0, 1),
+		NumberColor:  *gglm.NewVec4(0, 1, 0, 1),
+		CommentColor: *gglm.NewVec4(0, 0, 1, 1),
+		KeywordColor: *gglm.NewVec4(1, 1, 0, 1),
+	}
+
+	// In masks '.' is uncolored, 's' is a string, 'n' a number, 'c' a comment and 'k' a keyword
+	tests := []struct {
+		name string
+		h    nterm.Highlighter
+		line string
+		mask string
+	}{
+		{"strings", &nterm.DefaultHighlighter{Settings: s}, `x := "a" + 'c'`, `.....sss...sss`},
+		{"escaped quote", &nterm.DefaultHighlighter{Settings: s}, `"a\"b" c`, `ssssss..`},
+		{"escaped backslash", &nterm.DefaultHighlighter{Settings: s}, `"a\\" b`, `sssss..`},
+		{"unterminated string", &nterm.DefaultHighlighter{Settings: s}, `say "hi there`, `....sssssssss`},
+		{"apostrophe in word", &nterm.DefaultHighlighter{Settings: s}, `don't "x"`, `......sss`},
+		{"numbers", &nterm.DefaultHighlighter{Settings: s}, `v2 = 3.14 + 0x1f`, `.....nnnn...nnnn`},
+		{"hash comment", &nterm.DefaultHighlighter{Settings: s}, `a # b "c"`, `..ccccccc`},
+		{"slash comment", &nterm.DefaultHighlighter{Settings: s}, `// 1 "x"`, `cccccccc`},
+		{"url isn't a comment", &nterm.DefaultHighlighter{Settings: s}, `http://x 1`, `.........n`},
+		{"no keywords", &nterm.DefaultHighlighter{Settings: s}, `for x`, `.....`},
+		{"go keywords", &nterm.GoHighlighter{Settings: s}, `func f() { return 1 }`, `kkkk.......kkkkkk.n..`},
+		{"go keywords are whole words", &nterm.GoHighlighter{Settings: s}, `iffy if _if`, `.....kk....`},
+		{"go comment", &nterm.GoHighlighter{Settings: s}, `# go // go`, `..kk.ccccc`},
+		{"go string", &nterm.GoHighlighter{Settings: s}, `"for" 'x'`, `sssss.sss`},
+		{"empty", &nterm.GoHighlighter{Settings: s}, ``, ``},
+	}
+
+	fg, bg := nterm.NewTestColors()
+	colors := map[byte]gglm.Vec4{'.': *fg, 's': s.StringColor, 'n': s.NumberColor, 'c': s.CommentColor, 'k': s.KeywordColor}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			line := []rune(tt.line)
+			tiles := tt.h.Highlight(line, fg, bg)
+			Check(t, len(line), len(tiles))
+			Check(t, len(tt.mask), len(tiles))
+
+			for i := 0; i < len(tiles); i++ {
+				Check(t, line[i], tiles[i].Glyph)
+				Check(t, *bg, tiles[i].BgColor)
+				if tiles[i].FgColor != colors[tt.mask[i]] {
+					t.Fatalf("Expected '%c' color at index %d of %q but got %v\n", tt.mask[i], i, tt.line, tiles[i].FgColor)
+				}
+			}
+		})
+	}
+}
+
+func TestStringLiteralEnd(t *testing.T) {
+
+	tests := []struct {
+		line     string
+		start    int
+		expected int
+	}{
+		{`"abc"`, 0, 5},
+		{`x "y" z`, 2, 5},
+		{`"ab`, 0, 3},
+		{`"a\"b"`, 0, 6},
+		{`"a\`, 0, 3},
+		{`'a"b'`, 0, 5},
+		{`""`, 0, 2},
+	}
+
+	for _, tt := range tests {
+		Check(t, tt.expected, nterm.StringLiteralEnd([]rune(tt.line), tt.start))
+	}
+}
+
+func TestHighlightAndWriteToGrid(t *testing.T) {
+
+	fg, bg := nterm.NewTestColors()
+	nt := nterm.NewTextOnlyNterm()
+	nt.SetScreenSize(790, 400, 10, 20)
+	nt.Settings.KeywordColor = *gglm.NewVec4(1, 1, 0, 1)
+	nt.Settings.NumberColor = *gglm.NewVec4(0, 1, 0, 1)
+	grid := nt.ActiveGlyphGrid()
+
+	// Highlighted tiles are written like any other output
+	nt.Highlighter = &nterm.GoHighlighter{Settings: nt.Settings}
+	nt.HighlightAndWriteToGrid([]rune("go 1\n"), fg, bg)
+	nt.HighlightAndWriteToGrid([]rune("x"), fg, bg)
+	Check(t, "go 1", rowText(grid, 0))
+	Check(t, nt.Settings.KeywordColor, grid.Tiles[0][0].FgColor)
+	Check(t, *fg, grid.Tiles[0][2].FgColor)
+	Check(t, nt.Settings.NumberColor, grid.Tiles[0][3].FgColor)
+	Check(t, 'x', grid.Tiles[1][0].Glyph)
+	Check(t, uint(1), grid.CursorX)
+
+	// Without a highlighter the text keeps the passed colors
+	nt.Highlighter = nil
+	nt.HighlightAndWriteToGrid([]rune(" go"), fg, bg)
+	Check(t, *fg, grid.Tiles[1][2].FgColor)
+}
+
+func TestAtlasForStyle(t *testing.T) {
+
+	regular := &glyphs.FontAtlas{}
+	bold := &glyphs.FontAtlas{}
+	italic := &glyphs.FontAtlas{}
+	boldItalic := &glyphs.FontAtlas{}
+
+	// No style variants means everything uses the regular atlas, with synthetic bold
+	gr := &glyphs.GlyphRend{Atlas: regular}
+	checkAtlasForStyle(t, gr, false, false, regular, false)
+	checkAtlasForStyle(t, gr, true, false, regular, true)
+	checkAtlasForStyle(t, gr, false, true, regular, false)
+	checkAtlasForStyle(t, gr, true, true, regular, true)
+
+	// Only italic
+	gr.ItalicAtlas = italic
+	checkAtlasForStyle(t, gr, false, true, italic, false)
+	checkAtlasForStyle(t, gr, true, true, italic, true)
+
+	// Only bold
+	gr.ItalicAtlas = nil
+	gr.BoldAtlas = bold
+	checkAtlasForStyle(t, gr, true, false, bold, false)
+	checkAtlasForStyle(t, gr, true, true, bold, false)
+	checkAtlasForStyle(t, gr, false, true, regular, false)
+
+	// All variants
+	gr.ItalicAtlas = italic
+	gr.BoldItalicAtlas = boldItalic
+	checkAtlasForStyle(t, gr, false, false, regular, false)
+	checkAtlasForStyle(t, gr, true, false, bold, false)
+	checkAtlasForStyle(t, gr, false, true, italic, false)
+	checkAtlasForStyle(t, gr, true, true, boldItalic, false)
+}
+
+func checkAtlasForStyle(t *testing.T, gr *glyphs.GlyphRend, bold, italic bool, expectedAtlas *glyphs.FontAtlas, expectedSyntheticBold bool) {
+
+	atlas, syntheticBold := gr.AtlasForStyle(bold, italic)
+	if atlas != expectedAtlas || syntheticBold != expectedSyntheticBold {
+		t.Fatalf("Wrong atlas or synthetic bold for bold=%v, italic=%v. Expected synthetic bold=%v but got %v\n", bold, italic, expectedSyntheticBold, syntheticBold)
+	}
+}
+
+func TestGlyphAt(t *testing.T) {
+
+	// V is from the bottom of the 20x10 atlas, so 'a' is 2 pixels from the top
+	atlas := &glyphs.FontAtlas{
+		Img: image.NewRGBA(image.Rect(0, 0, 20, 10)),
+		Glyphs: map[rune]glyphs.FontAtlasGlyph{
+			'a': {Rune: 'a', U: 2, V: 3, SizeU: 4, SizeV: 5},
+			'b': {Rune: 'b', U: 10, V: 0, SizeU: 5, SizeV: 10},
+		},
+	}
+
+	Check(t, image.Rect(2, 2, 6, 7), atlas.GlyphBounds('a'))
+	Check(t, image.Rect(10, 0, 15, 10), atlas.GlyphBounds('b'))
+	Check(t, image.Rectangle{}, atlas.GlyphBounds('c'))
+
+	r, found := atlas.GlyphAt(2, 2)
+	Check(t, 'a', r)
+	Check(t, true, found)
+
+	r, found = atlas.GlyphAt(14, 9)
+	Check(t, 'b', r)
+	Check(t, true, found)
+
+	// Max is exclusive, and the space between glyphs is empty
+	_, found = atlas.GlyphAt(6, 2)
+	Check(t, false, found)
+	_, found = atlas.GlyphAt(8, 5)
+	Check(t, false, found)
+	_, found = atlas.GlyphAt(-1, 20)
+	Check(t, false, found)
+
+	// Glyphs don't overlap
+	for r1 := range atlas.Glyphs {
+		for r2 := range atlas.Glyphs {
+			Check(t, r1 == r2, atlas.GlyphBounds(r1).Overlaps(atlas.GlyphBounds(r2)))
+		}
+	}
+}
+
+func TestAtlasStats(t *testing.T) {
+
+	// 'a' is a 4x5 glyph with 10 white pixels and 'b' is a 5x10 glyph with none
+	img := image.NewRGBA(image.Rect(0, 0, 20, 10))
+	draw.Draw(img, img.Bounds(), image.Black, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(2, 2, 4, 7), image.White, image.Point{}, draw.Src)
+
+	atlasPath := filepath.Join(t.TempDir(), "atlas")
+	err := glyphs.SaveAtlas(atlasPath, &glyphs.FontAtlas{
+		Img: img,
+		Glyphs: map[rune]glyphs.FontAtlasGlyph{
+			'a': {Rune: 'a', U: 2, V: 3, SizeU: 4, SizeV: 5},
+			'b': {Rune: 'b', U: 10, V: 0, SizeU: 5, SizeV: 10},
+		},
+	})
+	Check(t, true, err == nil)
+
+	atlas, err := glyphs.LoadAtlas(atlasPath)
+	Check(t, true, err == nil)
+	Check(t, 2, atlas.GlyphCount)
+	Check(t, image.Pt(20, 10), atlas.AtlasSize)
+	Check(t, float32(20+50)/200, atlas.PackingEfficiency)
+	Check(t, float32(0.25), atlas.AverageGlyphDensity)
+
+	statsPath := filepath.Join(t.TempDir(), "atlas-stats.json")
+	err = atlas.SaveStats(statsPath)
+	Check(t, true, err == nil)
+
+	statsBytes, err := os.ReadFile(statsPath)
+	Check(t, true, err == nil)
+
+	stats := map[string]any{}
+	err = json.Unmarshal(statsBytes, &stats)
+	Check(t, true, err == nil)
+	Check[any](t, float64(2), stats["GlyphCount"])
+	Check[any](t, float64(20), stats["AtlasSizeX"])
+	Check[any](t, float64(10), stats["AtlasSizeY"])
+	Check[any](t, float64(0.35), stats["PackingEfficiency"])
+}
+
+func TestDefaultBoldOffsetX(t *testing.T) {
+
+	// Don't read or write the user's atlas cache
+	cacheDir := glyphs.AtlasCacheDir
+	glyphs.AtlasCacheDir = ""
+	t.Cleanup(func() { glyphs.AtlasCacheDir = cacheDir })
+
+	checkOffset := func(fontSize float64, expectedSpaceAdvance, expectedOffset float32) {
+
+		atlas, err := glyphs.NewFontAtlasFromFile("./res/fonts/CascadiaMono-Regular.ttf", &truetype.Options{Size: fontSize, DPI: 72})
+		Check(t, true, err == nil)
+		Check(t, expectedSpaceAdvance, atlas.SpaceAdvance)
+		Check(t, expectedOffset, glyphs.DefaultBoldOffsetX(atlas))
+	}
+
+	// The offset is 1/12 of the advance
+	checkOffset(24, 14.0625, 1.171875)
+
+	// Small fonts still get a whole pixel
+	checkOffset(12, 7.03125, 1)
+}
+
+// newBgRunsGlyphRend returns a GlyphRend without a window that draws bg colors, which is enough for filling the instance
+// buffers as long as they don't get full
+func newBgRunsGlyphRend(bg *gglm.Vec4) *glyphs.GlyphRend {
+	return &glyphs.GlyphRend{
+		Atlas: &glyphs.FontAtlas{
+			Glyphs:       map[rune]glyphs.FontAtlasGlyph{'a': {Rune: 'a', Advance: 10}},
+			SpaceAdvance: 10,
+			LineHeight:   20,
+		},
+		GlyphFgVBO: make([]float32, glyphs.MaxGlyphsPerBatch*16),
+		GlyphBgVBO: make([]float32, glyphs.MaxGlyphsPerBatch*16),
+		Opts:       glyphs.GlyphRendOpt_BgColor,
+		OptValues:  glyphs.GlyphRendOptValues{BgColor: bg},
+	}
+}
+
+func TestGlyphRendBgRuns(t *testing.T) {
+
+	// Each bg instance is 13 floats, where model pos x is at 8 and model scale x is at 11
+	const floatsPerGlyph = 13
+
+	fg := gglm.NewVec4(1, 1, 1, 1)
+	bg := gglm.NewVec4(0, 0, 0, 1)
+	gr := newBgRunsGlyphRend(bg)
+
+	drawRow := func(x, y float32, count int) {
+		pos := gglm.NewVec3(x, y, 0)
+		for i := 0; i < count; i++ {
+			pos.Data = gr.DrawRune('a', pos, fg).Data
+		}
+	}
+
+	// Cells with the same bg take one stretched instance, but each glyph still takes its own
+	drawRow(0, 100, 4)
+	Check(t, uint32(4), gr.GlyphFgCount)
+	Check(t, uint32(1), gr.GlyphBgCount)
+	Check(t, float32(0), gr.GlyphBgVBO[8])
+	Check(t, float32(40), gr.GlyphBgVBO[11])
+
+	// A new color starts a new run
+	bg.Data = gglm.NewVec4(1, 0, 0, 1).Data
+	drawRow(40, 100, 2)
+	Check(t, uint32(2), gr.GlyphBgCount)
+	Check(t, float32(40), gr.GlyphBgVBO[floatsPerGlyph+8])
+	Check(t, float32(20), gr.GlyphBgVBO[floatsPerGlyph+11])
+
+	// As does a new row or a gap
+	drawRow(60, 80, 1)
+	drawRow(80, 80, 1)
+	Check(t, uint32(4), gr.GlyphBgCount)
+	Check(t, float32(10), gr.GlyphBgVBO[3*floatsPerGlyph+11])
+}
+
+func BenchmarkGlyphRendBgRuns(b *testing.B) {
+
+	fg := gglm.NewVec4(1, 1, 1, 1)
+	bg := gglm.NewVec4(0, 0, 0, 1)
+	gr := newBgRunsGlyphRend(bg)
+
+	// A row of 200 columns with the same colors used to take 200 bg instances
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+
+		gr.GlyphFgCount, gr.GlyphBgCount = 0, 0
+		pos := gglm.NewVec3(0, 100, 0)
+		for x := 0; x < 200; x++ {
+			pos.Data = gr.DrawRune('a', pos, fg).Data
+		}
+	}
+
+	b.ReportMetric(float64(gr.GlyphFgCount), "fg-instances/row")
+	b.ReportMetric(float64(gr.GlyphBgCount), "bg-instances/row")
+}
+
+func TestDrawRuneTabStops(t *testing.T) {
+
+	fg, bg := nterm.NewTestColors()
+	gr := newBgRunsGlyphRend(bg)
+	gr.TabStopInterval = 8
+
+	// Columns are counted from TabOriginX, so a pane that starts at 105 has its first tab stop at 105+8*10
+	gr.TabOriginX = 105
+	pos := gr.DrawRune('\t', gglm.NewVec3(135, 0, 0), fg)
+	Check(t, float32(185), pos.X())
+
+	pos = gr.DrawRune('\t', &pos, fg)
+	Check(t, float32(265), pos.X())
+
+	gr.TabOriginX = 0
+	pos = gr.DrawRune('\t', gglm.NewVec3(30, 0, 0), fg)
+	Check(t, float32(80), pos.X())
+}
+
+func TestDrawGlyphGridReuse(t *testing.T) {
+
+	// Bg instances are 13 floats, where model pos x is at 8
+	fg := gglm.NewVec4(1, 1, 1, 1)
+	bg := gglm.NewVec4(0, 0, 0, 1)
+	gr := newBgRunsGlyphRend(bg)
+	gr.ScreenWidth, gr.ScreenHeight = 800, 100
+
+	nt := nterm.NewTextOnlyNterm()
+	nt.SetGlyphRend(gr)
+	p, err := nt.SplitVertical()
+	Check(t, true, err == nil)
+	p.ActiveGlyphGrid().WriteString("aaa", fg, bg)
+
+	drawFrame := func() {
+		gr.GlyphFgCount, gr.GlyphBgCount = 0, 0
+		p.DrawGlyphGrid()
+	}
+
+	drawFrame()
+	Check(t, uint32(3), gr.GlyphFgCount)
+	Check(t, float32(400), gr.GlyphBgVBO[8])
+
+	// Nothing changed, so the instances of the last draw are used as they are
+	gr.GlyphBgVBO[8] = -1
+	drawFrame()
+	Check(t, uint32(3), gr.GlyphFgCount)
+	Check(t, float32(-1), gr.GlyphBgVBO[8])
+
+	// A wider window moves the pane without changing its grid size, which must redraw it at the new position
+	gr.ScreenWidth = 810
+	nt.LayoutPanes()
+	drawFrame()
+	Check(t, uint32(3), gr.GlyphFgCount)
+	Check(t, float32(405), gr.GlyphBgVBO[8])
+
+	// So do settings changes, like those made in the settings editor
+	gr.GlyphBgVBO[8] = -1
+	p.Settings.PaddingLeft = 10
+	drawFrame()
+	Check(t, float32(415), gr.GlyphBgVBO[8])
+
+	gr.GlyphBgVBO[8] = -1
+	p.Settings.DefaultBgColor = *gglm.NewVec4(0.5, 0, 0, 1)
+	drawFrame()
+	Check(t, float32(415), gr.GlyphBgVBO[8])
+}
+
+func BenchmarkDrawGlyphGrid(b *testing.B) {
+
+	fg := gglm.NewVec4(1, 1, 1, 1)
+	bg := gglm.NewVec4(0, 0, 0, 1)
+	gr := newBgRunsGlyphRend(bg)
+	gr.ScreenWidth, gr.ScreenHeight = 800, 480
+
+	nt := nterm.NewTextOnlyNterm()
+	nt.SetGlyphRend(gr)
+	grid := nt.ActiveGlyphGrid()
+	grid.WriteString(strings.Repeat("a", int(grid.SizeX*grid.SizeY)), fg, bg)
+
+	drawFrame := func() {
+		gr.GlyphFgCount, gr.GlyphBgCount = 0, 0
+		nt.DrawGlyphGrid()
+	}
+
+	// All tiles change every frame, which is also what every frame cost before dirty tracking
+	b.Run("changing", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			grid.MarkAllDirty()
+			drawFrame()
+		}
+	})
+
+	// A static screen reuses the instances of the last draw
+	b.Run("static", func(b *testing.B) {
+		drawFrame()
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			drawFrame()
+		}
+	})
+}
+
+// benchText is ~500k chars of mixed ascii and multi-byte text, similar to what the debug 'drawManyLines' mode draws per frame.
+// The benchmark grids fit all of it so writing never stops early
+var benchText = []byte(strings.Repeat("Hello there, friend! مرحبا\n", 500_000/27))
+
+func TestGlyphGridCopyRegion(t *testing.T) {
+
+	fg, bg := nterm.NewTestColors()
+
+	grid := nterm.NewGlyphGrid(3, 4)
+	grid.WriteString("abcdefghijkl", fg, bg)
+
+	// Shift the middle two rows down by one (overlapping)
+	grid.CopyRegion(1, 2, 2, 0, 0, 3)
+	Check(t, "abcdefdefghi", gridText(grid))
+
+	// Clear the vacated row
+	grid.FillRegion(1, 0, 1, 3, nterm.GridTile{Glyph: ' '})
+	Check(t, "abc   defghi", gridText(grid))
+
+	// Shift up (overlapping) part of the rows
+	grid.CopyRegion(2, 1, 2, 1, 0, 2)
+	Check(t, "abcef hifghi", gridText(grid))
+}
+
+func TestGlyphGridResized(t *testing.T) {
+
+	fg, bg := nterm.NewTestColors()
+
+	grid := nterm.NewGlyphGrid(5, 3)
+	grid.WriteString("abcdefgh", fg, bg)
+	grid.SetCharset(ansi.Charset_DecSpecialGraphics)
+
+	// Narrower grids keep the start of each row, and the cursor stays in the grid
+	narrow := grid.Resized(3, 3)
+	Check(t, "abc", rowText(narrow, 0))
+	Check(t, "fgh", rowText(narrow, 1))
+	Check(t, uint(2), narrow.CursorX)
+	Check(t, uint(1), narrow.CursorY)
+	Check(t, true, narrow.HasDirty())
+
+	// The original grid is unchanged
+	Check(t, "abcde", rowText(grid, 0))
+	Check(t, uint(3), grid.CursorX)
+
+	// Shorter grids drop the rows above the cursor first, and writing continues with the same charset
+	short := grid.Resized(6, 1)
+	Check(t, "fgh", rowText(short, 0))
+	Check(t, uint(3), short.CursorX)
+	Check(t, uint(0), short.CursorY)
+
+	short.WriteString("q", fg, bg)
+	Check(t, "fgh─", rowText(short, 0))
+
+	// A wide rune that loses its tail is dropped
+	wide := nterm.NewGlyphGrid(4, 1)
+	wide.WriteString("ab世", fg, bg)
+	Check(t, "ab", rowText(wide.Resized(3, 1), 0))
+	Check(t, "ab世", rowText(wide.Resized(5, 1), 0))
+}
+
+func TestGlyphGridInsertDelete(t *testing.T) {
+
+	fg, bg := nterm.NewTestColors()
+
+	grid := nterm.NewGlyphGrid(4, 3)
+	grid.WriteString("abcdefghijkl", fg, bg)
+
+	grid.InsertCells(0, 1, 2, nterm.GridTile{Glyph: ' '})
+	Check(t, "a  befghijkl", gridText(grid))
+
+	grid.DeleteCells(1, 1, 2, nterm.GridTile{Glyph: '_'})
+	Check(t, "a  beh__ijkl", gridText(grid))
+
+	grid.InsertLines(1, 1, nterm.GridTile{Glyph: '.'})
+	Check(t, "a  b....eh__", gridText(grid))
+
+	grid.DeleteLines(0, 1, nterm.GridTile{Glyph: '-'})
+	Check(t, "....eh__----", gridText(grid))
+
+	// Counts are clamped to the grid
+	grid.InsertCells(2, 1, 10, nterm.GridTile{Glyph: 'x'})
+	Check(t, "....eh__-xxx", gridText(grid))
+	grid.DeleteLines(1, 10, nterm.GridTile{Glyph: 'y'})
+	Check(t, "....yyyyyyyy", gridText(grid))
+
+	// Codes edit at the cursor
+	info := ansi.InfoFromAnsiCode([]byte("\x1b[3P"))
+	Check(t, ansi.CSIType_DCH, info.Type)
+	Check(t, 1, len(info.Payload))
+	Check(t, ansi.AnsiCodePayloadType_Count, info.Payload[0].Type)
+	Check(t, float32(3), info.Payload[0].Info.X())
+	Check(t, ansi.CSIType_ICH, ansi.InfoFromAnsiCode([]byte("\x1b[@")).Type)
+	Check(t, ansi.CSIType_IL, ansi.InfoFromAnsiCode([]byte("\x1b[2L")).Type)
+	Check(t, float32(1), ansi.InfoFromAnsiCode([]byte("\x1b[0M")).Payload[0].Info.X())
+
+	nt := nterm.NewTextOnlyNterm()
+	grid = nterm.NewGlyphGrid(6, 2)
+	nt.DrawTextAnsiCodesOnGrid(grid, []byte("abc"), fg, bg)
+
+	grid.SetCursor(1, 0)
+	nt.DrawTextAnsiCodesOnGrid(grid, []byte("\x1b[2@"), fg, bg)
+	Check(t, "a  bc", rowText(grid, 0))
+	Check(t, uint(1), grid.CursorX)
+
+	nt.DrawTextAnsiCodesOnGrid(grid, []byte("\x1b[P"), fg, bg)
+	Check(t, "a bc", rowText(grid, 0))
+
+	nt.DrawTextAnsiCodesOnGrid(grid, []byte("\x1b[L"), fg, bg)
+	Check(t, "      ", rowText(grid, 0))
+	Check(t, "a bc", rowText(grid, 1))
+	Check(t, uint(0), grid.CursorX)
+
+	nt.DrawTextAnsiCodesOnGrid(grid, []byte("\x1b[M"), fg, bg)
+	Check(t, "a bc", rowText(grid, 0))
+	Check(t, "      ", rowText(grid, 1))
+}
+
+func TestRepeatLastRune(t *testing.T) {
+
+	fg, bg := nterm.NewTestColors()
+
+	nt := nterm.NewTextOnlyNterm()
+	red := nt.Settings.ColorPalette[1]
+
+	// The repeated char keeps its color even if the colors changed after it was written
+	grid := nterm.NewGlyphGrid(8, 3)
+	nt.DrawTextAnsiCodesOnGrid(grid, []byte("a\x1b[31m-\x1b[0m\x1b[3bx"), fg, bg)
+	Check(t, "a----x", rowText(grid, 0))
+	for x := 1; x <= 4; x++ {
+		Check(t, red, grid.Tiles[0][x].FgColor)
+	}
+	Check(t, nt.Settings.DefaultFgColor, grid.Tiles[0][5].FgColor)
+
+	// Default count is one, and repeats wrap like other writes
+	nt.DrawTextAnsiCodesOnGrid(grid, []byte("\x1b[b\x1b[2b"), fg, bg)
+	Check(t, "a----xxx", rowText(grid, 0))
+	Check(t, "x", rowText(grid, 1))
+
+	// New lines aren't repeated, and nothing is repeated on a cleared grid
+	nt.DrawTextAnsiCodesOnGrid(grid, []byte("\n\x1b[2b"), fg, bg)
+	Check(t, "x", rowText(grid, 1))
+	Check(t, "xx", rowText(grid, 2))
+
+	grid.ClearAll()
+	grid.SetCursor(0, 0)
+	nt.DrawTextAnsiCodesOnGrid(grid, []byte("\x1b[5b"), fg, bg)
+	Check(t, "", rowText(grid, 0))
+}
+
+func TestTabCompletion(t *testing.T) {
+
+	if runtime.GOOS == "windows" {
+		t.Skip("completed paths use '\\' on windows")
+	}
+
+	dir := t.TempDir()
+	for _, name := range []string{"alpha.txt", "beta", "nterm-test-cmd", "nterm-test-data"} {
+		err := os.WriteFile(filepath.Join(dir, name), []byte{}, 0755)
+		Check(t, true, err == nil)
+	}
+	Check(t, true, os.Mkdir(filepath.Join(dir, "alps"), 0755) == nil)
+	Check(t, true, os.Chmod(filepath.Join(dir, "nterm-test-data"), 0644) == nil)
+
+	// Completes text typed into a new cmdBuf
+	nt := nterm.NewTextOnlyNterm()
+	typeAndComplete := func(text string) string {
+		nt = nterm.NewTextOnlyNterm()
+		nt.WriteToCmdBuf([]rune(text))
+		nt.CompleteAtCursor()
+		cmdText, _ := nt.CmdBufText()
+		return cmdText
+	}
+
+	// Many matches complete the common prefix, then cycle
+	Check(t, "cat "+dir+"/alp", typeAndComplete("cat "+dir+"/a"))
+
+	candidates, index := nt.TabCandidates()
+	CheckArr(t, []string{dir + "/alpha.txt", dir + "/alps/"}, candidates)
+	Check(t, -1, index)
+
+	nt.CompleteAtCursor()
+	cmdText, cursorPos := nt.CmdBufText()
+	Check(t, "cat "+dir+"/alpha.txt", cmdText)
+	Check(t, int64(len([]rune(cmdText))), cursorPos)
+
+	nt.CompleteAtCursor()
+	cmdText, _ = nt.CmdBufText()
+	Check(t, "cat "+dir+"/alps/", cmdText)
+
+	nt.CompleteAtCursor()
+	cmdText, _ = nt.CmdBufText()
+	Check(t, "cat "+dir+"/alpha.txt", cmdText)
+
+	// Cycling is one undo step each
+	nt.UndoCmdBuf()
+	cmdText, _ = nt.CmdBufText()
+	Check(t, "cat "+dir+"/alps/", cmdText)
+
+	// A unique file match gets a space and has no candidates to cycle
+	Check(t, "cat "+dir+"/beta ", typeAndComplete("cat "+dir+"/b"))
+	candidates, _ = nt.TabCandidates()
+	Check(t, 0, len(candidates))
+
+	// Text after the cursor is kept
+	nt = nterm.NewTextOnlyNterm()
+	nt.WriteToCmdBuf([]rune("cat " + dir + "/alph | wc"))
+	nt.SetCmdBufCursor(int64(len("cat " + dir + "/alph")))
+	nt.CompleteAtCursor()
+	cmdText, _ = nt.CmdBufText()
+	Check(t, "cat "+dir+"/alpha.txt  | wc", cmdText)
+
+	// No matches change nothing
+	Check(t, "cat "+dir+"/zzz", typeAndComplete("cat "+dir+"/zzz"))
+
+	// Relative paths are completed from the current dir of the pane
+	nt = nterm.NewTextOnlyNterm()
+	nt.WriteToCmdBuf([]rune("cd " + dir + "\n"))
+	nt.HandleReturn()
+	nt.WriteToCmdBuf([]rune("cat ./be"))
+	nt.CompleteAtCursor()
+	cmdText, _ = nt.CmdBufText()
+	Check(t, "cat ./beta ", cmdText)
+
+	// Command names come from $PATH and the builtins
+	t.Setenv("PATH", dir)
+
+	Check(t, "echo ", typeAndComplete("ech"))
+	Check(t, "ls | echo ", typeAndComplete("ls | ec"))
+
+	// Non executable files aren't commands
+	Check(t, "nterm-test-cmd ", typeAndComplete("nterm-t"))
+
+	// Commands aren't completed in argument positions
+	Check(t, "echo ech", typeAndComplete("echo ech"))
+}
+
+func TestGlyphGridScrollX(t *testing.T) {
+
+	fg, bg := nterm.NewTestColors()
+
+	// Lines wrap normally, but their full length is tracked
+	grid := nterm.NewGlyphGrid(6, 3)
+	grid.WriteString("abcdefghij\nxy\n", fg, bg)
+	Check(t, "abcdef", rowText(grid, 0))
+	Check(t, uint(10), grid.LongestLineLen)
+
+	// Scrolled lines skip the first columns and are cut before the last column instead of wrapping
+	grid.ClearAll()
+	Check(t, uint(0), grid.LongestLineLen)
+
+	grid.ScrollX = 2
+	grid.SetCursor(0, 0)
+	grid.WriteString("abcdefghij\nxy\nz\u00e9e\u0301", fg, bg)
+	Check(t, "cdefg", rowText(grid, 0))
+	Check(t, '\n', grid.Tiles[0][5].Glyph)
+	Check(t, "", rowText(grid, 1))
+	Check(t, "e", rowText(grid, 2))
+	Check(t, rune('\u0301'), grid.Tiles[2][0].Mark)
+	Check(t, uint(10), grid.LongestLineLen)
+
+	// Marks of skipped runes are dropped
+	grid.ClearAll()
+	grid.ScrollX = 1
+	grid.SetCursor(0, 0)
+	grid.WriteString("e\u0301\u4e16b", fg, bg)
+	Check(t, "\u4e16b", rowText(grid, 0))
+	Check(t, rune(0), grid.Tiles[0][0].Mark)
+	Check(t, uint(4), grid.LongestLineLen)
+}
+
+func TestParseLinesStreaming(t *testing.T) {
+
+	nt := nterm.NewTextOnlyNterm()
+
+	// A line split over many writes is only added once its new line arrives
+	nterm.WriteToActiveScreen(nt, []byte("hel"))
+	Check(t, int64(0), nt.Lines.Len())
+	Check(t, uint64(0), nt.LineBeingParsed.StartIndex_WriteCount)
+	Check(t, uint64(3), nt.LineBeingParsed.EndIndex_WriteCount)
+
+	nterm.WriteToActiveScreen(nt, []byte("lo\nwor"))
+	Check(t, int64(1), nt.Lines.Len())
+	Check(t, nterm.Line{StartIndex_WriteCount: 0, EndIndex_WriteCount: 6}, nt.Lines.Get(0))
+	Check(t, nterm.Line{StartIndex_WriteCount: 6, EndIndex_WriteCount: 9}, nt.LineBeingParsed)
+
+	nterm.WriteToActiveScreen(nt, []byte("ld"))
+	nterm.WriteToActiveScreen(nt, []byte("\n\n"))
+	Check(t, int64(3), nt.Lines.Len())
+	Check(t, nterm.Line{StartIndex_WriteCount: 6, EndIndex_WriteCount: 12}, nt.Lines.Get(1))
+	Check(t, nterm.Line{StartIndex_WriteCount: 12, EndIndex_WriteCount: 13}, nt.Lines.Get(2))
+	Check(t, nterm.Line{StartIndex_WriteCount: 13, EndIndex_WriteCount: 13}, nt.LineBeingParsed)
+}
+
+func TestGetLineFromTextBufIndex(t *testing.T) {
+
+	textBuf := ring.NewBuffer[byte](16)
+	lines := ring.NewBuffer[nterm.Line](4)
+
+	// Empty buffers
+	line, _, err := nterm.GetLineFromTextBufIndex(textBuf.Iterator(), lines.Iterator(), 0)
+	Check(t, true, line == nil && err == nil)
+
+	// The last line isn't finished so it isn't in lines
+	textBuf.Write([]byte("ab\ncde\nfg")...)
+	lines.Write(nterm.Line{StartIndex_WriteCount: 0, EndIndex_WriteCount: 3}, nterm.Line{StartIndex_WriteCount: 3, EndIndex_WriteCount: 7})
+	checkLineFromTextBufIndex(t, textBuf, lines, 0, 0)
+	checkLineFromTextBufIndex(t, textBuf, lines, 4, 1)
+
+	// Last byte of a line is its new line
+	checkLineFromTextBufIndex(t, textBuf, lines, 2, 0)
+	checkLineFromTextBufIndex(t, textBuf, lines, 6, 1)
+
+	// Chars after the last line and past the end of textBuf
+	_, _, err = nterm.GetLineFromTextBufIndex(textBuf.Iterator(), lines.Iterator(), 7)
+	Check(t, true, err != nil)
+	_, _, err = nterm.GetLineFromTextBufIndex(textBuf.Iterator(), lines.Iterator(), 100)
+	Check(t, true, err != nil)
+
+	// When textBuf wraps the first line loses its start and can't be found anymore
+	textBuf = ring.NewBuffer[byte](8)
+	textBuf.Write([]byte("ab\ncde\nfg")...)
+	_, _, err = nterm.GetLineFromTextBufIndex(textBuf.Iterator(), lines.Iterator(), 0)
+	Check(t, true, err != nil)
+	checkLineFromTextBufIndex(t, textBuf, lines, 3, 1)
+}
+
+func checkLineFromTextBufIndex(t *testing.T, textBuf *ring.Buffer[byte], lines *ring.Buffer[nterm.Line], textBufIndexRel, expectedLineIndex uint64) {
+
+	line, lineIndex, err := nterm.GetLineFromTextBufIndex(textBuf.Iterator(), lines.Iterator(), textBufIndexRel)
+	if err != nil {
+		t.Fatalf("Expected line %d for index %d but got error: %s\n", expectedLineIndex, textBufIndexRel, err.Error())
+	}
+
+	Check(t, expectedLineIndex, lineIndex)
+	Check(t, lines.Get(expectedLineIndex), *line)
+}
+
+func TestFindNLinesWordWrap(t *testing.T) {
+
+	// With 7 chars per row the rows are "one ", "three ", "five\n" and "six\n", then the cursor row at 19
+	textBuf := ring.NewBuffer[byte](32)
+	lines := ring.NewBuffer[nterm.Line](4)
+	textBuf.Write([]byte("one three five\nsix\n")...)
+	lines.Write(nterm.Line{StartIndex_WriteCount: 0, EndIndex_WriteCount: 15}, nterm.Line{StartIndex_WriteCount: 15, EndIndex_WriteCount: 19})
+
+	findNLines := func(startIndex, n int64) int64 {
+		return nterm.FindNLinesIndexIterator(textBuf.Iterator(), lines.Iterator(), startIndex, n, 6, true)
+	}
+
+	// Forward
+	Check(t, 4, findNLines(0, 1))
+	Check(t, 10, findNLines(0, 2))
+	Check(t, 10, findNLines(4, 1))
+	Check(t, 19, findNLines(15, 5))
+
+	// Backward, within a line and across lines
+	Check(t, 4, findNLines(10, -1))
+	Check(t, 10, findNLines(15, -1))
+	Check(t, 0, findNLines(15, -3))
+	Check(t, 0, findNLines(15, -10))
+
+	// From the cursor row, like JumpToBottom
+	Check(t, 15, findNLines(19, -1))
+	Check(t, 10, findNLines(19, -2))
+	Check(t, 4, findNLines(19, -3))
+
+	// Char wrap splits words, so it gives different rows
+	Check(t, 7, nterm.FindNLinesIndexIterator(textBuf.Iterator(), lines.Iterator(), 0, 1, 6, false))
+}
+
+func TestLazyRuneInfos(t *testing.T) {
+
+	unicodeData := "0041;LATIN CAPITAL LETTER A;Lu;0;L;;;;;N;;;;0061;\n" +
+		"0301;COMBINING ACUTE ACCENT;Mn;230;NSM;;;;;N;NON-SPACING ACUTE;;;;\n" +
+		"0628;ARABIC LETTER BEH;Lo;0;AL;;;;;N;;;;;\n" +
+		"FE91;ARABIC LETTER BEH INITIAL FORM;Lo;0;AL;<initial> 0628;;;;N;;;;;\n"
+	arabicShaping := "# Comment\n0628; BEH; D; BEH\n"
+
+	p, err := glyphs.LazyRuneInfosFromBytes([]byte(unicodeData), []byte(arabicShaping))
+	Check(t, true, err == nil)
+
+	ri, ok := p.Get('A')
+	Check(t, true, ok)
+	Check(t, glyphs.Category_Lu, ri.Cat)
+	Check(t, unicode.Latin, ri.ScriptTable)
+
+	ri, ok = p.Get('\u0301')
+	Check(t, true, ok)
+	Check(t, glyphs.Category_Mn, ri.Cat)
+
+	// Equivalent runes in the same script are found even though the other rune wasn't requested yet
+	ri, ok = p.Get('\u0628')
+	Check(t, true, ok)
+	Check(t, glyphs.JoiningType_Dual, ri.JoinType)
+	Check(t, 1, len(ri.EquivalentRunes))
+	Check(t, '\uFE91', ri.EquivalentRunes[0])
+
+	// Not in the data
+	_, ok = p.Get('B')
+	Check(t, false, ok)
+
+	p.PreloadScript(unicode.Arabic)
+	ri, ok = p.Get('\uFE91')
+	Check(t, true, ok)
+	Check(t, glyphs.DecompTag_initial, ri.DecompTag)
+}
+
+func TestCmdBufUndoRedo(t *testing.T) {
+
+	nt := nterm.NewTextOnlyNterm()
+	nt.Settings.CmdBufUndoLimit = 3
+
+	nt.WriteToCmdBuf([]rune("ls"))
+	nt.WriteToCmdBuf([]rune(" -a"))
+	nt.DeletePrevChar()
+	checkCmdBuf(t, nt, "ls -", 4)
+
+	nt.UndoCmdBuf()
+	checkCmdBuf(t, nt, "ls -a", 5)
+	nt.UndoCmdBuf()
+	checkCmdBuf(t, nt, "ls", 2)
+
+	nt.RedoCmdBuf()
+	checkCmdBuf(t, nt, "ls -a", 5)
+
+	// A new edit drops the redo history
+	nt.WriteToCmdBuf([]rune("l"))
+	nt.RedoCmdBuf()
+	checkCmdBuf(t, nt, "ls -al", 6)
+
+	// Only the last 3 edits can be undone
+	nt.WriteToCmdBuf([]rune("h"))
+	nt.UndoCmdBuf()
+	nt.UndoCmdBuf()
+	nt.UndoCmdBuf()
+	checkCmdBuf(t, nt, "ls", 2)
+	nt.UndoCmdBuf()
+	checkCmdBuf(t, nt, "ls", 2)
+}
+
+func checkCmdBuf(t *testing.T, nt interface{ CmdBufText() (string, int64) }, expectedText string, expectedCursorPos int64) {
+
+	text, cursorPos := nt.CmdBufText()
+	Check(t, expectedText, text)
+	Check(t, expectedCursorPos, cursorPos)
+}
+
+func TestSearchNextMatch(t *testing.T) {
+
+	nt := nterm.NewTextOnlyNterm()
+	nt.SetScreenSize(400, 400, 10, 20)
+	nt.WriteToTextBuf([]byte("a foo\nb\nfoo c\nfoo\n"))
+
+	nt.OpenSearch()
+	nt.WriteToSearchBuf([]rune("foo"))
+	matches, index := nt.SearchMatch()
+	Check(t, 3, len(matches))
+	Check(t, -1, index)
+
+	// Matches are refreshed before every jump (like ReadSearchInputs does), which must not get stuck on the current match
+	expected := []struct {
+		index     int
+		scrollPos int64
+	}{
+		{0, 0},
+		{1, 8},
+		{2, 14},
+		{0, 0},
+	}
+
+	for _, e := range expected {
+		nt.UpdateSearchMatches()
+		nt.GotoSearchMatch(true)
+		_, index = nt.SearchMatch()
+		Check(t, e.index, index)
+		Check(t, e.scrollPos, nt.ScrollPos())
+	}
+
+	// New output keeps the current match, and going back from the first match wraps around to the new one
+	nt.WriteToTextBuf([]byte("more foo\n"))
+	nt.UpdateSearchMatches()
+	matches, index = nt.SearchMatch()
+	Check(t, 4, len(matches))
+	Check(t, 0, index)
+
+	nt.GotoSearchMatch(false)
+	_, index = nt.SearchMatch()
+	Check(t, 3, index)
+	Check(t, int64(18), nt.ScrollPos())
+
+	// A query that no longer matches the current match starts over
+	nt.WriteToSearchBuf([]rune("x"))
+	matches, index = nt.SearchMatch()
+	Check(t, 0, len(matches))
+	Check(t, -1, index)
+}
+
+func TestBuiltins(t *testing.T) {
+
+	wd, err := os.Getwd()
+	Check(t, true, err == nil)
+
+	dir := t.TempDir()
+	Check(t, true, os.Mkdir(filepath.Join(dir, "sub"), 0755) == nil)
+	Check(t, true, os.WriteFile(filepath.Join(dir, "sub", "a.txt"), nil, 0644) == nil)
+
+	nt := nterm.NewTextOnlyNterm()
+	Check(t, wd, nt.CurrentDir())
+
+	// runCmd returns what the cmd wrote to textBuf, which starts with the cmd itself
+	runCmd := func(cmd string) string {
+
+		textLen := len(nt.TextBufText())
+		nt.WriteToCmdBuf([]rune(cmd + "\n"))
+		nt.HandleReturn()
+		return nt.TextBufText()[textLen:]
+	}
+
+	Check(t, "cd "+dir+"\n"+dir+"\n", runCmd("cd "+dir))
+	Check(t, dir, nt.CurrentDir())
+
+	subDir := filepath.Join(dir, "sub")
+	Check(t, "cd sub\n"+subDir+"\n", runCmd("cd sub"))
+	Check(t, subDir, nt.CurrentDir())
+
+	// Only the pane changes dirs, because the working directory of the process is shared by all panes
+	newWd, _ := os.Getwd()
+	Check(t, wd, newWd)
+
+	Check(t, "pwd\n"+subDir+"\n", runCmd("pwd"))
+	Check(t, "cd ..\n"+dir+"\n", runCmd("cd .."))
+	Check(t, "cd sub\n"+subDir+"\n", runCmd("cd sub"))
+
+	// Cmds run in the current dir, and relative globs are expanded from it
+	Check(t, "echo *.txt\na.txt\n", runCmd("echo *.txt"))
+
+	cmd, err := nterm.NewExecCmd("cat *.txt", nt.CurrentDir())
+	Check(t, true, err == nil)
+	Check(t, subDir, cmd.Dir)
+	CheckArr(t, []string{"cat", "a.txt"}, cmd.Args)
+
+	// Quotes group words and are removed, and quoted args are never globs even if nothing matches them
+	cmd, err = nterm.NewExecCmd(`grep "a.*b" 'x  y' *.txt`, nt.CurrentDir())
+	Check(t, true, err == nil)
+	CheckArr(t, []string{"grep", "a.*b", "x  y", "a.txt"}, cmd.Args)
+	Check(t, "echo \"*.md\" 'a  b'\n*.md a  b\n", runCmd(`echo "*.md" 'a  b'`))
+
+	// Failing cd keeps the current dir
+	Check(t, true, strings.HasPrefix(runCmd("cd missing"), "cd missing\ncd: "))
+	Check(t, "cd a b\ncd: too many arguments\n", runCmd("cd a b"))
+	Check(t, "cd a.txt\ncd: '"+filepath.Join(subDir, "a.txt")+"' is not a directory\n", runCmd("cd a.txt"))
+	Check(t, subDir, nt.CurrentDir())
+
+	// Exported vars are used by later cmds
+	t.Setenv("NTERM_TEST_VAR", "")
+	Check(t, "export NTERM_TEST_VAR=hi\n", runCmd("export NTERM_TEST_VAR=hi"))
+	Check(t, "hi", os.Getenv("NTERM_TEST_VAR"))
+	Check(t, "echo $NTERM_TEST_VAR  there\nhi there\n", runCmd("echo $NTERM_TEST_VAR  there"))
+	Check(t, "export NTERM_TEST_VAR\nexport: 'NTERM_TEST_VAR' is not in the form VAR=value\n", runCmd("export NTERM_TEST_VAR"))
+}
+
+func TestPaste(t *testing.T) {
+
+	t.Setenv("NTERM_PASTE_VAR", "")
+	nt := nterm.NewTextOnlyNterm()
+
+	// Without bracketed paste each newline runs the cmd before it, and the last line stays in cmdBuf
+	nt.Paste("export NTERM_PASTE_VAR=1\n\nech")
+	Check(t, "1", os.Getenv("NTERM_PASTE_VAR"))
+	checkCmdBuf(t, nt, "ech", 3)
+
+	// Text pasted while a cmd is running goes to its stdin as is
+	nt = nterm.NewTextOnlyNterm()
+	stdin := &bufWriteCloser{}
+	nt.SetActiveCmd(exec.Command("vim"), stdin)
+	nt.Paste("a\x1b[201~b\n")
+	Check(t, "a\x1b[201~b\n", stdin.String())
+
+	// In bracketed paste mode it is wrapped, and ESC chars are removed so the paste can't end early
+	stdin.Reset()
+	nt.WriteToTextBuf([]byte("\x1b[?2004h"))
+	nt.Paste("a\x1b[201~b\n")
+	Check(t, "\x1b[200~a[201~b\n\x1b[201~", stdin.String())
+
+	// Bracketed paste mode ends with the cmd, so newlines run cmdBuf again
+	nt.ClearActiveCmd()
+	nt.Paste("export NTERM_PASTE_VAR=2\nx")
+	Check(t, "2", os.Getenv("NTERM_PASTE_VAR"))
+	checkCmdBuf(t, nt, "x", 1)
+}
+
+func TestClearActiveCmd(t *testing.T) {
+
+	if runtime.GOOS == "windows" {
+		t.Skip("sleep isn't available on windows")
+	}
+
+	nt := nterm.NewTextOnlyNterm()
+	nt.SetScreenSize(790, 400, 10, 20)
+	normalGrid := nt.ActiveGlyphGrid()
+
+	sleepCmd := exec.Command("sleep", "10")
+	Check(t, true, sleepCmd.Start() == nil)
+	t.Cleanup(func() {
+		sleepCmd.Process.Kill()
+		sleepCmd.Wait()
+	})
+	nt.SetActiveCmd(sleepCmd, nil)
+
+	// A full-screen program that hides the cursor and is killed before leaving the alt screen
+	nt.WriteToTextBuf([]byte("before\n\x1b[?1049h\x1b[?25lfull screen"))
+	Check(t, true, nt.IsAltScreen())
+	Check(t, false, nt.CursorVisible)
+	Check(t, false, nt.ActiveGlyphGrid() == normalGrid)
+
+	// The normal screen comes back, and new output goes to textBuf again
+	nt.ClearActiveCmd()
+	Check(t, false, nt.IsAltScreen())
+	Check(t, normalGrid, nt.ActiveGlyphGrid())
+
+	// The prompt cursor is shown again
+	Check(t, true, nt.CursorVisible)
+
+	nt.WriteToTextBuf([]byte("after\n"))
+	Check(t, true, strings.HasSuffix(nt.TextBufText(), "before\nafter\n"))
+}
+
+func TestWriteToActiveCmdError(t *testing.T) {
+
+	if runtime.GOOS == "windows" {
+		t.Skip("sleep isn't available on windows")
+	}
+
+	sleepCmd := exec.Command("sleep", "10")
+	stdin, err := sleepCmd.StdinPipe()
+	Check(t, true, err == nil)
+	Check(t, true, sleepCmd.Start() == nil)
+	t.Cleanup(func() {
+		sleepCmd.Process.Kill()
+		sleepCmd.Wait()
+	})
+
+	nt := nterm.NewTextOnlyNterm()
+	nt.SetActiveCmd(sleepCmd, stdin)
+
+	// The error is shown, but the cmd is still running so it stays active
+	stdin.Close()
+	nt.WriteToActiveCmd([]byte("x"))
+	Check(t, true, strings.HasPrefix(nt.TextBufText(), "Writing to stdin pipe of '"))
+	Check(t, true, nt.HasActiveCmd())
+}
+
+func TestDecscusr(t *testing.T) {
+
+	nt := nterm.NewTextOnlyNterm()
+	nt.SetScreenSize(790, 400, 10, 20)
+	nt.Settings.CursorStyle = nterm.CursorStyle_Bar
+	nt.Settings.CursorBlink = true
+	nt.SetActiveCmd(exec.Command("vim"), nil)
+
+	other, err := nt.SplitVertical()
+	Check(t, true, err == nil)
+
+	// Steady underline overrides the settings of this pane only
+	nt.WriteToTextBuf([]byte("a\x1b[4 qb"))
+	Check(t, nterm.CursorStyle_Underline, nt.CursorStyle())
+	Check(t, false, nt.CursorBlink())
+	Check(t, nterm.CursorStyle_Bar, nt.Settings.CursorStyle)
+	Check(t, true, nt.Settings.CursorBlink)
+	Check(t, nterm.CursorStyle_Bar, other.CursorStyle())
+	Check(t, true, other.CursorBlink())
+
+	nt.WriteToTextBuf([]byte("\x1b[1 q"))
+	Check(t, nterm.CursorStyle_Block, nt.CursorStyle())
+	Check(t, true, nt.CursorBlink())
+
+	// The settings are used again once the cmd is done
+	nt.ClearActiveCmd()
+	Check(t, nterm.CursorStyle_Bar, nt.CursorStyle())
+	Check(t, true, nt.CursorBlink())
+}
+
+func TestDecawm(t *testing.T) {
+
+	nt := nterm.NewTextOnlyNterm()
+	nt.SetScreenSize(100, 400, 10, 20)
+	nt.SetActiveCmd(exec.Command("vim"), nil)
+
+	// The codes are handled once as they come in and aren't kept in textBuf
+	nt.WriteToTextBuf([]byte("a\x1b[?7lb"))
+	Check(t, "ab", nt.TextBufText())
+
+	// Text after DECRST 7 overwrites the last column, and text before it still wraps
+	w, _, _, _ := nt.GridSizes()
+	nt.WriteToTextBuf([]byte("\x1b[?1049h\x1b[?7h" + strings.Repeat("a", int(w)+1) + "\x1b[?7l" + strings.Repeat("b", int(w)+1)))
+	grid := nt.AltGrid()
+	Check(t, 'a', grid.Tiles[1][0].Glyph)
+	Check(t, 'b', grid.Tiles[1][w-1].Glyph)
+	Check(t, uint(1), grid.CursorY)
+
+	// Switching screens in the same code as DECSET 7 keeps both
+	nt.WriteToTextBuf([]byte("\x1b[?1049;7l"))
+	Check(t, false, nt.IsAltScreen())
+	nt.WriteToTextBuf([]byte("\x1b[?7;1049h" + strings.Repeat("c", int(w)+1)))
+	Check(t, 'c', grid.Tiles[1][0].Glyph)
+
+	// Auto wrap is back on for the next cmd
+	nt.WriteToTextBuf([]byte("\x1b[?7l"))
+	nt.ClearActiveCmd()
+	nt.SetActiveCmd(exec.Command("vim"), nil)
+	nt.WriteToTextBuf([]byte("\x1b[?1049h" + strings.Repeat("d", int(w)+1)))
+	Check(t, 'd', grid.Tiles[1][0].Glyph)
+}
+
+func TestSplitPipeline(t *testing.T) {
+
+	CheckArr(t, []string{"ls -a"}, nterm.SplitPipeline("ls -a"))
+	CheckArr(t, []string{"ls", "grep go", "wc -l"}, nterm.SplitPipeline("ls | grep go|wc -l"))
+
+	// Quoted pipes aren't split on
+	CheckArr(t, []string{"echo 'a|b'", `grep "a|b"`}, nterm.SplitPipeline(`echo 'a|b' | grep "a|b"`))
+
+	// Empty stages are kept so they can be reported
+	CheckArr(t, []string{"ls", "", "wc"}, nterm.SplitPipeline("ls || wc"))
+	CheckArr(t, []string{"ls", ""}, nterm.SplitPipeline("ls |"))
+}
+
+func TestExpandAliases(t *testing.T) {
+
+	aliases := map[string]string{
+		"ll":    "ls -la $@",
+		"g":     "git",
+		"gs":    "g status",
+		"ls":    "ls --color",
+		"count": "wc -l",
+		"lsgo":  "ls | grep go",
+		"a":     "b",
+		"b":     "a",
+	}
+
+	checkExpand := func(expected string, cmdStr string) {
+		t.Helper()
+		s, expanded, err := nterm.ExpandAliases(cmdStr, aliases)
+		Check(t, true, err == nil)
+		Check(t, expected, s)
+		Check(t, expected != cmdStr, expanded)
+	}
+
+	checkExpand("echo hi", "echo hi")
+	checkExpand("ls --color -la ./a b", "ll ./a b")
+	checkExpand("ls --color -la", "ll")
+	checkExpand("git status -s", "gs -s")
+
+	// Aliases aren't expanded within their own expansion
+	checkExpand("ls --color", "ls")
+
+	// Each stage is expanded, and aliases can contain pipes
+	checkExpand("ls --color -la | wc -l", "ll | count")
+	checkExpand("ls --color | grep go", "lsgo")
+
+	// Expanding stops when an alias repeats
+	s, expanded, err := nterm.ExpandAliases("a x", aliases)
+	Check(t, true, err == nil)
+	Check(t, "a x", s)
+	Check(t, true, expanded)
+
+	// Too many levels
+	deep := map[string]string{}
+	for i := 0; i < 40; i++ {
+		deep[fmt.Sprint("a", i)] = fmt.Sprint("a", i+1)
+	}
+
+	_, _, err = nterm.ExpandAliases("a0", deep)
+	Check(t, false, err == nil)
+
+	_, _, err = nterm.ExpandAliases("a8", deep)
+	Check(t, true, err == nil)
+}
+
+func TestPaneBounds(t *testing.T) {
+
+	left, width := nterm.PaneBounds(0, 1, 800)
+	Check(t, 0, left)
+	Check(t, 800, width)
+
+	// The last pane takes the rounding left over
+	left, width = nterm.PaneBounds(1, 3, 800)
+	Check(t, 266, left)
+	Check(t, 267, width)
+	left, width = nterm.PaneBounds(2, 3, 800)
+	Check(t, 533, left)
+	Check(t, 267, width)
+}
+
+func TestSplitVertical(t *testing.T) {
+
+	nt := nterm.NewTextOnlyNterm()
+	nt.SetScreenSize(790, 400, 10, 20)
+	Check(t, 1, len(nt.Panes()))
+
+	w, h, altW, altH := nt.GridSizes()
+	Check(t, 79, w)
+	Check(t, 20, h)
+	Check(t, 79, altW)
+	Check(t, 20, altH)
+
+	// What a full-screen program drew is kept when the pane is resized
+	nt.WriteToTextBuf([]byte("\x1b[?1049hfull screen"))
+
+	// The new pane gets focus and half the width, and so do the grids of both panes
+	p, err := nt.SplitVertical()
+	Check(t, true, err == nil)
+	Check(t, "full screen", rowText(nt.ActiveGlyphGrid(), 0))
+	Check(t, uint(11), nt.ActiveGlyphGrid().CursorX)
+	Check(t, 2, len(nt.Panes()))
+	Check(t, nt, nt.Panes()[0])
+	Check(t, p, nt.Panes()[1])
+	Check(t, p, nt.FocusedPane())
+	Check(t, nt, p.Root())
+
+	left, width, focused := nt.PaneBoundsAndFocus()
+	Check(t, 0, left)
+	Check(t, 395, width)
+	Check(t, false, focused)
+
+	left, width, focused = p.PaneBoundsAndFocus()
+	Check(t, 395, left)
+	Check(t, 395, width)
+	Check(t, true, focused)
+
+	w, h, altW, altH = nt.GridSizes()
+	Check(t, 39, w)
+	Check(t, 20, h)
+	Check(t, 39, altW)
+	Check(t, 20, altH)
+
+	w, _, _, _ = p.GridSizes()
+	Check(t, 39, w)
+
+	// Splitting the root puts the new pane between the root and p
+	p2, err := nt.SplitVertical()
+	Check(t, true, err == nil)
+	Check(t, 3, len(nt.Panes()))
+	Check(t, p2, nt.Panes()[1])
+	Check(t, p, nt.Panes()[2])
+	Check(t, p2, nt.FocusedPane())
+
+	nt.FocusNext()
+	Check(t, p, nt.FocusedPane())
+	nt.FocusNext()
+	Check(t, nt, nt.FocusedPane())
+	p.FocusPrev()
+	Check(t, p, nt.FocusedPane())
+
+	_, _, focused = nt.PaneBoundsAndFocus()
+	Check(t, false, focused)
+
+	// Panes can't be narrower than 20 columns
+	_, err = nt.SplitVertical()
+	Check(t, false, err == nil)
+	Check(t, 3, len(nt.Panes()))
+}
+
+func TestClosePane(t *testing.T) {
+
+	nt := nterm.NewTextOnlyNterm()
+	nt.SetScreenSize(900, 400, 10, 20)
+	p, err := nt.SplitVertical()
+	Check(t, true, err == nil)
+	p2, err := p.SplitVertical()
+	Check(t, true, err == nil)
+
+	// exit closes only its pane, and focus moves left
+	p.WriteToCmdBuf([]rune("exit\n"))
+	p.HandleReturn()
+	Check(t, 2, len(nt.Panes()))
+	Check(t, nt, nt.Panes()[0])
+	Check(t, p2, nt.Panes()[1])
+	Check(t, nt, nt.FocusedPane())
+
+	left, width, _ := p2.PaneBoundsAndFocus()
+	Check(t, 450, left)
+	Check(t, 450, width)
+
+	// The root pane can be closed too, and the rest take the whole window
+	nt.ClosePane()
+	Check(t, 1, len(nt.Panes()))
+	Check(t, p2, nt.Panes()[0])
+	Check(t, p2, nt.FocusedPane())
+
+	left, width, focused := p2.PaneBoundsAndFocus()
+	Check(t, 0, left)
+	Check(t, 900, width)
+	Check(t, true, focused)
+
+	w, _, _, _ := p2.GridSizes()
+	Check(t, 90, w)
+}
+
+func TestRuneWidth(t *testing.T) {
+
+	Check(t, 1, glyphs.RuneWidth('a'))
+	Check(t, 1, glyphs.RuneWidth('م'))
+	Check(t, 2, glyphs.RuneWidth('中'))
+
+	// Combining marks
+	Check(t, 0, glyphs.RuneWidth('\u0301')) // Acute accent
+	Check(t, 0, glyphs.RuneWidth('\u0308')) // Diaeresis
+	Check(t, 0, glyphs.RuneWidth('\u064E')) // Arabic fatha
+	Check(t, 0, glyphs.RuneWidth('\u20DD')) // Enclosing circle
+
+	// Zero width format chars
+	Check(t, 0, glyphs.RuneWidth('\uFEFF')) // BOM
+	Check(t, 0, glyphs.RuneWidth('\u200B')) // Zero width space
+}
+
+func TestEastAsianWidth(t *testing.T) {
+
+	// The first and last runes of wide ranges, and the runes just outside them
+	tests := []struct {
+		r         rune
+		eaWidth   int
+		runeWidth int
+	}{
+		// Ascii and other narrow scripts
+		{'a', 1, 1},
+		{'~', 1, 1},
+		{'é', 1, 1},
+		{'\u10FF', 1, 1},
+
+		// Hangul Jamo, where only the leading consonants are wide
+		{'\u1100', 2, 2},
+		{'\u115F', 2, 2},
+		{'\u1160', 1, 1},
+
+		// CJK symbols and ideographs
+		{'\u3000', 2, 2},
+		{'\u3040', 1, 1},
+		{'\u3041', 2, 2},
+		{'\u4DBF', 2, 2},
+		{'\u4DC0', 1, 1},
+		{'\u4E00', 2, 2},
+		{'中', 2, 2},
+		{'\uA48C', 2, 2},
+		{'\uA48D', 1, 1},
+		{'\U00020000', 2, 2},
+		{'\U0002FFFD', 2, 2},
+		{'\U0002FFFE', 1, 1},
+
+		// Hangul syllables
+		{'\uABFF', 1, 1},
+		{'\uAC00', 2, 2},
+		{'\uD7A3', 2, 2},
+		{'\uD7A4', 1, 1},
+
+		// Fullwidth forms are wide but halfwidth forms aren't
+		{'\uFF00', 1, 1},
+		{'\uFF01', 2, 2},
+		{'Ａ', 2, 2},
+		{'\uFF60', 2, 2},
+		{'\uFF61', 1, 1},
+		{'ｱ', 1, 1},
+		{'\uFFE0', 2, 2},
+		{'\uFFE6', 2, 2},
+		{'\uFFE7', 1, 1},
+
+		// Emoji
+		{'\U0001F600', 2, 2},
+		{'\U0001F650', 1, 1},
+
+		// Combining marks take no columns, even those in wide ranges
+		{'\u0300', 1, 0},
+		{'\u036F', 1, 0},
+		{'\u0370', 1, 1},
+		{'\u302A', 2, 0},
+		{'\u3099', 2, 0},
+	}
+
+	for _, tt := range tests {
+		if got := glyphs.EastAsianWidth(tt.r); got != tt.eaWidth {
+			t.Errorf("Expected EastAsianWidth of %U to be %d but got %d\n", tt.r, tt.eaWidth, got)
+		}
+
+		if got := glyphs.RuneWidth(tt.r); got != tt.runeWidth {
+			t.Errorf("Expected RuneWidth of %U to be %d but got %d\n", tt.r, tt.runeWidth, got)
+		}
+	}
+}
+
+func TestGlyphGridCombiningMarks(t *testing.T) {
+
+	fg, bg := nterm.NewTestColors()
+
+	// Marks go on the previous tile, and the BOM takes no tile
+	grid := nterm.NewGlyphGrid(4, 1)
+	grid.WriteString("\uFEFFe\u0301x", fg, bg)
+	Check(t, 'e', grid.Tiles[0][0].Glyph)
+	Check(t, '\u0301', grid.Tiles[0][0].Mark)
+	Check(t, 'x', grid.Tiles[0][1].Glyph)
+	Check(t, 0, grid.Tiles[0][1].Mark)
+	Check(t, uint(2), grid.CursorX)
+
+	// A mark with nothing before it is dropped
+	grid = nterm.NewGlyphGrid(4, 1)
+	grid.WriteString("\u0301a", fg, bg)
+	Check(t, 'a', grid.Tiles[0][0].Glyph)
+	Check(t, 0, grid.Tiles[0][0].Mark)
+}
+
+func TestGlyphGridWordWrap(t *testing.T) {
+
+	fg, bg := nterm.NewTestColors()
+
+	// Words that don't fit move to the next row
+	grid := nterm.NewGlyphGrid(8, 3)
+	grid.WordWrap = true
+	grid.WriteString("hello world foo", fg, bg)
+	Check(t, "hello   ", rowText(grid, 0))
+	Check(t, "world   ", rowText(grid, 1))
+	Check(t, "foo", rowText(grid, 2))
+	Check(t, nterm.WrapMode_Word, grid.RowWrapKind[0])
+	Check(t, nterm.WrapMode_Word, grid.RowWrapKind[1])
+	Check(t, nterm.WrapMode_Hard, grid.RowWrapKind[2])
+
+	// Same with the other write functions, and across calls
+	grid = nterm.NewGlyphGrid(8, 3)
+	grid.WordWrap = true
+	grid.Write([]rune("hello "), fg, bg)
+	grid.WriteBytes([]byte("world"), fg, bg)
+	Check(t, "hello   ", rowText(grid, 0))
+	Check(t, 'w', grid.Tiles[1][0].Glyph)
+
+	// Words longer than a row are split, and new lines are kept
+	grid = nterm.NewGlyphGrid(5, 3)
+	grid.WordWrap = true
+	grid.Write([]rune("a abcdef\nb"), fg, bg)
+	Check(t, "a abcdef", rowText(grid, 0)+rowText(grid, 1))
+	Check(t, nterm.WrapMode_Soft, grid.RowWrapKind[0])
+	Check(t, nterm.WrapMode_Hard, grid.RowWrapKind[1])
+	Check(t, 'b', grid.Tiles[2][0].Glyph)
+
+	// The left margin is skipped on wrapped rows
+	grid = nterm.NewGlyphGrid(8, 2)
+	grid.WordWrap = true
+	grid.LeftMargin = 2
+	grid.SetCursor(2, 0)
+	grid.WriteString("abc defg", fg, bg)
+	Check(t, 'd', grid.Tiles[1][2].Glyph)
+
+	// Nothing changes without word wrap
+	grid = nterm.NewGlyphGrid(8, 2)
+	grid.WriteString("hello world", fg, bg)
+	Check(t, "hello wo", rowText(grid, 0))
+	Check(t, nterm.WrapMode_Soft, grid.RowWrapKind[0])
+}
+
+// rowText returns the glyphs of row y up to the first empty tile or new line
+func TestGlyphGridWordAndLineAt(t *testing.T) {
+
+	fg, bg := nterm.NewTestColors()
+
+	// Row 0 and 1 are one logical line because row 0 soft wraps
+	grid := nterm.NewGlyphGrid(7, 4)
+	grid.WriteString("ab cd\u4e16xyz\nq", fg, bg)
+	Check(t, "ab cd\u4e16", rowText(grid, 0))
+	Check(t, "xyz", rowText(grid, 1))
+
+	startX, endX, ok := grid.WordAt(1, 0)
+	Check(t, true, ok)
+	Check(t, uint(0), startX)
+	Check(t, uint(1), endX)
+
+	// Clicking a wide glyph's tail selects the whole word
+	startX, endX, ok = grid.WordAt(6, 0)
+	Check(t, true, ok)
+	Check(t, uint(3), startX)
+	Check(t, uint(6), endX)
+
+	startX, endX, ok = grid.WordAt(0, 2)
+	Check(t, true, ok)
+	Check(t, uint(0), startX)
+	Check(t, uint(0), endX)
+
+	// Spaces and empty tiles aren't words
+	_, _, ok = grid.WordAt(2, 0)
+	Check(t, false, ok)
+	_, _, ok = grid.WordAt(4, 1)
+	Check(t, false, ok)
+	_, _, ok = grid.WordAt(0, 3)
+	Check(t, false, ok)
+
+	startY, endY := grid.LogicalLineAt(0)
+	Check(t, uint(0), startY)
+	Check(t, uint(1), endY)
+
+	startY, endY = grid.LogicalLineAt(1)
+	Check(t, uint(0), startY)
+	Check(t, uint(1), endY)
+
+	startY, endY = grid.LogicalLineAt(2)
+	Check(t, uint(2), startY)
+	Check(t, uint(2), endY)
+}
+
+func TestGlyphGridTileAt(t *testing.T) {
+
+	fg, bg := nterm.NewTestColors()
+
+	grid := nterm.NewGlyphGrid(3, 3)
+	grid.WriteString("abcdefghi", fg, bg)
+
+	// Cells are 10x20 pixels
+	checkTile := func(screenX, screenY float32, expectedX, expectedY int, expectedGlyph rune) {
+		t.Helper()
+
+		x, y, tile, found := grid.TileAt(screenX, screenY, 10, 20)
+		Check(t, true, found)
+		Check(t, expectedX, x)
+		Check(t, expectedY, y)
+		Check(t, expectedGlyph, tile.Glyph)
+	}
+
+	checkTile(0, 0, 0, 0, 'a')
+	checkTile(9.9, 19.9, 0, 0, 'a')
+	checkTile(10, 20, 1, 1, 'e')
+	checkTile(29.9, 0, 2, 0, 'c')
+	checkTile(0, 59.9, 0, 2, 'g')
+	checkTile(29.9, 59.9, 2, 2, 'i')
+
+	// Outside the grid
+	for _, pos := range [][2]float32{{30, 0}, {0, 60}, {-0.1, 0}, {0, -0.1}, {100, 100}} {
+		_, _, tile, found := grid.TileAt(pos[0], pos[1], 10, 20)
+		Check(t, false, found)
+		Check(t, true, tile == nil)
+	}
+}
+
+func rowText(grid *nterm.GlyphGrid, y uint) string {
+
+	sb := strings.Builder{}
+	for x := uint(0); x < grid.SizeX; x++ {
+
+		g := grid.Tiles[y][x].Glyph
+		if g == 0 || g == utf8.RuneError || g == '\n' {
+			break
+		}
+
+		if g == nterm.WideGlyphTail {
+			continue
+		}
+
+		sb.WriteRune(g)
+	}
+
+	return sb.String()
+}
+
+func gridText(grid *nterm.GlyphGrid) string {
+
+	sb := strings.Builder{}
+	for y := uint(0); y < grid.SizeY; y++ {
+		for x := uint(0); x < grid.SizeX; x++ {
+			sb.WriteRune(grid.Tiles[y][x].Glyph)
+		}
+	}
+
+	return sb.String()
+}
+
+func TestSettingsEditor(t *testing.T) {
+
+	nt := nterm.NewTextOnlyNterm()
+	nt.Settings.MaxFps = 60
+	nt.Settings.MinFontSize = 8
+	nt.Settings.MaxFontSize = 96
+
+	nt.OpenSettingsEditor()
+	se := nt.ActiveSettingsEditor()
+	Check(t, true, se != nil)
+	Check(t, 0, se.SelectedIndex)
+
+	// Selection wraps around
+	se.SelectField(-1)
+	Check(t, len(se.Fields)-1, se.SelectedIndex)
+	se.SelectField(1)
+	Check(t, 0, se.SelectedIndex)
+
+	// Editing starts with the current value
+	se.StartEdit()
+	Check(t, true, se.IsEditing)
+	Check(t, "60", string(se.EditBuf))
+
+	se.EditBuf = se.EditBuf[:0]
+	se.WriteToEditBuf([]rune("144"))
+	se.ConfirmEdit()
+	Check(t, false, se.IsEditing)
+	Check(t, 144, nt.Settings.MaxFps)
+
+	// Invalid values keep us editing and don't change the setting
+	se.StartEdit()
+	se.EditBuf = append(se.EditBuf[:0], []rune("-5")...)
+	se.ConfirmEdit()
+	Check(t, true, se.IsEditing)
+	Check(t, true, se.ErrMsg != "")
+	Check(t, 144, nt.Settings.MaxFps)
+
+	// The selection can't move while editing, and canceling leaves the setting as is
+	se.SelectField(1)
+	Check(t, 0, se.SelectedIndex)
+	se.WriteToEditBuf([]rune("0"))
+	se.CancelEdit()
+	Check(t, false, se.IsEditing)
+	Check(t, "", se.ErrMsg)
+	Check(t, 144, nt.Settings.MaxFps)
+
+	// Text is ignored when not editing
+	se.WriteToEditBuf([]rune("abc"))
+	Check(t, 0, len(se.EditBuf))
+
+	// Cursor style
+	se.SelectField(-1)
+	se.StartEdit()
+	se.EditBuf = append(se.EditBuf[:0], []rune("underline")...)
+	se.ConfirmEdit()
+	Check(t, nterm.CursorStyle_Underline, nt.Settings.CursorStyle)
+
+	nt.CloseSettingsEditor()
+	Check(t, true, nt.ActiveSettingsEditor() == nil)
+}
+
+func TestHexColors(t *testing.T) {
+
+	c, err := nterm.ParseHexColor("#ff0080")
+	Check(t, true, err == nil)
+	Check(t, *gglm.NewVec4(1, 0, 128/255.0, 1), c)
+	Check(t, "#ff0080ff", nterm.FormatHexColor(&c))
+
+	c, err = nterm.ParseHexColor("00ff0040")
+	Check(t, true, err == nil)
+	Check(t, *gglm.NewVec4(0, 1, 0, 64/255.0), c)
+	Check(t, "#00ff0040", nterm.FormatHexColor(&c))
+
+	_, err = nterm.ParseHexColor("#fff")
+	Check(t, true, err != nil)
+
+	_, err = nterm.ParseHexColor("#gg0000")
+	Check(t, true, err != nil)
+}
+
+func TestFormatStatusLine(t *testing.T) {
+
+	now := time.Date(2022, 7, 1, 9, 5, 3, 0, time.UTC)
+
+	Check(t, "/home/a          42% 09:05:03", nterm.FormatStatusLine(29, "/home/a", "", 42, now))
+	Check(t, "/home/a | vim   100% 09:05:03", nterm.FormatStatusLine(29, "/home/a", "vim", 100, now))
+
+	// Long directories are shortened from the left, and at least one space is kept before the right side
+	Check(t, "\u2026ong/path/dir 0% 09:05:03", nterm.FormatStatusLine(25, "/a/very/long/path/dir", "", 0, now))
+	Check(t, "0% 09:05:03", nterm.FormatStatusLine(11, "/a", "", 0, now))
+}
+
+func BenchmarkGlyphGridWrite(b *testing.B) {
+
+	gg := nterm.NewGlyphGrid(30, 19_000)
+	fg, bg := nterm.NewTestColors()
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchText)))
+	for i := 0; i < b.N; i++ {
+		gg.SetCursor(0, 0)
+		gg.Write([]rune(string(benchText)), fg, bg)
+	}
+}
+
+func BenchmarkGlyphGridWriteBytes(b *testing.B) {
+
+	gg := nterm.NewGlyphGrid(30, 19_000)
+	fg, bg := nterm.NewTestColors()
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchText)))
+	for i := 0; i < b.N; i++ {
+		gg.SetCursor(0, 0)
+		gg.WriteBytes(benchText, fg, bg)
+	}
+}
+
+func BenchmarkBytesToRunesAlloc(b *testing.B) {
+
+	text := []byte(strings.Repeat("Hello there, friend! مرحبا\n", 1024*1024/32))
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(text)))
+	for i := 0; i < b.N; i++ {
+
+		// This is the old bytesToRunes which allocated on every call
+		rs := make([]rune, 0, utf8.RuneCount(text))
+		for bs := text; len(bs) > 0; {
+			r, size := utf8.DecodeRune(bs)
+			rs = append(rs, r)
+			bs = bs[size:]
+		}
+	}
+}
+
+func TestTerminateCmds(t *testing.T) {
+
+	if runtime.GOOS == "windows" {
+		t.Skip("SIGTERM isn't supported on windows")
+	}
+
+	// Cmds that exit on SIGTERM don't wait for the grace period
+	sleepCmd := exec.Command("sleep", "10")
+	Check(t, true, sleepCmd.Start() == nil)
+
+	startTime := time.Now()
+	nterm.TerminateCmds([]*exec.Cmd{sleepCmd}, 10*time.Second)
+	Check(t, true, sleepCmd.Wait() != nil)
+	Check(t, true, time.Since(startTime) < 5*time.Second)
+
+	// Cmds that ignore SIGTERM are killed after the grace period
+	// The cmd prints once the trap is set, so the SIGTERM doesn't arrive before that
+	stubbornCmd := exec.Command("sh", "-c", "trap '' TERM; echo ready; sleep 10 & wait")
+	stubbornOut, err := stubbornCmd.StdoutPipe()
+	Check(t, true, err == nil)
+	Check(t, true, stubbornCmd.Start() == nil)
+
+	readyBuf := make([]byte, 6)
+	_, err = io.ReadFull(stubbornOut, readyBuf)
+	Check(t, true, err == nil)
+	Check(t, "ready\n", string(readyBuf))
+
+	startTime = time.Now()
+	nterm.TerminateCmds([]*exec.Cmd{stubbornCmd}, 500*time.Millisecond)
+	Check(t, true, stubbornCmd.Wait() != nil)
+
+	elapsed := time.Since(startTime)
+	Check(t, true, elapsed >= 500*time.Millisecond && elapsed < 5*time.Second)
+}
+
+func BenchmarkBytesToRunesPooled(b *testing.B) {
+
+	text := []byte(strings.Repeat("Hello there, friend! مرحبا\n", 1024*1024/32))
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(text)))
+	for i := 0; i < b.N; i++ {
+		rs := nterm.BytesToRunes(text)
+		nterm.ReleaseRunes(rs)
+	}
+}
+
 func Check[T comparable](t *testing.T, expected, got T) {
 	if got != expected {
 		t.Fatalf("Expected %v but got %v\n", expected, got)
 	}
 }
+
+func CheckArr[T comparable](t *testing.T, expected, got []T) {
+
+	if len(expected) != len(got) {
+		t.Fatalf("Expected %v but got %v\n", expected, got)
+	}
+
+	for i := 0; i < len(expected); i++ {
+		if got[i] != expected[i] {
+			t.Fatalf("Expected %v but got %v\n", expected, got)
+		}
+	}
+}
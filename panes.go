@@ -0,0 +1,236 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/bloeys/gglm/gglm"
+	"github.com/bloeys/nmage/engine"
+	"github.com/bloeys/nterm/ansi"
+	"github.com/bloeys/nterm/ring"
+)
+
+const (
+	// minPaneCols is the fewest columns a pane can have, so splitting stops once panes would get narrower than that
+	minPaneCols = 20
+
+	// unfocusedPaneDim is what the fg colors of panes without focus are multiplied by
+	unfocusedPaneDim = 0.5
+)
+
+// Root returns the nterm that owns the window and the panes, which is nt itself if nt isn't a split pane
+func (nt *nterm) Root() *nterm {
+
+	if nt.root != nil {
+		return nt.root
+	}
+
+	return nt
+}
+
+// Panes returns all panes from left to right, which is only the root if the window isn't split
+func (nt *nterm) Panes() []*nterm {
+
+	root := nt.Root()
+	if len(root.panes) == 0 {
+		return []*nterm{root}
+	}
+
+	return root.panes
+}
+
+// FocusedPane returns the pane that gets input and draws the cursor
+func (nt *nterm) FocusedPane() *nterm {
+	root := nt.Root()
+	return root.Panes()[root.focusedPane]
+}
+
+// SplitVertical splits the window into one more pane, which is placed right of nt and gets focus.
+// All panes get an equal part of the window width
+func (nt *nterm) SplitVertical() (*nterm, error) {
+
+	root := nt.Root()
+	panes := root.Panes()
+
+	paneWidth := float32(root.GlyphRend.ScreenWidth) / float32(len(panes)+1)
+	if paneWidth-root.Settings.PaddingLeft-root.Settings.PaddingRight < minPaneCols*root.GlyphRend.Atlas.SpaceAdvance {
+		return nil, errors.New("window is too narrow for another pane")
+	}
+
+	newPaneIndex := 0
+	for i, p := range panes {
+		if p == nt {
+			newPaneIndex = i + 1
+			break
+		}
+	}
+
+	p := nt.newPane()
+	root.panes = append(panes[:newPaneIndex:newPaneIndex], append([]*nterm{p}, panes[newPaneIndex:]...)...)
+	root.LayoutPanes()
+	root.focusPane(newPaneIndex)
+
+	return p, nil
+}
+
+// ClosePane removes nt from the panes, gives its width to the rest and moves focus to the pane on its left.
+// Closing the last pane quits. The root keeps owning the window and renderer even after its own pane is closed
+func (nt *nterm) ClosePane() {
+
+	root := nt.Root()
+	panes := root.Panes()
+	if len(panes) == 1 {
+		engine.Quit()
+		return
+	}
+
+	for i, p := range panes {
+
+		if p != nt {
+			continue
+		}
+
+		root.panes = append(panes[:i:i], panes[i+1:]...)
+		root.LayoutPanes()
+		root.focusPane(clamp(i-1, 0, len(root.panes)-1))
+		return
+	}
+}
+
+// FocusNext moves focus to the pane on the right, wrapping around to the first pane
+func (nt *nterm) FocusNext() {
+	root := nt.Root()
+	root.focusPane((root.focusedPane + 1) % len(root.Panes()))
+}
+
+// FocusPrev moves focus to the pane on the left, wrapping around to the last pane
+func (nt *nterm) FocusPrev() {
+	root := nt.Root()
+	paneCount := len(root.Panes())
+	root.focusPane((root.focusedPane - 1 + paneCount) % paneCount)
+}
+
+func (nt *nterm) focusPane(index int) {
+
+	root := nt.Root()
+	root.focusedPane = index
+	for i, p := range root.Panes() {
+		p.unfocused = i != index
+	}
+}
+
+// LayoutPanes gives each pane an equal part of the window width, and rebuilds the grids of panes whose size changed.
+// It is called when the window is resized and when a pane is added
+func (nt *nterm) LayoutPanes() {
+
+	root := nt.Root()
+	panes := root.Panes()
+	screenWidth := float32(root.GlyphRend.ScreenWidth)
+	for i, p := range panes {
+
+		p.paneLeft, p.paneWidth = paneBounds(i, len(panes), screenWidth)
+
+		gw, gh := p.GridSize()
+		if p.glyphGrid == nil || p.glyphGrid.SizeX != uint(gw) || p.glyphGrid.SizeY != uint(gh) {
+			p.rebuildGrids()
+		}
+	}
+}
+
+// rebuildGrids replaces the grids of nt with ones that fit GridSize, which is needed when the font or pane size changes.
+// The normal grid is rebuilt from textBuf every frame so it starts empty, but the alt grid is only written as output
+// comes in so it keeps its tiles and cursor (see GlyphGrid.Resized)
+func (nt *nterm) rebuildGrids() {
+
+	gridWidth, gridHeight := nt.GridSize()
+	nt.glyphGrid = NewGlyphGrid(uint(gridWidth), uint(gridHeight))
+
+	nt.textBufMutex.Lock()
+	if nt.altGlyphGrid == nil {
+		nt.altGlyphGrid = NewGlyphGrid(uint(gridWidth), uint(gridHeight))
+	} else {
+		nt.altGlyphGrid = nt.altGlyphGrid.Resized(uint(gridWidth), uint(gridHeight))
+	}
+	nt.textBufMutex.Unlock()
+}
+
+// paneBounds returns the left edge and width in pixels of pane i when screenWidth is split into paneCount equal panes.
+// Edges are whole pixels, and the last pane takes whatever rounding left over
+func paneBounds(i, paneCount int, screenWidth float32) (left, width float32) {
+
+	left = FloorF32(screenWidth * float32(i) / float32(paneCount))
+	right := FloorF32(screenWidth * float32(i+1) / float32(paneCount))
+	if i == paneCount-1 {
+		right = screenWidth
+	}
+
+	return left, right - left
+}
+
+// PaneWidth returns the width in pixels of the part of the window used by nt
+func (nt *nterm) PaneWidth() float32 {
+
+	// Zero until the window is split
+	if nt.paneWidth == 0 {
+		return float32(nt.GlyphRend.ScreenWidth)
+	}
+
+	return nt.paneWidth
+}
+
+// newPane returns an nterm that shares the window, renderer and settings of nt but has its own buffers, grids and cmd.
+// It starts in the working directory of nt
+func (nt *nterm) newPane() *nterm {
+
+	root := nt.Root()
+	p := &nterm{
+		win:       root.win,
+		rend:      root.rend,
+		imguiInfo: root.imguiInfo,
+		FontSize:  root.FontSize,
+		Dpi:       root.Dpi,
+		GlyphRend: root.GlyphRend,
+		gridMesh:  root.gridMesh,
+		gridMat:   root.gridMat,
+
+		Lines:   ring.NewBuffer[Line](minLineBufSize),
+		textBuf: ring.NewBuffer[byte](minTextBufSize),
+
+		lastCmdCharPos: gglm.NewVec3(0, root.GlyphRend.Atlas.LineHeight, 0),
+		cmdBuf:         make([]rune, defaultCmdBufSize),
+
+		scrollSpd:   defaultScrollSpd,
+		startupTime: root.startupTime,
+		Settings:    root.Settings,
+
+		Highlighter:      nt.Highlighter,
+		highlighters:     root.highlighters,
+		highlighterIndex: nt.highlighterIndex,
+
+		Theme:      root.Theme,
+		themes:     root.themes,
+		themeIndex: root.themeIndex,
+
+		cursorBlinkOn: true,
+		CursorVisible: true,
+
+		firstValidLine: &Line{},
+		root:           root,
+	}
+
+	if root.ansiEventLog != nil {
+		p.ansiEventLog = ansi.NewAnsiEventLog(ansiEventLogSize)
+	}
+
+	p.initBuiltins()
+	p.currentDir = nt.currentDir
+
+	return p
+}
+
+// dimColor returns c with its rgb multiplied by unfocusedPaneDim
+func dimColor(c gglm.Vec4) gglm.Vec4 {
+	c.SetR(c.R() * unfocusedPaneDim)
+	c.SetG(c.G() * unfocusedPaneDim)
+	c.SetB(c.B() * unfocusedPaneDim)
+	return c
+}
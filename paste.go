@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bloeys/nterm/ansi"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// PasteFromClipboard pastes the clipboard text with Paste. It is bound to Ctrl+Shift+V
+func (nt *nterm) PasteFromClipboard() {
+
+	text, err := sdl.GetClipboardText()
+	if err != nil {
+		fmt.Printf("Failed to read clipboard. Err: %s\n", err.Error())
+		return
+	}
+
+	nt.Paste(text)
+}
+
+// Paste writes text to the stdin of the active cmd if there is one, and to cmdBuf otherwise, where each pasted
+// newline is like pressing Return.
+//
+// In bracketed paste mode text sent to the cmd is wrapped in ansi.BracketedPasteStart and ansi.BracketedPasteEnd
+// so it can tell a paste from typing. ESC chars are removed from the text first, otherwise a pasted BracketedPasteEnd
+// would end the paste early and the cmd would run the rest as if it was typed
+func (nt *nterm) Paste(text string) {
+
+	if text == "" {
+		return
+	}
+
+	if nt.activeCmd != nil {
+
+		if nt.bracketedPasteMode {
+			text = ansi.BracketedPasteStart + strings.ReplaceAll(text, "\x1b", "") + ansi.BracketedPasteEnd
+		}
+
+		nt.WriteToActiveCmd([]byte(text))
+		return
+	}
+
+	for {
+
+		line, rest, foundNewline := strings.Cut(text, "\n")
+		nt.writeToCmdBufClamped([]rune(line))
+		if !foundNewline {
+			break
+		}
+
+		if nt.cmdBufLen > 0 {
+			nt.cursorCharIndex = nt.cmdBufLen
+			nt.WriteToCmdBuf([]rune{'\n'})
+			nt.HandleReturn()
+		} else {
+			nt.WriteToTextBuf([]byte{'\n'})
+		}
+
+		// Lines after the one that started a cmd go to that cmd while it is running
+		text = rest
+		if nt.activeCmd != nil {
+			nt.Paste(text)
+			return
+		}
+	}
+}
+
+// writeToCmdBufClamped is like WriteToCmdBuf but drops the end of text if it doesn't fit in cmdBuf, which leaves
+// room for the newline written on Return
+func (nt *nterm) writeToCmdBufClamped(text []rune) {
+
+	free := int64(len(nt.cmdBuf)) - nt.cmdBufLen - 1
+	if free <= 0 {
+		return
+	}
+
+	if int64(len(text)) > free {
+		text = text[:free]
+	}
+
+	nt.WriteToCmdBuf(text)
+}
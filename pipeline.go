@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/bloeys/nterm/shell"
+)
+
+// splitPipeline splits cmdStr on each '|' that isn't within single or double quotes, and trims the spaces around each command.
+// For example, `ls | grep "a|b"` gives `ls` and `grep "a|b"`
+func splitPipeline(cmdStr string) []string {
+
+	cmds := make([]string, 0, 1)
+
+	var quote rune
+	cmdStart := 0
+	for i, r := range cmdStr {
+
+		if quote != 0 {
+			if r == quote {
+				quote = 0
+			}
+			continue
+		}
+
+		switch r {
+		case '"', '\'':
+			quote = r
+		case '|':
+			cmds = append(cmds, strings.TrimSpace(cmdStr[cmdStart:i]))
+			cmdStart = i + 1
+		}
+	}
+
+	return append(cmds, strings.TrimSpace(cmdStr[cmdStart:]))
+}
+
+// maxAliasDepth is the max number of aliases a single alias can expand through
+const maxAliasDepth = 32
+
+// expandAliases replaces the first word of each stage of cmdStr with its alias, and returns the new cmdStr with its stages
+// joined by ' | '. '$@' in an alias is replaced with the args that followed the alias, and if there is no '$@' the args are
+// appended. Aliases can expand to other aliases (up to maxAliasDepth levels), but an alias is never expanded within
+// its own expansion, so aliases like "ls": "ls --color" work.
+//
+// expanded is false if no stage used an alias, in which case cmdStr is returned as-is
+func expandAliases(cmdStr string, aliases map[string]string) (newCmdStr string, expanded bool, err error) {
+
+	if len(aliases) == 0 {
+		return cmdStr, false, nil
+	}
+
+	stageStrs := splitPipeline(cmdStr)
+	for i := 0; i < len(stageStrs); i++ {
+
+		origName, _, _ := strings.Cut(stageStrs[i], " ")
+		stageExpanded := false
+		seen := map[string]struct{}{}
+		for depth := 0; ; depth++ {
+
+			name, args, _ := strings.Cut(stageStrs[i], " ")
+			alias, ok := aliases[name]
+			if _, isSeen := seen[name]; !ok || isSeen {
+				break
+			}
+
+			if depth == maxAliasDepth {
+				return cmdStr, false, fmt.Errorf("alias '%s' expands to more than %d levels of aliases", origName, maxAliasDepth)
+			}
+
+			seen[name] = struct{}{}
+			if strings.Contains(alias, "$@") {
+				stageStrs[i] = strings.ReplaceAll(alias, "$@", args)
+			} else if args != "" {
+				stageStrs[i] = alias + " " + args
+			} else {
+				stageStrs[i] = alias
+			}
+
+			stageStrs[i] = strings.TrimSpace(stageStrs[i])
+			stageExpanded = true
+		}
+
+		expanded = expanded || stageExpanded
+	}
+
+	if !expanded {
+		return cmdStr, false, nil
+	}
+
+	return strings.Join(stageStrs, " | "), true, nil
+}
+
+// newExecCmd creates a cmd from a single command (no pipes), where the first word is the program and the rest are its args.
+// Words are split like shells do (see shell.SplitWords), so quotes group words and are removed. The cmd runs in dir, and
+// relative globs in unquoted args are expanded from it. If a glob has no matches the returned error says so but the cmd
+// is still usable (see shell.ExpandGlobs).
+//
+// On windows the args are quoted again by exec when building the command line, so programs get the same args
+func newExecCmd(cmdStr, dir string) (*exec.Cmd, error) {
+
+	words := shell.SplitWords(cmdStr)
+	if len(words) == 0 {
+		words = append(words, shell.Word{})
+	}
+
+	args, err := shell.ExpandWordGlobsInDir(dir, words[1:])
+
+	cmd := exec.Command(words[0].Text, args...)
+	cmd.Dir = dir
+	return cmd, err
+}
+
+// killCmds kills the started cmds. Errors are ignored because some cmds might have exited already
+func killCmds(cmds []*exec.Cmd) {
+
+	for _, c := range cmds {
+
+		if c.Process == nil {
+			continue
+		}
+
+		c.Process.Kill()
+	}
+}
+
+// terminateCmds asks the started cmds to exit with SIGTERM, and kills the ones still running after gracePeriod.
+// Windows doesn't support SIGTERM, so there the cmds are killed right away
+func terminateCmds(cmds []*exec.Cmd, gracePeriod time.Duration) {
+
+	if runtime.GOOS == "windows" {
+		killCmds(cmds)
+		return
+	}
+
+	for _, c := range cmds {
+
+		if c.Process == nil {
+			continue
+		}
+
+		c.Process.Signal(syscall.SIGTERM)
+	}
+
+	time.AfterFunc(gracePeriod, func() {
+		killCmds(cmds)
+	})
+}
+
+// isPipelineStageFailure returns true if err (returned by Wait) means the stage failed. Stages killed because a later
+// stage stopped reading (e.g. 'yes | head') are not failures, which matches how shells treat SIGPIPE
+func isPipelineStageFailure(err error) bool {
+
+	if err == nil {
+		return false
+	}
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return true
+	}
+
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	return !ok || !status.Signaled() || status.Signal() != syscall.SIGPIPE
+}
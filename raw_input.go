@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/bloeys/nmage/input"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// rawKeySeqs are the bytes sent to the active cmd for special keys in raw input mode, which are what xterm sends.
+// The exception is Enter: xterm sends \r which a pty turns into \n, but cmds are connected with pipes so we send \n ourselves
+var rawKeySeqs = []struct {
+	key sdl.Keycode
+	seq string
+}{
+	{sdl.K_RETURN, "\n"},
+	{sdl.K_KP_ENTER, "\n"},
+	{sdl.K_BACKSPACE, "\x7f"},
+	{sdl.K_TAB, "\t"},
+	{sdl.K_ESCAPE, "\x1b"},
+	{sdl.K_UP, "\x1b[A"},
+	{sdl.K_DOWN, "\x1b[B"},
+	{sdl.K_RIGHT, "\x1b[C"},
+	{sdl.K_LEFT, "\x1b[D"},
+	{sdl.K_HOME, "\x1b[H"},
+	{sdl.K_END, "\x1b[F"},
+	{sdl.K_INSERT, "\x1b[2~"},
+	{sdl.K_DELETE, "\x1b[3~"},
+	{sdl.K_PAGEUP, "\x1b[5~"},
+	{sdl.K_PAGEDOWN, "\x1b[6~"},
+}
+
+// letterKeys are the keycodes of a to z in order
+var letterKeys = []sdl.Keycode{
+	sdl.K_a, sdl.K_b, sdl.K_c, sdl.K_d, sdl.K_e, sdl.K_f, sdl.K_g, sdl.K_h, sdl.K_i, sdl.K_j, sdl.K_k, sdl.K_l, sdl.K_m,
+	sdl.K_n, sdl.K_o, sdl.K_p, sdl.K_q, sdl.K_r, sdl.K_s, sdl.K_t, sdl.K_u, sdl.K_v, sdl.K_w, sdl.K_x, sdl.K_y, sdl.K_z,
+}
+
+// IsRawInputMode returns true if input goes straight to the active cmd instead of cmdBuf (see rawInputMode)
+func (nt *nterm) IsRawInputMode() bool {
+	return nt.rawInputMode && nt.activeCmd != nil
+}
+
+// WriteToActiveCmd writes bs to the stdin of the active cmd. If writing fails the error is shown, but the cmd stays active
+// because it might still be running (e.g. it closed its stdin but still writes output)
+func (nt *nterm) WriteToActiveCmd(bs []byte) {
+
+	activeCmd := nt.activeCmd
+	if activeCmd == nil {
+		return
+	}
+
+	_, err := activeCmd.Stdin.Write(bs)
+	if err != nil {
+		nt.WriteToTextBuf([]byte(fmt.Sprintf("Writing to stdin pipe of '%s' failed. Error: %s\n", activeCmd.C.Path, err.Error())))
+	}
+}
+
+// ReadRawInputs replaces the cmdBuf editing part of ReadInputs while in raw input mode. Special keys and Ctrl+letter
+// are sent to the active cmd as the bytes a terminal would send, and the cmd does its own echo and cursor movement.
+//
+// Keys bound by nterm itself aren't sent, which are all Ctrl+Shift combinations (e.g. Ctrl+Shift+R leaves raw input mode),
+// Ctrl+Tab and Ctrl+T
+func (nt *nterm) ReadRawInputs(wheelDeltaY float32) {
+
+	if wheelDeltaY != 0 {
+		nt.ScrollSmooth(-wheelDeltaY * float32(nt.scrollSpd))
+	}
+
+	isCtrlDown := input.KeyDown(sdl.K_LCTRL) || input.KeyDown(sdl.K_RCTRL)
+	isShiftDown := input.KeyDown(sdl.K_LSHIFT) || input.KeyDown(sdl.K_RSHIFT)
+	if isCtrlDown && isShiftDown {
+		return
+	}
+
+	for _, k := range rawKeySeqs {
+
+		if !input.KeyClicked(k.key) || k.key == sdl.K_TAB && isCtrlDown {
+			continue
+		}
+
+		nt.WriteToActiveCmd([]byte(k.seq))
+	}
+
+	// Ctrl+letter gives the control char of that letter (e.g. Ctrl+C is 0x03). Ctrl+T is skipped as it terminates the cmd,
+	// and Ctrl+F never gets here because it opens the search bar
+	if isCtrlDown {
+		for i, k := range letterKeys {
+			if k != sdl.K_t && input.KeyClicked(k) {
+				nt.WriteToActiveCmd([]byte{byte(i) + 1})
+			}
+		}
+	}
+}
@@ -1,53 +1,417 @@
 package ring
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
 	"github.com/bloeys/nterm/assert"
 	"golang.org/x/exp/constraints"
 )
 
 type Buffer[T any] struct {
 	Data  []T
-	Start int64
-	Len   int64
-	Cap   int64
+	start int64
+	len   int64
+	cap   int64
+
+	// writtenElements is the total number of elements written to the buffer over its lifetime.
+	// Can be bigger than cap
+	writtenElements uint64
+}
+
+// Len returns the number of elements in the buffer, which is at most Cap
+func (b *Buffer[T]) Len() int64 {
+	return b.len
+}
+
+// Cap returns the number of elements the buffer can hold before new writes overwrite the oldest ones
+func (b *Buffer[T]) Cap() int64 {
+	return b.cap
+}
 
-	// WrittenElements is the total number of elements written to the buffer over its lifetime.
-	// Can be bigger than Cap
-	WrittenElements uint64
+// Start returns the index into Data of the oldest element, which is what relative indices are relative to
+func (b *Buffer[T]) Start() int64 {
+	return b.start
+}
+
+// Written returns the total number of elements written to the buffer over its lifetime, which can be bigger than Cap
+func (b *Buffer[T]) Written() uint64 {
+	return b.writtenElements
 }
 
 func (b *Buffer[T]) Write(x ...T) {
 
 	inLen := int64(len(x))
-	b.WrittenElements += uint64(inLen)
+	b.writtenElements += uint64(inLen)
 
 	for len(x) > 0 {
 
 		copied := copy(b.Data[b.WriteHead():], x)
 		x = x[copied:]
+		b.growAfterWrite(int64(copied))
+	}
+}
+
+// WriteByte writes a single byte, and is faster than calling Write with one element because nothing is copied
+// into a variadic slice. Go doesn't allow methods only for some element types, so this is a function
+func WriteByte(b *Buffer[byte], c byte) {
+	writeOne(b, c)
+}
+
+// WriteRune is like WriteByte but for rune buffers
+func WriteRune(b *Buffer[rune], r rune) {
+	writeOne(b, r)
+}
+
+func writeOne[T any](b *Buffer[T], x T) {
+
+	b.writtenElements++
+
+	b.Data[b.WriteHead()] = x
+	b.growAfterWrite(1)
+}
+
+// growAfterWrite updates Len and Start after count elements were placed at WriteHead.
+// Start might not be zero when the buffer isn't full (e.g. after Rotate), so we only grow by count
+// and move Start past any elements that got overwritten
+func (b *Buffer[T]) growAfterWrite(count int64) {
+
+	newLen := b.len + count
+	if newLen > b.cap {
+		b.start = (b.start + newLen - b.cap) % b.cap
+		newLen = b.cap
+	}
+	b.len = newLen
+}
+
+// ReadFrom implements io.ReaderFrom for byte buffers, and writes everything read from r until io.EOF like Write does.
+// Reads go directly into Data in chunks that end at the end of Data (or earlier if r returns less), so like Write old
+// elements are overwritten once the buffer is full. It blocks whenever r blocks.
+//
+// An error is returned for buffers that don't hold bytes
+func (b *Buffer[T]) ReadFrom(r io.Reader) (n int64, err error) {
+
+	data, ok := any(b.Data).([]byte)
+	if !ok {
+		return 0, errors.New("ring.Buffer.ReadFrom: only byte buffers can be read into")
+	}
 
-		if b.Len == b.Cap {
-			b.Start = (b.Start + int64(copied)) % (b.Cap)
-		} else {
-			b.Len = clamp(b.Len+inLen, 0, b.Cap)
+	for {
+
+		read, err := r.Read(data[b.WriteHead():])
+		if read > 0 {
+			n += int64(read)
+			b.writtenElements += uint64(read)
+			b.growAfterWrite(int64(read))
+		}
+
+		if err == io.EOF {
+			return n, nil
+		}
+
+		if err != nil {
+			return n, err
+		}
+	}
+}
+
+// WriteTo implements io.WriterTo for byte buffers, and writes all elements (oldest first) to w.
+// Unlike bytes.Buffer.WriteTo the buffer isn't changed, use Drain to also remove the elements.
+//
+// An error is returned for buffers that don't hold bytes
+func (b *Buffer[T]) WriteTo(w io.Writer) (n int64, err error) {
+
+	if _, ok := any(b.Data).([]byte); !ok {
+		return 0, errors.New("ring.Buffer.WriteTo: only byte buffers can be written out")
+	}
+
+	v1, v2 := b.Views()
+	for _, v := range [2][]byte{any(v1).([]byte), any(v2).([]byte)} {
+
+		if len(v) == 0 {
+			continue
+		}
+
+		written, err := w.Write(v)
+		n += int64(written)
+		if err != nil {
+			return n, err
 		}
 	}
+
+	return n, nil
 }
 
 //WriteHead is the absolute position within the buffer where new writes will happen
 func (b *Buffer[T]) WriteHead() int64 {
-	return (b.Start + b.Len) % b.Cap
+	return (b.start + b.len) % b.cap
 }
 
 //Clear resets Len and Start to zero but elements within Data aren't touched.
 //This gives you empty Views and new writes/inserts will overwrite old data
 func (b *Buffer[T]) Clear() {
-	b.Len = 0
-	b.Start = 0
+	b.len = 0
+	b.start = 0
+}
+
+// Count returns the number of elements for which fn returns true
+func (b *Buffer[T]) Count(fn func(T) bool) int {
+
+	count := 0
+	v1, v2 := b.Views()
+	for i := 0; i < len(v1); i++ {
+		if fn(v1[i]) {
+			count++
+		}
+	}
+
+	for i := 0; i < len(v2); i++ {
+		if fn(v2[i]) {
+			count++
+		}
+	}
+
+	return count
+}
+
+// Any returns true if fn returns true for at least one element. False is returned if the buffer is empty
+func (b *Buffer[T]) Any(fn func(T) bool) bool {
+
+	v1, v2 := b.Views()
+	for i := 0; i < len(v1); i++ {
+		if fn(v1[i]) {
+			return true
+		}
+	}
+
+	for i := 0; i < len(v2); i++ {
+		if fn(v2[i]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// All returns true if fn returns true for every element. True is returned if the buffer is empty
+func (b *Buffer[T]) All(fn func(T) bool) bool {
+
+	return !b.Any(func(val T) bool {
+		return !fn(val)
+	})
+}
+
+// Map returns a new buffer of capacity cap with the result of fn on each element of b (oldest first).
+// If cap is smaller than b.len then only the newest cap results are kept, just like writing to a full buffer
+func Map[T, U any](b *Buffer[T], fn func(T) U, cap uint64) *Buffer[U] {
+
+	out := NewBuffer[U](cap)
+	v1, v2 := b.Views()
+	for i := 0; i < len(v1); i++ {
+		out.Write(fn(v1[i]))
+	}
+
+	for i := 0; i < len(v2); i++ {
+		out.Write(fn(v2[i]))
+	}
+
+	return out
+}
+
+// Filter returns a new buffer of capacity cap with the elements of b for which fn returns true (oldest first).
+// Like Map, only the newest cap elements are kept if more than cap elements pass
+func Filter[T any](b *Buffer[T], fn func(T) bool, cap uint64) *Buffer[T] {
+
+	out := NewBuffer[T](cap)
+	v1, v2 := b.Views()
+	for i := 0; i < len(v1); i++ {
+		if fn(v1[i]) {
+			out.Write(v1[i])
+		}
+	}
+
+	for i := 0; i < len(v2); i++ {
+		if fn(v2[i]) {
+			out.Write(v2[i])
+		}
+	}
+
+	return out
+}
+
+// Reduce calls fn on each element of b (oldest first) with the result of the previous call, starting with initial,
+// and returns the last result. initial is returned if the buffer is empty
+func Reduce[T, U any](b *Buffer[T], initial U, fn func(U, T) U) U {
+
+	acc := initial
+	v1, v2 := b.Views()
+	for i := 0; i < len(v1); i++ {
+		acc = fn(acc, v1[i])
+	}
+
+	for i := 0; i < len(v2); i++ {
+		acc = fn(acc, v2[i])
+	}
+
+	return acc
+}
+
+// BinarySearch returns the relative index of target in b, which must be sorted in ascending order according to less.
+// If target isn't in b then found is false and relIndex is where target would be inserted to keep b sorted
+func BinarySearch[T any](b *Buffer[T], target T, less func(T, T) bool) (relIndex int64, found bool) {
+
+	relIndex = int64(sort.Search(int(b.len), func(i int) bool {
+		return !less(b.Get(uint64(i)), target)
+	}))
+
+	return relIndex, relIndex < b.len && !less(target, b.Get(uint64(relIndex)))
+}
+
+// BinarySearchFunc is like BinarySearch but uses cmp, which returns a negative number for elements before the target,
+// zero for elements matching the target and a positive number for elements after it. If multiple elements match then
+// relIndex is the first of them
+func BinarySearchFunc[T any](b *Buffer[T], cmp func(T) int) (relIndex int64, found bool) {
+
+	relIndex = int64(sort.Search(int(b.len), func(i int) bool {
+		return cmp(b.Get(uint64(i))) >= 0
+	}))
+
+	return relIndex, relIndex < b.len && cmp(b.Get(uint64(relIndex))) == 0
+}
+
+// Drain returns all elements in a new slice (oldest first) and clears the buffer. Written() is unchanged
+func (b *Buffer[T]) Drain() []T {
+
+	out := make([]T, b.len)
+	b.DrainInto(out)
+	return out
+}
+
+// DrainInto is like Drain but copies into dst and returns the number of copied elements. If dst is smaller than Len
+// then only the oldest len(dst) elements are copied and removed, and the rest stay in the buffer
+func (b *Buffer[T]) DrainInto(dst []T) int {
+
+	v1, v2 := b.Views()
+	copied := copy(dst, v1)
+	copied += copy(dst[copied:], v2)
+
+	// Unlike Clear, Rotate keeps Start matching Written() even when everything is drained
+	b.Rotate(int64(copied))
+	return copied
+}
+
+// Peek returns a new slice with up to n elements starting at fromRelIndex (oldest first). Unlike ViewsFromToRelIndex
+// the elements are always in one slice even if they wrap around the end of Data. The buffer isn't changed
+func (b *Buffer[T]) Peek(fromRelIndex, n uint64) []T {
+
+	if fromRelIndex >= uint64(b.len) {
+		return []T{}
+	}
+
+	out := make([]T, clamp(n, 0, uint64(b.len)-fromRelIndex))
+	b.PeekInto(out, fromRelIndex)
+	return out
+}
+
+// PeekInto is like Peek but copies up to len(dst) elements into dst and returns the number of copied elements
+func (b *Buffer[T]) PeekInto(dst []T, fromRelIndex uint64) int {
+
+	if len(dst) == 0 {
+		return 0
+	}
+
+	v1, v2 := b.ViewsFromToRelIndex(fromRelIndex, fromRelIndex+uint64(len(dst))-1)
+	copied := copy(dst, v1)
+	copied += copy(dst[copied:], v2)
+	return copied
+}
+
+// Rotate discards the oldest n elements by moving Start forward, which is like DrainInto without the copying.
+// n is clamped to Len, and nothing happens if n isn't positive. Unlike Clear, Start keeps matching Written()
+// so indices based on write counts stay correct
+func (b *Buffer[T]) Rotate(n int64) {
+
+	if n <= 0 {
+		return
+	}
+
+	n = clamp(n, 0, b.len)
+	b.start = (b.start + n) % b.cap
+	b.len -= n
+}
+
+// Compact moves the buffer contents into a new Data slice of size newCap, which can be smaller or bigger than Cap.
+// An error is returned if newCap is zero or smaller than Len.
+//
+// Elements keep their relative indices, and are placed such that indices based on Written()
+// (e.g. AbsIndexFromWriteCount) stay correct. Existing views and iterators become invalid
+func (b *Buffer[T]) Compact(newCap int64) error {
+
+	if newCap <= 0 {
+		return errors.New("ring.Buffer.Compact: new capacity must be larger than zero")
+	}
+
+	if newCap < b.len {
+		return fmt.Errorf("ring.Buffer.Compact: new capacity of %d is smaller than buffer length of %d", newCap, b.len)
+	}
+
+	// The last written element always lives at (Written()-1)%Cap, so the first element must start
+	// at (Written()-Len)%newCap in the new buffer
+	newData := make([]T, newCap)
+	newStart := int64((b.writtenElements - uint64(b.len)) % uint64(newCap))
+
+	v1, v2 := b.Views()
+	copyWrapped(newData, newStart, v1)
+	copyWrapped(newData, (newStart+int64(len(v1)))%newCap, v2)
+
+	b.Data = newData
+	b.start = newStart
+	b.cap = newCap
+	return nil
+}
+
+// Grow is like Compact but only increases the capacity, and returns an error if newCap is smaller than Cap
+func (b *Buffer[T]) Grow(newCap int64) error {
+
+	if newCap < b.cap {
+		return fmt.Errorf("ring.Buffer.Grow: new capacity of %d is smaller than current capacity of %d", newCap, b.cap)
+	}
+
+	return b.Compact(newCap)
+}
+
+// CopyTo replaces the contents of dst with the elements of b (oldest first) and returns the number of copied elements.
+// If dst.cap is smaller than Len then only the newest dst.cap elements are copied, like writing all of b into dst would.
+//
+// dst gets the Written() of b, and like with Compact, elements are placed such that indices based on Written()
+// stay correct in dst. b isn't changed
+func (b *Buffer[T]) CopyTo(dst *Buffer[T]) int {
+
+	copyLen := clamp(b.len, 0, dst.cap)
+	dst.start = int64((b.writtenElements - uint64(copyLen)) % uint64(dst.cap))
+	dst.len = copyLen
+	dst.writtenElements = b.writtenElements
+
+	if copyLen == 0 {
+		return 0
+	}
+
+	v1, v2 := b.ViewsFromToRelIndex(uint64(b.len-copyLen), uint64(b.len-1))
+	copyWrapped(dst.Data, dst.start, v1)
+	copyWrapped(dst.Data, (dst.start+int64(len(v1)))%dst.cap, v2)
+	return int(copyLen)
+}
+
+// copyWrapped copies src into dst starting at index start, and continues from the beginning of dst if the end is reached
+func copyWrapped[T any](dst []T, start int64, src []T) {
+	copied := copy(dst[start:], src)
+	copy(dst, src[copied:])
 }
 
 func (b *Buffer[T]) IsFull() bool {
-	return b.Len == b.Cap
+	return b.len == b.cap
 }
 
 func clamp[T constraints.Ordered](x, min, max T) T {
@@ -63,37 +427,133 @@ func clamp[T constraints.Ordered](x, min, max T) T {
 	return x
 }
 
-// Get returns the element at the index relative from Buffer.Start
+// Get returns the element at the index relative from Buffer.Start()
 // If there are no elements then the default value of T is returned
 func (b *Buffer[T]) Get(index uint64) (val T) {
 
-	if index >= uint64(b.Len) {
+	if index >= uint64(b.len) {
 		return val
 	}
 
-	return b.Data[(b.Start+int64(index))%b.Cap]
+	return b.Data[(b.start+int64(index))%b.cap]
 }
 
-// Get returns the element at the index relative from Buffer.Start
+// Get returns the element at the index relative from Buffer.Start()
 // If there are no elements then the default value of T is returned
 func (b *Buffer[T]) GetPtr(index uint64) (val *T) {
 
-	if index >= uint64(b.Len) {
+	if index >= uint64(b.len) {
 		return new(T)
 	}
 
-	return &b.Data[(b.Start+int64(index))%b.Cap]
+	return &b.Data[(b.start+int64(index))%b.cap]
+}
+
+// First returns the oldest element (the one at Buffer.Start()). ok is false if the buffer is empty
+func (b *Buffer[T]) First() (val T, ok bool) {
+
+	if b.len == 0 {
+		return val, false
+	}
+
+	return b.Data[b.start], true
 }
 
-// AbsIndexFromRel takes an index relative to Buffer.Start and returns an absolute index into Buffer.Data
+// Last returns the last written element. ok is false if the buffer is empty
+func (b *Buffer[T]) Last() (val T, ok bool) {
+
+	if b.len == 0 {
+		return val, false
+	}
+
+	return b.Data[(b.start+b.len-1)%b.cap], true
+}
+
+// FirstPtr is like First but returns a pointer into Data, which is nil if the buffer is empty
+func (b *Buffer[T]) FirstPtr() (val *T, ok bool) {
+
+	if b.len == 0 {
+		return nil, false
+	}
+
+	return &b.Data[b.start], true
+}
+
+// LastPtr is like Last but returns a pointer into Data, which is nil if the buffer is empty
+func (b *Buffer[T]) LastPtr() (val *T, ok bool) {
+
+	if b.len == 0 {
+		return nil, false
+	}
+
+	return &b.Data[(b.start+b.len-1)%b.cap], true
+}
+
+// WriteAt overwrites the element at the index relative from Buffer.Start().
+// Unlike Write this doesn't change Len, Start or Written().
+//
+// Panics if relIndex>=Buffer.Len
+func (b *Buffer[T]) WriteAt(relIndex uint64, val T) {
+
+	if relIndex >= uint64(b.len) {
+		panic("ring.Buffer.WriteAt: index out of range")
+	}
+
+	b.Data[b.AbsIndexFromRel(relIndex)] = val
+}
+
+// WriteRangeAt overwrites elements starting at the index relative from Buffer.Start().
+// Only existing elements are overwritten, so writing stops at Buffer.Len and the number of written elements is returned.
+// Like WriteAt this doesn't change Len, Start or Written()
+func (b *Buffer[T]) WriteRangeAt(relIndex uint64, vals []T) int {
+
+	if relIndex >= uint64(b.len) {
+		return 0
+	}
+
+	writeCount := clamp(uint64(len(vals)), 0, uint64(b.len)-relIndex)
+	for i := uint64(0); i < writeCount; i++ {
+		b.Data[b.AbsIndexFromRel(relIndex+i)] = vals[i]
+	}
+
+	return int(writeCount)
+}
+
+// InsertAt inserts vals before the element at the index relative from Buffer.Start(), moving that element and the ones
+// after it towards the end. If relIndex==Len this is the same as Write.
+//
+// Like with Write, the oldest elements are dropped if there isn't enough room, and Written() grows by len(vals) so indices
+// based on write counts of elements after relIndex move by len(vals).
+//
+// Panics if relIndex>Buffer.Len
+func (b *Buffer[T]) InsertAt(relIndex uint64, vals ...T) {
+
+	if relIndex > uint64(b.len) {
+		panic("ring.Buffer.InsertAt: index out of range")
+	}
+
+	if len(vals) == 0 {
+		return
+	}
+
+	// The elements after relIndex are cut off and written again after vals, which handles wrapping and dropping old elements
+	tail := b.Peek(relIndex, uint64(b.len)-relIndex)
+	b.len = int64(relIndex)
+	b.writtenElements -= uint64(len(tail))
+
+	b.Write(vals...)
+	b.Write(tail...)
+}
+
+// AbsIndexFromRel takes an index relative to Buffer.Start() and returns an absolute index into Buffer.Data
 func (b *Buffer[T]) AbsIndexFromRel(relIndex uint64) uint64 {
-	return uint64((b.Start + int64(relIndex)) % b.Cap)
+	return uint64((b.start + int64(relIndex)) % b.cap)
 }
 
-// RelIndexFromAbs takes an index into Buffer.Data and returns an index relative to Buffer.Start
+// RelIndexFromAbs takes an index into Buffer.Data and returns an index relative to Buffer.Start()
 func (b *Buffer[T]) RelIndexFromAbs(absIndex uint64) uint64 {
-	assert.T(absIndex < uint64(b.Cap), "absIndex must be between 0 and Buffer.Cap-1")
-	return uint64((int64(absIndex) - b.Start + b.Cap) % b.Cap)
+	assert.T(absIndex < uint64(b.cap), "absIndex must be between 0 and Buffer.Cap-1")
+	return uint64((int64(absIndex) - b.start + b.cap) % b.cap)
 }
 
 // AbsIndexFromWriteCount takes the total number of elements written and returns the index of the
@@ -108,11 +568,11 @@ func (b *Buffer[T]) AbsIndexFromWriteCount(writeCount uint64) uint64 {
 		return 0
 	}
 
-	return (writeCount - 1) % uint64(b.Cap)
+	return (writeCount - 1) % uint64(b.cap)
 }
 
 // RelIndexFromWriteCount takes the total number of elements written and returns the index of the
-// last written element after 'writeCount' writes relative to the current Buffer.Start value.
+// last written element after 'writeCount' writes relative to the current Buffer.Start() value.
 //
 // For example, if writeCount=1 then the index of last written element (the returned value) is zero.
 // For a buffer of cap=4, after 5 writes the last updated index is absIndex=0
@@ -134,12 +594,12 @@ func (b *Buffer[T]) RelIndexFromWriteCount(writeCount uint64) uint64 {
 // Note: Views become invalid when a write/insert is done on the buffer
 func (b *Buffer[T]) Views() (v1, v2 []T) {
 
-	if b.Start+b.Len <= b.Cap {
-		return b.Data[b.Start : b.Start+b.Len], []T{}
+	if b.start+b.len <= b.cap {
+		return b.Data[b.start : b.start+b.len], []T{}
 	}
 
-	v1 = b.Data[b.Start:]
-	v2 = b.Data[:(b.Start+b.Len)%b.Cap]
+	v1 = b.Data[b.start:]
+	v2 = b.Data[:(b.start+b.len)%b.cap]
 	return
 }
 
@@ -149,12 +609,12 @@ func (b *Buffer[T]) ViewsFromToWriteCount(fromIndex, toIndex uint64) (v1, v2 []T
 	return b.ViewsFromToRelIndex(fromIndex, toIndex)
 }
 
-// ViewsFromToRelIndex takes indices relative to Buffer.Start and returns views adjusted to contain
+// ViewsFromToRelIndex takes indices relative to Buffer.Start() and returns views adjusted to contain
 // elements between these two indices (inclusive)
 func (b *Buffer[T]) ViewsFromToRelIndex(fromIndex, toIndex uint64) (v1, v2 []T) {
 
 	toIndex++ // We convert the index into a length (e.g. from=0, to=0 is from=0, len=1)
-	if toIndex <= fromIndex || fromIndex >= uint64(b.Len) {
+	if toIndex <= fromIndex || fromIndex >= uint64(b.len) {
 		return []T{}, []T{}
 	}
 
@@ -196,32 +656,45 @@ func (b *Buffer[T]) Iterator() Iterator[T] {
 	return NewIterator(b)
 }
 
+// ReverseIterator returns an iterator positioned at the end of the buffer, such that the first Prev() call returns
+// the last (newest) element. It is the same as calling Iterator.GotoEnd() on a new iterator
+func (b *Buffer[T]) ReverseIterator() Iterator[T] {
+	it := NewIterator(b)
+	it.GotoEnd()
+	return it
+}
+
 func NewBuffer[T any](capacity uint64) *Buffer[T] {
 
 	return &Buffer[T]{
 		Data:  make([]T, capacity),
-		Start: 0,
-		Len:   0,
-		Cap:   int64(capacity),
+		start: 0,
+		len:   0,
+		cap:   int64(capacity),
 	}
 }
 
 // Iterator provides a way of iterating and indexing values of a ring buffer as if it was a flat array
 // without having to deal with wrapping and so on.
 //
-// Indices used are all relative to 'Buffer.Start'
+// Indices used are all relative to 'Buffer.Start()'
 type Iterator[T any] struct {
 	Buf *Buffer[T]
 	V1  []T
 	V2  []T
 
 	// Curr is the index of the element that will be returned on Next(),
-	// which means it is an index into V1 or V2 and so is relative to Buffer.Start value at the time
+	// which means it is an index into V1 or V2 and so is relative to Buffer.Start() value at the time
 	// of creating this iterator instance
 	Curr int64
 	InV1 bool
 }
 
+// Clone returns a copy of the iterator at the same position, which can be moved without changing the position of it
+func (it *Iterator[T]) Clone() Iterator[T] {
+	return *it
+}
+
 func (it *Iterator[T]) Len() int64 {
 	return int64(len(it.V1) + len(it.V2))
 }
@@ -312,6 +785,18 @@ func (it *Iterator[T]) Prev() (v T, done bool) {
 	return *vPtr, done
 }
 
+// ForEachReverse calls Prev() until there are no more values or fn returns false, and passes each value
+// with its index relative to Buffer.Start() to fn. Use with Buffer.ReverseIterator to go over all values newest first
+func (it *Iterator[T]) ForEachReverse(fn func(index int64, val T) bool) {
+
+	for v, done := it.PrevPtr(); !done; v, done = it.PrevPtr() {
+
+		if !fn(int64(it.CurrToRelIndex()), *v) {
+			break
+		}
+	}
+}
+
 // NextN calls Next() up to n times and places the result in the passed buffer.
 // 'read' is the actual number of elements put in the buffer.
 // We might not be able to put 'n' elements because the buffer is too small or because there aren't enough remaining elements
@@ -386,7 +871,7 @@ func (it *Iterator[T]) GotoStart() {
 	it.InV1 = len(it.V1) > 0
 }
 
-// GotoIndex goes to the index n relative to Buffer.Start.
+// GotoIndex goes to the index n relative to Buffer.Start().
 // If n<=0 this is equivalent to Iterator.GotoStart()
 // if n>=Buffer.Len this is equivalent to Iterator.GotoEnd()
 func (it *Iterator[T]) GotoIndex(n int64) {
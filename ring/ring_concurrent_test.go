@@ -0,0 +1,119 @@
+package ring_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/bloeys/nterm/ring"
+)
+
+// TestConcurrentReadWrite uses a buffer from many goroutines with a shared mutex, like nterm does with textBuf.
+// Run with 'go test -race' to also check for data races
+func TestConcurrentReadWrite(t *testing.T) {
+
+	const writers = 4
+	const readers = 4
+	const writesPerWriter = 10_000
+	const chunkSize = 100
+
+	var mutex sync.Mutex
+	b := ring.NewBuffer[int](1024)
+
+	// Each value is writerIndex*writesPerWriter+seq, so values of the same writer must be increasing
+	writersWg := sync.WaitGroup{}
+	for w := 0; w < writers; w++ {
+
+		writersWg.Add(1)
+		go func(w int) {
+
+			defer writersWg.Done()
+
+			chunk := make([]int, chunkSize)
+			for seq := 0; seq < writesPerWriter; seq += chunkSize {
+
+				for i := 0; i < chunkSize; i++ {
+					chunk[i] = w*writesPerWriter + seq + i
+				}
+
+				mutex.Lock()
+				b.Write(chunk...)
+				mutex.Unlock()
+			}
+		}(w)
+	}
+
+	done := make(chan struct{})
+	readersWg := sync.WaitGroup{}
+	errs := make(chan string, readers)
+	for r := 0; r < readers; r++ {
+
+		readersWg.Add(1)
+		go func() {
+
+			defer readersWg.Done()
+
+			for {
+
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				mutex.Lock()
+				err := checkWriterOrder(b, writesPerWriter)
+				mutex.Unlock()
+
+				if err != "" {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+
+	writersWg.Wait()
+	close(done)
+	readersWg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	Check(t, uint64(writers*writesPerWriter), b.Written())
+	Check(t, b.Cap(), b.Len())
+
+	err := checkWriterOrder(b, writesPerWriter)
+	Check(t, "", err)
+}
+
+// checkWriterOrder returns an error message if the values of any writer are out of order in the views of b,
+// or if iterating doesn't visit every element
+func checkWriterOrder(b *ring.Buffer[int], writesPerWriter int) string {
+
+	it := b.Iterator()
+	v1, v2 := b.Views()
+	if int64(len(v1)+len(v2)) != b.Len() {
+		return "views don't cover the whole buffer"
+	}
+
+	seen := int64(0)
+	lastSeen := map[int]int{}
+	for v, done := it.Next(); !done; v, done = it.Next() {
+
+		seen++
+		w := v / writesPerWriter
+		if last, ok := lastSeen[w]; ok && v <= last {
+			return "values of a writer are out of order"
+		}
+
+		lastSeen[w] = v
+	}
+
+	if seen != b.Len() {
+		return "iterating didn't visit every element"
+	}
+
+	return ""
+}
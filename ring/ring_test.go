@@ -1,7 +1,10 @@
 package ring_test
 
 import (
+	"fmt"
+	"io"
 	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/bloeys/nterm/ring"
@@ -17,11 +20,11 @@ func TestRing(t *testing.T) {
 	v1, v2 := b.Views()
 	CheckArr(t, []rune{'a', 'b', 'c', 'd'}, v1)
 	CheckArr(t, nil, v2)
-	Check(t, 0, b.Start)
-	Check(t, 4, b.Len)
+	Check(t, 0, b.Start())
+	Check(t, 4, b.Len())
 
 	b.Write('e', 'f')
-	Check(t, 2, b.Start)
+	Check(t, 2, b.Start())
 	CheckArr(t, []rune{'e', 'f', 'c', 'd'}, b.Data)
 
 	v1, v2 = b.Views()
@@ -29,7 +32,7 @@ func TestRing(t *testing.T) {
 	CheckArr(t, []rune{'e', 'f'}, v2)
 
 	b.Write('g')
-	Check(t, 3, b.Start)
+	Check(t, 3, b.Start())
 
 	v1, v2 = b.Views()
 	CheckArr(t, []rune{'e', 'f', 'g', 'd'}, b.Data)
@@ -38,7 +41,7 @@ func TestRing(t *testing.T) {
 
 	b = ring.NewBuffer[rune](4)
 	b.Write('a', 'b', 'c', 'd', 'e')
-	Check(t, 1, b.Start)
+	Check(t, 1, b.Start())
 
 	// Input over 2x bigger than buffer
 	b = ring.NewBuffer[rune](4)
@@ -47,25 +50,25 @@ func TestRing(t *testing.T) {
 
 	// Input starting in the middle and having to loop back and WrittenElements
 	b2 := ring.NewBuffer[int](4)
-	Check(t, 0, b2.WrittenElements)
+	Check(t, 0, b2.Written())
 
 	b2.Write(1, 2, 3)
-	Check(t, 3, b2.WrittenElements)
+	Check(t, 3, b2.Written())
 
 	b2.Write(4, 5)
-	Check(t, 5, b2.WrittenElements)
+	Check(t, 5, b2.Written())
 	CheckArr(t, []int{5, 2, 3, 4}, b2.Data)
 
 	b2.Write(6)
-	Check(t, 6, b2.WrittenElements)
+	Check(t, 6, b2.Written())
 	CheckArr(t, []int{5, 6, 3, 4}, b2.Data)
 
 	b2.Write(7)
-	Check(t, 7, b2.WrittenElements)
+	Check(t, 7, b2.Written())
 	CheckArr(t, []int{5, 6, 7, 4}, b2.Data)
 
 	b2.Write(8)
-	Check(t, 8, b2.WrittenElements)
+	Check(t, 8, b2.Written())
 	CheckArr(t, []int{5, 6, 7, 8}, b2.Data)
 
 	// ViewsFromTo
@@ -147,6 +150,99 @@ func TestRing(t *testing.T) {
 	CheckArr(t, []int{5, 6}, v22)
 }
 
+func TestWriteAt(t *testing.T) {
+
+	b := ring.NewBuffer[int](4)
+	b.Write(1, 2, 3)
+
+	b.WriteAt(0, 10)
+	b.WriteAt(2, 30)
+	CheckArr(t, []int{10, 2, 30, 0}, b.Data)
+	Check(t, 0, b.Start())
+	Check(t, 3, b.Len())
+	Check(t, 3, b.Written())
+
+	// Wrapping
+	b.Write(4, 5)
+	b.WriteAt(3, 50)
+	b.WriteAt(0, 20)
+	CheckArr(t, []int{50, 20, 30, 4}, b.Data)
+	Check(t, 1, b.Start())
+	Check(t, 4, b.Len())
+	Check(t, 5, b.Written())
+
+	func() {
+
+		defer func() {
+			if recover() == nil {
+				t.Fatalf("Expected WriteAt to panic on an out of range index\n")
+			}
+		}()
+
+		b.WriteAt(4, 0)
+	}()
+
+	// WriteRangeAt
+	b = ring.NewBuffer[int](4)
+	b.Write(1, 2, 3)
+
+	Check(t, 2, b.WriteRangeAt(1, []int{20, 30}))
+	CheckArr(t, []int{1, 20, 30, 0}, b.Data)
+
+	Check(t, 1, b.WriteRangeAt(2, []int{300, 400, 500}))
+	CheckArr(t, []int{1, 20, 300, 0}, b.Data)
+
+	Check(t, 0, b.WriteRangeAt(3, []int{4}))
+	CheckArr(t, []int{1, 20, 300, 0}, b.Data)
+	Check(t, 3, b.Len())
+	Check(t, 3, b.Written())
+
+	b.Write(4, 5, 6)
+	Check(t, 4, b.WriteRangeAt(0, []int{30, 40, 50, 60, 70}))
+	CheckArr(t, []int{50, 60, 30, 40}, b.Data)
+	Check(t, 2, b.Start())
+	Check(t, 6, b.Written())
+}
+
+func TestInsertAt(t *testing.T) {
+
+	b := ring.NewBuffer[int](5)
+	b.Write(1, 2, 3)
+
+	b.InsertAt(1, 10, 11)
+	CheckArr(t, []int{1, 10, 11, 2, 3}, b.Peek(0, 5))
+	Check(t, 5, b.Len())
+	Check(t, 5, b.Written())
+
+	// Full buffers drop the oldest elements, which here is the inserted one
+	b.InsertAt(0, 0)
+	CheckArr(t, []int{1, 10, 11, 2, 3}, b.Peek(0, 5))
+	Check(t, 6, b.Written())
+
+	b.InsertAt(2, 20)
+	CheckArr(t, []int{10, 20, 11, 2, 3}, b.Peek(0, 5))
+	Check(t, 3, b.Get(b.RelIndexFromWriteCount(b.Written())))
+
+	// Inserting at Len appends
+	b.InsertAt(5, 4)
+	CheckArr(t, []int{20, 11, 2, 3, 4}, b.Peek(0, 5))
+	Check(t, 8, b.Written())
+
+	b.InsertAt(1)
+	Check(t, 8, b.Written())
+
+	func() {
+
+		defer func() {
+			if recover() == nil {
+				t.Fatalf("Expected InsertAt to panic on an out of range index\n")
+			}
+		}()
+
+		b.InsertAt(6, 0)
+	}()
+}
+
 func TestIterator(t *testing.T) {
 
 	// Only v1 set
@@ -275,6 +371,672 @@ func TestIterator(t *testing.T) {
 	Check(t, true, done)
 }
 
+func TestCompact(t *testing.T) {
+
+	b := ring.NewBuffer[int](8)
+	b.Write(1, 2, 3, 4, 5, 6, 7, 8, 9, 10)
+	Check(t, 2, b.Start())
+	Check(t, 8, b.Len())
+
+	// Too small
+	Check(t, true, b.Compact(7) != nil)
+	Check(t, true, b.Compact(0) != nil)
+
+	// Growing
+	Check(t, true, b.Compact(16) == nil)
+	Check(t, 16, b.Cap())
+	Check(t, 8, b.Len())
+	Check(t, 10, b.Written())
+	checkBufferContents(t, b, []int{3, 4, 5, 6, 7, 8, 9, 10})
+	Check(t, 10, b.Get(uint64(b.RelIndexFromWriteCount(b.Written()))))
+
+	// Writes after compacting continue normally
+	b.Write(11, 12)
+	checkBufferContents(t, b, []int{3, 4, 5, 6, 7, 8, 9, 10, 11, 12})
+	Check(t, 12, b.Get(uint64(b.RelIndexFromWriteCount(b.Written()))))
+
+	// Shrinking with wrapping
+	b.Clear()
+	b.Write(1, 2, 3)
+	Check(t, true, b.Compact(4) == nil)
+	checkBufferContents(t, b, []int{1, 2, 3})
+	Check(t, 3, b.Get(uint64(b.RelIndexFromWriteCount(b.Written()))))
+
+	b.Write(4, 5, 6)
+	checkBufferContents(t, b, []int{3, 4, 5, 6})
+	Check(t, 6, b.Get(uint64(b.RelIndexFromWriteCount(b.Written()))))
+
+	// Iterators see the compacted data
+	Check(t, true, b.Compact(5) == nil)
+	it := b.Iterator()
+	buf := make([]int, 4)
+	read, _ := it.NextN(buf, 4)
+	Check(t, 4, read)
+	CheckArr(t, []int{3, 4, 5, 6}, buf)
+}
+
+func TestGrow(t *testing.T) {
+
+	b := ring.NewBuffer[int](4)
+	b.Write(1, 2, 3, 4, 5, 6)
+	Check(t, 2, b.Start())
+
+	// Can't shrink, even if the elements would fit
+	Check(t, true, b.Grow(3) != nil)
+	Check(t, true, b.Grow(2) != nil)
+	Check(t, 4, b.Cap())
+
+	// Same capacity is allowed
+	Check(t, true, b.Grow(4) == nil)
+	checkBufferContents(t, b, []int{3, 4, 5, 6})
+
+	Check(t, true, b.Grow(10) == nil)
+	Check(t, 10, b.Cap())
+	Check(t, 4, b.Len())
+	Check(t, 6, b.Written())
+	checkBufferContents(t, b, []int{3, 4, 5, 6})
+	Check(t, 6, b.Get(uint64(b.RelIndexFromWriteCount(b.Written()))))
+
+	// The extra capacity is used before overwriting
+	b.Write(7, 8, 9, 10, 11, 12)
+	checkBufferContents(t, b, []int{3, 4, 5, 6, 7, 8, 9, 10, 11, 12})
+	b.Write(13)
+	checkBufferContents(t, b, []int{4, 5, 6, 7, 8, 9, 10, 11, 12, 13})
+}
+
+func TestCopyTo(t *testing.T) {
+
+	src := ring.NewBuffer[int](4)
+	src.Write(1, 2, 3, 4, 5, 6)
+	Check(t, 2, src.Start())
+
+	// Bigger dst gets everything
+	dst := ring.NewBuffer[int](8)
+	dst.Write(100, 101, 102)
+	Check(t, 4, src.CopyTo(dst))
+	Check(t, 4, dst.Len())
+	Check(t, 6, dst.Written())
+	checkBufferContents(t, dst, []int{3, 4, 5, 6})
+	Check(t, 6, dst.Get(uint64(dst.RelIndexFromWriteCount(dst.Written()))))
+
+	// The source is unchanged and the copy is independent of it
+	checkBufferContents(t, src, []int{3, 4, 5, 6})
+	dst.Write(7)
+	checkBufferContents(t, dst, []int{3, 4, 5, 6, 7})
+	checkBufferContents(t, src, []int{3, 4, 5, 6})
+
+	// Smaller dst gets the newest elements
+	small := ring.NewBuffer[int](3)
+	Check(t, 3, src.CopyTo(small))
+	Check(t, 3, small.Len())
+	Check(t, 6, small.Written())
+	checkBufferContents(t, small, []int{4, 5, 6})
+	Check(t, 6, small.Get(uint64(small.RelIndexFromWriteCount(small.Written()))))
+
+	small.Write(7, 8)
+	checkBufferContents(t, small, []int{6, 7, 8})
+
+	// Same capacity
+	same := ring.NewBuffer[int](4)
+	Check(t, 4, src.CopyTo(same))
+	checkBufferContents(t, same, []int{3, 4, 5, 6})
+	CheckArr(t, src.Data, same.Data)
+
+	// Empty source empties dst
+	Check(t, 0, ring.NewBuffer[int](4).CopyTo(same))
+	Check(t, 0, same.Len())
+	checkBufferContents(t, same, []int{})
+}
+
+func TestCountAnyAll(t *testing.T) {
+
+	isEven := func(x int) bool { return x%2 == 0 }
+	isPositive := func(x int) bool { return x > 0 }
+
+	// Empty
+	b := ring.NewBuffer[int](4)
+	Check(t, 0, b.Count(isEven))
+	Check(t, false, b.Any(isEven))
+	Check(t, true, b.All(isEven))
+
+	b.Write(1, 2, 3)
+	Check(t, 1, b.Count(isEven))
+	Check(t, 3, b.Count(isPositive))
+	Check(t, true, b.Any(isEven))
+	Check(t, false, b.All(isEven))
+	Check(t, true, b.All(isPositive))
+
+	// Wrapped, so both views are used
+	b.Write(4, 5, 6)
+	Check(t, 2, b.Count(isEven))
+	Check(t, 4, b.Count(isPositive))
+	Check(t, true, b.Any(func(x int) bool { return x == 6 }))
+	Check(t, false, b.Any(func(x int) bool { return x == 1 }))
+	Check(t, true, b.All(func(x int) bool { return x >= 3 }))
+	Check(t, false, b.All(func(x int) bool { return x < 6 }))
+}
+
+func TestFirstLast(t *testing.T) {
+
+	// Empty
+	b := ring.NewBuffer[int](4)
+	_, ok := b.First()
+	Check(t, false, ok)
+	_, ok = b.Last()
+	Check(t, false, ok)
+
+	p, ok := b.FirstPtr()
+	Check(t, false, ok)
+	Check(t, true, p == nil)
+	p, ok = b.LastPtr()
+	Check(t, false, ok)
+	Check(t, true, p == nil)
+
+	// One element
+	b.Write(1)
+	val, ok := b.First()
+	Check(t, true, ok)
+	Check(t, 1, val)
+	val, ok = b.Last()
+	Check(t, true, ok)
+	Check(t, 1, val)
+
+	// Full without wrapping
+	b.Write(2, 3, 4)
+	val, _ = b.First()
+	Check(t, 1, val)
+	val, _ = b.Last()
+	Check(t, 4, val)
+
+	// Fully wrapped
+	b.Write(5, 6, 7, 8, 9)
+	val, _ = b.First()
+	Check(t, 6, val)
+	val, _ = b.Last()
+	Check(t, 9, val)
+
+	// Pointers point into the buffer
+	p, ok = b.FirstPtr()
+	Check(t, true, ok)
+	*p = 60
+	Check(t, 60, b.Get(0))
+
+	p, ok = b.LastPtr()
+	Check(t, true, ok)
+	*p = 90
+	Check(t, 90, b.Get(3))
+
+	// Cleared buffers are empty again
+	b.Clear()
+	_, ok = b.Last()
+	Check(t, false, ok)
+}
+
+func TestDrain(t *testing.T) {
+
+	// Empty
+	b := ring.NewBuffer[int](4)
+	Check(t, 0, len(b.Drain()))
+
+	// Wrapped
+	b.Write(1, 2, 3, 4, 5, 6)
+	CheckArr(t, []int{3, 4, 5, 6}, b.Drain())
+	Check(t, 0, b.Len())
+	Check(t, 6, b.Written())
+
+	// Writes after draining start cleanly
+	b.Write(7, 8)
+	checkBufferContents(t, b, []int{7, 8})
+	Check(t, 8, b.Written())
+
+	// Partial drain only removes what fits in dst
+	b.Write(9, 10)
+	dst := make([]int, 3)
+	Check(t, 3, b.DrainInto(dst))
+	CheckArr(t, []int{7, 8, 9}, dst)
+	checkBufferContents(t, b, []int{10})
+
+	dst = make([]int, 8)
+	Check(t, 1, b.DrainInto(dst))
+	Check(t, 10, dst[0])
+	Check(t, 0, b.Len())
+	Check(t, 10, b.Written())
+
+	// Full drains keep the last written element at the index given by Written()
+	b.Write(11, 12, 13)
+	checkBufferContents(t, b, []int{11, 12, 13})
+	Check(t, 13, b.Written())
+	Check(t, 13, b.Data[b.AbsIndexFromWriteCount(b.Written())])
+	Check(t, 2, b.RelIndexFromWriteCount(b.Written()))
+	Check(t, 11, b.Get(0))
+}
+
+func TestMapFilter(t *testing.T) {
+
+	// Wrapped source
+	b := ring.NewBuffer[int](4)
+	b.Write(1, 2, 3, 4, 5, 6)
+
+	strs := ring.Map(b, func(x int) string { return fmt.Sprint(x * 10) }, 4)
+	Check(t, 4, strs.Len())
+	Check(t, 4, strs.Cap())
+	v1, v2 := strs.Views()
+	CheckArr(t, []string{"30", "40", "50", "60"}, append(v1, v2...))
+
+	// Smaller cap keeps the newest results
+	checkBufferContents(t, ring.Map(b, func(x int) int { return -x }, 2), []int{-5, -6})
+
+	// Source is unchanged
+	checkBufferContents(t, b, []int{3, 4, 5, 6})
+
+	evens := ring.Filter(b, func(x int) bool { return x%2 == 0 }, 8)
+	Check(t, 8, evens.Cap())
+	checkBufferContents(t, evens, []int{4, 6})
+
+	checkBufferContents(t, ring.Filter(b, func(x int) bool { return x > 2 }, 3), []int{4, 5, 6})
+	checkBufferContents(t, ring.Filter(b, func(x int) bool { return false }, 3), []int{})
+
+	// Empty source
+	empty := ring.NewBuffer[int](4)
+	Check(t, 0, ring.Map(empty, func(x int) bool { return true }, 4).Len())
+	Check(t, 0, ring.Filter(empty, func(x int) bool { return true }, 4).Len())
+}
+
+func TestWriteByteRune(t *testing.T) {
+
+	// Single writes wrap around like Write
+	b := ring.NewBuffer[byte](3)
+	for _, c := range []byte("abcde") {
+		ring.WriteByte(b, c)
+	}
+
+	Check(t, uint64(5), b.Written())
+	Check(t, int64(3), b.Len())
+	checkByteBufferContents(t, b, "cde")
+
+	ring.WriteByte(b, 'f')
+	checkByteBufferContents(t, b, "def")
+
+	// Same result as Write after Rotate, where Start isn't zero while the buffer isn't full
+	expected := ring.NewBuffer[rune](4)
+	expected.Write('a', 'b')
+	expected.Rotate(1)
+	expected.Write('世', 'x', 'y')
+
+	rs := ring.NewBuffer[rune](4)
+	rs.Write('a', 'b')
+	rs.Rotate(1)
+	for _, r := range "世xy" {
+		ring.WriteRune(rs, r)
+	}
+
+	Check(t, expected.Start(), rs.Start())
+	Check(t, expected.Len(), rs.Len())
+	Check(t, expected.Written(), rs.Written())
+	CheckArr(t, expected.Data, rs.Data)
+}
+
+func TestReadFromWriteTo(t *testing.T) {
+
+	// Write doesn't match io.Writer so io.Copy can't take a buffer, but ReadFrom and WriteTo can be called directly
+	var _ io.ReaderFrom = &ring.Buffer[byte]{}
+	var _ io.WriterTo = &ring.Buffer[byte]{}
+
+	// Reading from a pipe in many chunks, where the writes wrap around
+	b := ring.NewBuffer[byte](8)
+	b.Write('x', 'y', 'z')
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.Write([]byte("hello"))
+		pw.Write([]byte(" world"))
+		pw.Close()
+	}()
+
+	n, err := b.ReadFrom(pr)
+	Check(t, true, err == nil)
+	Check(t, int64(11), n)
+	Check(t, uint64(14), b.Written())
+	Check(t, int64(8), b.Len())
+	checkByteBufferContents(t, b, "lo world")
+
+	// Errors other than io.EOF are returned with the bytes read before them
+	pr, pw = io.Pipe()
+	go func() {
+		pw.Write([]byte("ab"))
+		pw.CloseWithError(io.ErrUnexpectedEOF)
+	}()
+
+	n, err = b.ReadFrom(pr)
+	Check(t, true, err == io.ErrUnexpectedEOF)
+	Check(t, int64(2), n)
+	checkByteBufferContents(t, b, " worldab")
+
+	// Writing out keeps the order of wrapped buffers and doesn't change the buffer
+	out := &strings.Builder{}
+	n, err = b.WriteTo(out)
+	Check(t, true, err == nil)
+	Check(t, int64(8), n)
+	Check(t, " worldab", out.String())
+	Check(t, int64(8), b.Len())
+
+	pr, pw = io.Pipe()
+	go func() {
+		b.WriteTo(pw)
+		pw.Close()
+	}()
+
+	piped, err := io.ReadAll(pr)
+	Check(t, true, err == nil)
+	Check(t, " worldab", string(piped))
+
+	// Empty buffers write nothing
+	out.Reset()
+	n, err = ring.NewBuffer[byte](4).WriteTo(out)
+	Check(t, true, err == nil)
+	Check(t, int64(0), n)
+
+	// Other element types aren't supported
+	ints := ring.NewBuffer[int](4)
+	_, err = ints.ReadFrom(strings.NewReader("abc"))
+	Check(t, true, err != nil)
+	Check(t, int64(0), ints.Len())
+
+	_, err = ints.WriteTo(out)
+	Check(t, true, err != nil)
+}
+
+func checkByteBufferContents(t *testing.T, b *ring.Buffer[byte], expected string) {
+
+	t.Helper()
+
+	v1, v2 := b.Views()
+	Check(t, expected, string(v1)+string(v2))
+}
+
+func TestReverseIterator(t *testing.T) {
+
+	// Wrapped buffer
+	b := ring.NewBuffer[int](4)
+	b.Write(1, 2, 3, 4, 5, 6)
+
+	it := b.ReverseIterator()
+	got := []int{}
+	for v, done := it.Prev(); !done; v, done = it.Prev() {
+		got = append(got, v)
+	}
+	CheckArr(t, []int{6, 5, 4, 3}, got)
+
+	// Nothing after the end
+	it = b.ReverseIterator()
+	_, done := it.Next()
+	Check(t, true, done)
+
+	// ForEachReverse passes relative indices
+	got = []int{}
+	indices := []int64{}
+	it = b.ReverseIterator()
+	it.ForEachReverse(func(index int64, val int) bool {
+		got = append(got, val)
+		indices = append(indices, index)
+		return true
+	})
+	CheckArr(t, []int{6, 5, 4, 3}, got)
+	CheckArr(t, []int64{3, 2, 1, 0}, indices)
+
+	// Stopping early, then continuing from where it stopped
+	got = []int{}
+	it = b.ReverseIterator()
+	it.ForEachReverse(func(index int64, val int) bool {
+		got = append(got, val)
+		return val != 5
+	})
+	CheckArr(t, []int{6, 5}, got)
+
+	v, _ := it.Prev()
+	Check(t, 4, v)
+
+	// ForEachReverse starts at the current position
+	got = []int{}
+	it.GotoIndex(2)
+	it.ForEachReverse(func(index int64, val int) bool {
+		got = append(got, val)
+		return true
+	})
+	CheckArr(t, []int{4, 3}, got)
+
+	// Empty buffer
+	calls := 0
+	it = ring.NewBuffer[int](4).ReverseIterator()
+	it.ForEachReverse(func(index int64, val int) bool {
+		calls++
+		return true
+	})
+	Check(t, 0, calls)
+}
+
+func TestIteratorClone(t *testing.T) {
+
+	// Wrapped buffer
+	b := ring.NewBuffer[int](4)
+	b.Write(1, 2, 3, 4, 5, 6)
+
+	it := b.Iterator()
+	it.Next()
+
+	// Moving the clone doesn't move the original
+	clone := it.Clone()
+	v, _ := clone.Next()
+	Check(t, 4, v)
+	v, _ = clone.Next()
+	Check(t, 5, v)
+
+	v, _ = it.Next()
+	Check(t, 4, v)
+
+	// And moving the original doesn't move the clone
+	it.GotoEnd()
+	v, _ = clone.Next()
+	Check(t, 6, v)
+}
+
+func TestReduce(t *testing.T) {
+
+	// Wrapped buffer
+	b := ring.NewBuffer[int](4)
+	b.Write(7, 1, 9, 2, 5, 3)
+
+	sum := ring.Reduce(b, 0, func(acc, x int) int { return acc + x })
+	Check(t, 19, sum)
+
+	max := ring.Reduce(b, b.Get(0), func(acc, x int) int {
+		if x > acc {
+			return x
+		}
+		return acc
+	})
+	Check(t, 9, max)
+
+	// Order is oldest first
+	concat := ring.Reduce(b, "", func(acc string, x int) string { return acc + fmt.Sprint(x) })
+	Check(t, "9253", concat)
+
+	strs := ring.NewBuffer[string](3)
+	strs.Write("a", "b", "c", "d", "e")
+	Check(t, ">cde", ring.Reduce(strs, ">", func(acc, s string) string { return acc + s }))
+
+	// Empty buffer gives initial
+	empty := ring.NewBuffer[int](4)
+	Check(t, 42, ring.Reduce(empty, 42, func(acc, x int) int { return acc + x }))
+}
+
+func checkBufferContents(t *testing.T, b *ring.Buffer[int], expected []int) {
+
+	v1, v2 := b.Views()
+	CheckArr(t, expected, append(append([]int{}, v1...), v2...))
+}
+
+func TestBinarySearch(t *testing.T) {
+
+	less := func(x, y int) bool { return x < y }
+
+	// Empty
+	b := ring.NewBuffer[int](5)
+	i, found := ring.BinarySearch(b, 1, less)
+	Check(t, int64(0), i)
+	Check(t, false, found)
+
+	// Wrapped so the elements are split between both views
+	b.Write(0, 0, 1, 3, 5, 7, 9)
+	v1, v2 := b.Views()
+	CheckArr(t, []int{1, 3, 5}, v1)
+	CheckArr(t, []int{7, 9}, v2)
+
+	for relIndex, x := range []int{1, 3, 5, 7, 9} {
+		i, found = ring.BinarySearch(b, x, less)
+		Check(t, int64(relIndex), i)
+		Check(t, true, found)
+	}
+
+	i, found = ring.BinarySearch(b, 0, less)
+	Check(t, int64(0), i)
+	Check(t, false, found)
+
+	i, found = ring.BinarySearch(b, 6, less)
+	Check(t, int64(3), i)
+	Check(t, false, found)
+
+	i, found = ring.BinarySearch(b, 10, less)
+	Check(t, int64(5), i)
+	Check(t, false, found)
+
+	// Func version, with duplicates returning the first match
+	b = ring.NewBuffer[int](4)
+	b.Write(1, 2, 2, 2, 3, 4)
+	cmpTo := func(target int) func(int) int {
+		return func(x int) int { return x - target }
+	}
+
+	i, found = ring.BinarySearchFunc(b, cmpTo(2))
+	Check(t, int64(0), i)
+	Check(t, true, found)
+
+	i, found = ring.BinarySearchFunc(b, cmpTo(4))
+	Check(t, int64(3), i)
+	Check(t, true, found)
+
+	i, found = ring.BinarySearchFunc(b, cmpTo(1))
+	Check(t, int64(0), i)
+	Check(t, false, found)
+
+	i, found = ring.BinarySearchFunc(b, cmpTo(5))
+	Check(t, int64(4), i)
+	Check(t, false, found)
+}
+
+func TestPeek(t *testing.T) {
+
+	b := ring.NewBuffer[int](4)
+	CheckArr(t, []int{}, b.Peek(0, 2))
+
+	b.Write(1, 2, 3)
+	CheckArr(t, []int{1, 2, 3}, b.Peek(0, 3))
+	CheckArr(t, []int{2, 3}, b.Peek(1, 10))
+	CheckArr(t, []int{}, b.Peek(1, 0))
+	CheckArr(t, []int{}, b.Peek(3, 1))
+
+	// Wrapped, where Data is [5, 6, 3, 4]
+	b.Write(4, 5, 6)
+	CheckArr(t, []int{3, 4, 5, 6}, b.Peek(0, 4))
+	CheckArr(t, []int{4, 5}, b.Peek(1, 2))
+	CheckArr(t, []int{5, 6}, b.Peek(2, 5))
+
+	// Peeking doesn't change the buffer
+	Check(t, int64(2), b.Start())
+	Check(t, int64(4), b.Len())
+	Check(t, uint64(6), b.Written())
+	CheckArr(t, []int{5, 6, 3, 4}, b.Data)
+
+	it := b.Iterator()
+	b.Peek(0, 4)
+	v, done := it.Next()
+	Check(t, 3, v)
+	Check(t, false, done)
+
+	// Into a caller provided slice
+	dst := make([]int, 3)
+	Check(t, 3, b.PeekInto(dst, 1))
+	CheckArr(t, []int{4, 5, 6}, dst)
+
+	dst = make([]int, 5)
+	Check(t, 2, b.PeekInto(dst, 2))
+	CheckArr(t, []int{5, 6, 0, 0, 0}, dst)
+
+	Check(t, 0, b.PeekInto(nil, 0))
+	Check(t, 0, b.PeekInto(dst, 4))
+}
+
+func TestRotate(t *testing.T) {
+
+	b := ring.NewBuffer[int](4)
+	b.Write(1, 2, 3, 4, 5, 6)
+
+	// Negative and zero do nothing
+	b.Rotate(-1)
+	b.Rotate(0)
+	Check(t, int64(2), b.Start())
+	Check(t, int64(4), b.Len())
+
+	b.Rotate(1)
+	Check(t, int64(3), b.Start())
+	Check(t, int64(3), b.Len())
+	Check(t, uint64(6), b.Written())
+
+	v1, v2 := b.Views()
+	CheckArr(t, []int{4}, v1)
+	CheckArr(t, []int{5, 6}, v2)
+
+	// Write count indices still work
+	Check(t, 5, b.Get(b.RelIndexFromWriteCount(5)))
+
+	b.Rotate(1)
+	it := b.Iterator()
+	for _, expected := range []int{5, 6} {
+		v, done := it.Next()
+		Check(t, expected, v)
+		Check(t, false, done)
+	}
+	_, done := it.Next()
+	Check(t, true, done)
+
+	// New writes go after the existing elements
+	b.Write(7)
+	v1, v2 = b.Views()
+	CheckArr(t, []int{5, 6, 7}, v1)
+	CheckArr(t, []int{}, v2)
+
+	// Rotating past the end empties the buffer
+	b.Rotate(10)
+	Check(t, int64(0), b.Len())
+	Check(t, 0, b.Count(func(int) bool { return true }))
+
+	b.Write(8, 9)
+	v1, v2 = b.Views()
+	CheckArr(t, []int{8}, v1)
+	CheckArr(t, []int{9}, v2)
+	Check(t, 8, b.Get(b.RelIndexFromWriteCount(8)))
+
+	// Writes that fill a rotated buffer overwrite the oldest elements
+	b = ring.NewBuffer[int](4)
+	b.Write(1, 2, 3, 4, 5)
+	b.Rotate(1)
+	b.Write(6, 7, 8)
+	Check(t, int64(4), b.Len())
+	v1, v2 = b.Views()
+	CheckArr(t, []int{5, 6, 7, 8}, v1)
+	CheckArr(t, []int{}, v2)
+}
+
 func Check[T comparable](t *testing.T, expected, got T) {
 	if got != expected {
 		_, _, line, _ := runtime.Caller(1)
@@ -298,3 +1060,46 @@ func CheckArr[T comparable](t *testing.T, expected, got []T) {
 		}
 	}
 }
+
+func BenchmarkWrite(b *testing.B) {
+
+	buf := ring.NewBuffer[byte](64 * 1024)
+	chunk := make([]byte, 4096)
+
+	b.SetBytes(int64(len(chunk)))
+	for i := 0; i < b.N; i++ {
+		buf.Write(chunk...)
+	}
+}
+
+func BenchmarkWriteByte(b *testing.B) {
+
+	buf := ring.NewBuffer[byte](64 * 1024)
+	for i := 0; i < b.N; i++ {
+		ring.WriteByte(buf, '\n')
+	}
+}
+
+func BenchmarkWriteOneByte(b *testing.B) {
+
+	buf := ring.NewBuffer[byte](64 * 1024)
+	for i := 0; i < b.N; i++ {
+		buf.Write('\n')
+	}
+}
+
+func BenchmarkRelIndexFromAbs(b *testing.B) {
+
+	buf := ring.NewBuffer[byte](1024)
+	buf.Write(make([]byte, 1500)...)
+
+	sum := uint64(0)
+	for i := 0; i < b.N; i++ {
+		sum += buf.RelIndexFromAbs(uint64(i) % 1024)
+	}
+
+	benchSink = sum
+}
+
+// benchSink keeps benchmark results alive so the compiler can't remove the benchmarked code
+var benchSink uint64
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+
+	"github.com/bloeys/nmage/input"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+const searchBarPrompt = "Find: "
+
+// OpenSearch shows the search bar and sends text input to searchBuf instead of cmdBuf
+func (nt *nterm) OpenSearch() {
+	nt.searchMode = true
+	nt.searchBuf = nt.searchBuf[:0]
+	nt.searchMatches = nt.searchMatches[:0]
+	nt.searchMatchIndex = -1
+}
+
+func (nt *nterm) CloseSearch() {
+	nt.searchMode = false
+	nt.searchBuf = nt.searchBuf[:0]
+	nt.searchMatches = nt.searchMatches[:0]
+	nt.searchMatchIndex = -1
+}
+
+func (nt *nterm) WriteToSearchBuf(text []rune) {
+	nt.searchBuf = append(nt.searchBuf, text...)
+	nt.UpdateSearchMatches()
+}
+
+// ReadSearchInputs replaces ReadInputs while the search bar is open
+func (nt *nterm) ReadSearchInputs() {
+
+	if input.KeyClicked(sdl.K_ESCAPE) {
+		nt.CloseSearch()
+		return
+	}
+
+	if input.KeyClicked(sdl.K_BACKSPACE) && len(nt.searchBuf) > 0 {
+		nt.searchBuf = nt.searchBuf[:len(nt.searchBuf)-1]
+		nt.UpdateSearchMatches()
+	}
+
+	shiftDown := input.KeyDown(sdl.K_LSHIFT) || input.KeyDown(sdl.K_RSHIFT)
+	if input.KeyClicked(sdl.K_RETURN) || input.KeyClicked(sdl.K_KP_ENTER) || input.KeyClicked(sdl.K_F3) {
+
+		// Output might have come in since the last search
+		nt.UpdateSearchMatches()
+		if shiftDown {
+			nt.GotoSearchMatch(false)
+		} else {
+			nt.GotoSearchMatch(true)
+		}
+	}
+}
+
+// UpdateSearchMatches finds all occurrences of searchBuf in textBuf and stores their indices
+// (relative to textBuf.Start()) in searchMatches
+func (nt *nterm) UpdateSearchMatches() {
+
+	nt.textBufMutex.Lock()
+	defer nt.textBufMutex.Unlock()
+
+	// Indices relative to textBuf.Start() change as output comes in, so the current match is found again using its write count.
+	// This way going to the next match continues from the current one instead of starting over from the scroll position
+	currMatchWriteCount := uint64(0)
+	if nt.searchMatchIndex >= 0 && nt.searchMatchIndex < len(nt.searchMatches) {
+		currMatchWriteCount = nt.textBuf.Written() - uint64(nt.textBuf.Len()) + uint64(nt.searchMatches[nt.searchMatchIndex]) + 1
+	}
+
+	nt.searchMatches = nt.searchMatches[:0]
+	nt.searchMatchIndex = -1
+	if len(nt.searchBuf) == 0 {
+		return
+	}
+
+	pattern := []byte(string(nt.searchBuf))
+
+	v1, v2 := nt.textBuf.Views()
+	nt.searchMatches = appendMatches(nt.searchMatches, v1, pattern, 0)
+
+	// Matches that start in v1 and end in v2. We only look at the end of v1 so we don't find v1 matches again
+	if len(v1) > 0 && len(v2) > 0 && len(pattern) > 1 {
+
+		seamStart := len(v1) - len(pattern) + 1
+		if seamStart < 0 {
+			seamStart = 0
+		}
+
+		seamEnd := len(pattern) - 1
+		if seamEnd > len(v2) {
+			seamEnd = len(v2)
+		}
+
+		seam := make([]byte, 0, len(v1)-seamStart+seamEnd)
+		seam = append(seam, v1[seamStart:]...)
+		seam = append(seam, v2[:seamEnd]...)
+		nt.searchMatches = appendMatches(nt.searchMatches, seam, pattern, int64(seamStart))
+	}
+
+	nt.searchMatches = appendMatches(nt.searchMatches, v2, pattern, int64(len(v1)))
+
+	for i, m := range nt.searchMatches {
+		if nt.textBuf.Written()-uint64(nt.textBuf.Len())+uint64(m)+1 == currMatchWriteCount {
+			nt.searchMatchIndex = i
+			break
+		}
+	}
+}
+
+// appendMatches appends the index of every occurrence of pattern in bs plus indexOffset
+func appendMatches(matches []int64, bs, pattern []byte, indexOffset int64) []int64 {
+
+	searchStart := 0
+	for {
+
+		index := bytes.Index(bs[searchStart:], pattern)
+		if index == -1 {
+			return matches
+		}
+
+		index += searchStart
+		matches = append(matches, indexOffset+int64(index))
+		searchStart = index + 1
+	}
+}
+
+// GotoSearchMatch scrolls so the line of the next (or previous) match is at the top of the screen.
+// Searching wraps around when reaching the last (or first) match
+func (nt *nterm) GotoSearchMatch(forward bool) {
+
+	if len(nt.searchMatches) == 0 {
+		return
+	}
+
+	if nt.searchMatchIndex == -1 {
+
+		// Start from the first match after the current scroll position, which only happens for new searches
+		// or if the current match is gone (e.g. it was rotated out of textBuf or no longer matches)
+		nt.searchMatchIndex = len(nt.searchMatches) - 1
+		for i := 0; i < len(nt.searchMatches); i++ {
+			if nt.searchMatches[i] > nt.scrollPosRel {
+				nt.searchMatchIndex = i
+				break
+			}
+		}
+
+		if !forward {
+			nt.searchMatchIndex = (nt.searchMatchIndex + len(nt.searchMatches) - 1) % len(nt.searchMatches)
+		}
+
+	} else if forward {
+		nt.searchMatchIndex = (nt.searchMatchIndex + 1) % len(nt.searchMatches)
+	} else {
+		nt.searchMatchIndex = (nt.searchMatchIndex + len(nt.searchMatches) - 1) % len(nt.searchMatches)
+	}
+
+	nt.textBufMutex.Lock()
+	defer nt.textBufMutex.Unlock()
+
+	// Move back to the start of the line, but not past the first valid line
+	charsPerLine, _ := nt.GridSize()
+	minIndex := int64(nt.textBuf.RelIndexFromWriteCount(nt.firstValidLine.StartIndex_WriteCount))
+	lineStart := nt.searchMatches[nt.searchMatchIndex]
+	for i := int64(0); i < charsPerLine && lineStart > minIndex && nt.textBuf.Get(uint64(lineStart-1)) != '\n'; i++ {
+		lineStart--
+	}
+
+	nt.scrollPosRel = clamp(lineStart, minIndex, nt.textBuf.Len()-1)
+	nt.subLineScrollOffset = 0
+}
+
+// HighlightSearchMatches sets the background of grid tiles that match searchBuf
+func (nt *nterm) HighlightSearchMatches(grid *GlyphGrid) {
+
+	if len(nt.searchBuf) == 0 {
+		return
+	}
+
+	tileCount := grid.SizeX * grid.SizeY
+	patternLen := uint(len(nt.searchBuf))
+	for start := uint(0); start+patternLen <= tileCount; start++ {
+
+		matched := true
+		for i := uint(0); i < patternLen; i++ {
+
+			tileIndex := start + i
+			if grid.Tiles[tileIndex/grid.SizeX][tileIndex%grid.SizeX].Glyph != nt.searchBuf[i] {
+				matched = false
+				break
+			}
+		}
+
+		if !matched {
+			continue
+		}
+
+		for i := uint(0); i < patternLen; i++ {
+
+			tileIndex := start + i
+			x, y := tileIndex%grid.SizeX, tileIndex/grid.SizeX
+
+			t := grid.Tiles[y][x]
+			t.BgColor = nt.Settings.SearchMatchBgColor
+			grid.setTile(x, y, t)
+		}
+	}
+}
+
+// DrawSearchBar draws the search prompt and query on the last row of the grid
+func (nt *nterm) DrawSearchBar(grid *GlyphGrid) {
+
+	lastRow := grid.SizeY - 1
+	grid.ClearRow(lastRow)
+	grid.SetCursor(0, lastRow)
+
+	grid.WriteString(searchBarPrompt, &nt.Settings.DefaultFgColor, &nt.Settings.SearchBarBgColor)
+	grid.Write(nt.searchBuf, &nt.Settings.DefaultFgColor, &nt.Settings.SearchBarBgColor)
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bloeys/gglm/gglm"
+)
+
+const settingsFile = "./nterm-settings.json"
+
+type CursorStyle uint8
+
+const (
+	CursorStyle_Block CursorStyle = iota
+	CursorStyle_Underline
+	CursorStyle_Bar
+)
+
+func (cs CursorStyle) String() string {
+
+	switch cs {
+	case CursorStyle_Block:
+		return "block"
+	case CursorStyle_Underline:
+		return "underline"
+	case CursorStyle_Bar:
+		return "bar"
+	default:
+		return fmt.Sprint("unknown cursor style ", uint8(cs))
+	}
+}
+
+// MarshalText lets cursor styles be written by name in the settings file
+func (cs CursorStyle) MarshalText() ([]byte, error) {
+	return []byte(cs.String()), nil
+}
+
+func (cs *CursorStyle) UnmarshalText(text []byte) error {
+
+	switch strings.ToLower(string(text)) {
+	case "block":
+		*cs = CursorStyle_Block
+	case "underline":
+		*cs = CursorStyle_Underline
+	case "bar":
+		*cs = CursorStyle_Bar
+	default:
+		return fmt.Errorf("unknown cursor style '%s'. Valid styles are: block, underline, bar", string(text))
+	}
+
+	return nil
+}
+
+type Settings struct {
+	DefaultFgColor gglm.Vec4
+	DefaultBgColor gglm.Vec4
+	CursorColor    gglm.Vec4
+
+	// ThemeFile is an optional theme (see theme.LoadThemeFromFile) used at startup instead of the default colors.
+	// It is added to the built in themes cycled through with Ctrl+T
+	ThemeFile string
+
+	// ColorPalette has the colors of base 16 and 256 color ansi codes (e.g. ESC[31m and ESC[38;5;208m), and defaults to
+	// the xterm palette. Setting a theme replaces the first 16 colors with the ones of the theme.
+	//
+	// PaletteFile is an optional palette (see LoadPaletteFromFile) used at startup instead of ColorPalette
+	ColorPalette [256]gglm.Vec4
+	PaletteFile  string
+
+	// Colors used by highlighters
+	StringColor  gglm.Vec4
+	NumberColor  gglm.Vec4
+	CommentColor gglm.Vec4
+	KeywordColor gglm.Vec4
+
+	// SelectionBgColor is the background color of tiles selected with the mouse
+	SelectionBgColor gglm.Vec4
+
+	// HyperlinkColor is the fg color of text within OSC 8 hyperlinks, which open when clicked
+	HyperlinkColor gglm.Vec4
+
+	// PaddingLeft, PaddingTop, PaddingRight and PaddingBottom are the empty space in pixels between the window edges and
+	// the text, and are clamped between 0 and 32
+	PaddingLeft   float32
+	PaddingTop    float32
+	PaddingRight  float32
+	PaddingBottom float32
+
+	// ShowLineNumbers draws the index of each line in a gutter on the left of the screen using LineNumberColor
+	ShowLineNumbers bool
+	LineNumberColor gglm.Vec4
+
+	// FontFile is the regular font. The bold/italic font files are optional, and if missing
+	// bold is synthesized while italic text is drawn using the regular font
+	FontFile           string
+	BoldFontFile       string
+	ItalicFontFile     string
+	BoldItalicFontFile string
+
+	// SearchMatchBgColor is the background color of tiles matching the search query, and
+	// SearchBarBgColor is the background color of the search bar
+	SearchMatchBgColor gglm.Vec4
+	SearchBarBgColor   gglm.Vec4
+
+	// MinFontSize and MaxFontSize limit zooming
+	MinFontSize uint32
+	MaxFontSize uint32
+
+	// MaxScrollbackBytes and MaxScrollbackLines limit how much output is kept. Larger values let you scroll further back,
+	// but use more memory and make searching and scrolling through lines slower
+	MaxScrollbackBytes int
+	MaxScrollbackLines int
+
+	// CmdBufUndoLimit is how many edits to the command being typed can be undone with Ctrl+Z. Zero disables undo
+	CmdBufUndoLimit int
+
+	// Aliases replace the first word of commands (including each command in a pipeline) with their value, where '$@' is
+	// replaced with the rest of the command. For example "ll": "ls -la $@". Expanded commands are shown using AliasColor
+	Aliases    map[string]string
+	AliasColor gglm.Vec4
+
+	// GlobNoMatchError makes commands with a glob that matches no files fail (like zsh), instead of passing
+	// the glob as-is (like bash)
+	GlobNoMatchError bool
+
+	// WordWrap wraps output lines that don't fit the window at the last space before the window edge instead of
+	// in the middle of a word
+	WordWrap bool
+
+	// CommandTimeout kills cmds that run for longer than it, and is disabled if it isn't positive.
+	// In the settings file it is in nanoseconds
+	CommandTimeout time.Duration
+
+	// ShowStatusLine uses the bottom row of the window for a status line with the working directory, the running
+	// command, the scroll position and the time. It is drawn with SearchBarBgColor as its background
+	ShowStatusLine bool
+
+	CursorStyle CursorStyle
+	CursorBlink bool
+	// CursorBlinkIntervalMs is how long the cursor stays visible (or hidden) when blinking
+	CursorBlinkIntervalMs int
+
+	// SlowBlinkPeriodMs and RapidBlinkPeriodMs are how long a full hide and show cycle of blinking text (SGR 5 and 6) takes.
+	// Blinking is disabled if the period isn't positive
+	SlowBlinkPeriodMs  int64
+	RapidBlinkPeriodMs int64
+
+	// DoubleClickIntervalMs is the longest time between clicks for them to count as a double (or triple) click,
+	// which selects a word (or a whole line)
+	DoubleClickIntervalMs int
+
+	MaxFps   int
+	LimitFps bool
+}
+
+// LoadSettings overwrites the values in s with the ones found in the json settings file.
+// Values missing from the file are unchanged, and a missing file is not an error
+func LoadSettings(file string, s *Settings) error {
+
+	fBytes, err := os.ReadFile(file)
+	if err != nil {
+
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		return err
+	}
+
+	return json.Unmarshal(fBytes, s)
+}
+
+// LoadPaletteFromFile loads a 256 color palette from a file with one color per line in the form #RRGGBB or #RRGGBBAA,
+// in the order of the palette indices. Empty lines are ignored, and the file must have exactly 256 colors
+func LoadPaletteFromFile(path string) ([256]gglm.Vec4, error) {
+
+	var palette [256]gglm.Vec4
+
+	f, err := os.Open(path)
+	if err != nil {
+		return palette, err
+	}
+	defer f.Close()
+
+	lineNum := 0
+	colorCount := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if colorCount >= len(palette) {
+			return palette, fmt.Errorf("palette file '%s' has more than %d colors", path, len(palette))
+		}
+
+		c, err := parseHexColor(line)
+		if err != nil {
+			return palette, fmt.Errorf("line %d of palette file '%s' has an invalid color. Err: %w", lineNum, path, err)
+		}
+
+		palette[colorCount] = c
+		colorCount++
+	}
+
+	if err := scanner.Err(); err != nil {
+		return palette, err
+	}
+
+	if colorCount != len(palette) {
+		return palette, fmt.Errorf("palette file '%s' has %d colors but must have %d", path, colorCount, len(palette))
+	}
+
+	return palette, nil
+}
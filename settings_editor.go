@@ -0,0 +1,330 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bloeys/gglm/gglm"
+	"github.com/bloeys/nmage/input"
+	"github.com/bloeys/nterm/glyphs"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+const settingsEditorHelp = "Settings (Up/Down: select, Enter: edit/confirm, Escape: cancel/close)"
+
+// settingsEditorField is one editable value. Value returns the current value as text, and SetValue parses
+// text and applies it, leaving the current value unchanged if text is invalid
+type settingsEditorField struct {
+	Name     string
+	Value    func() string
+	SetValue func(text string) error
+}
+
+// SettingsEditor is a full-screen overlay for changing settings while nterm runs. It has its own grid that is
+// drawn instead of the active grid while the editor is open, so closing it shows the terminal as it was
+type SettingsEditor struct {
+	Fields        []settingsEditorField
+	SelectedIndex int
+
+	// IsEditing is true while typing a new value for the selected field into EditBuf.
+	// ErrMsg describes why the last confirmed value was rejected
+	IsEditing bool
+	EditBuf   []rune
+	ErrMsg    string
+
+	grid *GlyphGrid
+}
+
+// OpenSettingsEditor shows the settings editor and sends text input to it instead of cmdBuf
+func (nt *nterm) OpenSettingsEditor() {
+
+	nt.settingsEditor = &SettingsEditor{
+		Fields: []settingsEditorField{
+			{
+				Name:  "Max FPS",
+				Value: func() string { return strconv.Itoa(nt.Settings.MaxFps) },
+				SetValue: func(text string) error {
+
+					maxFps, err := strconv.Atoi(text)
+					if err != nil || maxFps <= 0 {
+						return fmt.Errorf("'%s' is not a positive integer", text)
+					}
+
+					nt.Settings.MaxFps = maxFps
+					return nil
+				},
+			},
+			{
+				Name:  "Limit FPS",
+				Value: func() string { return strconv.FormatBool(nt.Settings.LimitFps) },
+				SetValue: func(text string) error {
+
+					limitFps, err := strconv.ParseBool(text)
+					if err != nil {
+						return fmt.Errorf("'%s' is not true or false", text)
+					}
+
+					nt.Settings.LimitFps = limitFps
+					return nil
+				},
+			},
+			{
+				Name:  "Default foreground color",
+				Value: func() string { return formatHexColor(&nt.Settings.DefaultFgColor) },
+				SetValue: func(text string) error {
+					return nt.setDefaultColor(&nt.Settings.DefaultFgColor, text)
+				},
+			},
+			{
+				Name:  "Default background color",
+				Value: func() string { return formatHexColor(&nt.Settings.DefaultBgColor) },
+				SetValue: func(text string) error {
+					return nt.setDefaultColor(&nt.Settings.DefaultBgColor, text)
+				},
+			},
+			{
+				Name:  "Scroll speed",
+				Value: func() string { return strconv.FormatInt(nt.scrollSpd, 10) },
+				SetValue: func(text string) error {
+
+					scrollSpd, err := strconv.ParseInt(text, 10, 64)
+					if err != nil || scrollSpd <= 0 {
+						return fmt.Errorf("'%s' is not a positive integer", text)
+					}
+
+					nt.scrollSpd = scrollSpd
+					return nil
+				},
+			},
+			{
+				Name:  "Font size",
+				Value: func() string { return strconv.FormatUint(uint64(nt.FontSize), 10) },
+				SetValue: func(text string) error {
+
+					fontSize, err := strconv.ParseUint(text, 10, 32)
+					if err != nil || fontSize < uint64(nt.Settings.MinFontSize) || fontSize > uint64(nt.Settings.MaxFontSize) {
+						return fmt.Errorf("'%s' is not an integer between %d and %d", text, nt.Settings.MinFontSize, nt.Settings.MaxFontSize)
+					}
+
+					nt.SetFontSize(uint32(fontSize))
+					return nil
+				},
+			},
+			{
+				Name:  "Cursor style",
+				Value: func() string { return nt.Settings.CursorStyle.String() },
+				SetValue: func(text string) error {
+					return nt.Settings.CursorStyle.UnmarshalText([]byte(text))
+				},
+			},
+		},
+	}
+}
+
+func (nt *nterm) CloseSettingsEditor() {
+	nt.settingsEditor = nil
+}
+
+// setDefaultColor sets color (one of the default colors in settings) from a hex string and updates the GlyphRend defaults
+func (nt *nterm) setDefaultColor(color *gglm.Vec4, text string) error {
+
+	c, err := parseHexColor(text)
+	if err != nil {
+		return err
+	}
+
+	*color = c
+	nt.GlyphRend.SetOptions(glyphs.GlyphRendOpts{
+		BgColor: &nt.Settings.DefaultBgColor,
+		FgColor: &nt.Settings.DefaultFgColor,
+	})
+
+	return nil
+}
+
+// SelectField moves the selection by delta fields, wrapping around at the ends. The selection doesn't move while editing
+func (se *SettingsEditor) SelectField(delta int) {
+
+	if se.IsEditing {
+		return
+	}
+
+	n := len(se.Fields)
+	se.SelectedIndex = ((se.SelectedIndex+delta)%n + n) % n
+}
+
+// StartEdit starts editing the selected field with its current value as the initial text
+func (se *SettingsEditor) StartEdit() {
+	se.IsEditing = true
+	se.EditBuf = append(se.EditBuf[:0], []rune(se.Fields[se.SelectedIndex].Value())...)
+	se.ErrMsg = ""
+}
+
+// ConfirmEdit applies EditBuf to the selected field. If the value is invalid we keep editing and set ErrMsg
+func (se *SettingsEditor) ConfirmEdit() {
+
+	if !se.IsEditing {
+		return
+	}
+
+	f := &se.Fields[se.SelectedIndex]
+	err := f.SetValue(strings.TrimSpace(string(se.EditBuf)))
+	if err != nil {
+		se.ErrMsg = fmt.Sprintf("Invalid %s: %s", strings.ToLower(f.Name), err.Error())
+		return
+	}
+
+	se.IsEditing = false
+	se.EditBuf = se.EditBuf[:0]
+	se.ErrMsg = ""
+}
+
+// CancelEdit stops editing without changing the selected field
+func (se *SettingsEditor) CancelEdit() {
+	se.IsEditing = false
+	se.EditBuf = se.EditBuf[:0]
+	se.ErrMsg = ""
+}
+
+func (se *SettingsEditor) WriteToEditBuf(text []rune) {
+
+	if !se.IsEditing {
+		return
+	}
+
+	se.EditBuf = append(se.EditBuf, text...)
+}
+
+// ReadSettingsEditorInputs replaces ReadInputs while the settings editor is open
+func (nt *nterm) ReadSettingsEditorInputs() {
+
+	se := nt.settingsEditor
+	if input.KeyClicked(sdl.K_ESCAPE) {
+
+		if se.IsEditing {
+			se.CancelEdit()
+		} else {
+			nt.CloseSettingsEditor()
+		}
+
+		return
+	}
+
+	if input.KeyClicked(sdl.K_RETURN) || input.KeyClicked(sdl.K_KP_ENTER) {
+
+		if se.IsEditing {
+			se.ConfirmEdit()
+		} else {
+			se.StartEdit()
+		}
+
+		return
+	}
+
+	if input.KeyClicked(sdl.K_BACKSPACE) && len(se.EditBuf) > 0 {
+		se.EditBuf = se.EditBuf[:len(se.EditBuf)-1]
+	}
+
+	if input.KeyClicked(sdl.K_UP) {
+		se.SelectField(-1)
+	} else if input.KeyClicked(sdl.K_DOWN) {
+		se.SelectField(1)
+	}
+}
+
+// DrawSettingsEditor fills the settings editor grid, which is then drawn by DrawGlyphGrid in place of the active grid
+func (nt *nterm) DrawSettingsEditor() {
+
+	se := nt.settingsEditor
+
+	// The grid size changes with the window and font sizes
+	gw, gh := nt.GridSize()
+	if se.grid == nil || se.grid.SizeX != uint(gw) || se.grid.SizeY != uint(gh) {
+		se.grid = NewGlyphGrid(uint(gw), uint(gh))
+		se.grid.AutoWrap = false
+	}
+
+	grid := se.grid
+	grid.ClearAll()
+
+	nameWidth := 0
+	for i := 0; i < len(se.Fields); i++ {
+		if len(se.Fields[i].Name) > nameWidth {
+			nameWidth = len(se.Fields[i].Name)
+		}
+	}
+
+	fg := &nt.Settings.DefaultFgColor
+	bg := &nt.Settings.DefaultBgColor
+	drawRow := func(y uint, text string, rowBg *gglm.Vec4) {
+
+		if y >= grid.SizeY {
+			return
+		}
+
+		grid.SetCursor(0, y)
+		grid.WriteString(text, fg, rowBg)
+
+		// Pad so the whole row has the background
+		for x := grid.CursorX; x < grid.SizeX; x++ {
+			grid.setTile(x, y, GridTile{Glyph: ' ', FgColor: *fg, BgColor: *rowBg})
+		}
+	}
+
+	drawRow(0, settingsEditorHelp, &nt.Settings.SearchBarBgColor)
+	for i := 0; i < len(se.Fields); i++ {
+
+		f := &se.Fields[i]
+		rowBg := bg
+		value := f.Value()
+		if i == se.SelectedIndex {
+
+			rowBg = &nt.Settings.SelectionBgColor
+			if se.IsEditing {
+				value = string(se.EditBuf) + "_"
+			}
+		}
+
+		drawRow(uint(i)+2, fmt.Sprintf(" %-*s  %s", nameWidth, f.Name, value), rowBg)
+	}
+
+	if se.ErrMsg != "" {
+		drawRow(uint(len(se.Fields))+3, " "+se.ErrMsg, bg)
+	}
+}
+
+// parseHexColor parses colors in the form #RRGGBB or #RRGGBBAA, where the '#' is optional and alpha is 255 if missing
+func parseHexColor(s string) (gglm.Vec4, error) {
+
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) != 6 && len(hex) != 8 {
+		return gglm.Vec4{}, fmt.Errorf("'%s' is not in the form #RRGGBB or #RRGGBBAA", s)
+	}
+
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+
+	rgba, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return gglm.Vec4{}, fmt.Errorf("'%s' is not in the form #RRGGBB or #RRGGBBAA", s)
+	}
+
+	return *gglm.NewVec4(
+		float32(rgba>>24&0xff)/255,
+		float32(rgba>>16&0xff)/255,
+		float32(rgba>>8&0xff)/255,
+		float32(rgba&0xff)/255,
+	), nil
+}
+
+// formatHexColor is the inverse of parseHexColor, and always includes alpha
+func formatHexColor(c *gglm.Vec4) string {
+
+	toByte := func(f float32) uint8 {
+		return uint8(clamp(f, 0, 1)*255 + 0.5)
+	}
+
+	return fmt.Sprintf("#%02x%02x%02x%02x", toByte(c.R()), toByte(c.G()), toByte(c.B()), toByte(c.A()))
+}
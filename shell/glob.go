@@ -0,0 +1,116 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ErrNoMatch is returned (wrapped) by ExpandGlobs when a pattern matches no files
+var ErrNoMatch = errors.New("no matches found")
+
+// ExpandGlobs replaces each arg that is a glob pattern (i.e. has '*', '?' or '[') with the sorted list of files matching it.
+// See filepath.Match for the pattern syntax.
+//
+// Patterns that match nothing or are malformed are kept as-is, and the returned args are always usable. In that case err
+// describes the first such pattern, so callers wanting bash behaviour can ignore it while callers wanting zsh behaviour
+// can refuse to run the command. Errors of patterns without matches wrap ErrNoMatch
+func ExpandGlobs(args []string) (expandedArgs []string, err error) {
+	return ExpandGlobsInDir("", args)
+}
+
+// ExpandGlobsInDir is like ExpandGlobs, but relative patterns are matched from dir instead of the working directory
+// of the process. See GlobInDir
+func ExpandGlobsInDir(dir string, args []string) (expandedArgs []string, err error) {
+
+	expandedArgs = make([]string, 0, len(args))
+	for _, arg := range args {
+
+		var globErr error
+		expandedArgs, globErr = appendExpandedGlob(expandedArgs, dir, arg)
+		if err == nil {
+			err = globErr
+		}
+	}
+
+	return expandedArgs, err
+}
+
+// appendExpandedGlob appends the sorted matches of arg if it's a glob pattern, and arg itself if it isn't one
+// or if it has no matches. err is only set in the latter case
+func appendExpandedGlob(expandedArgs []string, dir, arg string) (newExpandedArgs []string, err error) {
+
+	if !strings.ContainsAny(arg, "*?[") {
+		return append(expandedArgs, arg), nil
+	}
+
+	matches, err := GlobInDir(dir, arg)
+	if err == nil && len(matches) == 0 {
+		err = ErrNoMatch
+	}
+
+	if err != nil {
+		return append(expandedArgs, arg), fmt.Errorf("%w: %s", err, arg)
+	}
+
+	sort.Strings(matches)
+	return append(expandedArgs, matches...), nil
+}
+
+// ExpandWordGlobsInDir is like ExpandGlobsInDir, but takes words split by SplitWords and returns their text.
+// Quoted words are taken literally, so only unquoted words are expanded
+func ExpandWordGlobsInDir(dir string, words []Word) (expandedArgs []string, err error) {
+
+	expandedArgs = make([]string, 0, len(words))
+	for _, w := range words {
+
+		if w.Quoted {
+			expandedArgs = append(expandedArgs, w.Text)
+			continue
+		}
+
+		var globErr error
+		expandedArgs, globErr = appendExpandedGlob(expandedArgs, dir, w.Text)
+		if err == nil {
+			err = globErr
+		}
+	}
+
+	return expandedArgs, err
+}
+
+// GlobInDir is like filepath.Glob, but relative patterns are matched from dir instead of the working directory of the process.
+// Matches of relative patterns are relative to dir, so they are what a shell whose working directory is dir would give.
+// If dir is empty this is the same as filepath.Glob
+func GlobInDir(dir, pattern string) (matches []string, err error) {
+
+	if dir == "" || filepath.IsAbs(pattern) {
+		return filepath.Glob(pattern)
+	}
+
+	// Join would clean the pattern, which changes its meaning if it ends with a separator
+	matches, err = filepath.Glob(dir + string(filepath.Separator) + pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	// Like filepath.Glob, matches start with the cleaned dir part of the pattern. Rel can't be used when the dir part has no
+	// globs, because it would also clean away things like '../sub' when dir is 'sub'
+	patternDir, _ := filepath.Split(pattern)
+	for i := 0; i < len(matches); i++ {
+
+		if !strings.ContainsAny(patternDir, "*?[") {
+			matches[i] = filepath.Join(patternDir, filepath.Base(matches[i]))
+			continue
+		}
+
+		relMatch, err := filepath.Rel(dir, matches[i])
+		if err == nil {
+			matches[i] = relMatch
+		}
+	}
+
+	return matches, nil
+}
@@ -0,0 +1,137 @@
+package shell_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/bloeys/nterm/shell"
+)
+
+func TestExpandGlobs(t *testing.T) {
+
+	dir := t.TempDir()
+	for _, name := range []string{"b.go", "a.go", "c.txt", "ab.go", "x1", "x2", "y1"} {
+		err := os.WriteFile(filepath.Join(dir, name), nil, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := func(name string) string {
+		return filepath.Join(dir, name)
+	}
+
+	// '*'
+	args, err := shell.ExpandGlobs([]string{"-l", p("*.go")})
+	Check(t, true, err == nil)
+	CheckArr(t, []string{"-l", p("a.go"), p("ab.go"), p("b.go")}, args)
+
+	args, err = shell.ExpandGlobs([]string{p("*.txt"), p("x*")})
+	Check(t, true, err == nil)
+	CheckArr(t, []string{p("c.txt"), p("x1"), p("x2")}, args)
+
+	// '?'
+	args, err = shell.ExpandGlobs([]string{p("?.go")})
+	Check(t, true, err == nil)
+	CheckArr(t, []string{p("a.go"), p("b.go")}, args)
+
+	args, err = shell.ExpandGlobs([]string{p("??")})
+	Check(t, true, err == nil)
+	CheckArr(t, []string{p("x1"), p("x2"), p("y1")}, args)
+
+	// '[...]'
+	args, err = shell.ExpandGlobs([]string{p("[ab].go")})
+	Check(t, true, err == nil)
+	CheckArr(t, []string{p("a.go"), p("b.go")}, args)
+
+	args, err = shell.ExpandGlobs([]string{p("[xy]1"), p("x[2-9]")})
+	Check(t, true, err == nil)
+	CheckArr(t, []string{p("x1"), p("y1"), p("x2")}, args)
+
+	// Args that aren't globs are unchanged even if no such file exists
+	args, err = shell.ExpandGlobs([]string{"-a", p("missing.go"), p("a.go")})
+	Check(t, true, err == nil)
+	CheckArr(t, []string{"-a", p("missing.go"), p("a.go")}, args)
+
+	args, err = shell.ExpandGlobs(nil)
+	Check(t, true, err == nil)
+	Check(t, 0, len(args))
+
+	// No matches keeps the pattern but reports an error
+	args, err = shell.ExpandGlobs([]string{p("*.md"), p("*.txt"), p("z?")})
+	Check(t, true, errors.Is(err, shell.ErrNoMatch))
+	CheckArr(t, []string{p("*.md"), p("c.txt"), p("z?")}, args)
+
+	// Bad patterns are kept too
+	args, err = shell.ExpandGlobs([]string{p("[a")})
+	Check(t, true, errors.Is(err, filepath.ErrBadPattern))
+	CheckArr(t, []string{p("[a")}, args)
+}
+
+func TestExpandGlobsInDir(t *testing.T) {
+
+	dir := t.TempDir()
+	err := os.Mkdir(filepath.Join(dir, "sub"), 0755)
+	Check(t, true, err == nil)
+
+	for _, name := range []string{"a.go", "b.txt", filepath.Join("sub", "c.go")} {
+		err := os.WriteFile(filepath.Join(dir, name), nil, 0644)
+		Check(t, true, err == nil)
+	}
+
+	// Relative patterns are matched from dir, and so are relative to it
+	args, err := shell.ExpandGlobsInDir(dir, []string{"-l", "*.go", filepath.Join("sub", "*")})
+	Check(t, true, err == nil)
+	CheckArr(t, []string{"-l", "a.go", filepath.Join("sub", "c.go")}, args)
+
+	args, err = shell.ExpandGlobsInDir(filepath.Join(dir, "sub"), []string{filepath.Join("..", "*.txt")})
+	Check(t, true, err == nil)
+	CheckArr(t, []string{filepath.Join("..", "b.txt")}, args)
+
+	// Absolute patterns are left as they are
+	args, err = shell.ExpandGlobsInDir(filepath.Join(dir, "sub"), []string{filepath.Join(dir, "*.go")})
+	Check(t, true, err == nil)
+	CheckArr(t, []string{filepath.Join(dir, "a.go")}, args)
+
+	args, err = shell.ExpandGlobsInDir(dir, []string{"*.md"})
+	Check(t, true, errors.Is(err, shell.ErrNoMatch))
+	CheckArr(t, []string{"*.md"}, args)
+}
+
+func TestExpandWordGlobsInDir(t *testing.T) {
+
+	dir := t.TempDir()
+	for _, name := range []string{"a.go", "b.go"} {
+		err := os.WriteFile(filepath.Join(dir, name), nil, 0644)
+		Check(t, true, err == nil)
+	}
+
+	// Quoted words are never expanded, even if they match files or are malformed patterns
+	args, err := shell.ExpandWordGlobsInDir(dir, shell.SplitWords(`"a.*b" *.go '*.go' [a`))
+	Check(t, true, errors.Is(err, filepath.ErrBadPattern))
+	CheckArr(t, []string{"a.*b", "a.go", "b.go", "*.go", "[a"}, args)
+
+	args, err = shell.ExpandWordGlobsInDir(dir, shell.SplitWords(`"x*" '[a' \?.md`))
+	Check(t, true, err == nil)
+	CheckArr(t, []string{"x*", "[a", "?.md"}, args)
+}
+
+func CheckArr[T comparable](t *testing.T, expected, got []T) {
+
+	_, _, line, _ := runtime.Caller(1)
+	if len(expected) != len(got) {
+		t.Fatalf("Expected %v but got %v by test at line %d\n", expected, got, line)
+		return
+	}
+
+	for i := 0; i < len(expected); i++ {
+
+		if expected[i] != got[i] {
+			t.Fatalf("Expected %v but got %v by test at line %d\n", expected, got, line)
+			return
+		}
+	}
+}
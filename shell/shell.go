@@ -0,0 +1,153 @@
+package shell
+
+import (
+	"os"
+	"strings"
+)
+
+// ExpandEnvVars replaces $VAR and ${VAR} with the value of the environment variable VAR, and replaces
+// a '~' at the start of a word with the home dir of the user. Missing variables are replaced with nothing.
+//
+// Similar to shells, nothing within single quotes is expanded, while within double quotes variables are
+// expanded but '~' isn't. Quotes are kept as-is, and '\$' gives a literal '$'.
+//
+// Names within braces can themselves have variables (e.g. ${PREFIX_${NAME}}), which are expanded first
+func ExpandEnvVars(s string) string {
+
+	// If there is no home dir we leave '~' as-is
+	homeDir, _ := os.UserHomeDir()
+	return expandEnvVars(s, os.Getenv, homeDir)
+}
+
+func expandEnvVars(s string, getenv func(string) string, homeDir string) string {
+
+	// Fast path for most commands
+	if !strings.ContainsAny(s, "$~") {
+		return s
+	}
+
+	var quote byte
+	out := strings.Builder{}
+	out.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+
+		c := s[i]
+		if quote == '\'' {
+
+			if c == '\'' {
+				quote = 0
+			}
+
+			out.WriteByte(c)
+			continue
+		}
+
+		switch c {
+
+		case '\\':
+
+			// Escaped chars never start a quote or variable, but the backslash is only removed from '\$'
+			// since that is the only way to get a literal '$'
+			if i+1 >= len(s) {
+				out.WriteByte(c)
+				continue
+			}
+
+			i++
+			if s[i] != '$' {
+				out.WriteByte(c)
+			}
+			out.WriteByte(s[i])
+
+		case '\'':
+
+			// Single quotes within double quotes are normal chars
+			if quote == 0 {
+				quote = '\''
+			}
+			out.WriteByte(c)
+
+		case '"':
+
+			if quote == '"' {
+				quote = 0
+			} else {
+				quote = '"'
+			}
+			out.WriteByte(c)
+
+		case '$':
+
+			value, varLen := expandVar(s[i+1:], getenv, homeDir)
+			if varLen == 0 {
+				out.WriteByte(c)
+				continue
+			}
+
+			out.WriteString(value)
+			i += varLen
+
+		case '~':
+
+			isWordStart := i == 0 || s[i-1] == ' '
+			isWordEnd := i+1 == len(s) || s[i+1] == '/' || s[i+1] == ' '
+			if quote == 0 && isWordStart && isWordEnd && homeDir != "" {
+				out.WriteString(homeDir)
+				continue
+			}
+			out.WriteByte(c)
+
+		default:
+			out.WriteByte(c)
+		}
+	}
+
+	return out.String()
+}
+
+// expandVar expands the variable at the start of s, where s is the string right after a '$'.
+// varLen is the number of bytes of s used by the variable, and is zero if s doesn't start with a variable (e.g. '$ ' or an unclosed '${')
+func expandVar(s string, getenv func(string) string, homeDir string) (value string, varLen int) {
+
+	if len(s) == 0 {
+		return "", 0
+	}
+
+	if s[0] != '{' {
+
+		nameLen := 0
+		for nameLen < len(s) && isNameChar(s[nameLen], nameLen == 0) {
+			nameLen++
+		}
+
+		if nameLen == 0 {
+			return "", 0
+		}
+
+		return getenv(s[:nameLen]), nameLen
+	}
+
+	// Find the brace that closes the first one, while skipping nested pairs
+	depth := 0
+	for i := 0; i < len(s); i++ {
+
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		}
+
+		if depth == 0 {
+			name := expandEnvVars(s[1:i], getenv, homeDir)
+			return getenv(name), i + 1
+		}
+	}
+
+	return "", 0
+}
+
+// isNameChar returns true if c can be part of a variable name, which is letters, digits and underscores, except that names can't start with a digit
+func isNameChar(c byte, isFirst bool) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || !isFirst && c >= '0' && c <= '9'
+}
@@ -0,0 +1,89 @@
+package shell_test
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/bloeys/nterm/shell"
+)
+
+func TestExpandEnvVars(t *testing.T) {
+
+	t.Setenv("NTERM_A", "apple")
+	t.Setenv("NTERM_B", "banana split")
+	t.Setenv("NTERM_NAME", "A")
+	t.Setenv("NTERM_EMPTY", "")
+
+	// Basics
+	Check(t, "echo hi", shell.ExpandEnvVars("echo hi"))
+	Check(t, "echo apple", shell.ExpandEnvVars("echo $NTERM_A"))
+	Check(t, "echo apple", shell.ExpandEnvVars("echo ${NTERM_A}"))
+	Check(t, "echo apple/banana split", shell.ExpandEnvVars("echo $NTERM_A/$NTERM_B"))
+	Check(t, "echo appleapple", shell.ExpandEnvVars("echo $NTERM_A$NTERM_A"))
+	Check(t, "echo apples", shell.ExpandEnvVars("echo ${NTERM_A}s"))
+	Check(t, "echo apple.txt", shell.ExpandEnvVars("echo $NTERM_A.txt"))
+
+	// Missing variables
+	Check(t, "echo ", shell.ExpandEnvVars("echo $NTERM_MISSING"))
+	Check(t, "echo ", shell.ExpandEnvVars("echo ${NTERM_MISSING}"))
+	Check(t, "echo ", shell.ExpandEnvVars("echo $NTERM_EMPTY"))
+	Check(t, "echo -", shell.ExpandEnvVars("echo $NTERM_As-"))
+
+	// Not variables
+	Check(t, "echo $", shell.ExpandEnvVars("echo $"))
+	Check(t, "echo $ a", shell.ExpandEnvVars("echo $ a"))
+	Check(t, "echo $1", shell.ExpandEnvVars("echo $1"))
+	Check(t, "echo ${NTERM_A", shell.ExpandEnvVars("echo ${NTERM_A"))
+
+	// Nested braces
+	Check(t, "echo apple", shell.ExpandEnvVars("echo ${NTERM_${NTERM_NAME}}"))
+	Check(t, "echo apple!", shell.ExpandEnvVars("echo ${NTERM_${NTERM_NAME}}!"))
+	Check(t, "echo ", shell.ExpandEnvVars("echo ${NTERM_${NTERM_MISSING}}"))
+	Check(t, "echo ${NTERM_A", shell.ExpandEnvVars("echo ${NTERM_${NTERM_NAME}"))
+
+	// Quotes
+	Check(t, "echo '$NTERM_A'", shell.ExpandEnvVars("echo '$NTERM_A'"))
+	Check(t, "echo '${NTERM_A}' apple", shell.ExpandEnvVars("echo '${NTERM_A}' $NTERM_A"))
+	Check(t, `echo "apple"`, shell.ExpandEnvVars(`echo "$NTERM_A"`))
+	Check(t, `echo "'apple'"`, shell.ExpandEnvVars(`echo "'$NTERM_A'"`))
+	Check(t, `echo '"$NTERM_A"'`, shell.ExpandEnvVars(`echo '"$NTERM_A"'`))
+	Check(t, `echo 'a\' apple`, shell.ExpandEnvVars(`echo 'a\' $NTERM_A`))
+
+	// Escapes
+	Check(t, "echo $NTERM_A", shell.ExpandEnvVars(`echo \$NTERM_A`))
+	Check(t, "echo ${NTERM_A}", shell.ExpandEnvVars(`echo \${NTERM_A}`))
+	Check(t, `echo "$NTERM_A"`, shell.ExpandEnvVars(`echo "\$NTERM_A"`))
+	Check(t, `echo \'apple\'`, shell.ExpandEnvVars(`echo \'$NTERM_A\'`))
+	Check(t, `echo \"apple`, shell.ExpandEnvVars(`echo \"$NTERM_A`))
+	Check(t, `echo \`, shell.ExpandEnvVars(`echo \`))
+}
+
+func TestExpandEnvVarsHomeDir(t *testing.T) {
+
+	if runtime.GOOS == "windows" {
+		t.Setenv("USERPROFILE", "/home/nterm")
+	} else {
+		t.Setenv("HOME", "/home/nterm")
+	}
+
+	Check(t, "/home/nterm", shell.ExpandEnvVars("~"))
+	Check(t, "cd /home/nterm", shell.ExpandEnvVars("cd ~"))
+	Check(t, "cd /home/nterm/a", shell.ExpandEnvVars("cd ~/a"))
+	Check(t, "ls /home/nterm /home/nterm/b", shell.ExpandEnvVars("ls ~ ~/b"))
+
+	// Only a '~' at the start of a word is expanded
+	Check(t, "cd a~", shell.ExpandEnvVars("cd a~"))
+	Check(t, "cd a/~", shell.ExpandEnvVars("cd a/~"))
+	Check(t, "cd ~a", shell.ExpandEnvVars("cd ~a"))
+
+	// Quoted
+	Check(t, "cd '~'", shell.ExpandEnvVars("cd '~'"))
+	Check(t, `cd "~/a"`, shell.ExpandEnvVars(`cd "~/a"`))
+}
+
+func Check[T comparable](t *testing.T, expected, got T) {
+	if got != expected {
+		_, _, line, _ := runtime.Caller(1)
+		t.Fatalf("Expected %v but got %v by test at line %d\n", expected, got, line)
+	}
+}
@@ -0,0 +1,106 @@
+package shell
+
+import (
+	"runtime"
+	"strings"
+)
+
+// Word is a word of a command, as split by SplitWords
+type Word struct {
+	// Text is the word with its quotes and escaping backslashes removed
+	Text string
+
+	// Quoted is true if any part of the word was quoted or escaped, in which case it is taken literally and never
+	// expanded as a glob (e.g. the pattern of grep "a.*b")
+	Quoted bool
+}
+
+// SplitWords splits s into words on spaces and tabs that aren't quoted, similar to shells.
+// Nothing within single quotes is special, while within double quotes a backslash escapes '"' and '\'.
+// Outside quotes a backslash escapes any char. Unclosed quotes last until the end of s.
+//
+// For example, `grep "a b" c\ d 'e'` gives `grep`, `a b`, `c d` and `e`, where all but the first are quoted.
+//
+// On windows backslashes are path separators (e.g. cd C:\Users), so they are normal chars everywhere
+func SplitWords(s string) []Word {
+	return splitWords(s, runtime.GOOS != "windows")
+}
+
+func splitWords(s string, backslashEscapes bool) []Word {
+
+	words := make([]Word, 0, 4)
+
+	var quote byte
+	inWord := false
+	curr := Word{}
+	text := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+
+		c := s[i]
+		if quote == '\'' {
+
+			if c == '\'' {
+				quote = 0
+			} else {
+				text.WriteByte(c)
+			}
+			continue
+		}
+
+		if quote == '"' {
+
+			switch {
+			case c == '"':
+				quote = 0
+			case c == '\\' && backslashEscapes && i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\\'):
+				i++
+				text.WriteByte(s[i])
+			default:
+				text.WriteByte(c)
+			}
+			continue
+		}
+
+		switch c {
+
+		case ' ', '\t':
+
+			if inWord {
+				curr.Text = text.String()
+				words = append(words, curr)
+
+				inWord = false
+				curr = Word{}
+				text.Reset()
+			}
+
+		case '\'', '"':
+			quote = c
+			inWord = true
+			curr.Quoted = true
+
+		case '\\':
+
+			inWord = true
+			if backslashEscapes {
+
+				curr.Quoted = true
+				if i+1 < len(s) {
+					i++
+				}
+			}
+			text.WriteByte(s[i])
+
+		default:
+			inWord = true
+			text.WriteByte(c)
+		}
+	}
+
+	if inWord {
+		curr.Text = text.String()
+		words = append(words, curr)
+	}
+
+	return words
+}
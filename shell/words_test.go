@@ -0,0 +1,54 @@
+package shell_test
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/bloeys/nterm/shell"
+)
+
+func TestSplitWords(t *testing.T) {
+
+	check := func(s string, expected ...shell.Word) {
+		t.Helper()
+		CheckArr(t, expected, shell.SplitWords(s))
+	}
+
+	w := func(text string) shell.Word {
+		return shell.Word{Text: text}
+	}
+
+	q := func(text string) shell.Word {
+		return shell.Word{Text: text, Quoted: true}
+	}
+
+	// Spaces and tabs split words, and repeated ones don't give empty words
+	check("")
+	check("  \t ")
+	check("ls", w("ls"))
+	check(" ls  -l\t-a ", w("ls"), w("-l"), w("-a"))
+
+	// Quotes group words and are removed
+	check(`grep "a.*b" f`, w("grep"), q("a.*b"), w("f"))
+	check(`echo 'a  b' "c  d"`, w("echo"), q("a  b"), q("c  d"))
+	check(`echo a"b c"d`, w("echo"), q("ab cd"))
+	check(`echo "" ''`, w("echo"), q(""), q(""))
+	check(`echo "it's" 'say "hi"'`, w("echo"), q("it's"), q(`say "hi"`))
+
+	// Backslashes escape any char outside quotes, but only '"' and '\' within double quotes.
+	// On windows they are path separators and so are never escapes
+	if runtime.GOOS == "windows" {
+		check(`cd C:\Users\a\ b`, w("cd"), w(`C:\Users\a\`), w("b"))
+		check(`echo "a\"b"`, w("echo"), q(`a\b`))
+	} else {
+		check(`echo a\ b \* \\`, w("echo"), q("a b"), q("*"), q(`\`))
+		check(`echo "a\"b\\c\d"`, w("echo"), q(`a"b\c\d`))
+		check(`echo a\`, w("echo"), q(`a\`))
+	}
+
+	check(`echo 'a\'`, w("echo"), q(`a\`))
+
+	// Unclosed quotes last until the end
+	check(`echo "a b`, w("echo"), q("a b"))
+	check(`echo 'a "b`, w("echo"), q(`a "b`))
+}
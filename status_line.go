@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bloeys/gglm/gglm"
+	"github.com/bloeys/nterm/glyphs"
+)
+
+// UpdateStatusLine fills statusLineGrid with the current state. Must be called with textBufMutex held
+func (nt *nterm) UpdateStatusLine() {
+
+	gw, _ := nt.GridSize()
+	if nt.statusLineGrid == nil || nt.statusLineGrid.SizeX != uint(gw) {
+		nt.statusLineGrid = NewGlyphGrid(uint(gw), 1)
+		nt.statusLineGrid.AutoWrap = false
+	}
+
+	cwd := nt.currentDir
+	if cwd == "" {
+		cwd = "?"
+	}
+
+	cmdName := ""
+	if activeCmd := nt.activeCmd; activeCmd != nil {
+		cmdName = filepath.Base(activeCmd.C.Path)
+	}
+
+	grid := nt.statusLineGrid
+	grid.ClearAll()
+	grid.SetCursor(0, 0)
+	grid.WriteString(formatStatusLine(int(grid.SizeX), cwd, cmdName, nt.scrollPercent(), time.Now()), &nt.Settings.DefaultFgColor, &nt.Settings.SearchBarBgColor)
+}
+
+// scrollPercent returns how much of the scrollback is above the bottom of the screen, so it's 100 when scrolled to the bottom.
+// Must be called with textBufMutex held
+func (nt *nterm) scrollPercent() int {
+
+	firstValidLineStartIndexRel := int64(nt.textBuf.RelIndexFromWriteCount(nt.firstValidLine.StartIndex_WriteCount))
+	scrollbackLen := nt.textBuf.Len() - firstValidLineStartIndexRel
+	if scrollbackLen <= 0 {
+		return 100
+	}
+
+	gw, gh := nt.GridSize()
+	screenEnd := clamp(nt.scrollPosRel+gw*gh, firstValidLineStartIndexRel, nt.textBuf.Len())
+	return int((screenEnd - firstValidLineStartIndexRel) * 100 / scrollbackLen)
+}
+
+// formatStatusLine returns the status line text padded to width runes, with the cwd and running cmd on the left
+// and the scroll percent and time on the right. The cwd is shortened from the left if there isn't enough room
+func formatStatusLine(width int, cwd, cmdName string, scrollPercent int, now time.Time) string {
+
+	left := cwd
+	if cmdName != "" {
+		left = fmt.Sprintf("%s | %s", cwd, cmdName)
+	}
+	right := fmt.Sprintf("%d%% %s", scrollPercent, now.Format("15:04:05"))
+
+	// At least one space separates the two sides
+	maxLeftLen := width - utf8.RuneCountInString(right) - 1
+	if maxLeftLen < 0 {
+		maxLeftLen = 0
+	}
+
+	if leftRunes := []rune(left); len(leftRunes) > maxLeftLen {
+
+		left = ""
+		if maxLeftLen > 0 {
+			left = "…" + string(leftRunes[len(leftRunes)-maxLeftLen+1:])
+		}
+	}
+
+	padding := width - utf8.RuneCountInString(left) - utf8.RuneCountInString(right)
+	if padding < 0 {
+		padding = 0
+	}
+
+	return fmt.Sprintf("%s%*s%s", left, padding, "", right)
+}
+
+// DrawStatusLine draws statusLineGrid on the row below the active grid. It isn't affected by scrolling or selection
+func (nt *nterm) DrawStatusLine() {
+
+	if nt.statusLineGrid == nil {
+		return
+	}
+
+	_, gh := nt.GridSize()
+	y := float32(nt.GlyphRend.ScreenHeight) - nt.Settings.PaddingTop - float32(gh+1)*nt.GlyphRend.Atlas.LineHeight
+
+	row := nt.statusLineGrid.Tiles[0]
+	for x := 0; x < len(row); x++ {
+
+		t := &row[x]
+		if t.Glyph == utf8.RuneError || t.Glyph == WideGlyphTail {
+			continue
+		}
+
+		// Each tile is placed by its column so wide glyphs keep the following tiles aligned
+		pos := gglm.NewVec3(nt.paneLeft+nt.Settings.PaddingLeft+float32(x)*nt.GlyphRend.Atlas.SpaceAdvance, y, 0)
+		nt.GlyphRend.SetOptions(glyphs.GlyphRendOpts{BgColor: &t.BgColor})
+		markPos := nt.GlyphRend.DrawRune(t.Glyph, pos, &t.FgColor)
+		if t.Mark != 0 {
+			nt.GlyphRend.DrawRune(t.Mark, &markPos, &t.FgColor)
+		}
+	}
+
+	nt.statusLineGrid.ClearDirty()
+}
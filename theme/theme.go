@@ -0,0 +1,256 @@
+package theme
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/bloeys/gglm/gglm"
+)
+
+// Indices of the base 16 ansi colors in Theme.Colors
+const (
+	Color_Black = iota
+	Color_Red
+	Color_Green
+	Color_Yellow
+	Color_Blue
+	Color_Magenta
+	Color_Cyan
+	Color_White
+	Color_BrightBlack
+	Color_BrightRed
+	Color_BrightGreen
+	Color_BrightYellow
+	Color_BrightBlue
+	Color_BrightMagenta
+	Color_BrightCyan
+	Color_BrightWhite
+)
+
+// ColorKeys are the keys of Theme.Colors in theme files, in the same order as Theme.Colors
+var ColorKeys = [16]string{
+	"black",
+	"red",
+	"green",
+	"yellow",
+	"blue",
+	"magenta",
+	"cyan",
+	"white",
+	"bright_black",
+	"bright_red",
+	"bright_green",
+	"bright_yellow",
+	"bright_blue",
+	"bright_magenta",
+	"bright_cyan",
+	"bright_white",
+}
+
+// Theme is a set of colors used when drawing the terminal. Colors are the colors of the base 16 ansi codes
+// (e.g. ESC[31m and ESC[41m both use the red color), and are indexed with the Color_ constants
+type Theme struct {
+	Name string
+
+	Colors      [16]gglm.Vec4
+	DefaultFg   gglm.Vec4
+	DefaultBg   gglm.Vec4
+	CursorColor gglm.Vec4
+}
+
+var (
+	ThemeDark = Theme{
+		Name: "dark",
+		Colors: [16]gglm.Vec4{
+			rgbF(0, 0, 0),
+			rgbF(0.7, 0, 0),
+			rgbF(0, 0.7, 0),
+			rgbF(0.7, 0.7, 0),
+			rgbF(0, 0, 0.7),
+			rgbF(0.7, 0, 0.7),
+			rgbF(0, 0.66, 0.66),
+			rgbF(0.8, 0.8, 0.8),
+			rgbF(0.7, 0.7, 0.7),
+			rgbF(1, 0, 0),
+			rgbF(0, 1, 0),
+			rgbF(1, 1, 0),
+			rgbF(0, 0, 1),
+			rgbF(1, 0, 1),
+			rgbF(0, 1, 1),
+			rgbF(1, 1, 1),
+		},
+		DefaultFg:   rgbF(1, 1, 1),
+		DefaultBg:   *gglm.NewVec4(0, 0, 0, 0),
+		CursorColor: rgbF(1, 1, 1),
+	}
+
+	ThemeLight = Theme{
+		Name: "light",
+		Colors: [16]gglm.Vec4{
+			rgbF(0, 0, 0),
+			rgbF(0.75, 0.1, 0.1),
+			rgbF(0, 0.5, 0),
+			rgbF(0.55, 0.45, 0),
+			rgbF(0.1, 0.2, 0.75),
+			rgbF(0.6, 0.1, 0.6),
+			rgbF(0, 0.5, 0.55),
+			rgbF(0.6, 0.6, 0.6),
+			rgbF(0.4, 0.4, 0.4),
+			rgbF(0.9, 0.2, 0.2),
+			rgbF(0.2, 0.65, 0.2),
+			rgbF(0.7, 0.6, 0),
+			rgbF(0.25, 0.4, 0.9),
+			rgbF(0.75, 0.3, 0.75),
+			rgbF(0.1, 0.6, 0.65),
+			rgbF(0.85, 0.85, 0.85),
+		},
+		DefaultFg:   rgbF(0.1, 0.1, 0.1),
+		DefaultBg:   rgbF(0.98, 0.98, 0.98),
+		CursorColor: rgbF(0.1, 0.1, 0.1),
+	}
+
+	// See: https://ethanschoonover.com/solarized
+	ThemeSolarizedDark = Theme{
+		Name:        "solarized-dark",
+		Colors:      solarizedColors,
+		DefaultFg:   rgb(0x839496), // base0
+		DefaultBg:   rgb(0x002b36), // base03
+		CursorColor: rgb(0x93a1a1), // base1
+	}
+
+	ThemeSolarizedLight = Theme{
+		Name:        "solarized-light",
+		Colors:      solarizedColors,
+		DefaultFg:   rgb(0x657b83), // base00
+		DefaultBg:   rgb(0xfdf6e3), // base3
+		CursorColor: rgb(0x586e75), // base01
+	}
+
+	// solarizedColors are the same for the dark and light variants, which only swap the default colors
+	solarizedColors = [16]gglm.Vec4{
+		rgb(0x073642), // base02
+		rgb(0xdc322f), // red
+		rgb(0x859900), // green
+		rgb(0xb58900), // yellow
+		rgb(0x268bd2), // blue
+		rgb(0xd33682), // magenta
+		rgb(0x2aa198), // cyan
+		rgb(0xeee8d5), // base2
+		rgb(0x002b36), // base03
+		rgb(0xcb4b16), // orange
+		rgb(0x586e75), // base01
+		rgb(0x657b83), // base00
+		rgb(0x839496), // base0
+		rgb(0x6c71c4), // violet
+		rgb(0x93a1a1), // base1
+		rgb(0xfdf6e3), // base3
+	}
+)
+
+// rgb converts a color in the form 0xRRGGBB to an opaque Vec4
+func rgb(hex uint32) gglm.Vec4 {
+	return *gglm.NewVec4(float32(hex>>16&0xff)/255, float32(hex>>8&0xff)/255, float32(hex&0xff)/255, 1)
+}
+
+func rgbF(r, g, b float32) gglm.Vec4 {
+	return *gglm.NewVec4(r, g, b, 1)
+}
+
+// LoadThemeFromFile loads a theme from a file where each line is in the form 'key = r,g,b,a', with components
+// between 0 and 1. Keys are the names in ColorKeys, 'default_fg', 'default_bg' and 'cursor'.
+// Empty lines and lines starting with '#' are ignored.
+//
+// Keys missing from the file keep their values from ThemeDark, and the theme is named after the file (without the extension)
+func LoadThemeFromFile(path string) (Theme, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return Theme{}, err
+	}
+	defer f.Close()
+
+	t := ThemeDark
+	t.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+
+	lineNum := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			return Theme{}, fmt.Errorf("line %d of theme file '%s' is not in the form 'key = r,g,b,a'", lineNum, path)
+		}
+
+		key = strings.TrimSpace(key)
+		color := t.colorByKey(key)
+		if color == nil {
+			return Theme{}, fmt.Errorf("line %d of theme file '%s' has unknown key '%s'", lineNum, path, key)
+		}
+
+		c, err := parseColor(value)
+		if err != nil {
+			return Theme{}, fmt.Errorf("line %d of theme file '%s' has an invalid color. Err: %w", lineNum, path, err)
+		}
+
+		*color = c
+	}
+
+	if err := scanner.Err(); err != nil {
+		return Theme{}, err
+	}
+
+	return t, nil
+}
+
+// colorByKey returns the color named key in theme files, or nil if there is no such key
+func (t *Theme) colorByKey(key string) *gglm.Vec4 {
+
+	switch key {
+	case "default_fg":
+		return &t.DefaultFg
+	case "default_bg":
+		return &t.DefaultBg
+	case "cursor":
+		return &t.CursorColor
+	}
+
+	for i := 0; i < len(ColorKeys); i++ {
+		if ColorKeys[i] == key {
+			return &t.Colors[i]
+		}
+	}
+
+	return nil
+}
+
+// parseColor parses colors in the form 'r,g,b,a'
+func parseColor(s string) (gglm.Vec4, error) {
+
+	components := strings.Split(s, ",")
+	if len(components) != 4 {
+		return gglm.Vec4{}, fmt.Errorf("'%s' is not in the form r,g,b,a", strings.TrimSpace(s))
+	}
+
+	c := gglm.Vec4{}
+	for i := 0; i < len(components); i++ {
+
+		f, err := strconv.ParseFloat(strings.TrimSpace(components[i]), 32)
+		if err != nil || f < 0 || f > 1 {
+			return gglm.Vec4{}, fmt.Errorf("'%s' is not a number between 0 and 1", strings.TrimSpace(components[i]))
+		}
+
+		c.Data[i] = float32(f)
+	}
+
+	return c, nil
+}
@@ -0,0 +1,88 @@
+package theme_test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/bloeys/gglm/gglm"
+	"github.com/bloeys/nterm/theme"
+)
+
+func TestLoadThemeFromFile(t *testing.T) {
+
+	dir := t.TempDir()
+	writeTheme := func(name, text string) string {
+
+		path := filepath.Join(dir, name)
+		err := os.WriteFile(path, []byte(text), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return path
+	}
+
+	// Missing keys keep the dark theme colors
+	th, err := theme.LoadThemeFromFile(writeTheme("mine.theme", `
+# Comments and empty lines are skipped
+
+red = 1, 0.5, 0, 1
+bright_white=0,0,0,0.5
+default_fg = 0.25,0.25,0.25,1
+default_bg = 1,1,1,1
+cursor = 0,0,1,1
+`))
+	Check(t, true, err == nil)
+	Check(t, "mine", th.Name)
+	Check(t, *gglm.NewVec4(1, 0.5, 0, 1), th.Colors[theme.Color_Red])
+	Check(t, *gglm.NewVec4(0, 0, 0, 0.5), th.Colors[theme.Color_BrightWhite])
+	Check(t, *gglm.NewVec4(0.25, 0.25, 0.25, 1), th.DefaultFg)
+	Check(t, *gglm.NewVec4(1, 1, 1, 1), th.DefaultBg)
+	Check(t, *gglm.NewVec4(0, 0, 1, 1), th.CursorColor)
+	Check(t, theme.ThemeDark.Colors[theme.Color_Green], th.Colors[theme.Color_Green])
+
+	// Loading doesn't change the built in themes
+	Check(t, "dark", theme.ThemeDark.Name)
+	Check(t, *gglm.NewVec4(0.7, 0, 0, 1), theme.ThemeDark.Colors[theme.Color_Red])
+
+	// Errors
+	_, err = theme.LoadThemeFromFile(filepath.Join(dir, "missing.theme"))
+	Check(t, true, os.IsNotExist(err))
+
+	_, err = theme.LoadThemeFromFile(writeTheme("bad_key.theme", "red = 1,0,0,1\npurple = 1,0,1,1"))
+	Check(t, true, err != nil && strings.Contains(err.Error(), "line 2") && strings.Contains(err.Error(), "'purple'"))
+
+	_, err = theme.LoadThemeFromFile(writeTheme("no_value.theme", "red"))
+	Check(t, true, err != nil && strings.Contains(err.Error(), "line 1"))
+
+	_, err = theme.LoadThemeFromFile(writeTheme("short.theme", "red = 1,0,0"))
+	Check(t, true, err != nil && strings.Contains(err.Error(), "r,g,b,a"))
+
+	_, err = theme.LoadThemeFromFile(writeTheme("range.theme", "red = 1,0,2,1"))
+	Check(t, true, err != nil && strings.Contains(err.Error(), "'2'"))
+}
+
+func TestBuiltinThemes(t *testing.T) {
+
+	// The solarized themes share colors but not defaults
+	Check(t, theme.ThemeSolarizedDark.Colors, theme.ThemeSolarizedLight.Colors)
+	Check(t, theme.ThemeSolarizedDark.DefaultFg, theme.ThemeSolarizedLight.Colors[theme.Color_BrightBlue])
+	Check(t, theme.ThemeSolarizedDark.DefaultBg, theme.ThemeSolarizedLight.Colors[theme.Color_BrightBlack])
+	Check(t, *gglm.NewVec4(0xdc/255.0, 0x32/255.0, 0x2f/255.0, 1), theme.ThemeSolarizedDark.Colors[theme.Color_Red])
+
+	for _, th := range []theme.Theme{theme.ThemeDark, theme.ThemeLight, theme.ThemeSolarizedDark, theme.ThemeSolarizedLight} {
+		Check(t, true, th.Name != "")
+		Check(t, float32(1), th.DefaultFg.A())
+		Check(t, float32(1), th.CursorColor.A())
+	}
+}
+
+func Check[T comparable](t *testing.T, expected, got T) {
+	if got != expected {
+		_, _, line, _ := runtime.Caller(1)
+		t.Fatalf("Expected %v but got %v by test at line %d\n", expected, got, line)
+	}
+}
@@ -0,0 +1,198 @@
+package main_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/bloeys/gglm/gglm"
+	nterm "github.com/bloeys/nterm"
+)
+
+// vt100Test feeds input to an empty grid like output of a cmd, and expects expectedGrid.
+//
+// expectedGrid has one slice per row and one string per cell. A cell is its glyph, followed by ";fg" if the fg color isn't the
+// default and ";fg;bg" if the bg color isn't the default, where colors are palette indices (or hex if not in the palette).
+// Empty cells are "", and empty cells at the end of a row and empty rows at the end of the grid are left out.
+//
+// unsupported is set for sequences nterm doesn't handle yet, whose tests are skipped until they are
+type vt100Test struct {
+	name          string
+	width, height uint
+	input         string
+	expectedGrid  [][]string
+	unsupported   string
+}
+
+// vt100Tests are based on the parts of vttest (https://invisible-island.net/vttest/) that cover
+// cursor movement, SGR colors, erasing, line wrapping and the VT102 editing functions
+var vt100Tests = []vt100Test{
+
+	// Line wrapping
+	{name: "autowrap", width: 5, height: 3, input: "abcdefgh", expectedGrid: [][]string{
+		{"a", "b", "c", "d", "e"},
+		{"f", "g", "h"},
+	}},
+	{name: "new_line_then_wrap", width: 5, height: 3, input: "ab\ncdefghi", expectedGrid: [][]string{
+		{"a", "b"},
+		{"c", "d", "e", "f", "g"},
+		{"h", "i"},
+	}},
+	{name: "wide_rune_wrap", width: 5, height: 2, input: "abcd世界", expectedGrid: [][]string{
+		{"a", "b", "c", "d", " "},
+		{"世", "", "界"},
+	}},
+	{name: "no_autowrap", width: 5, height: 2, input: "\x1b[?7labcdefg", expectedGrid: [][]string{
+		{"a", "b", "c", "d", "g"},
+	}},
+	{name: "scroll_at_bottom", width: 5, height: 2, input: "a\nb\nc", unsupported: "scrolling when writing past the last row", expectedGrid: [][]string{
+		{"b"},
+		{"c"},
+	}},
+
+	// SGR colors
+	{name: "sgr_fg_bg", width: 5, height: 1, input: "\x1b[31mr\x1b[42mg\x1b[0mn", expectedGrid: [][]string{
+		{"r;1", "g;1;2", "n"},
+	}},
+	{name: "sgr_bright_256_rgb", width: 5, height: 1, input: "\x1b[91ma\x1b[38;5;208mb\x1b[38;2;0;128;255mc", expectedGrid: [][]string{
+		{"a;9", "b;208", "c;#0080ffff"},
+	}},
+	{name: "sgr_default_colors", width: 5, height: 1, input: "\x1b[31;44mx\x1b[39my\x1b[49mz", unsupported: "SGR 39 and 49", expectedGrid: [][]string{
+		{"x;1;4", "y;;4", "z"},
+	}},
+
+	// VT102 editing functions and others that only write at the cursor
+	{name: "insert_delete_chars", width: 6, height: 1, input: "abcd\x1b[2@\x1b[P", expectedGrid: [][]string{
+		{"a", "b", "c", "d", " "},
+	}},
+	{name: "repeat_char", width: 6, height: 1, input: "\x1b[32m-\x1b[0m\x1b[3b", expectedGrid: [][]string{
+		{"-;2", "-;2", "-;2", "-;2"},
+	}},
+	{name: "dec_line_drawing", width: 6, height: 1, input: "\x1b(0qxq\x1b(Bq", expectedGrid: [][]string{
+		{"─", "│", "─", "q"},
+	}},
+
+	// Cursor movement
+	{name: "cursor_position", width: 5, height: 3, input: "\x1b[2;3Hx", unsupported: "CUP", expectedGrid: [][]string{
+		{},
+		{"", "", "x"},
+	}},
+	{name: "cursor_up_down_forward_back", width: 5, height: 3, input: "ab\x1b[Bc\x1b[2Dd\x1b[Ae\x1b[3Cf", unsupported: "CUU, CUD, CUF and CUB", expectedGrid: [][]string{
+		{"a", "b", "e", "", "f"},
+		{"", "d", "c"},
+	}},
+	{name: "carriage_return", width: 5, height: 1, input: "abc\rx", unsupported: "CR", expectedGrid: [][]string{
+		{"x", "b", "c"},
+	}},
+	{name: "backspace", width: 5, height: 1, input: "ab\bx", unsupported: "BS", expectedGrid: [][]string{
+		{"a", "x"},
+	}},
+
+	// Erasing
+	{name: "erase_in_line", width: 5, height: 1, input: "abcde\x1b[3G\x1b[K", unsupported: "CHA and EL", expectedGrid: [][]string{
+		{"a", "b"},
+	}},
+	{name: "erase_in_display", width: 5, height: 2, input: "abc\nde\x1b[1;2H\x1b[J", unsupported: "CUP and ED", expectedGrid: [][]string{
+		{"a"},
+	}},
+}
+
+func TestVT100(t *testing.T) {
+
+	for _, test := range vt100Tests {
+
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+
+			if test.unsupported != "" {
+				t.Skipf("Not supported yet: %s", test.unsupported)
+			}
+
+			nt := nterm.NewTextOnlyNterm()
+			nt.Settings.DefaultFgColor = *gglm.NewVec4(1, 1, 1, 1)
+			fg := nt.Settings.DefaultFgColor
+			bg := nt.Settings.DefaultBgColor
+			grid := nterm.NewGlyphGrid(test.width, test.height)
+			nt.DrawTextAnsiCodesOnGrid(grid, []byte(test.input), &fg, &bg)
+
+			expected := formatVT100Grid(test.expectedGrid)
+			got := formatVT100Grid(vt100GridCells(grid, nt.Settings.DefaultFgColor, nt.Settings.DefaultBgColor, nt.Settings.ColorPalette))
+			if got != expected {
+				t.Fatalf("Input %q gave the grid\n%s\nbut expected\n%s", test.input, got, expected)
+			}
+		})
+	}
+}
+
+// vt100GridCells returns the cells of grid in the format of vt100Test.expectedGrid
+func vt100GridCells(grid *nterm.GlyphGrid, defaultFg, defaultBg gglm.Vec4, palette [256]gglm.Vec4) [][]string {
+
+	colorName := func(c gglm.Vec4) string {
+
+		for i := 0; i < len(palette); i++ {
+			if palette[i] == c {
+				return fmt.Sprint(i)
+			}
+		}
+
+		return nterm.FormatHexColor(&c)
+	}
+
+	cells := make([][]string, grid.SizeY)
+	for y := uint(0); y < grid.SizeY; y++ {
+
+		row := make([]string, 0, grid.SizeX)
+		for x := uint(0); x < grid.SizeX; x++ {
+
+			t := grid.Tiles[y][x]
+			if t.Glyph == '\n' {
+				break
+			}
+
+			if t.Glyph == 0 || t.Glyph == utf8.RuneError || t.Glyph == nterm.WideGlyphTail {
+				row = append(row, "")
+				continue
+			}
+
+			fgName, bgName := "", ""
+			if t.FgColor != defaultFg {
+				fgName = colorName(t.FgColor)
+			}
+
+			if t.BgColor != defaultBg {
+				bgName = colorName(t.BgColor)
+			}
+
+			cell := string(t.Glyph)
+			if bgName != "" {
+				cell += ";" + fgName + ";" + bgName
+			} else if fgName != "" {
+				cell += ";" + fgName
+			}
+			row = append(row, cell)
+		}
+
+		for len(row) > 0 && row[len(row)-1] == "" {
+			row = row[:len(row)-1]
+		}
+		cells[y] = row
+	}
+
+	for len(cells) > 0 && len(cells[len(cells)-1]) == 0 {
+		cells = cells[:len(cells)-1]
+	}
+
+	return cells
+}
+
+// formatVT100Grid returns the cells with one row per line, which makes failures readable
+func formatVT100Grid(cells [][]string) string {
+
+	sb := strings.Builder{}
+	for _, row := range cells {
+		sb.WriteString(fmt.Sprintf("%q\n", row))
+	}
+
+	return sb.String()
+}